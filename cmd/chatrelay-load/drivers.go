@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"chatrelay-bot/internal/bot"
+	"chatrelay-bot/internal/chatbackend"
+	"chatrelay-bot/internal/slack"
+	"chatrelay-bot/internal/slack/fakeslack"
+	"chatrelay-bot/internal/slack/slacktest"
+	"chatrelay-bot/pkg/models"
+)
+
+// finalMarker is the footer on every generated answer, which marks its
+// final revision.
+const finalMarker = "_load test_"
+
+// driver delivers mentions to the bot.
+type driver interface {
+	// send delivers a mention and returns its ts without waiting for the
+	// answer.
+	send(ctx context.Context, msg models.IncomingMessage) string
+	slackCalls() map[string]int
+	close()
+}
+
+// callCounter counts Slack API calls by method.
+type callCounter struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (c *callCounter) count(method string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls == nil {
+		c.calls = make(map[string]int)
+	}
+	c.calls[method]++
+}
+
+func (c *callCounter) snapshot() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	calls := make(map[string]int, len(c.calls))
+	for method, n := range c.calls {
+		calls[method] = n
+	}
+	return calls
+}
+
+// inProcessDriver calls the bot's HandleMessage directly, with an in-memory
+// Slack.
+type inProcessDriver struct {
+	bot      *bot.ChatRelayBot
+	settings models.ChannelSettings
+	calls    *callCounter
+	seq      atomic.Int64
+}
+
+func newInProcessDriver(t *tracker, backend chatbackend.Client, settings models.ChannelSettings, cfg *models.AppConfig, slackLatency time.Duration) *inProcessDriver {
+	messenger := slacktest.NewMessenger()
+	messenger.OnChange = func(m slacktest.Message) {
+		t.observe(m.Channel, m.ThreadTS, len(m.Revisions), m.Text(), time.Now())
+	}
+	calls := &callCounter{}
+	b := bot.NewChatRelayBot(&slowMessenger{Messenger: messenger, latency: slackLatency, calls: calls}, backend)
+	b.ApplyConfig(cfg)
+	return &inProcessDriver{bot: b, settings: settings, calls: calls}
+}
+
+func (d *inProcessDriver) send(ctx context.Context, msg models.IncomingMessage) string {
+	msg.ID = fmt.Sprintf("1600000000.%06d", d.seq.Add(1))
+	go d.bot.HandleMessage(ctx, msg, d.settings)
+	return msg.ID
+}
+
+func (d *inProcessDriver) slackCalls() map[string]int {
+	return d.calls.snapshot()
+}
+
+func (d *inProcessDriver) close() {}
+
+// slowMessenger counts calls to a Messenger and delays each by latency, to
+// stand in for Slack's response time.
+type slowMessenger struct {
+	*slacktest.Messenger
+	latency time.Duration
+	calls   *callCounter
+}
+
+func (m *slowMessenger) call(ctx context.Context, method string) {
+	m.calls.count(method)
+	if m.latency <= 0 {
+		return
+	}
+	t := time.NewTimer(m.latency)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+func (m *slowMessenger) Post(ctx context.Context, msg models.OutgoingMessage) (string, error) {
+	m.call(ctx, "chat.postMessage")
+	return m.Messenger.Post(ctx, msg)
+}
+
+func (m *slowMessenger) Update(ctx context.Context, id string, msg models.OutgoingMessage) error {
+	m.call(ctx, "chat.update")
+	return m.Messenger.Update(ctx, id, msg)
+}
+
+func (m *slowMessenger) Delete(ctx context.Context, conversation, id string) error {
+	m.call(ctx, "chat.delete")
+	return m.Messenger.Delete(ctx, conversation, id)
+}
+
+func (m *slowMessenger) Notify(ctx context.Context, conversation, userID, text string) error {
+	m.call(ctx, "chat.postEphemeral")
+	return m.Messenger.Notify(ctx, conversation, userID, text)
+}
+
+// socketDriver runs the real Slack client and its Socket Mode loop against
+// an in-process fake Slack.
+type socketDriver struct {
+	fake   *fakeslack.Server
+	server *httptest.Server
+	calls  *callCounter
+	cancel context.CancelFunc
+}
+
+type fixedSettings models.ChannelSettings
+
+func (s fixedSettings) Resolve(teamID, channelID string) models.ChannelSettings {
+	return models.ChannelSettings(s)
+}
+
+func newSocketDriver(ctx context.Context, t *tracker, backend chatbackend.Client, settings models.ChannelSettings, cfg *models.AppConfig, slackLatency time.Duration) (*socketDriver, error) {
+	fake := fakeslack.NewServer()
+	fake.Messenger().OnChange = func(m slacktest.Message) {
+		t.observe(m.Channel, m.ThreadTS, len(m.Revisions), m.Text(), time.Now())
+	}
+	calls := &callCounter{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if method, ok := strings.CutPrefix(r.URL.Path, "/api/"); ok && method != "auth.test" && method != "apps.connections.open" {
+			calls.count(method)
+			if slackLatency > 0 {
+				time.Sleep(slackLatency)
+			}
+		}
+		fake.ServeHTTP(w, r)
+	}))
+
+	b := bot.NewChatRelayBot(nil, backend)
+	b.ApplyConfig(cfg)
+	client := slack.NewClient("xoxb-load", "xapp-load", b, 0, 0, server.URL+"/api/")
+	client.SetSettingsResolver(fixedSettings(settings))
+	b.SetMessenger(client)
+
+	ctx, cancel := context.WithCancel(ctx)
+	go client.ConnectAndListen(ctx)
+	waitCtx, stop := context.WithTimeout(ctx, 10*time.Second)
+	defer stop()
+	if err := fake.WaitForConnection(waitCtx); err != nil {
+		cancel()
+		server.Close()
+		return nil, fmt.Errorf("bot did not connect to the fake Slack: %w", err)
+	}
+	return &socketDriver{fake: fake, server: server, calls: calls, cancel: cancel}, nil
+}
+
+func (d *socketDriver) send(ctx context.Context, msg models.IncomingMessage) string {
+	return d.fake.Mention(msg.Conversation, msg.Author.ID, msg.Text)
+}
+
+func (d *socketDriver) slackCalls() map[string]int {
+	return d.calls.snapshot()
+}
+
+func (d *socketDriver) close() {
+	d.cancel()
+	d.server.Close()
+}
+
+// fakeBackend answers every request with sentences sentences after latency
+// plus up to jitter.
+type fakeBackend struct {
+	latency   time.Duration
+	jitter    time.Duration
+	sentences int
+}
+
+func (f fakeBackend) SendChatRequest(ctx context.Context, req models.ChatRequest) (models.ChatResponse, error) {
+	d := f.latency
+	if f.jitter > 0 {
+		d += rand.N(f.jitter)
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+		return models.ChatResponse{}, ctx.Err()
+	}
+
+	var answer strings.Builder
+	for i := range f.sentences {
+		fmt.Fprintf(&answer, "This is sentence %d of the answer to %q. ", i+1, req.Query)
+	}
+	return models.ChatResponse{FullResponse: strings.TrimSpace(answer.String())}, nil
+}
@@ -0,0 +1,191 @@
+// Command chatrelay-load generates mentions at configurable arrival rates
+// and reports how quickly the bot answers them.
+//
+// In the default inproc mode mentions go straight to the bot's
+// HandleMessage and replies to an in-memory Slack. In socket mode they go
+// through the real Slack client and its Socket Mode loop, against an
+// in-process fake Slack. The backend is a fake with configurable latency
+// unless -backend points at a real one, e.g. cmd/mockbackend.
+//
+//	chatrelay-load -rates 5,10,20 -stage 20s -slack-latency 80ms
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"chatrelay-bot/internal/chatbackend"
+	"chatrelay-bot/pkg/models"
+)
+
+type options struct {
+	mode           string
+	rates          []float64
+	stage          time.Duration
+	arrival        string
+	channels       int
+	users          int
+	timeout        time.Duration
+	backendURL     string
+	backendLatency time.Duration
+	backendJitter  time.Duration
+	sentences      int
+	slackLatency   time.Duration
+	streaming      bool
+	updateInterval time.Duration
+	verbose        bool
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	var opts options
+	fs := flag.NewFlagSet("chatrelay-load", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&opts.mode, "mode", "inproc", "inproc (call the bot directly) or socket (through the fake Slack)")
+	rates := fs.String("rates", "5", "comma-separated arrival rates in mentions per second, one per stage")
+	fs.DurationVar(&opts.stage, "stage", 30*time.Second, "duration of each rate stage")
+	fs.StringVar(&opts.arrival, "arrival", "poisson", "poisson or uniform arrivals")
+	fs.IntVar(&opts.channels, "channels", 10, "number of channels mentions are spread over")
+	fs.IntVar(&opts.users, "users", 50, "number of users mentions are spread over")
+	fs.DurationVar(&opts.timeout, "timeout", time.Minute, "how long to wait for answers after the last mention before counting them as dropped")
+	fs.StringVar(&opts.backendURL, "backend", "", "chat backend URL; empty uses an in-process fake")
+	fs.DurationVar(&opts.backendLatency, "backend-latency", 800*time.Millisecond, "fake backend latency")
+	fs.DurationVar(&opts.backendJitter, "backend-jitter", 400*time.Millisecond, "fake backend extra random latency")
+	fs.IntVar(&opts.sentences, "sentences", 4, "sentences in each fake backend answer")
+	fs.DurationVar(&opts.slackLatency, "slack-latency", 0, "added latency of every Slack API call")
+	fs.BoolVar(&opts.streaming, "streaming", true, "stream answers sentence by sentence")
+	fs.DurationVar(&opts.updateInterval, "update-interval", 500*time.Millisecond, "STREAM_UPDATE_INTERVAL for the bot")
+	fs.BoolVar(&opts.verbose, "v", false, "show the bot's logs")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	for _, r := range strings.Split(*rates, ",") {
+		rate, err := strconv.ParseFloat(strings.TrimSpace(r), 64)
+		if err != nil || rate <= 0 {
+			fmt.Fprintf(stderr, "invalid rate %q\n", r)
+			return 2
+		}
+		opts.rates = append(opts.rates, rate)
+	}
+	if opts.arrival != "poisson" && opts.arrival != "uniform" {
+		fmt.Fprintf(stderr, "invalid arrival %q\n", opts.arrival)
+		return 2
+	}
+	if opts.channels < 1 || opts.users < 1 {
+		fmt.Fprintln(stderr, "-channels and -users must be at least 1")
+		return 2
+	}
+
+	if !opts.verbose {
+		slog.SetDefault(slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: slog.LevelError + 4})))
+		log.SetOutput(io.Discard)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if err := runLoad(ctx, opts, stdout); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func runLoad(ctx context.Context, opts options, stdout io.Writer) error {
+	var backend chatbackend.Client = fakeBackend{latency: opts.backendLatency, jitter: opts.backendJitter, sentences: opts.sentences}
+	if opts.backendURL != "" {
+		backend = chatbackend.NewClient(opts.backendURL, 30*time.Second, 3, time.Second, 5, 30*time.Second)
+	}
+	settings := models.ChannelSettings{
+		Enabled:     true,
+		Placeholder: "Thinking...",
+		Footer:      finalMarker,
+		Streaming:   opts.streaming,
+		// Replies are matched to mentions by their thread.
+		ThreadOnly: true,
+	}
+	cfg := &models.AppConfig{StreamUpdateInterval: opts.updateInterval}
+
+	t := newTracker()
+	var d driver
+	switch opts.mode {
+	case "inproc":
+		d = newInProcessDriver(t, backend, settings, cfg, opts.slackLatency)
+	case "socket":
+		sd, err := newSocketDriver(ctx, t, backend, settings, cfg, opts.slackLatency)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if unacked := sd.fake.Unacked(); len(unacked) > 0 {
+				fmt.Fprintf(stdout, "Unacknowledged Socket Mode envelopes: %d\n", len(unacked))
+			}
+		}()
+		d = sd
+	default:
+		return fmt.Errorf("invalid mode %q", opts.mode)
+	}
+	defer d.close()
+
+	start := time.Now()
+	for _, rate := range opts.rates {
+		fmt.Fprintf(stdout, "Stage: %.1f mentions/s for %s\n", rate, opts.stage)
+		if !arrive(ctx, opts, rate, t, d) {
+			break
+		}
+	}
+	t.close()
+
+	select {
+	case <-t.done:
+	case <-time.After(opts.timeout):
+	case <-ctx.Done():
+	}
+	t.report(d.slackCalls(), time.Since(start)).print(stdout)
+	return nil
+}
+
+// arrive sends mentions at rate for one stage. It returns false if ctx is
+// cancelled.
+func arrive(ctx context.Context, opts options, rate float64, t *tracker, d driver) bool {
+	end := time.Now().Add(opts.stage)
+	next := time.Now()
+	for {
+		gap := time.Duration(float64(time.Second) / rate)
+		if opts.arrival == "poisson" {
+			gap = time.Duration(rand.ExpFloat64() * float64(time.Second) / rate)
+		}
+		next = next.Add(gap)
+		if next.After(end) {
+			return true
+		}
+		select {
+		case <-time.After(time.Until(next)):
+		case <-ctx.Done():
+			return false
+		}
+
+		msg := models.IncomingMessage{
+			Platform:     "slack",
+			Workspace:    "T0LOAD",
+			Conversation: fmt.Sprintf("C%04d", rand.IntN(opts.channels)),
+			Author:       models.Author{ID: fmt.Sprintf("U%04d", rand.IntN(opts.users))},
+			Text:         "load test question",
+		}
+		t.start(msg.Conversation, func() string { return d.send(ctx, msg) })
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// restoreLogs undoes run silencing the default loggers.
+func restoreLogs(t *testing.T) {
+	t.Helper()
+	prevSlog, prevLog := slog.Default(), log.Writer()
+	t.Cleanup(func() {
+		slog.SetDefault(prevSlog)
+		log.SetOutput(prevLog)
+	})
+}
+
+func TestRunRejectsInvalidFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "rate", args: []string{"-rates", "5,fast"}, want: `invalid rate "fast"`},
+		{name: "zero rate", args: []string{"-rates", "0"}, want: `invalid rate "0"`},
+		{name: "arrival", args: []string{"-arrival", "bursty"}, want: `invalid arrival "bursty"`},
+		{name: "channels", args: []string{"-channels", "0"}, want: "-channels and -users must be at least 1"},
+		{name: "unknown flag", args: []string{"-rps", "5"}, want: "flag provided but not defined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr strings.Builder
+			if code := run(tt.args, &stdout, &stderr); code != 2 {
+				t.Errorf("run = %d, want 2", code)
+			}
+			if !strings.Contains(stderr.String(), tt.want) {
+				t.Errorf("stderr = %q, want %q", stderr.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	for _, mode := range []string{"inproc", "socket"} {
+		t.Run(mode, func(t *testing.T) {
+			restoreLogs(t)
+			var stdout, stderr strings.Builder
+			code := run([]string{
+				"-mode", mode, "-rates", "40,80", "-stage", "150ms", "-arrival", "uniform",
+				"-backend-latency", "20ms", "-backend-jitter", "0", "-sentences", "2",
+				"-update-interval", "5ms", "-timeout", "5s",
+			}, &stdout, &stderr)
+			if code != 0 {
+				t.Fatalf("run = %d, stderr:\n%s", code, stderr.String())
+			}
+			out := stdout.String()
+			for _, want := range []string{
+				"Stage: 40.0 mentions/s for 150ms",
+				"Stage: 80.0 mentions/s for 150ms",
+				"0 failed, 0 dropped",
+				"chat.postMessage",
+				"chat.update",
+			} {
+				if !strings.Contains(out, want) {
+					t.Errorf("output does not contain %q:\n%s", want, out)
+				}
+			}
+			if strings.Contains(out, "Unacknowledged") {
+				t.Errorf("envelopes were left unacknowledged:\n%s", out)
+			}
+		})
+	}
+}
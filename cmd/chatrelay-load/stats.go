@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// mention is one generated mention and what happened to it.
+type mention struct {
+	channel  string
+	ts       string
+	sentAt   time.Time
+	placed   time.Duration // placeholder posted
+	first    time.Duration // first answer text
+	final    time.Duration // final answer, with the footer
+	failed   bool          // the bot answered with an error
+	finished bool
+}
+
+// tracker follows the bot's replies to generated mentions. Replies are
+// threaded under the mention, so a reply's thread ts identifies it.
+type tracker struct {
+	mu       sync.Mutex
+	mentions map[string]*mention
+	order    []*mention
+	done     chan struct{}
+	pending  int
+	closed   bool
+}
+
+func newTracker() *tracker {
+	return &tracker{mentions: make(map[string]*mention), done: make(chan struct{})}
+}
+
+// start sends a mention with send, which returns its ts. Replies are not
+// matched until send returns, so the tracker lock is held throughout.
+func (t *tracker) start(channel string, send func() string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	m := &mention{channel: channel, sentAt: time.Now()}
+	m.ts = send()
+	t.mentions[channel+"/"+m.ts] = m
+	t.order = append(t.order, m)
+	t.pending++
+}
+
+// observe records a change to a bot message: its revision count, thread,
+// channel and latest text.
+func (t *tracker) observe(channel, threadTS string, revisions int, text string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	m, ok := t.mentions[channel+"/"+threadTS]
+	if !ok || m.finished {
+		return
+	}
+	elapsed := at.Sub(m.sentAt)
+	if m.placed == 0 {
+		m.placed = elapsed
+	}
+	if revisions < 2 {
+		return
+	}
+	if m.first == 0 {
+		m.first = elapsed
+	}
+	switch {
+	case strings.HasSuffix(text, finalMarker):
+		m.final = elapsed
+	case strings.HasPrefix(text, "Apologies"):
+		m.failed = true
+	default:
+		return
+	}
+	m.finished = true
+	t.pending--
+	if t.pending == 0 && t.closed {
+		close(t.done)
+	}
+}
+
+// close marks the end of arrivals; done is closed once every mention has
+// finished.
+func (t *tracker) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	if t.pending == 0 {
+		close(t.done)
+	}
+}
+
+// report is the summary printed at the end of a run.
+type report struct {
+	sent, answered, failed, dropped int
+	placed, first, final            []time.Duration
+	slackCalls                      map[string]int
+	elapsed                         time.Duration
+}
+
+func (t *tracker) report(slackCalls map[string]int, elapsed time.Duration) report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := report{sent: len(t.order), slackCalls: slackCalls, elapsed: elapsed}
+	for _, m := range t.order {
+		switch {
+		case !m.finished:
+			r.dropped++
+			continue
+		case m.failed:
+			r.failed++
+		default:
+			r.answered++
+			r.final = append(r.final, m.final)
+		}
+		r.placed = append(r.placed, m.placed)
+		r.first = append(r.first, m.first)
+	}
+	return r
+}
+
+func (r report) print(w io.Writer) {
+	fmt.Fprintf(w, "\nMentions: %d sent in %s, %d answered, %d failed, %d dropped\n\n",
+		r.sent, r.elapsed.Round(time.Millisecond), r.answered, r.failed, r.dropped)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "\tp50\tp95\tp99\tmax\t")
+	for _, row := range []struct {
+		name string
+		d    []time.Duration
+	}{
+		{"placeholder", r.placed},
+		{"first update", r.first},
+		{"final", r.final},
+	} {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t\n", row.name,
+			percentile(row.d, 50), percentile(row.d, 95), percentile(row.d, 99), percentile(row.d, 100))
+	}
+	tw.Flush()
+
+	total := 0
+	methods := make([]string, 0, len(r.slackCalls))
+	for method, n := range r.slackCalls {
+		total += n
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	finished := r.answered + r.failed
+	fmt.Fprintf(w, "\nSlack calls: %d (%.1f/s)", total, float64(total)/r.elapsed.Seconds())
+	if finished > 0 {
+		fmt.Fprintf(w, ", %.1f per answer", float64(total)/float64(finished))
+	}
+	fmt.Fprintln(w)
+	for _, method := range methods {
+		fmt.Fprintf(w, "  %-22s %d\n", method, r.slackCalls[method])
+	}
+}
+
+// percentile uses the nearest-rank method.
+func percentile(d []time.Duration, p int) string {
+	if len(d) == 0 {
+		return "-"
+	}
+	sorted := slices.Clone(d)
+	slices.Sort(sorted)
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1].Round(time.Millisecond).String()
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	ms := func(ns ...int) []time.Duration {
+		var d []time.Duration
+		for _, n := range ns {
+			d = append(d, time.Duration(n)*time.Millisecond)
+		}
+		return d
+	}
+	tests := []struct {
+		name string
+		d    []time.Duration
+		p    int
+		want string
+	}{
+		{name: "empty", p: 50, want: "-"},
+		{name: "single", d: ms(7), p: 99, want: "7ms"},
+		{name: "median of unsorted", d: ms(5, 1, 4, 2, 3), p: 50, want: "3ms"},
+		{name: "p95 of 20", d: ms(20, 19, 18, 17, 16, 15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1), p: 95, want: "19ms"},
+		{name: "max", d: ms(3, 9, 1), p: 100, want: "9ms"},
+		{name: "p0 is the minimum", d: ms(3, 9, 1), p: 0, want: "1ms"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentile(tt.d, tt.p); got != tt.want {
+				t.Errorf("percentile(%v, %d) = %s, want %s", tt.d, tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTracker(t *testing.T) {
+	tr := newTracker()
+	sent := time.Now()
+	ts := map[string]string{"answered": "1.000001", "failed": "1.000002", "dropped": "1.000003"}
+	for _, name := range []string{"answered", "failed", "dropped"} {
+		tr.start("C1", func() string { return ts[name] })
+	}
+	for _, m := range tr.order {
+		m.sentAt = sent
+	}
+	at := func(ms int) time.Time { return sent.Add(time.Duration(ms) * time.Millisecond) }
+
+	tr.observe("C1", ts["answered"], 1, "Thinking...", at(10))
+	tr.observe("C1", ts["answered"], 2, "This is", at(100))
+	tr.observe("C1", ts["answered"], 3, "This is the answer\n"+finalMarker, at(300))
+	// Changes after the final revision and replies to unknown mentions are
+	// ignored.
+	tr.observe("C1", ts["answered"], 4, "late edit", at(400))
+	tr.observe("C2", ts["answered"], 2, "other channel\n"+finalMarker, at(50))
+	tr.observe("C1", ts["failed"], 1, "Thinking...", at(20))
+	tr.observe("C1", ts["failed"], 2, "Apologies, something went wrong.", at(200))
+	tr.observe("C1", ts["dropped"], 1, "Thinking...", at(30))
+	tr.close()
+
+	select {
+	case <-tr.done:
+		t.Fatal("done closed with a mention still unanswered")
+	default:
+	}
+
+	r := tr.report(map[string]int{"chat.postMessage": 3, "chat.update": 3}, time.Second)
+	if r.sent != 3 || r.answered != 1 || r.failed != 1 || r.dropped != 1 {
+		t.Errorf("report = %d sent, %d answered, %d failed, %d dropped, want 3, 1, 1, 1", r.sent, r.answered, r.failed, r.dropped)
+	}
+	want := map[string][]time.Duration{
+		"placed": {10 * time.Millisecond, 20 * time.Millisecond},
+		"first":  {100 * time.Millisecond, 200 * time.Millisecond},
+		"final":  {300 * time.Millisecond},
+	}
+	for name, got := range map[string][]time.Duration{"placed": r.placed, "first": r.first, "final": r.final} {
+		if !slices.Equal(got, want[name]) {
+			t.Errorf("%s = %v, want %v", name, got, want[name])
+		}
+	}
+
+	var out strings.Builder
+	r.print(&out)
+	for _, line := range []string{
+		"Mentions: 3 sent in 1s, 1 answered, 1 failed, 1 dropped",
+		"Slack calls: 6 (6.0/s), 3.0 per answer",
+		"chat.postMessage       3",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("report does not contain %q:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestTrackerDone(t *testing.T) {
+	tr := newTracker()
+	tr.start("C1", func() string { return "1.0" })
+	tr.observe("C1", "1.0", 2, "Answer\n"+finalMarker, time.Now())
+	select {
+	case <-tr.done:
+		t.Fatal("done closed before arrivals ended")
+	default:
+	}
+	tr.close()
+	select {
+	case <-tr.done:
+	default:
+		t.Fatal("done not closed once every mention finished")
+	}
+}
@@ -0,0 +1,111 @@
+// Command chatrelay-replay records chat backend traffic to a cassette and
+// replays it.
+//
+//	chatrelay-replay record -backend http://backend:8081 -cassette prod.json
+//	chatrelay-replay replay -cassette prod.json
+//
+// Point CHAT_BACKEND_URL at the tool in either mode.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"chatrelay-bot/internal/replay"
+)
+
+const usage = `usage: chatrelay-replay <record|replay> [flags]
+
+  record  proxy requests to -backend and save them to -cassette
+  replay  answer requests from -cassette
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+func run(args []string, stderr io.Writer) int {
+	if len(args) == 0 || (args[0] != "record" && args[0] != "replay") {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	mode := args[0]
+
+	fs := flag.NewFlagSet(mode, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	addr := fs.String("addr", ":8082", "address to listen on")
+	cassettePath := fs.String("cassette", "chatrelay-cassette.json", "cassette file")
+	ignore := fs.String("ignore", "user_id", "comma-separated request body fields left out of the match key")
+	backend := fs.String("backend", "", "backend base URL to record from (record mode)")
+	speed := fs.Float64("speed", 1, "replay speed: 1 is real time, 0 skips all delays (replay mode)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	cassette, err := replay.Open(*cassettePath)
+	if err != nil {
+		slog.Error("Failed to open cassette", "error", err)
+		return 1
+	}
+	matcher := replay.Matcher{Ignore: splitList(*ignore)}
+
+	var handler http.Handler
+	switch mode {
+	case "record":
+		if *backend == "" {
+			fmt.Fprintln(stderr, "record mode needs -backend")
+			return 2
+		}
+		handler = replay.NewRecorder(*backend, cassette, matcher)
+		slog.Info("Recording backend traffic", "backend", *backend, "cassette", *cassettePath, "existing", len(cassette.Interactions()))
+	case "replay":
+		player := replay.NewPlayer(cassette, matcher, *speed)
+		if player.Keys() == 0 {
+			slog.Warn("Cassette is empty; every request will miss", "cassette", *cassettePath)
+		}
+		handler = player
+		slog.Info("Replaying cassette", "cassette", *cassettePath, "requests", player.Keys(), "speed", *speed)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	server := &http.Server{Addr: *addr, Handler: handler}
+	errc := make(chan error, 1)
+	go func() {
+		slog.Info("Listening", "addr", *addr)
+		errc <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		slog.Error("Server failed", "error", err)
+		return 1
+	case <-ctx.Done():
+	}
+	shutdownCtx, stop := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stop()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Server forced to shutdown", "error", err)
+	}
+	return 0
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"chatrelay-bot/internal/config"
+)
+
+// runConfigCheck implements `chatrelay config check`: it loads the
+// configuration exactly as the bot would, prints the effective values with
+// secrets redacted and reports every validation error. It returns the
+// process exit code.
+func runConfigCheck(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("config check", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", os.Getenv(config.ConfigPathEnv), "path to a YAML or TOML config file")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	res, err := config.Load(*configPath)
+	if res == nil {
+		fmt.Fprintf(stderr, "Failed to load configuration: %v\n", err)
+		return 1
+	}
+
+	if res.Path != "" {
+		fmt.Fprintf(stdout, "Config file: %s\n\n", res.Path)
+	} else {
+		fmt.Fprintf(stdout, "Config file: none (set --config or %s)\n\n", config.ConfigPathEnv)
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tVALUE\tSOURCE")
+	for _, s := range res.Settings() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Name, s.Value, s.Source)
+	}
+	tw.Flush()
+
+	if err != nil {
+		var joined interface{ Unwrap() []error }
+		errs := []error{err}
+		if errors.As(err, &joined) {
+			errs = joined.Unwrap()
+		}
+		fmt.Fprintf(stderr, "\nConfiguration is invalid (%d errors):\n", len(errs))
+		for _, e := range errs {
+			fmt.Fprintf(stderr, "  - %v\n", e)
+		}
+		return 1
+	}
+	fmt.Fprintln(stdout, "\nConfiguration is valid.")
+	return 0
+}
@@ -2,25 +2,61 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
+	"chatrelay-bot/internal/api"
 	"chatrelay-bot/internal/bot"
 	"chatrelay-bot/internal/chatbackend"
 	"chatrelay-bot/internal/config"
+	"chatrelay-bot/internal/discord"
+	"chatrelay-bot/internal/health"
+	"chatrelay-bot/internal/mattermost"
+	"chatrelay-bot/internal/ratelimit"
+	"chatrelay-bot/internal/redact"
+	"chatrelay-bot/internal/secrets"
+	"chatrelay-bot/internal/server"
 	"chatrelay-bot/internal/slack"
+	"chatrelay-bot/internal/store"
+	"chatrelay-bot/internal/teams"
 	"chatrelay-bot/internal/telemetry"
+	"chatrelay-bot/internal/webhook"
+	"chatrelay-bot/pkg/models"
 )
 
 func main() {
-	cfg, err := config.LoadConfig()
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "check" {
+		os.Exit(runConfigCheck(os.Args[3:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "repl" {
+		os.Exit(runRepl(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+
+	configPath := flag.String("config", os.Getenv(config.ConfigPathEnv), "path to a YAML or TOML config file")
+	flag.Parse()
+
+	loaded, err := config.Load(*configPath)
 	if err != nil {
 		slog.Error("Failed to load application configuration", "error", err)
 		os.Exit(1)
 	}
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	cfg := loaded.Config
+	// exitCode is set when the bot stops because of a failure rather than
+	// a signal. It is applied after every other deferred shutdown step.
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 	if err := telemetry.InitOpenTelemetry(ctx, cfg); err != nil {
 		slog.Error("Failed to initialize OpenTelemetry", "error", err)
@@ -33,27 +69,231 @@ func main() {
 	}()
 
 	slog.Info("ChatRelay Bot is starting...")
-	backendClient := chatbackend.NewClient(cfg.ChatBackendURL, cfg.RequestTimeout, cfg.BackendAPIRetryCount, cfg.BackendAPIRetryDelay)
+
+	httpServer := server.New(cfg.ListenPort)
+	httpServer.Handle("/metrics", telemetry.MetricsHandler())
+	httpServer.Handle("/healthz", health.LivenessHandler())
+	httpServer.Handle("/readyz", health.Default().ReadinessHandler())
+	// The HTTP server carries API and Teams requests that are answered
+	// like any other mention, so it keeps serving until they have drained.
+	serveCtx, stopServing := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopServing()
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		if err := httpServer.Run(serveCtx); err != nil {
+			slog.Error("HTTP server stopped with an error", "error", err)
+			cancel()
+		}
+	}()
+
+	backendClient := chatbackend.NewClient(cfg.ChatBackendURL, cfg.RequestTimeout, cfg.BackendAPIRetryCount, cfg.BackendAPIRetryDelay, cfg.BackendBreakerThreshold, cfg.BackendBreakerCooldown)
 	slog.Info("Chat backend client initialized", "url", cfg.ChatBackendURL)
 
-	chatRelayBot := bot.NewChatRelayBot(nil, backendClient)
+	conversationStore, err := store.New(cfg.StorePath)
+	if err != nil {
+		slog.Error("Failed to open conversation store", "error", err, "path", cfg.StorePath)
+		os.Exit(1)
+	}
+	defer conversationStore.Close()
+	if cfg.StorePath == "" {
+		slog.Warn("STORE_PATH is not set: conversations, retry offers and quota usage are kept in memory and lost on restart, so unfinished replies cannot be recovered")
+	}
+	quotas := ratelimit.NewQuotas(conversationStore, cfg)
+
+	channelResolver := config.NewChannelResolver(cfg)
+	meteredBackend := ratelimit.MeterTokens(backendClient, quotas)
+	var pipelines []*pipeline
+	var reloadTargets []config.Reloadable
+
+	if cfg.SlackBotToken != "" {
+		p := newPipeline(meteredBackend, conversationStore, quotas, cfg)
+		slackClient := slack.NewClient(cfg.SlackBotToken, cfg.SlackAppToken, p.handler, cfg.SlackAPIRetryCount, cfg.SlackAPIRetryDelay, cfg.SlackAPIURL)
+		p.setMessenger(slackClient)
+		p.guard.SetDirectory(slackClient)
+		slackClient.SetRetryHandler(p.bot)
+		slackClient.SetMentionChangeHandler(p.bot)
+		slackClient.SetSettingsResolver(channelResolver)
+		pipelines = append(pipelines, p)
+		reloadTargets = append(reloadTargets, slackClient)
+
+		slog.Info("Slack client initialized",
+			"bot_token", redact.Secret(cfg.SlackBotToken),
+			"app_token", redact.Secret(cfg.SlackAppToken),
+		)
+	}
+
+	if cfg.DiscordBotToken != "" {
+		p := newPipeline(meteredBackend, conversationStore, quotas, cfg)
+		discordClient := discord.NewClient(cfg.DiscordBotToken, p.handler, cfg.DiscordAPIURL)
+		p.setMessenger(discordClient)
+		discordClient.SetRetryHandler(p.bot)
+		discordClient.SetMentionChangeHandler(p.bot)
+		discordClient.SetSettingsResolver(channelResolver)
+		pipelines = append(pipelines, p)
+		reloadTargets = append(reloadTargets, discordClient)
+
+		slog.Info("Discord client initialized", "bot_token", redact.Secret(cfg.DiscordBotToken))
+	}
+
+	if cfg.MattermostBotToken != "" {
+		actionsURL := cfg.MattermostActionsURL
+		if actionsURL == "" {
+			actionsURL = "http://localhost:" + cfg.ListenPort + mattermost.ActionsPath
+		}
+		p := newPipeline(meteredBackend, conversationStore, quotas, cfg)
+		mattermostClient := mattermost.NewClient(cfg.MattermostURL, cfg.MattermostBotToken, p.handler, actionsURL)
+		p.setMessenger(mattermostClient)
+		mattermostClient.SetRetryHandler(p.bot)
+		mattermostClient.SetMentionChangeHandler(p.bot)
+		mattermostClient.SetSettingsResolver(channelResolver)
+		httpServer.Handle(mattermost.ActionsPath, mattermostClient)
+		pipelines = append(pipelines, p)
+		reloadTargets = append(reloadTargets, mattermostClient)
 
+		slog.Info("Mattermost client initialized", "url", cfg.MattermostURL, "bot_token", redact.Secret(cfg.MattermostBotToken), "actions_url", actionsURL)
+	}
+
+	if cfg.TeamsAppID != "" {
+		p := newPipeline(meteredBackend, conversationStore, quotas, cfg)
+		teamsClient := teams.NewClient(cfg.TeamsAppID, cfg.TeamsAppPassword, p.handler, cfg.TeamsJWKSURL, cfg.TeamsTokenURL, cfg.TeamsServiceURL)
+		p.setMessenger(teamsClient)
+		teamsClient.SetRetryHandler(p.bot)
+		teamsClient.SetMentionChangeHandler(p.bot)
+		teamsClient.SetSettingsResolver(channelResolver)
+		httpServer.Handle(teams.MessagesPath, teamsClient)
+		pipelines = append(pipelines, p)
+		reloadTargets = append(reloadTargets, teamsClient)
+
+		slog.Info("Teams client initialized", "app_id", cfg.TeamsAppID, "app_password", redact.Secret(cfg.TeamsAppPassword), "messages_path", teams.MessagesPath)
+	}
+
+	// The webhook hears about answers on every platform, the API's
+	// included.
+	var webhookSender *webhook.Sender
+	if cfg.WebhookURL != "" {
+		webhookSender = webhook.NewSender(cfg.WebhookURL, cfg.WebhookSecret)
+		for _, p := range pipelines {
+			p.bot.SetAnswerListener(webhookSender)
+		}
+		reloadTargets = append(reloadTargets, config.ReloadFunc(func(cfg *models.AppConfig) {
+			webhookSender.SetSecret(cfg.WebhookSecret)
+		}))
+		slog.Info("Answer webhook initialized", "url", cfg.WebhookURL, "secret", redact.Secret(cfg.WebhookSecret))
+	}
 
-	slackClient := slack.NewClient(cfg.SlackBotToken, cfg.SlackAppToken, chatRelayBot, cfg.SlackAPIRetryCount, cfg.SlackAPIRetryDelay)
-	chatRelayBot.SetSlackClient(slackClient)
+	if cfg.APIKeys != "" {
+		keys, err := config.ParseAPIKeys(cfg.APIKeys)
+		if err != nil {
+			slog.Error("Invalid API_KEYS", "error", err)
+			os.Exit(1)
+		}
+		p := newPipeline(meteredBackend, conversationStore, quotas, cfg)
+		// An API answer can't outlive its request, so there is nothing to
+		// recover after a restart.
+		p.bot.SetConversationStore(nil)
+		apiServer := api.NewServer(keys, p.handler)
+		p.setMessenger(apiServer)
+		p.guard.SetMessenger(apiServer.WithNotifyStatus(http.StatusForbidden))
+		p.limiter.SetMessenger(apiServer.WithNotifyStatus(http.StatusTooManyRequests))
+		apiServer.SetSettingsResolver(channelResolver)
+		if webhookSender != nil {
+			p.bot.SetAnswerListener(bot.AnswerListeners{apiServer, webhookSender})
+		} else {
+			p.bot.SetAnswerListener(apiServer)
+		}
+		httpServer.Handle(api.AskPath, apiServer)
+		pipelines = append(pipelines, p)
+		reloadTargets = append(reloadTargets, config.ReloadFunc(func(cfg *models.AppConfig) {
+			// A reload with malformed keys is rejected before it gets here.
+			if keys, err := config.ParseAPIKeys(cfg.APIKeys); err == nil && len(keys) > 0 {
+				apiServer.SetKeys(keys)
+			}
+		}))
 
-	slog.Info("Slack client initialized",
-		"bot_token_prefix", cfg.SlackBotToken[:5]+"...",
-		"app_token_prefix", cfg.SlackAppToken[:5]+"...",
+		clients := make([]string, 0, len(keys))
+		for key, name := range keys {
+			clients = append(clients, name+"="+redact.Secret(key))
+		}
+		slog.Info("HTTP API initialized", "path", api.AskPath, "clients", clients)
+	}
+
+	for _, p := range pipelines {
+		reloadTargets = append(reloadTargets, p.bot, p.guard, p.limiter)
+	}
+	reloadTargets = append(reloadTargets,
+		channelResolver,
+		quotas,
+		config.ReloadFunc(func(cfg *models.AppConfig) {
+			if mode, err := redact.ParseMode(cfg.RedactionMode); err == nil {
+				redact.SetPolicy(redact.Policy{Mode: mode, TruncateLength: cfg.RedactionTruncateLength})
+			}
+		}),
 	)
+	if reloadable, ok := backendClient.(config.Reloadable); ok {
+		reloadTargets = append(reloadTargets, reloadable)
+	}
+	watcher := config.NewWatcher(*configPath, cfg, reloadTargets...)
+	go watcher.Run(ctx)
 
+	rotator := secrets.NewRotator(cfg.SecretsRefreshInterval, func(ctx context.Context, changed []string) {
+		watcher.Reload(ctx, "secrets rotated")
+	})
+	for name, provider := range loaded.Secrets {
+		slog.Info("Secret loaded from provider", "secret", name, "provider", provider.Describe())
+		if !config.Live(name) {
+			slog.Warn("Secret is only read at startup, restart to rotate it", "secret", name)
+			continue
+		}
+		rotator.Add(name, provider, loaded.Value(name))
+	}
+	go rotator.Run(ctx)
 
-	slog.Info("Connecting to Slack and starting event listener...")
-	err = chatRelayBot.StartBot(ctx)
-	if err != nil {
-		slog.Error("ChatRelay Bot failed to start or stopped with an error", "error", err)
-		os.Exit(1)
+	for _, p := range pipelines {
+		if err := p.bot.Recover(ctx, cfg.RecoveryMode); err != nil {
+			slog.Error("Failed to recover unfinished replies", "error", err)
+		}
+	}
+
+	slog.Info("Connecting to chat platforms and starting event listeners...", "count", len(pipelines))
+	errs := make(chan error, len(pipelines))
+	for _, p := range pipelines {
+		go func() { errs <- p.bot.StartBot(ctx) }()
+	}
+	for range pipelines {
+		if err := <-errs; err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("ChatRelay Bot failed to start or stopped with an error", "error", err)
+			// Stop the other adapters and drain what they have started.
+			exitCode = 1
+			cancel()
+		}
 	}
 
+	if exitCode != 0 {
+		slog.Info("Stopping after an adapter failure, draining", "timeout", cfg.ShutdownDrainTimeout)
+	} else {
+		slog.Info("Shutdown signal received, draining", "timeout", cfg.ShutdownDrainTimeout)
+	}
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), cfg.ShutdownDrainTimeout)
+	var drained sync.WaitGroup
+	for _, p := range pipelines {
+		drained.Add(1)
+		go func() {
+			defer drained.Done()
+			p.bot.Drain(drainCtx)
+		}()
+	}
+	drained.Wait()
+	if webhookSender != nil {
+		webhookSender.Wait(drainCtx)
+	}
+	drainCancel()
+	stopServing()
+	<-served
+
+	if exitCode != 0 {
+		slog.Info("ChatRelay Bot stopped after a failure.")
+		return
+	}
 	slog.Info("ChatRelay Bot stopped gracefully.")
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"chatrelay-bot/internal/access"
+	"chatrelay-bot/internal/adapter"
+	"chatrelay-bot/internal/bot"
+	"chatrelay-bot/internal/chatbackend"
+	"chatrelay-bot/internal/ratelimit"
+	"chatrelay-bot/internal/store"
+	"chatrelay-bot/pkg/models"
+)
+
+// pipeline is the handler chain behind one chat platform's adapter:
+// adapter → enabled check → access guard → rate limiter → bot. Pipelines
+// share the backend, store and quotas, so a user's token budget spans
+// platforms.
+type pipeline struct {
+	// handler is the first stage, which the adapter delivers messages to.
+	handler adapter.Handler
+	bot     *bot.ChatRelayBot
+	guard   *access.Guard
+	limiter *ratelimit.Limiter
+}
+
+func newPipeline(backend chatbackend.Client, st store.Store, quotas *ratelimit.Quotas, cfg *models.AppConfig) *pipeline {
+	b := bot.NewChatRelayBot(nil, backend)
+	b.ApplyConfig(cfg)
+	b.SetConversationStore(st)
+	limiter := ratelimit.NewLimiter(b, quotas, cfg)
+	guard := access.NewGuard(limiter, cfg)
+	p := &pipeline{
+		handler: enabledOnly{next: guard},
+		bot:     b,
+		guard:   guard,
+		limiter: limiter,
+	}
+	b.SetHandler(p.handler)
+	return p
+}
+
+// setMessenger makes every stage reply through m.
+func (p *pipeline) setMessenger(m adapter.Messenger) {
+	p.bot.SetMessenger(m)
+	p.guard.SetMessenger(m)
+	p.limiter.SetMessenger(m)
+}
+
+// enabledOnly drops messages in conversations where the bot is disabled
+// before the other stages see them, so they use up no rate limit or quota
+// and get no notices.
+type enabledOnly struct {
+	next adapter.Handler
+}
+
+func (e enabledOnly) HandleMessage(ctx context.Context, msg models.IncomingMessage, settings models.ChannelSettings) error {
+	if !settings.Enabled {
+		slog.InfoContext(ctx, "Bot is disabled for this channel, ignoring mention", "channel", msg.Conversation, "team", msg.Workspace, "platform", msg.Platform)
+		return nil
+	}
+	return e.next.HandleMessage(ctx, msg, settings)
+}
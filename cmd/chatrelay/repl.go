@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"time"
+
+	"chatrelay-bot/internal/bot"
+	"chatrelay-bot/internal/chatbackend"
+	"chatrelay-bot/internal/config"
+	"chatrelay-bot/internal/repl"
+	"chatrelay-bot/internal/store"
+)
+
+// runRepl implements `chatrelay repl`: a terminal front end to the same
+// bot, backend client and channel routing as the Slack bot, for trying
+// prompts without a workspace. Slack tokens are not needed. It returns the
+// process exit code.
+func runRepl(args []string, stdin io.Reader, stdout *os.File, stderr io.Writer) int {
+	fs := flag.NewFlagSet("repl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", os.Getenv(config.ConfigPathEnv), "path to a YAML or TOML config file")
+	backendURL := fs.String("backend", "", "chat backend URL, overriding CHAT_BACKEND_URL")
+	channelID := fs.String("channel", "CREPL", "channel the questions are asked in, for channel overrides")
+	teamID := fs.String("team", "TREPL", "workspace the questions are asked in, for workspace overrides")
+	userID := fs.String("user", "UREPL", "user asking the questions")
+	verbose := fs.Bool("v", false, "show the bot's logs")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	res, err := config.Load(*configPath)
+	if res == nil {
+		fmt.Fprintf(stderr, "Failed to load configuration: %v\n", err)
+		return 1
+	}
+	if err := replConfigErrors(err, *backendURL != ""); err != nil {
+		fmt.Fprintf(stderr, "Configuration is invalid: %v\n", err)
+		return 1
+	}
+	cfg := res.Config
+	if *backendURL != "" {
+		cfg.ChatBackendURL = *backendURL
+	}
+
+	// The bot logs every step; keep the terminal for the conversation.
+	if !*verbose {
+		slog.SetDefault(slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: slog.LevelError})))
+		log.SetOutput(io.Discard)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	backendClient := chatbackend.NewClient(cfg.ChatBackendURL, cfg.RequestTimeout, cfg.BackendAPIRetryCount, cfg.BackendAPIRetryDelay, cfg.BackendBreakerThreshold, cfg.BackendBreakerCooldown)
+	term := repl.NewTerminal(stdout)
+	chatRelayBot := bot.NewChatRelayBot(term, backendClient)
+	chatRelayBot.ApplyConfig(cfg)
+	// Conversations are kept in memory so the repl never touches the
+	// bot's own store.
+	conversationStore, _ := store.New("")
+	chatRelayBot.SetConversationStore(conversationStore)
+
+	fmt.Fprintf(stdout, "ChatRelay repl, backend %s\n", cfg.ChatBackendURL)
+	session := repl.NewSession(chatRelayBot, config.NewChannelResolver(cfg), term, *teamID, *channelID, *userID)
+	if err := session.Run(ctx, stdin); err != nil {
+		fmt.Fprintf(stderr, "Failed to read input: %v\n", err)
+		return 1
+	}
+
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer drainCancel()
+	chatRelayBot.Drain(drainCtx)
+	return 0
+}
+
+// replConfigErrors drops the errors for settings the repl does without:
+// the Slack tokens, and the backend URL when --backend is given.
+func replConfigErrors(err error, haveBackend bool) error {
+	if err == nil {
+		return nil
+	}
+	errs := []error{err}
+	var joined interface{ Unwrap() []error }
+	if errors.As(err, &joined) {
+		errs = joined.Unwrap()
+	}
+	var remaining []error
+	for _, e := range errs {
+		var missing *config.MissingSettingError
+		if errors.As(e, &missing) {
+			switch missing.Name {
+			case "SLACK_BOT_TOKEN", "SLACK_APP_TOKEN":
+				continue
+			case "CHAT_BACKEND_URL":
+				if haveBackend {
+					continue
+				}
+			}
+		}
+		remaining = append(remaining, e)
+	}
+	return errors.Join(remaining...)
+}
@@ -0,0 +1,141 @@
+// Command fakediscord serves a local stand-in for the Discord REST API and
+// Gateway. Point the bot at it with
+// DISCORD_API_URL=http://localhost:8091/api/v10 and any DISCORD_BOT_TOKEN,
+// then send mentions and direct messages from a script file or the /_fake/
+// control endpoints.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"chatrelay-bot/internal/discord/fakediscord"
+)
+
+// step is one scripted message. With DM set it is sent to the bot in a
+// direct message, otherwise it mentions the bot in Channel.
+type step struct {
+	After   time.Duration `yaml:"after" json:"after"`
+	Channel string        `yaml:"channel" json:"channel"`
+	User    string        `yaml:"user" json:"user"`
+	Text    string        `yaml:"text" json:"text"`
+	DM      bool          `yaml:"dm" json:"dm"`
+}
+
+func main() {
+	addr := flag.String("addr", ":8091", "address to listen on")
+	script := flag.String("script", "", "YAML file of messages to send once the bot connects")
+	rateLimit := flag.Int("rate-limit", 5, "message requests allowed per channel per -rate-window")
+	rateWindow := flag.Duration("rate-window", 5*time.Second, "rate limit window of each channel's message bucket")
+	flag.Parse()
+
+	var steps []step
+	if *script != "" {
+		data, err := os.ReadFile(*script)
+		if err != nil {
+			slog.Error("Failed to read script", "error", err)
+			os.Exit(1)
+		}
+		if err := yaml.Unmarshal(data, &steps); err != nil {
+			slog.Error("Failed to parse script", "path", *script, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	fake := fakediscord.NewServer()
+	fake.RateLimit, fake.RateWindow = *rateLimit, *rateWindow
+	mux := http.NewServeMux()
+	mux.Handle("/", fake)
+	mux.HandleFunc("/_fake/message", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var s step
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		channel, id := send(fake, s)
+		writeJSON(w, map[string]string{"channel_id": channel, "id": id})
+	})
+	mux.HandleFunc("/_fake/messages", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, fake.Messages())
+	})
+	mux.HandleFunc("/_fake/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, fake.Stats())
+	})
+	mux.HandleFunc("/_fake/disconnect", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		fake.Disconnect()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	server := &http.Server{Addr: *addr, Handler: mux}
+	go func() {
+		slog.Info("Fake Discord listening", "addr", *addr, "api_url", fmt.Sprintf("http://localhost%s/api/v10", *addr))
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Fake Discord server failed", "error", err)
+			cancel()
+		}
+	}()
+
+	if len(steps) > 0 {
+		go runScript(ctx, fake, steps)
+	}
+
+	<-ctx.Done()
+	fake.Close()
+	shutdownCtx, stop := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stop()
+	server.Shutdown(shutdownCtx)
+}
+
+func runScript(ctx context.Context, fake *fakediscord.Server, steps []step) {
+	if err := fake.WaitForConnection(ctx); err != nil {
+		return
+	}
+	for _, s := range steps {
+		select {
+		case <-time.After(s.After):
+		case <-ctx.Done():
+			return
+		}
+		channel, id := send(fake, s)
+		slog.Info("Sent message", "channel", channel, "user", s.User, "id", id, "dm", s.DM)
+	}
+}
+
+func send(fake *fakediscord.Server, s step) (channel, id string) {
+	if s.User == "" {
+		s.User = fakediscord.User
+	}
+	if s.DM {
+		return fake.DMChannel(s.User), fake.DirectMessage(s.User, s.Text)
+	}
+	if s.Channel == "" {
+		s.Channel = fakediscord.Channel
+	}
+	return s.Channel, fake.Mention(s.Channel, s.User, s.Text)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
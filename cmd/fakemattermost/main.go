@@ -0,0 +1,151 @@
+// Command fakemattermost serves a local stand-in for a Mattermost server.
+// Point the bot at it with MATTERMOST_URL=http://localhost:8092 and any
+// MATTERMOST_BOT_TOKEN, then send posts from a script file or the /_fake/
+// control endpoints.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"chatrelay-bot/internal/mattermost/fakemattermost"
+)
+
+// step is one scripted post. With DM set it is sent to the bot in a direct
+// message, otherwise it mentions the bot in Channel, in the thread rooted
+// at Root if set.
+type step struct {
+	After   time.Duration `yaml:"after" json:"after"`
+	Channel string        `yaml:"channel" json:"channel"`
+	User    string        `yaml:"user" json:"user"`
+	Text    string        `yaml:"text" json:"text"`
+	Root    string        `yaml:"root" json:"root"`
+	DM      bool          `yaml:"dm" json:"dm"`
+}
+
+func main() {
+	addr := flag.String("addr", ":8092", "address to listen on")
+	script := flag.String("script", "", "YAML file of posts to send once the bot connects")
+	flag.Parse()
+
+	var steps []step
+	if *script != "" {
+		data, err := os.ReadFile(*script)
+		if err != nil {
+			slog.Error("Failed to read script", "error", err)
+			os.Exit(1)
+		}
+		if err := yaml.Unmarshal(data, &steps); err != nil {
+			slog.Error("Failed to parse script", "path", *script, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	fake := fakemattermost.NewServer()
+	mux := http.NewServeMux()
+	mux.Handle("/", fake)
+	mux.HandleFunc("/_fake/post", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var s step
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, map[string]string{"id": send(fake, s)})
+	})
+	mux.HandleFunc("/_fake/posts", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, fake.Posts())
+	})
+	mux.HandleFunc("/_fake/ephemerals", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, fake.Ephemerals())
+	})
+	mux.HandleFunc("/_fake/press", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			Post string `json:"post"`
+			User string `json:"user"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		if req.User == "" {
+			req.User = fakemattermost.User
+		}
+		if err := fake.PressButton(req.Post, req.User); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	server := &http.Server{Addr: *addr, Handler: mux}
+	go func() {
+		slog.Info("Fake Mattermost listening", "addr", *addr, "url", "http://localhost"+*addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Fake Mattermost server failed", "error", err)
+			cancel()
+		}
+	}()
+
+	if len(steps) > 0 {
+		go runScript(ctx, fake, steps)
+	}
+
+	<-ctx.Done()
+	fake.Close()
+	shutdownCtx, stop := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stop()
+	server.Shutdown(shutdownCtx)
+}
+
+func runScript(ctx context.Context, fake *fakemattermost.Server, steps []step) {
+	if err := fake.WaitForConnection(ctx); err != nil {
+		return
+	}
+	for _, s := range steps {
+		select {
+		case <-time.After(s.After):
+		case <-ctx.Done():
+			return
+		}
+		id := send(fake, s)
+		slog.Info("Sent post", "channel", s.Channel, "user", s.User, "id", id, "dm", s.DM)
+	}
+}
+
+func send(fake *fakemattermost.Server, s step) string {
+	if s.User == "" {
+		s.User = fakemattermost.User
+	}
+	if s.DM {
+		return fake.DirectMessage(s.User, s.Text)
+	}
+	if s.Channel == "" {
+		s.Channel = fakemattermost.Channel
+	}
+	return fake.MentionInThread(s.Channel, s.User, s.Root, s.Text)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,128 @@
+// Command fakeslack serves a local stand-in for the Slack Web API and Socket
+// Mode. Point the bot at it with SLACK_API_URL=http://localhost:8090/api/
+// and any xoxb-/xapp- tokens, then post mentions from a script file or the
+// /_fake/ control endpoints.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"chatrelay-bot/internal/slack/fakeslack"
+)
+
+// step is one scripted mention.
+type step struct {
+	After   time.Duration `yaml:"after"`
+	Channel string        `yaml:"channel"`
+	User    string        `yaml:"user"`
+	Text    string        `yaml:"text"`
+}
+
+func main() {
+	addr := flag.String("addr", ":8090", "address to listen on")
+	script := flag.String("script", "", "YAML file of mentions to send once the bot connects")
+	flag.Parse()
+
+	var steps []step
+	if *script != "" {
+		data, err := os.ReadFile(*script)
+		if err != nil {
+			slog.Error("Failed to read script", "error", err)
+			os.Exit(1)
+		}
+		if err := yaml.Unmarshal(data, &steps); err != nil {
+			slog.Error("Failed to parse script", "path", *script, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	fake := fakeslack.NewServer()
+	mux := http.NewServeMux()
+	mux.Handle("/", fake)
+	mux.HandleFunc("/_fake/mention", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var s step
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, map[string]string{"ts": mention(fake, s)})
+	})
+	mux.HandleFunc("/_fake/messages", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, fake.Messenger().Messages())
+	})
+	mux.HandleFunc("/_fake/acks", func(w http.ResponseWriter, r *http.Request) {
+		sent, acked := fake.AckStats()
+		writeJSON(w, map[string]any{"sent": sent, "acked": acked, "unacked": fake.Unacked()})
+	})
+
+	server := &http.Server{Addr: *addr, Handler: mux}
+	go func() {
+		slog.Info("Fake Slack listening", "addr", *addr, "api_url", fmt.Sprintf("http://localhost%s/api/", *addr))
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Fake Slack server failed", "error", err)
+			cancel()
+		}
+	}()
+
+	if len(steps) > 0 {
+		go runScript(ctx, fake, steps)
+	}
+
+	<-ctx.Done()
+	shutdownCtx, stop := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stop()
+	server.Shutdown(shutdownCtx)
+}
+
+func runScript(ctx context.Context, fake *fakeslack.Server, steps []step) {
+	if err := fake.WaitForConnection(ctx); err != nil {
+		return
+	}
+	for _, s := range steps {
+		select {
+		case <-time.After(s.After):
+		case <-ctx.Done():
+			return
+		}
+		ts := mention(fake, s)
+		slog.Info("Sent mention", "channel", s.Channel, "user", s.User, "ts", ts)
+	}
+	if err := fake.WaitForAcks(ctx); err != nil {
+		slog.Error("Not every event was acknowledged", "error", err)
+		return
+	}
+	slog.Info("All scripted events acknowledged")
+}
+
+func mention(fake *fakeslack.Server, s step) string {
+	if s.Channel == "" {
+		s.Channel = "C0FAKE"
+	}
+	if s.User == "" {
+		s.User = "U0FAKE"
+	}
+	return fake.Mention(s.Channel, s.User, s.Text)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,164 @@
+// Command faketeams serves a local stand-in for Microsoft Teams and the Bot
+// Framework. Point the bot at it with TEAMS_APP_ID and TEAMS_APP_PASSWORD
+// set to the fake's app credentials and TEAMS_JWKS_URL, TEAMS_TOKEN_URL and
+// TEAMS_SERVICE_URL set to the URLs it logs, then send messages from a
+// script file or the /_fake/ control endpoints.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"chatrelay-bot/internal/teams/faketeams"
+)
+
+// step is one scripted message. With Personal set it is sent to the bot in
+// the user's personal chat, otherwise it mentions the bot in Channel, in
+// the thread rooted at Root if set.
+type step struct {
+	After    time.Duration `yaml:"after" json:"after"`
+	Channel  string        `yaml:"channel" json:"channel"`
+	User     string        `yaml:"user" json:"user"`
+	Text     string        `yaml:"text" json:"text"`
+	Root     string        `yaml:"root" json:"root"`
+	Personal bool          `yaml:"personal" json:"personal"`
+}
+
+func main() {
+	addr := flag.String("addr", ":8093", "address to listen on")
+	bot := flag.String("bot", "http://localhost:8080/api/messages", "the bot's messaging endpoint")
+	script := flag.String("script", "", "YAML file of messages to send once the bot has started")
+	flag.Parse()
+
+	var steps []step
+	if *script != "" {
+		data, err := os.ReadFile(*script)
+		if err != nil {
+			slog.Error("Failed to read script", "error", err)
+			os.Exit(1)
+		}
+		if err := yaml.Unmarshal(data, &steps); err != nil {
+			slog.Error("Failed to parse script", "path", *script, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	fake := faketeams.NewServer(*bot)
+	fake.SetURL("http://localhost" + *addr)
+	mux := http.NewServeMux()
+	mux.Handle("/", fake)
+	mux.HandleFunc("/_fake/message", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var s step
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		id, err := send(fake, s)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		writeJSON(w, map[string]string{"id": id})
+	})
+	mux.HandleFunc("/_fake/activities", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, fake.Activities())
+	})
+	mux.HandleFunc("/_fake/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, fake.Stats())
+	})
+	mux.HandleFunc("/_fake/press", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			Activity string `json:"activity"`
+			User     string `json:"user"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		if req.User == "" {
+			req.User = faketeams.User
+		}
+		if err := fake.PressButton(req.Activity, req.User); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	server := &http.Server{Addr: *addr, Handler: mux}
+	go func() {
+		slog.Info("Fake Teams listening", "addr", *addr, "bot", *bot,
+			"app_id", faketeams.AppID, "app_password", faketeams.AppPassword,
+			"jwks_url", fake.JWKSURL(), "token_url", fake.TokenURL(), "service_url", fake.ServiceURL())
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Fake Teams server failed", "error", err)
+			cancel()
+		}
+	}()
+
+	if len(steps) > 0 {
+		go runScript(ctx, fake, steps)
+	}
+
+	<-ctx.Done()
+	shutdownCtx, stop := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stop()
+	server.Shutdown(shutdownCtx)
+}
+
+func runScript(ctx context.Context, fake *faketeams.Server, steps []step) {
+	if err := fake.WaitForBot(ctx); err != nil {
+		return
+	}
+	for _, s := range steps {
+		select {
+		case <-time.After(s.After):
+		case <-ctx.Done():
+			return
+		}
+		id, err := send(fake, s)
+		if err != nil {
+			slog.Error("Failed to send message", "error", err)
+			continue
+		}
+		slog.Info("Sent message", "channel", s.Channel, "user", s.User, "id", id, "personal", s.Personal)
+	}
+}
+
+func send(fake *faketeams.Server, s step) (string, error) {
+	if s.User == "" {
+		s.User = faketeams.User
+	}
+	if s.Personal {
+		return fake.PersonalMessage(s.User, s.Text)
+	}
+	if s.Channel == "" {
+		s.Channel = faketeams.Channel
+	}
+	return fake.MentionInThread(s.Channel, s.User, s.Root, s.Text)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
 	"go.opentelemetry.io/otel"
@@ -16,6 +17,7 @@ import (
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 	"chatrelay-bot/internal/config"
+	"chatrelay-bot/internal/redact"
 	"chatrelay-bot/internal/telemetry"
 	"chatrelay-bot/pkg/models"
 )
@@ -37,6 +39,17 @@ func main() {
 	}
 	defer telemetry.ShutdownOpenTelemetry(ctx)
 
+	scenarios, err := loadScenarios(cfg.MockBackendScenarios)
+	if err != nil {
+		slog.Error("Failed to load scenarios", "error", err)
+		os.Exit(1)
+	}
+	if _, ok := scenarios[cfg.MockBackendScenario]; !ok {
+		slog.Error("Unknown default scenario", "scenario", cfg.MockBackendScenario, "available", scenarioNames(scenarios))
+		os.Exit(1)
+	}
+	slog.Info("Mock backend scenarios loaded", "default", cfg.MockBackendScenario, "available", scenarioNames(scenarios))
+
 	tracer := otel.Tracer(tracerName)
 
 	mux := http.NewServeMux()
@@ -80,17 +93,34 @@ func main() {
 		slog.InfoContext(ctx, "Received chat request", "user_id", chatReq.UserID, "query", chatReq.Query)
 		span.SetAttributes(
 			attribute.String("chat.user_id", chatReq.UserID),
-			attribute.String("chat.query", chatReq.Query),
+			redact.Attr("chat.query", chatReq.Query),
 		)
 
-		processingDelay := time.Millisecond * time.Duration(500+time.Now().UnixNano()%1000)
-		slog.InfoContext(ctx, "Simulating processing delay", "duration", processingDelay)
-		time.Sleep(processingDelay)
+		scenarioName, scenario, err := selectScenario(r, chatReq.Query, scenarios, cfg.MockBackendScenario)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.WarnContext(ctx, "Unknown scenario requested", "scenario", scenarioName)
+			span.SetStatus(codes.Error, "Unknown scenario")
+			return
+		}
+		span.SetAttributes(attribute.String("mock.scenario", scenarioName))
+
+		processingDelay := scenario.delay()
+		slog.InfoContext(ctx, "Simulating processing delay", "duration", processingDelay, "scenario", scenarioName)
 		span.AddEvent("SimulatedProcessingDelay", trace.WithAttributes(attribute.String("duration", processingDelay.String())))
 
 		mockResponse := models.ChatResponse{
 			FullResponse: fmt.Sprintf("Hello %s! Your query about '%s' has been processed by the mock backend. This is a detailed and insightful response demonstrating efficient handling of concurrent requests and robust error management. We believe in providing scalable solutions with comprehensive observability features.", chatReq.UserID, chatReq.Query),
 		}
+		// Report usage the way token-counting backends do, approximating one
+		// token per word.
+		promptTokens := len(strings.Fields(chatReq.Query))
+		completionTokens := len(strings.Fields(mockResponse.FullResponse))
+		mockResponse.Usage = &models.Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		}
 
 		responseBody, err := json.Marshal(mockResponse)
 		if err != nil {
@@ -101,17 +131,14 @@ func main() {
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		_, err = w.Write(responseBody)
-		if err != nil {
-			slog.ErrorContext(ctx, "Failed to write response", "error", err)
+		if err := scenario.respond(ctx, w, responseBody, processingDelay); err != nil {
+			slog.ErrorContext(ctx, "Failed to write response", "error", err, "scenario", scenarioName)
 			span.RecordError(err)
 			span.SetStatus(codes.Error, "Failed to write response")
 			return
 		}
 
-		slog.InfoContext(ctx, "Sent mock response", "user_id", chatReq.UserID, "response_length", len(responseBody))
+		slog.InfoContext(ctx, "Sent mock response", "user_id", chatReq.UserID, "scenario", scenarioName, "response_length", len(responseBody))
 		span.SetStatus(codes.Ok, "Response sent")
 	})
 
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ScenarioHeader selects a scenario for a single request. A query containing
+// a #scenario:<name> tag does the same, which lets a scenario be picked from
+// Slack when the bot sits in between.
+const ScenarioHeader = "X-Mock-Scenario"
+
+var scenarioTag = regexp.MustCompile(`#scenario:([\w-]+)`)
+
+// Body modes.
+const (
+	BodyOK        = "ok"
+	BodyMalformed = "malformed"
+	BodyTruncated = "truncated"
+	BodyStall     = "stall"
+	BodyReset     = "reset"
+)
+
+// Scenario describes how the mock backend answers a request.
+type Scenario struct {
+	// Latency is waited before answering, plus up to Jitter more. With
+	// probability TailProbability, TailLatency is added on top.
+	Latency         time.Duration `yaml:"latency"`
+	Jitter          time.Duration `yaml:"jitter"`
+	TailLatency     time.Duration `yaml:"tail_latency"`
+	TailProbability float64       `yaml:"tail_probability"`
+
+	// Failures makes some requests fail with an error status instead.
+	Failures *Failures `yaml:"failures"`
+
+	// Body is one of ok, malformed (invalid JSON), truncated (half of the
+	// JSON, then the connection ends), stall (half of the JSON, then nothing
+	// until the client gives up) or reset (the connection is reset before
+	// any response).
+	Body string `yaml:"body"`
+
+	// ChunkSize and ChunkDelay drip the body out in flushed chunks.
+	ChunkSize  int           `yaml:"chunk_size"`
+	ChunkDelay time.Duration `yaml:"chunk_delay"`
+
+	mu       sync.Mutex
+	requests int
+}
+
+// Failures fails Count out of every Every requests, starting with the first,
+// with Status. Every of 0 fails only the first Count requests. RetryAfter
+// sets the Retry-After header, typically with status 429.
+type Failures struct {
+	Status     int           `yaml:"status"`
+	Count      int           `yaml:"count"`
+	Every      int           `yaml:"every"`
+	RetryAfter time.Duration `yaml:"retry_after"`
+}
+
+// builtinScenarios are available without a scenario file. "default" is the
+// mock's original behaviour.
+func builtinScenarios() map[string]*Scenario {
+	return map[string]*Scenario{
+		"default":   {Latency: 500 * time.Millisecond, Jitter: time.Second},
+		"fast":      {},
+		"slow":      {Latency: 8 * time.Second},
+		"long-tail": {Latency: 100 * time.Millisecond, Jitter: 100 * time.Millisecond, TailLatency: 5 * time.Second, TailProbability: 0.1},
+		"flaky":     {Latency: 100 * time.Millisecond, Failures: &Failures{Status: http.StatusServiceUnavailable, Count: 2, Every: 5}},
+		"down":      {Failures: &Failures{Status: http.StatusInternalServerError, Count: 1, Every: 1}},
+		"throttled": {Failures: &Failures{Status: http.StatusTooManyRequests, Count: 1, Every: 2, RetryAfter: 2 * time.Second}},
+		"malformed": {Body: BodyMalformed},
+		"truncated": {Body: BodyTruncated},
+		"stall":     {Body: BodyStall},
+		"reset":     {Body: BodyReset},
+		"drip":      {ChunkSize: 16, ChunkDelay: 200 * time.Millisecond},
+	}
+}
+
+// loadScenarios returns the built-in scenarios plus those in the YAML file
+// at path, which replace built-ins of the same name:
+//
+//	flaky-gateway:
+//	  latency: 200ms
+//	  failures: {status: 502, count: 3, every: 10}
+func loadScenarios(path string) (map[string]*Scenario, error) {
+	scenarios := builtinScenarios()
+	if path == "" {
+		return scenarios, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario file: %w", err)
+	}
+	var fromFile map[string]*Scenario
+	if err := yaml.Unmarshal(data, &fromFile); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario file %s: %w", path, err)
+	}
+	for name, s := range fromFile {
+		if s == nil {
+			s = &Scenario{}
+		}
+		if err := s.validate(); err != nil {
+			return nil, fmt.Errorf("%s: scenario %q: %w", path, name, err)
+		}
+		scenarios[name] = s
+	}
+	return scenarios, nil
+}
+
+func (s *Scenario) validate() error {
+	switch s.Body {
+	case "", BodyOK, BodyMalformed, BodyTruncated, BodyStall, BodyReset:
+	default:
+		return fmt.Errorf("unknown body %q", s.Body)
+	}
+	if s.TailProbability < 0 || s.TailProbability > 1 {
+		return fmt.Errorf("tail_probability must be between 0 and 1")
+	}
+	if f := s.Failures; f != nil && (f.Status < 400 || f.Status > 599) {
+		return fmt.Errorf("failures.status must be an HTTP error status, got %d", f.Status)
+	}
+	return nil
+}
+
+func scenarioNames(scenarios map[string]*Scenario) []string {
+	names := make([]string, 0, len(scenarios))
+	for name := range scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// selectScenario picks the scenario named by the request header, then by a
+// tag in the query, then the default.
+func selectScenario(r *http.Request, query string, scenarios map[string]*Scenario, defaultName string) (string, *Scenario, error) {
+	name := r.Header.Get(ScenarioHeader)
+	if name == "" {
+		if m := scenarioTag.FindStringSubmatch(query); m != nil {
+			name = m[1]
+		}
+	}
+	if name == "" {
+		name = defaultName
+	}
+	s, ok := scenarios[name]
+	if !ok {
+		return name, nil, fmt.Errorf("unknown scenario %q", name)
+	}
+	return name, s, nil
+}
+
+// delay is how long to wait before answering this request.
+func (s *Scenario) delay() time.Duration {
+	d := s.Latency
+	if s.Jitter > 0 {
+		d += rand.N(s.Jitter)
+	}
+	if s.TailProbability > 0 && rand.Float64() < s.TailProbability {
+		d += s.TailLatency
+	}
+	return d
+}
+
+// failure returns how this request should fail, or nil if it should be
+// answered normally.
+func (s *Scenario) failure() *Failures {
+	s.mu.Lock()
+	n := s.requests
+	s.requests++
+	s.mu.Unlock()
+
+	f := s.Failures
+	if f == nil || f.Count <= 0 {
+		return nil
+	}
+	if f.Every > 0 {
+		n %= f.Every
+	}
+	if n < f.Count {
+		return f
+	}
+	return nil
+}
+
+// respond writes body, or the fault the scenario calls for, after delay.
+func (s *Scenario) respond(ctx context.Context, w http.ResponseWriter, body []byte, delay time.Duration) error {
+	if !sleep(ctx, delay) {
+		return ctx.Err()
+	}
+
+	if f := s.failure(); f != nil {
+		if f.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(f.RetryAfter.Round(time.Second).Seconds())))
+		}
+		http.Error(w, fmt.Sprintf("mock failure: %s", http.StatusText(f.Status)), f.Status)
+		return nil
+	}
+
+	switch s.Body {
+	case BodyReset:
+		return resetConnection(w)
+	case BodyMalformed:
+		body = append([]byte(`{"full_response": `), body[:len(body)/2]...)
+	case BodyTruncated, BodyStall:
+		// Promise the whole body, then send only half of it.
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		body = body[:len(body)/2]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := s.write(ctx, w, body); err != nil {
+		return err
+	}
+
+	switch s.Body {
+	case BodyStall:
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	case BodyTruncated:
+		// Returning with less than Content-Length written makes the server
+		// close the connection.
+		return nil
+	}
+	return nil
+}
+
+// write sends body in ChunkSize pieces, flushing and waiting ChunkDelay
+// between them.
+func (s *Scenario) write(ctx context.Context, w http.ResponseWriter, body []byte) error {
+	if s.ChunkSize <= 0 {
+		_, err := w.Write(body)
+		return err
+	}
+	flusher, _ := w.(http.Flusher)
+	for len(body) > 0 {
+		n := min(s.ChunkSize, len(body))
+		if _, err := w.Write(body[:n]); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		body = body[n:]
+		if len(body) > 0 && !sleep(ctx, s.ChunkDelay) {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// resetConnection drops the connection with a TCP reset.
+func resetConnection(w http.ResponseWriter) error {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return fmt.Errorf("connection cannot be hijacked")
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		return fmt.Errorf("failed to hijack connection: %w", err)
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	slog.Info("Resetting connection", "remote_addr", conn.RemoteAddr())
+	return conn.Close()
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
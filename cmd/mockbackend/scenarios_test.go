@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadScenarios(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		// wantErr, when set, is part of the error loadScenarios must return.
+		wantErr string
+	}{
+		{name: "override and add", content: "fast:\n  latency: 1s\nflaky-gateway:\n  failures: {status: 502, count: 3, every: 10}\nempty:\n"},
+		{name: "unknown body", content: "odd:\n  body: garbled\n", wantErr: `scenario "odd": unknown body "garbled"`},
+		{name: "tail probability", content: "odd:\n  tail_probability: 2\n", wantErr: "tail_probability must be between 0 and 1"},
+		{name: "success status", content: "odd:\n  failures: {status: 200, count: 1}\n", wantErr: "failures.status must be an HTTP error status"},
+		{name: "invalid YAML", content: "odd: [\n", wantErr: "failed to parse scenario file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "_")+".yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			scenarios, err := loadScenarios(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("loadScenarios = %v, want an error about %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if scenarios["fast"].Latency != time.Second {
+				t.Errorf("fast latency = %s, want the file to replace the built-in", scenarios["fast"].Latency)
+			}
+			if f := scenarios["flaky-gateway"].Failures; f == nil || f.Status != 502 || f.Count != 3 || f.Every != 10 {
+				t.Errorf("flaky-gateway failures = %+v", f)
+			}
+			if scenarios["empty"] == nil || scenarios["slow"] == nil {
+				t.Errorf("scenarios = %v, want the empty one and the built-ins", scenarioNames(scenarios))
+			}
+		})
+	}
+
+	if _, err := loadScenarios(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("loadScenarios accepted a missing file")
+	}
+}
+
+func TestSelectScenario(t *testing.T) {
+	scenarios := builtinScenarios()
+	tests := []struct {
+		name   string
+		header string
+		query  string
+		want   string
+		// wantErr is set when the selected scenario does not exist.
+		wantErr bool
+	}{
+		{name: "default", query: "hello", want: "fast"},
+		{name: "tag", query: "hello #scenario:long-tail please", want: "long-tail"},
+		{name: "header over tag", header: "down", query: "hello #scenario:slow", want: "down"},
+		{name: "unknown", header: "sideways", want: "sideways", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v1/chat/stream", nil)
+			if tt.header != "" {
+				r.Header.Set(ScenarioHeader, tt.header)
+			}
+			name, s, err := selectScenario(r, tt.query, scenarios, "fast")
+			if name != tt.want || (err != nil) != tt.wantErr || (s == nil) != tt.wantErr {
+				t.Errorf("selectScenario = %q, %v, %v, want %q", name, s, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailurePattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures *Failures
+		want     string
+	}{
+		{name: "none", want: "........"},
+		{name: "every", failures: &Failures{Status: 503, Count: 2, Every: 5}, want: "xx...xx."},
+		{name: "first only", failures: &Failures{Status: 503, Count: 3}, want: "xxx....."},
+		{name: "always", failures: &Failures{Status: 500, Count: 1, Every: 1}, want: "xxxxxxxx"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scenario{Failures: tt.failures}
+			var got strings.Builder
+			for range len(tt.want) {
+				if s.failure() != nil {
+					got.WriteByte('x')
+				} else {
+					got.WriteByte('.')
+				}
+			}
+			if got.String() != tt.want {
+				t.Errorf("failures = %s, want %s", got.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestDelay(t *testing.T) {
+	s := &Scenario{Latency: 100 * time.Millisecond, Jitter: 50 * time.Millisecond}
+	for range 100 {
+		if d := s.delay(); d < 100*time.Millisecond || d >= 150*time.Millisecond {
+			t.Fatalf("delay = %s, want between 100ms and 150ms", d)
+		}
+	}
+	s = &Scenario{TailLatency: time.Second, TailProbability: 1}
+	if d := s.delay(); d != time.Second {
+		t.Errorf("delay = %s, want the tail latency", d)
+	}
+}
+
+func TestRespond(t *testing.T) {
+	const body = `{"full_response":"Hello there, this is the mock answer."}`
+	tests := []struct {
+		name     string
+		scenario *Scenario
+		// wantStatus is 0 when the request must fail without a response.
+		wantStatus int
+		wantBody   string
+		// wantReadErr is set when reading the body must fail.
+		wantReadErr bool
+		wantHeader  string
+	}{
+		{name: "ok", scenario: &Scenario{}, wantStatus: http.StatusOK, wantBody: body},
+		{name: "chunked", scenario: &Scenario{ChunkSize: 7, ChunkDelay: time.Millisecond}, wantStatus: http.StatusOK, wantBody: body},
+		{
+			name:       "throttled",
+			scenario:   &Scenario{Failures: &Failures{Status: http.StatusTooManyRequests, Count: 1, RetryAfter: 2 * time.Second}},
+			wantStatus: http.StatusTooManyRequests, wantBody: "mock failure: Too Many Requests\n", wantHeader: "2",
+		},
+		{name: "malformed", scenario: &Scenario{Body: BodyMalformed}, wantStatus: http.StatusOK, wantBody: `{"full_response": ` + body[:len(body)/2]},
+		{name: "truncated", scenario: &Scenario{Body: BodyTruncated}, wantStatus: http.StatusOK, wantReadErr: true},
+		{name: "stall", scenario: &Scenario{Body: BodyStall}, wantStatus: http.StatusOK, wantReadErr: true},
+		{name: "reset", scenario: &Scenario{Body: BodyReset}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tt.scenario.respond(r.Context(), w, []byte(body), 0)
+			}))
+			defer server.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, nil)
+			resp, err := http.DefaultClient.Do(req)
+			if tt.wantStatus == 0 {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("request succeeded with %s, want the connection reset", resp.Status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := resp.Header.Get("Retry-After"); got != tt.wantHeader {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantHeader)
+			}
+			got, err := io.ReadAll(resp.Body)
+			if tt.wantReadErr {
+				if err == nil || json.Valid(got) {
+					t.Errorf("read %q, %v, want part of the body and an error", got, err)
+				}
+				return
+			}
+			if err != nil || string(got) != tt.wantBody {
+				t.Errorf("body = %q, %v, want %q", got, err, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package access
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"chatrelay-bot/internal/adapter"
+	"chatrelay-bot/internal/telemetry"
+	"chatrelay-bot/pkg/models"
+)
+
+const tracerName = "chatrelay/internal/access"
+
+// Denial reasons, recorded in the audit log and on the access denied metric.
+const (
+	ReasonDeniedUser        = "denied_user"
+	ReasonDeniedChannel     = "denied_channel"
+	ReasonDeniedUserGroup   = "denied_usergroup"
+	ReasonUserNotAllowed    = "user_not_allowed"
+	ReasonChannelNotAllowed = "channel_not_allowed"
+	ReasonLookupFailed      = "usergroup_lookup_failed"
+)
+
+type policy struct {
+	allowUsers      []string
+	denyUsers       []string
+	allowChannels   []string
+	denyChannels    []string
+	allowUserGroups []string
+	denyUserGroups  []string
+	cacheTTL        time.Duration
+	deniedMessage   string
+}
+
+type groupMembers struct {
+	members   map[string]bool
+	fetchedAt time.Time
+}
+
+// Guard authorizes app mentions against the configured allow and deny lists
+// before passing them on to the next handler.
+//
+// Deny lists always win. When any user or user group allowlist is set, the
+// user must be on one of them; when a channel allowlist is set, the channel
+// must be on it. On platforms without a directory, user group denylists
+// deny no one and user group allowlists admit no one.
+type Guard struct {
+	next      adapter.Handler
+	messenger adapter.Messenger
+	directory adapter.Directory
+	policy    atomic.Pointer[policy]
+
+	mu     sync.Mutex
+	groups map[string]groupMembers
+}
+
+func NewGuard(next adapter.Handler, cfg *models.AppConfig) *Guard {
+	g := &Guard{
+		next:   next,
+		groups: make(map[string]groupMembers),
+	}
+	g.ApplyConfig(cfg)
+	return g
+}
+
+// SetMessenger sets where access denied notices are sent.
+func (g *Guard) SetMessenger(m adapter.Messenger) {
+	g.messenger = m
+}
+
+// SetDirectory sets where user group members are looked up. Without one,
+// no user is a member of any user group.
+func (g *Guard) SetDirectory(d adapter.Directory) {
+	g.directory = d
+}
+
+// ApplyConfig replaces the access lists from a (re)loaded configuration.
+func (g *Guard) ApplyConfig(cfg *models.AppConfig) {
+	g.policy.Store(&policy{
+		allowUsers:      cfg.AccessAllowUsers,
+		denyUsers:       cfg.AccessDenyUsers,
+		allowChannels:   cfg.AccessAllowChannels,
+		denyChannels:    cfg.AccessDenyChannels,
+		allowUserGroups: cfg.AccessAllowUserGroups,
+		denyUserGroups:  cfg.AccessDenyUserGroups,
+		cacheTTL:        cfg.AccessUserGroupCacheTTL,
+		deniedMessage:   cfg.AccessDeniedMessage,
+	})
+}
+
+func (g *Guard) HandleMessage(ctx context.Context, msg models.IncomingMessage, settings models.ChannelSettings) error {
+	tracer := otel.Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, "AuthorizeAppMention",
+		trace.WithAttributes(
+			attribute.String("chat.conversation", msg.Conversation),
+			attribute.String("chat.user", msg.Author.ID),
+		),
+	)
+
+	reason, detail := g.authorize(ctx, msg)
+	if reason == "" {
+		span.SetAttributes(attribute.Bool("access.allowed", true))
+		span.End()
+		return g.next.HandleMessage(ctx, msg, settings)
+	}
+	defer span.End()
+
+	span.SetAttributes(attribute.Bool("access.allowed", false), attribute.String("access.reason", reason))
+	span.SetStatus(codes.Ok, "Access denied")
+	telemetry.RecordAccessDenied(ctx, reason)
+	slog.WarnContext(ctx, "Access denied",
+		"audit", true,
+		"reason", reason,
+		"detail", detail,
+		"user", msg.Author.ID,
+		"channel", msg.Conversation,
+		"platform", msg.Platform,
+		"team", msg.Workspace,
+		"event_ts", msg.ID,
+	)
+
+	if g.messenger == nil {
+		return nil
+	}
+	if err := g.messenger.Notify(ctx, msg.Conversation, msg.Author.ID, g.policy.Load().deniedMessage); err != nil {
+		slog.ErrorContext(ctx, "Failed to send access denied message", "error", err, "user", msg.Author.ID, "channel", msg.Conversation)
+		span.RecordError(err)
+	}
+	return nil
+}
+
+// authorize returns an empty reason when the event is allowed, or the
+// denial reason and the list entry that caused it.
+func (g *Guard) authorize(ctx context.Context, msg models.IncomingMessage) (reason, detail string) {
+	p := g.policy.Load()
+	// Without a directory no one can be a member of a user group, so user
+	// group denylists deny no one and user group allowlists admit no one.
+	denyGroups := p.denyUserGroups
+	if g.directory == nil {
+		denyGroups = nil
+	}
+
+	if slices.Contains(p.denyUsers, msg.Author.ID) {
+		return ReasonDeniedUser, msg.Author.ID
+	}
+	if slices.Contains(p.denyChannels, msg.Conversation) {
+		return ReasonDeniedChannel, msg.Conversation
+	}
+	for _, group := range denyGroups {
+		member, err := g.isMember(ctx, p, group, msg.Author.ID)
+		if err != nil {
+			return ReasonLookupFailed, err.Error()
+		}
+		if member {
+			return ReasonDeniedUserGroup, group
+		}
+	}
+
+	if len(p.allowChannels) > 0 && !slices.Contains(p.allowChannels, msg.Conversation) {
+		return ReasonChannelNotAllowed, msg.Conversation
+	}
+	if len(p.allowUsers) == 0 && len(p.allowUserGroups) == 0 {
+		return "", ""
+	}
+	if slices.Contains(p.allowUsers, msg.Author.ID) {
+		return "", ""
+	}
+	if g.directory == nil {
+		return ReasonUserNotAllowed, msg.Author.ID
+	}
+	var lookupErr error
+	for _, group := range p.allowUserGroups {
+		member, err := g.isMember(ctx, p, group, msg.Author.ID)
+		if err != nil {
+			lookupErr = err
+			continue
+		}
+		if member {
+			return "", ""
+		}
+	}
+	if lookupErr != nil {
+		return ReasonLookupFailed, lookupErr.Error()
+	}
+	return ReasonUserNotAllowed, msg.Author.ID
+}
+
+// isMember reports whether userID belongs to the user group, using the
+// cached member list while it is younger than the configured TTL. Lookup
+// failures fail closed.
+func (g *Guard) isMember(ctx context.Context, p *policy, groupID, userID string) (bool, error) {
+	g.mu.Lock()
+	cached, ok := g.groups[groupID]
+	g.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < p.cacheTTL {
+		return cached.members[userID], nil
+	}
+
+	members, err := g.directory.UserGroupMembers(ctx, groupID)
+	if err != nil {
+		if ok {
+			slog.WarnContext(ctx, "Using stale user group members after lookup failure", "usergroup", groupID, "error", err)
+			return cached.members[userID], nil
+		}
+		return false, err
+	}
+
+	set := make(map[string]bool, len(members))
+	for _, m := range members {
+		set[m] = true
+	}
+	g.mu.Lock()
+	g.groups[groupID] = groupMembers{members: set, fetchedAt: time.Now()}
+	g.mu.Unlock()
+	return set[userID], nil
+}
@@ -0,0 +1,140 @@
+package access
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"chatrelay-bot/internal/slack/slacktest"
+	"chatrelay-bot/pkg/models"
+)
+
+// recorder is the next handler, counting the mentions it is passed.
+type recorder struct {
+	calls int
+}
+
+func (r *recorder) HandleMessage(ctx context.Context, msg models.IncomingMessage, settings models.ChannelSettings) error {
+	r.calls++
+	return nil
+}
+
+func TestGuardAuthorize(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         models.AppConfig
+		noDirectory bool
+		user        string
+		channel     string
+		wantReason  string
+	}{
+		{
+			name: "no lists", user: "U1", channel: "C1",
+		},
+		{
+			name: "denied user", cfg: models.AppConfig{AccessDenyUsers: []string{"U1"}, AccessAllowUsers: []string{"U1"}},
+			user: "U1", channel: "C1", wantReason: ReasonDeniedUser,
+		},
+		{
+			name: "denied channel", cfg: models.AppConfig{AccessDenyChannels: []string{"C1"}},
+			user: "U1", channel: "C1", wantReason: ReasonDeniedChannel,
+		},
+		{
+			name: "channel not allowed", cfg: models.AppConfig{AccessAllowChannels: []string{"C2"}},
+			user: "U1", channel: "C1", wantReason: ReasonChannelNotAllowed,
+		},
+		{
+			name: "user not allowed", cfg: models.AppConfig{AccessAllowUsers: []string{"U2"}},
+			user: "U1", channel: "C1", wantReason: ReasonUserNotAllowed,
+		},
+		{
+			name: "allowed user", cfg: models.AppConfig{AccessAllowUsers: []string{"U1"}},
+			user: "U1", channel: "C1",
+		},
+		{
+			name: "denied user group member", cfg: models.AppConfig{AccessDenyUserGroups: []string{"S1"}},
+			user: "U1", channel: "C1", wantReason: ReasonDeniedUserGroup,
+		},
+		{
+			name: "not in denied user group", cfg: models.AppConfig{AccessDenyUserGroups: []string{"S1"}},
+			user: "U3", channel: "C1",
+		},
+		{
+			name: "allowed user group member", cfg: models.AppConfig{AccessAllowUserGroups: []string{"S1"}},
+			user: "U1", channel: "C1",
+		},
+		{
+			name: "not in allowed user group", cfg: models.AppConfig{AccessAllowUserGroups: []string{"S1"}},
+			user: "U3", channel: "C1", wantReason: ReasonUserNotAllowed,
+		},
+		{
+			name: "unknown user group", cfg: models.AppConfig{AccessAllowUserGroups: []string{"S9"}},
+			user: "U1", channel: "C1", wantReason: ReasonLookupFailed,
+		},
+		{
+			name: "denied user group without a directory", cfg: models.AppConfig{AccessDenyUserGroups: []string{"S1"}},
+			noDirectory: true, user: "U1", channel: "C1",
+		},
+		{
+			name: "allowed user group without a directory", cfg: models.AppConfig{AccessAllowUserGroups: []string{"S1"}},
+			noDirectory: true, user: "U1", channel: "C1", wantReason: ReasonUserNotAllowed,
+		},
+		{
+			name:        "allowed user without a directory",
+			cfg:         models.AppConfig{AccessAllowUserGroups: []string{"S1"}, AccessAllowUsers: []string{"U3"}},
+			noDirectory: true, user: "U3", channel: "C1",
+		},
+		{
+			name:        "user allowlist still applies without a directory",
+			cfg:         models.AppConfig{AccessAllowUserGroups: []string{"S1"}, AccessAllowUsers: []string{"U2"}},
+			noDirectory: true, user: "U3", channel: "C1", wantReason: ReasonUserNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.AccessUserGroupCacheTTL = time.Minute
+			tt.cfg.AccessDeniedMessage = "no"
+			m := slacktest.NewMessenger()
+			m.SetUserGroup("S1", "U1", "U2")
+			next := &recorder{}
+			g := NewGuard(next, &tt.cfg)
+			g.SetMessenger(m)
+			if !tt.noDirectory {
+				g.SetDirectory(m)
+			}
+
+			msg := models.IncomingMessage{Platform: "test", Conversation: tt.channel, Author: models.Author{ID: tt.user}}
+			if err := g.HandleMessage(context.Background(), msg, models.ChannelSettings{}); err != nil {
+				t.Fatal(err)
+			}
+			if reason, _ := g.authorize(context.Background(), msg); reason != tt.wantReason {
+				t.Errorf("reason = %q, want %q", reason, tt.wantReason)
+			}
+			allowed := tt.wantReason == ""
+			if allowed != (next.calls == 1) {
+				t.Errorf("next handler called %d times, allowed = %v", next.calls, allowed)
+			}
+			if notices := len(m.Ephemerals()); allowed != (notices == 0) {
+				t.Errorf("sent %d denied notices, allowed = %v", notices, allowed)
+			}
+		})
+	}
+}
+
+func TestGuardUsesStaleMembersOnLookupFailure(t *testing.T) {
+	m := slacktest.NewMessenger()
+	m.SetUserGroup("S1", "U1")
+	g := NewGuard(&recorder{}, &models.AppConfig{AccessAllowUserGroups: []string{"S1"}})
+	g.SetDirectory(m)
+	msg := models.IncomingMessage{Conversation: "C1", Author: models.Author{ID: "U1"}}
+
+	// A zero TTL makes every check look the group up again.
+	if reason, _ := g.authorize(context.Background(), msg); reason != "" {
+		t.Fatalf("first check denied with %q", reason)
+	}
+	m.FailNext("UserGroupMembers", errors.New("ratelimited"))
+	if reason, _ := g.authorize(context.Background(), msg); reason != "" {
+		t.Errorf("check after a lookup failure denied with %q, want the cached members used", reason)
+	}
+}
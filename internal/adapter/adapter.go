@@ -0,0 +1,75 @@
+// Package adapter defines how the bot core talks to chat platforms. An
+// adapter turns a platform's events into models.IncomingMessage for a
+// Handler and posts the bot's models.OutgoingMessage replies, so the same
+// bot, access control and rate limiting serve every platform.
+package adapter
+
+import (
+	"context"
+	"time"
+
+	"chatrelay-bot/pkg/models"
+)
+
+// RetryAction is the action ID of the Retry button on recovered replies.
+const RetryAction = "chatrelay_retry"
+
+// Handler handles messages addressed to the bot.
+type Handler interface {
+	HandleMessage(ctx context.Context, msg models.IncomingMessage, settings models.ChannelSettings) error
+}
+
+// Messenger posts and edits the bot's messages. Post returns the ID of the
+// new message, which Update and Delete take.
+type Messenger interface {
+	Post(ctx context.Context, msg models.OutgoingMessage) (string, error)
+	Update(ctx context.Context, id string, msg models.OutgoingMessage) error
+	Delete(ctx context.Context, conversation, id string) error
+	// Notify shows text to a single user in a conversation, where the
+	// platform allows, or to them privately otherwise.
+	Notify(ctx context.Context, conversation, userID, text string) error
+}
+
+// Formatter is implemented by Messengers whose platform has markup for
+// mentioning a user or showing a time in the reader's own time zone. Notices
+// on other platforms use the user's name and UTC.
+type Formatter interface {
+	// Mention returns the markup that shows user as a mention.
+	Mention(user models.Author) string
+	// Time returns when t is as a phrase such as "at 15:04" or
+	// "on Jan 2 at 15:04", for the end of a sentence.
+	Time(t time.Time) string
+}
+
+// Adapter connects the bot to one chat platform.
+type Adapter interface {
+	Messenger
+	Name() string
+	// Run delivers incoming messages to the adapter's Handler until ctx is
+	// done.
+	Run(ctx context.Context) error
+}
+
+// ChangeHandler is told when a message addressed to the bot is edited or
+// deleted, so that an answer still in progress can be restarted or
+// cancelled.
+type ChangeHandler interface {
+	HandleMessageEdited(ctx context.Context, msg models.IncomingMessage)
+	HandleMessageDeleted(ctx context.Context, conversation, id string)
+}
+
+// RetryHandler handles presses of the RetryAction button on a message.
+type RetryHandler interface {
+	HandleRetry(ctx context.Context, conversation, messageID, userID, value string) error
+}
+
+// Directory looks up the members of a platform's user groups, for access
+// rules on user groups.
+type Directory interface {
+	UserGroupMembers(ctx context.Context, groupID string) ([]string, error)
+}
+
+// SettingsResolver resolves the per-conversation behaviour for a message.
+type SettingsResolver interface {
+	Resolve(workspace, conversation string) models.ChannelSettings
+}
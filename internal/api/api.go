@@ -0,0 +1,207 @@
+// Package api is the HTTP API adapter, for internal tools rather than chat
+// users. POST /v1/ask takes a question with a bearer API key and answers
+// it through the same access control, rate limiting and bot as the chat
+// platforms, as a synthetic user named after the key. The answer comes
+// back as one JSON object or, when the client accepts text/event-stream,
+// as server-sent events while it streams.
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"chatrelay-bot/internal/adapter"
+	"chatrelay-bot/pkg/models"
+)
+
+const (
+	tracerName   = "chatrelay/internal/api"
+	platformName = "api"
+	// AskPath is where ServeHTTP is mounted on the bot's HTTP server.
+	AskPath = "/v1/ask"
+	// DefaultConversation is the conversation of questions that name none.
+	// Access lists and channel overrides can refer to it, or to the
+	// conversations clients name.
+	DefaultConversation = "api"
+	// maxBody bounds the size of a request.
+	maxBody = 64 << 10
+)
+
+// defaultSettings are used for questions when no SettingsResolver is set.
+var defaultSettings = models.ChannelSettings{
+	Enabled:   true,
+	Streaming: true,
+}
+
+// request is the body of POST /v1/ask.
+type request struct {
+	Query        string `json:"query"`
+	Conversation string `json:"conversation,omitempty"`
+}
+
+// response is the JSON answer, and the data of the final "done" event.
+type response struct {
+	ID           string `json:"id"`
+	Conversation string `json:"conversation"`
+	Answer       string `json:"answer"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type Server struct {
+	keys     atomic.Pointer[map[string]string] // API key -> client name
+	handler  adapter.Handler
+	resolver adapter.SettingsResolver
+}
+
+var (
+	_ adapter.Adapter = (*Server)(nil)
+	_ http.Handler    = (*Server)(nil)
+)
+
+// NewServer creates the API adapter, passing questions to handler. keys
+// maps each API key to the name of the client it belongs to; see
+// config.ParseAPIKeys.
+func NewServer(keys map[string]string, handler adapter.Handler) *Server {
+	s := &Server{handler: handler}
+	s.SetKeys(keys)
+	return s
+}
+
+// SetKeys replaces the API keys, e.g. after they rotate. Requests already
+// admitted carry on.
+func (s *Server) SetKeys(keys map[string]string) {
+	s.keys.Store(&keys)
+}
+
+func (s *Server) SetSettingsResolver(r adapter.SettingsResolver) {
+	s.resolver = r
+}
+
+func (s *Server) Name() string {
+	return platformName
+}
+
+// Run waits for ctx to be done. Questions arrive through ServeHTTP on the
+// bot's HTTP server.
+func (s *Server) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// client returns the name of the client whose API key r carries.
+func (s *Server) client(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", false
+	}
+	for key, name := range *s.keys.Load() {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// ServeHTTP answers POST /v1/ask. The answer is relayed while the request
+// is open, so a client that goes away cancels it.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	client, ok := s.client(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="chatrelay"`)
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "missing or invalid API key"})
+		return
+	}
+	var req request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid JSON payload"})
+		return
+	}
+	req.Query = strings.TrimSpace(req.Query)
+	if req.Query == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "query is required"})
+		return
+	}
+	if req.Conversation == "" {
+		req.Conversation = DefaultConversation
+	}
+
+	msg := models.IncomingMessage{
+		Platform:     platformName,
+		ID:           newID(),
+		Workspace:    platformName,
+		Conversation: req.Conversation,
+		Author:       models.Author{ID: platformName + ":" + client, Name: client},
+		Text:         req.Query,
+	}
+	settings := defaultSettings
+	if s.resolver != nil {
+		settings = s.resolver.Resolve(msg.Workspace, msg.Conversation)
+	}
+	// A placeholder and footer are for chat readers; API clients get the
+	// answer alone.
+	settings.Placeholder = ""
+	settings.Footer = ""
+
+	tracer := otel.Tracer(tracerName)
+	ctx, span := tracer.Start(r.Context(), "HandleAPIQuestion",
+		trace.WithAttributes(
+			attribute.String("api.client", client),
+			attribute.String("api.conversation", msg.Conversation),
+			attribute.String("api.request_id", msg.ID),
+		),
+	)
+	defer span.End()
+
+	sk := newSink(w, r, msg)
+	settings.Streaming = sk.stream
+	slog.InfoContext(ctx, "Received API question", "client", client, "conversation", msg.Conversation, "id", msg.ID, "stream", sk.stream)
+	err := s.handler.HandleMessage(withSink(ctx, sk), msg, settings)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error handling API question", "error", err, "client", client, "id", msg.ID)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Error handling question")
+	} else {
+		span.SetStatus(codes.Ok, "Question handled")
+	}
+	sk.finish(err)
+}
+
+// AnswerCompleted records the answer to a question asked through
+// ServeHTTP, which is how ServeHTTP tells an answer from an interrupted
+// one. Answers to other questions are ignored.
+func (s *Server) AnswerCompleted(ctx context.Context, answer models.CompletedAnswer) {
+	if sk := sinkFrom(ctx); sk != nil {
+		sk.complete(answer.Answer)
+	}
+}
+
+func newID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,322 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chatrelay-bot/pkg/models"
+)
+
+// answerer stands in for the pipeline behind the server. It replies through
+// the server the way the bot does: a post, updates as the answer streams,
+// then the completed answer.
+type answerer struct {
+	server *Server
+	// replies are the texts of the reply as it streams; the last is the
+	// answer.
+	replies []string
+	// interrupt stops before the answer completes.
+	interrupt bool
+	// refuse, when set, turns the question away with a notice instead.
+	refuse string
+	err    error
+
+	msg      models.IncomingMessage
+	settings models.ChannelSettings
+}
+
+func (a *answerer) HandleMessage(ctx context.Context, msg models.IncomingMessage, settings models.ChannelSettings) error {
+	a.msg, a.settings = msg, settings
+	if a.refuse != "" {
+		return a.server.WithNotifyStatus(http.StatusTooManyRequests).Notify(ctx, msg.Conversation, msg.Author.ID, a.refuse)
+	}
+	if len(a.replies) == 0 {
+		return a.err
+	}
+	id, err := a.server.Post(ctx, models.OutgoingMessage{Conversation: msg.Conversation, Text: a.replies[0]})
+	if err != nil {
+		return err
+	}
+	for _, text := range a.replies[1:] {
+		if err := a.server.Update(ctx, id, models.OutgoingMessage{Conversation: msg.Conversation, Text: text}); err != nil {
+			return err
+		}
+	}
+	if a.err != nil || a.interrupt {
+		return a.err
+	}
+	a.server.AnswerCompleted(ctx, models.CompletedAnswer{Message: msg, ReplyID: id, Answer: a.replies[len(a.replies)-1]})
+	return nil
+}
+
+func newTestServer(a *answerer) *Server {
+	s := NewServer(map[string]string{"key-1": "reports", "key-2": "search"}, a)
+	a.server = s
+	return s
+}
+
+func ask(s *Server, key, accept, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, AskPath, strings.NewReader(body))
+	if key != "" {
+		r.Header.Set("Authorization", "Bearer "+key)
+	}
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestAskAuthentication(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{name: "no key", want: http.StatusUnauthorized},
+		{name: "unknown key", header: "Bearer key-3", want: http.StatusUnauthorized},
+		{name: "key prefix", header: "Bearer key-", want: http.StatusUnauthorized},
+		{name: "not a bearer token", header: "Basic key-1", want: http.StatusUnauthorized},
+		{name: "valid key", header: "Bearer key-2", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &answerer{replies: []string{"hi"}}
+			s := newTestServer(a)
+			r := httptest.NewRequest(http.MethodPost, AskPath, strings.NewReader(`{"query":"hello"}`))
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+			if w.Code == http.StatusOK && a.msg.Author != (models.Author{ID: "api:search", Name: "search"}) {
+				t.Errorf("asked as %+v, want the key's client", a.msg.Author)
+			}
+		})
+	}
+}
+
+func TestAskJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		answerer  answerer
+		body      string
+		want      int
+		wantError string
+	}{
+		{
+			name:     "answer",
+			answerer: answerer{replies: []string{"", "Chat", "ChatRelay relays chats."}},
+			body:     `{"query":"  what is ChatRelay?  ","conversation":"docs"}`,
+			want:     http.StatusOK,
+		},
+		{name: "invalid JSON", body: `{"query":`, want: http.StatusBadRequest, wantError: "invalid JSON payload"},
+		{name: "no query", body: `{"query":"   "}`, want: http.StatusBadRequest, wantError: "query is required"},
+		{
+			name:     "refused",
+			answerer: answerer{refuse: "You've reached your daily ChatRelay quota."},
+			body:     `{"query":"hello"}`, want: http.StatusTooManyRequests, wantError: "You've reached your daily ChatRelay quota.",
+		},
+		{
+			name: "disabled conversation",
+			body: `{"query":"hello"}`,
+			want: http.StatusForbidden, wantError: "ChatRelay is disabled for this conversation",
+		},
+		{
+			name:     "backend error",
+			answerer: answerer{replies: []string{"Thinking"}, err: errors.New("dial tcp 10.0.0.1:8080: connection refused")},
+			body:     `{"query":"hello"}`, want: http.StatusBadGateway, wantError: "the chat backend failed to answer",
+		},
+		{
+			name:     "interrupted",
+			answerer: answerer{replies: []string{"Chat"}, interrupt: true},
+			body:     `{"query":"hello"}`, want: http.StatusServiceUnavailable, wantError: "the answer was interrupted, please retry",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &tt.answerer
+			w := ask(newTestServer(a), "key-1", "", tt.body)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			if tt.wantError != "" {
+				var res errorResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Error != tt.wantError {
+					t.Errorf("body = %s, want error %q", w.Body, tt.wantError)
+				}
+				return
+			}
+
+			var res response
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Answer != "ChatRelay relays chats." || res.Conversation != "docs" || res.ID != a.msg.ID {
+				t.Errorf("response = %+v", res)
+			}
+			if a.msg.Text != "what is ChatRelay?" {
+				t.Errorf("query = %q, want it trimmed", a.msg.Text)
+			}
+			if a.settings.Streaming || a.settings.Placeholder != "" || a.settings.Footer != "" {
+				t.Errorf("settings = %+v, want no streaming, placeholder or footer", a.settings)
+			}
+		})
+	}
+}
+
+func TestAskDefaultConversation(t *testing.T) {
+	a := &answerer{replies: []string{"hi"}}
+	ask(newTestServer(a), "key-1", "", `{"query":"hello"}`)
+	if a.msg.Conversation != DefaultConversation {
+		t.Errorf("conversation = %q, want %q", a.msg.Conversation, DefaultConversation)
+	}
+}
+
+func TestAskMethodNotAllowed(t *testing.T) {
+	w := httptest.NewRecorder()
+	newTestServer(&answerer{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, AskPath, nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+// event is a server-sent event.
+type event struct {
+	name string
+	data string
+}
+
+func events(t *testing.T, body string) []event {
+	t.Helper()
+	var out []event
+	for _, block := range strings.Split(strings.TrimSuffix(body, "\n\n"), "\n\n") {
+		name, data, ok := strings.Cut(block, "\n")
+		if !ok || !strings.HasPrefix(name, "event: ") || !strings.HasPrefix(data, "data: ") {
+			t.Fatalf("malformed event %q", block)
+		}
+		out = append(out, event{name: strings.TrimPrefix(name, "event: "), data: strings.TrimPrefix(data, "data: ")})
+	}
+	return out
+}
+
+func TestAskStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		answerer answerer
+		want     int
+		// wantEvents are the expected events; a done event's data is
+		// checked separately.
+		wantEvents []event
+	}{
+		{
+			name:     "answer",
+			answerer: answerer{replies: []string{"", "Chat", "ChatRelay relays chats."}},
+			want:     http.StatusOK,
+			wantEvents: []event{
+				{"update", `{"text":"Chat"}`},
+				{"update", `{"text":"ChatRelay relays chats."}`},
+				{"done", ""},
+			},
+		},
+		{
+			name:     "error after the stream started",
+			answerer: answerer{replies: []string{"Chat"}, err: errors.New("backend went away")},
+			want:     http.StatusOK,
+			wantEvents: []event{
+				{"update", `{"text":"Chat"}`},
+				{"error", `{"error":"the chat backend failed to answer","status":502}`},
+			},
+		},
+		{
+			name:     "refused before the stream started",
+			answerer: answerer{refuse: "Slow down."},
+			want:     http.StatusTooManyRequests,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &tt.answerer
+			w := ask(newTestServer(a), "key-1", "application/json, text/event-stream", `{"query":"hello"}`)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.wantEvents == nil {
+				if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+					t.Errorf("Content-Type = %q, want a JSON error", ct)
+				}
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			if !a.settings.Streaming {
+				t.Error("streaming is off for a client that accepts events")
+			}
+			got := events(t, w.Body.String())
+			if len(got) != len(tt.wantEvents) {
+				t.Fatalf("events = %q, want %q", got, tt.wantEvents)
+			}
+			for i, ev := range got {
+				want := tt.wantEvents[i]
+				if ev.name != want.name || (want.data != "" && ev.data != want.data) {
+					t.Errorf("event %d = %q, want %q", i, ev, want)
+				}
+				if ev.name != "done" {
+					continue
+				}
+				var res response
+				if err := json.Unmarshal([]byte(ev.data), &res); err != nil {
+					t.Fatal(err)
+				}
+				if res.Answer != "ChatRelay relays chats." || res.ID != a.msg.ID || res.Conversation != DefaultConversation {
+					t.Errorf("done = %+v", res)
+				}
+			}
+		})
+	}
+}
+
+func TestRepliesAfterTheRequestEnded(t *testing.T) {
+	a := &answerer{replies: []string{"hi"}}
+	s := newTestServer(a)
+	ask(s, "key-1", "", `{"query":"hello"}`)
+
+	// Replies outside a request, such as those recovered after a restart,
+	// have nowhere to go.
+	ctx := context.Background()
+	if _, err := s.Post(ctx, models.OutgoingMessage{Text: "late"}); !errors.Is(err, errRequestEnded) {
+		t.Errorf("Post = %v, want %v", err, errRequestEnded)
+	}
+	if err := s.Update(ctx, a.msg.ID, models.OutgoingMessage{Text: "late"}); !errors.Is(err, errRequestEnded) {
+		t.Errorf("Update = %v, want %v", err, errRequestEnded)
+	}
+}
+
+func TestSetKeys(t *testing.T) {
+	a := &answerer{replies: []string{"hi"}}
+	s := newTestServer(a)
+	s.SetKeys(map[string]string{"key-3": "reports"})
+
+	if w := ask(s, "key-1", "", `{"query":"hello"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("rotated out key: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := ask(s, "key-3", "", `{"query":"hello"}`); w.Code != http.StatusOK {
+		t.Errorf("rotated in key: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"chatrelay-bot/internal/adapter"
+	"chatrelay-bot/pkg/models"
+)
+
+// errRequestEnded is returned for replies to a question whose request has
+// already been answered, such as those recovered after a restart.
+var errRequestEnded = errors.New("the API request for this answer has ended")
+
+type sinkKey struct{}
+
+// sink collects the bot's replies to one question and writes them to its
+// HTTP response. With stream set, every reply is sent as an "update" event
+// as it arrives; otherwise only the final answer is written.
+type sink struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	stream  bool
+	msg     models.IncomingMessage
+
+	mu      sync.Mutex
+	started bool // the event stream's headers have been written
+	done    bool
+	replied bool
+	answer  *string
+	notice  string
+	status  int
+}
+
+func newSink(w http.ResponseWriter, r *http.Request, msg models.IncomingMessage) *sink {
+	flusher, ok := w.(http.Flusher)
+	return &sink{
+		w:       w,
+		flusher: flusher,
+		stream:  ok && strings.Contains(r.Header.Get("Accept"), "text/event-stream"),
+		msg:     msg,
+	}
+}
+
+func withSink(ctx context.Context, sk *sink) context.Context {
+	return context.WithValue(ctx, sinkKey{}, sk)
+}
+
+func sinkFrom(ctx context.Context) *sink {
+	sk, _ := ctx.Value(sinkKey{}).(*sink)
+	return sk
+}
+
+func (sk *sink) update(text string) error {
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+	if sk.done {
+		return errRequestEnded
+	}
+	if text == "" {
+		return nil
+	}
+	sk.replied = true
+	if sk.stream {
+		return sk.event("update", map[string]string{"text": text})
+	}
+	return nil
+}
+
+func (sk *sink) notify(text string, status int) {
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+	if sk.notice == "" {
+		sk.notice, sk.status = text, status
+	}
+}
+
+func (sk *sink) complete(answer string) {
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+	sk.answer = &answer
+}
+
+// finish writes the outcome of the question, once the bot has returned
+// err for it.
+func (sk *sink) finish(err error) {
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+	sk.done = true
+
+	if sk.answer != nil {
+		res := response{ID: sk.msg.ID, Conversation: sk.msg.Conversation, Answer: *sk.answer}
+		if sk.stream {
+			sk.event("done", res)
+		} else {
+			writeJSON(sk.w, http.StatusOK, res)
+		}
+		return
+	}
+
+	status, text := http.StatusForbidden, "ChatRelay is disabled for this conversation"
+	switch {
+	case err != nil:
+		status, text = http.StatusBadGateway, "the chat backend failed to answer"
+	case sk.notice != "":
+		status, text = sk.status, sk.notice
+	case sk.replied:
+		status, text = http.StatusServiceUnavailable, "the answer was interrupted, please retry"
+	}
+	if sk.started {
+		sk.event("error", map[string]any{"status": status, "error": text})
+		return
+	}
+	writeJSON(sk.w, status, errorResponse{Error: text})
+}
+
+// event writes a server-sent event, starting the stream if needed.
+// sk.mu must be held.
+func (sk *sink) event(name string, data any) error {
+	if !sk.started {
+		h := sk.w.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		h.Set("X-Accel-Buffering", "no")
+		sk.w.WriteHeader(http.StatusOK)
+		sk.started = true
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(sk.w, "event: %s\ndata: %s\n\n", name, payload); err != nil {
+		return err
+	}
+	sk.flusher.Flush()
+	return nil
+}
+
+// Post starts the reply to the question being answered in ctx. The reply's
+// ID is the question's.
+func (s *Server) Post(ctx context.Context, msg models.OutgoingMessage) (string, error) {
+	sk := sinkFrom(ctx)
+	if sk == nil {
+		return "", errRequestEnded
+	}
+	return sk.msg.ID, sk.update(msg.Text)
+}
+
+func (s *Server) Update(ctx context.Context, id string, msg models.OutgoingMessage) error {
+	sk := sinkFrom(ctx)
+	if sk == nil || sk.msg.ID != id {
+		return errRequestEnded
+	}
+	return sk.update(msg.Text)
+}
+
+// Delete does nothing: a reply that has been sent cannot be taken back.
+func (s *Server) Delete(ctx context.Context, conversation, id string) error {
+	return nil
+}
+
+// Notify turns the question being answered in ctx away with text, as 503
+// Service Unavailable. Use WithNotifyStatus for other statuses.
+func (s *Server) Notify(ctx context.Context, conversation, userID, text string) error {
+	return s.notify(ctx, text, http.StatusServiceUnavailable)
+}
+
+func (s *Server) notify(ctx context.Context, text string, status int) error {
+	sk := sinkFrom(ctx)
+	if sk == nil {
+		return errRequestEnded
+	}
+	sk.notify(text, status)
+	return nil
+}
+
+// WithNotifyStatus returns a Messenger for a pipeline stage whose notices
+// turn questions away with the HTTP status, such as 403 Forbidden for the
+// access guard or 429 Too Many Requests for the rate limiter.
+func (s *Server) WithNotifyStatus(status int) adapter.Messenger {
+	return statusMessenger{Server: s, status: status}
+}
+
+type statusMessenger struct {
+	*Server
+	status int
+}
+
+func (m statusMessenger) Notify(ctx context.Context, conversation, userID, text string) error {
+	return m.notify(ctx, text, m.status)
+}
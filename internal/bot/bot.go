@@ -2,11 +2,13 @@ package bot
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.opentelemetry.io/otel"
@@ -14,97 +16,423 @@ import (
 	"go.opentelemetry.io/otel/codes"   
 	"go.opentelemetry.io/otel/trace"
 
+	"chatrelay-bot/internal/adapter"
 	"chatrelay-bot/internal/chatbackend"
-	"chatrelay-bot/internal/slack"
+	"chatrelay-bot/internal/redact"
+	"chatrelay-bot/internal/store"
+	"chatrelay-bot/internal/telemetry"
 	"chatrelay-bot/pkg/models"
 )
 
 const tracerName = "chatrelay/internal/bot"
 
+const defaultStreamUpdateInterval = 500 * time.Millisecond
+
+const (
+	drainingMessage    = "I'm restarting right now. Please ask again in a minute."
+	interruptedMessage = "Interrupted, please retry."
+	// interruptGrace bounds how long Drain waits for cancelled conversations
+	// to edit their replies.
+	interruptGrace = 10 * time.Second
+)
+
+// Cancellation causes for a conversation: the drain deadline passed, the
+// user edited the mention, or the user deleted it.
+var (
+	errDrained    = errors.New("bot is shutting down")
+	errSuperseded = errors.New("mention was edited")
+	errDeleted    = errors.New("mention was deleted")
+)
+
+// conversation is a message currently being answered. ts is empty until
+// the placeholder reply has been posted. next holds the edited message that
+// replaces this one.
+type conversation struct {
+	channel string
+	ts      string
+	cancel  context.CancelCauseFunc
+	next    *models.IncomingMessage
+}
+
+// AnswerListener is told about every answer the bot finishes relaying.
+type AnswerListener interface {
+	AnswerCompleted(ctx context.Context, answer models.CompletedAnswer)
+}
+
+// AnswerListeners tells each of its listeners in turn.
+type AnswerListeners []AnswerListener
+
+func (ls AnswerListeners) AnswerCompleted(ctx context.Context, answer models.CompletedAnswer) {
+	for _, l := range ls {
+		l.AnswerCompleted(ctx, answer)
+	}
+}
+
 type ChatRelayBot struct {
-	slackClient         *slack.Client
+	messenger           adapter.Messenger
+	handler             adapter.Handler
 	backendClient       chatbackend.Client
-	ongoingConversations map[string]string
+	store               store.Store
+	answers             AnswerListener
+	ongoingConversations map[string]*conversation
 	mu                   sync.Mutex
+	inFlight             sync.WaitGroup
+	draining             bool
+	streamUpdateInterval atomic.Int64
 }
 
-func NewChatRelayBot(sc *slack.Client, bc chatbackend.Client) *ChatRelayBot {
-	return &ChatRelayBot{
-		slackClient:         sc,
+func NewChatRelayBot(m adapter.Messenger, bc chatbackend.Client) *ChatRelayBot {
+	b := &ChatRelayBot{
+		messenger:           m,
 		backendClient:       bc,
-		ongoingConversations: make(map[string]string),
+		ongoingConversations: make(map[string]*conversation),
 	}
+	b.streamUpdateInterval.Store(int64(defaultStreamUpdateInterval))
+	return b
 }
 
-func (b *ChatRelayBot) SetSlackClient(sc *slack.Client) {
-	b.slackClient = sc
+// ApplyConfig updates the bot's live settings from a (re)loaded
+// configuration.
+func (b *ChatRelayBot) ApplyConfig(cfg *models.AppConfig) {
+	b.streamUpdateInterval.Store(int64(cfg.StreamUpdateInterval))
+}
+
+func (b *ChatRelayBot) SetMessenger(m adapter.Messenger) {
+	b.messenger = m
+}
+
+// SetConversationStore persists ongoing conversations to st so that replies
+// left unfinished by a crash can be recovered on the next start.
+func (b *ChatRelayBot) SetConversationStore(st store.Store) {
+	b.store = st
+}
+
+// SetHandler sets the first stage of the pipeline that ends at the bot.
+// Retried answers and edited messages go back through it, so access control and rate limits
+// apply to them as to new messages. It defaults to the bot itself.
+func (b *ChatRelayBot) SetHandler(h adapter.Handler) {
+	b.handler = h
+}
+
+func (b *ChatRelayBot) SetAnswerListener(l AnswerListener) {
+	b.answers = l
 }
 
 func (b *ChatRelayBot) StartBot(ctx context.Context) error {
 	slog.InfoContext(ctx, "Starting ChatRelay Bot...")
-	if b.slackClient == nil {
-		return fmt.Errorf("slack client is not set for ChatRelayBot")
+	if b.messenger == nil {
+		return fmt.Errorf("messenger is not set for ChatRelayBot")
 	}
-	return b.slackClient.ConnectAndListen(ctx)
+	a, ok := b.messenger.(adapter.Adapter)
+	if !ok {
+		return fmt.Errorf("messenger %T cannot listen for messages", b.messenger)
+	}
+	slog.InfoContext(ctx, "Running adapter", "adapter", a.Name())
+	return a.Run(ctx)
 }
 
-func (b *ChatRelayBot) HandleAppMention(ctx context.Context, event models.SlackEvent) error {
+// Drain stops the bot from accepting new mentions and waits for in-flight
+// answers to finish. Answers still running when ctx is done are cancelled
+// and their replies edited to ask the user to retry.
+func (b *ChatRelayBot) Drain(ctx context.Context) {
+	b.mu.Lock()
+	b.draining = true
+	remaining := len(b.ongoingConversations)
+	b.mu.Unlock()
+
+	slog.InfoContext(ctx, "Draining in-flight conversations", "count", remaining)
+
+	done := make(chan struct{})
+	go func() {
+		b.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		slog.InfoContext(ctx, "All in-flight conversations finished")
+		return
+	case <-ctx.Done():
+	}
+
+	b.mu.Lock()
+	remaining = len(b.ongoingConversations)
+	for _, c := range b.ongoingConversations {
+		c.cancel(errDrained)
+	}
+	b.mu.Unlock()
+	slog.WarnContext(ctx, "Drain deadline reached, interrupting conversations", "count", remaining)
+
+	select {
+	case <-done:
+	case <-time.After(interruptGrace):
+		slog.ErrorContext(ctx, "Conversations did not stop after being interrupted")
+	}
+}
+
+// begin registers a new conversation, or reports false once the bot is
+// draining.
+func (b *ChatRelayBot) begin(key string, conv *conversation) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.draining {
+		return false
+	}
+	b.inFlight.Add(1)
+	b.ongoingConversations[key] = conv
+	return true
+}
+
+func (b *ChatRelayBot) end(ctx context.Context, key string) {
+	b.mu.Lock()
+	delete(b.ongoingConversations, key)
+	b.mu.Unlock()
+	b.forget(ctx, key)
+	b.inFlight.Done()
+}
+
+// HandleMessageEdited restarts the answer to a message that is still being
+// answered with its edited text, reusing the same reply. The edited message
+// passes the access and rate limit checks again first.
+func (b *ChatRelayBot) HandleMessageEdited(ctx context.Context, msg models.IncomingMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	conv, ok := b.ongoingConversations[conversationKey(msg.Conversation, msg.ID)]
+	if !ok {
+		return
+	}
+	slog.InfoContext(ctx, "Mention edited while answering, restarting", "channel", msg.Conversation, "timestamp", msg.ID, "query", msg.Text)
+	conv.next = &msg
+	conv.cancel(errSuperseded)
+}
+
+// HandleMessageDeleted cancels the answer to a deleted message. The
+// cancelled answer removes its reply.
+func (b *ChatRelayBot) HandleMessageDeleted(ctx context.Context, conversation, id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	conv, ok := b.ongoingConversations[conversationKey(conversation, id)]
+	if !ok {
+		return
+	}
+	slog.InfoContext(ctx, "Mention deleted while answering, cancelling", "channel", conversation, "timestamp", id)
+	conv.cancel(errDeleted)
+}
+
+// conversationKey identifies the conversation answering a message.
+func conversationKey(conversation, id string) string {
+	return store.Key(conversation, id)
+}
+
+// stopped reports whether the conversation was cancelled by Drain or by an
+// edit or deletion of its mention, and cleans up the reply accordingly: an
+// interrupted reply asks the user to retry, a deleted mention's reply is
+// removed, and a superseded reply is left for the restarted answer.
+func (b *ChatRelayBot) stopped(ctx context.Context, channel, ts string) bool {
+	cause := context.Cause(ctx)
+	if !errors.Is(cause, errDrained) && !errors.Is(cause, errSuperseded) && !errors.Is(cause, errDeleted) {
+		return false
+	}
+	telemetry.RecordMentionCompleted(ctx, telemetry.OutcomeCancelled)
+	if ts == "" || errors.Is(cause, errSuperseded) {
+		return true
+	}
+
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if errors.Is(cause, errDeleted) {
+		if err := b.messenger.Delete(cleanupCtx, channel, ts); err != nil {
+			slog.ErrorContext(cleanupCtx, "Failed to delete reply to deleted mention", "error", err, "channel", channel, "timestamp", ts)
+		}
+		return true
+	}
+	if err := b.update(cleanupCtx, channel, ts, interruptedMessage); err != nil {
+		slog.ErrorContext(cleanupCtx, "Failed to mark interrupted reply", "error", err, "channel", channel, "timestamp", ts)
+	}
+	return true
+}
+
+// update replaces the text of the bot's message id, removing any actions.
+func (b *ChatRelayBot) update(ctx context.Context, conversation, id, text string) error {
+	return b.messenger.Update(ctx, id, models.OutgoingMessage{Conversation: conversation, Text: text})
+}
+
+// resumeKey is the context key of the resumption a message is passed
+// through the pipeline with by reanswer.
+type resumeKey struct{}
+
+// resumption asks HandleMessage to answer into an existing reply, and
+// records that the message got through to the bot.
+type resumption struct {
+	replyTS string
+	reached bool
+}
+
+func (b *ChatRelayBot) HandleMessage(ctx context.Context, msg models.IncomingMessage, settings models.ChannelSettings) error {
+	replyTS := ""
+	if r, ok := ctx.Value(resumeKey{}).(*resumption); ok && !r.reached {
+		r.reached = true
+		replyTS = r.replyTS
+	}
+	return b.answer(ctx, msg, settings, replyTS)
+}
+
+// reanswer passes msg back through the pipeline to be answered in the
+// existing reply replyTS. It reports whether msg got through to the bot;
+// when it did not, the stage that turned it away has told the user why.
+func (b *ChatRelayBot) reanswer(ctx context.Context, msg models.IncomingMessage, settings models.ChannelSettings, replyTS string) (bool, error) {
+	h := b.handler
+	if h == nil {
+		h = b
+	}
+	r := &resumption{replyTS: replyTS}
+	err := h.HandleMessage(context.WithValue(ctx, resumeKey{}, r), msg, settings)
+	return r.reached, err
+}
+
+// answer relays the backend's answer to msg. The answer goes into a new
+// reply, or into the existing reply replyTS when one is given. When the
+// message is edited mid-answer, the edited message goes back through the
+// pipeline, to be checked like a new one and answered in the same reply.
+func (b *ChatRelayBot) answer(ctx context.Context, msg models.IncomingMessage, settings models.ChannelSettings, replyTS string) error {
+	conv := &conversation{channel: msg.Conversation, ts: replyTS}
+	err := b.answerOnce(ctx, msg, settings, conv)
+
+	b.mu.Lock()
+	next, ts := conv.next, conv.ts
+	b.mu.Unlock()
+	if next == nil {
+		return err
+	}
+	reached, err := b.reanswer(ctx, *next, settings, ts)
+	if !reached && ts != "" {
+		// The edited message was turned away; the reply to its old text
+		// goes with it.
+		if err := b.messenger.Delete(ctx, msg.Conversation, ts); err != nil {
+			slog.ErrorContext(ctx, "Failed to delete reply to refused edit", "error", err, "channel", msg.Conversation, "timestamp", ts)
+		}
+	}
+	return err
+}
+
+func (b *ChatRelayBot) answerOnce(ctx context.Context, msg models.IncomingMessage, settings models.ChannelSettings, conv *conversation) error {
 	tracer := otel.Tracer(tracerName)
 	ctx, span := tracer.Start(ctx, "HandleAppMention",
 		trace.WithAttributes(
-			attribute.String("slack.event.channel", event.Channel),
-			attribute.String("slack.event.user", event.User),
-			attribute.String("slack.event.query", event.Text),
+			attribute.String("chat.platform", msg.Platform),
+			attribute.String("chat.conversation", msg.Conversation),
+			attribute.String("chat.user", msg.Author.ID),
+			redact.Attr("chat.query", msg.Text),
 		),
 	)
 	defer span.End()
 
-	slog.InfoContext(ctx, "Processing app mention", "user", event.User, "channel", event.Channel, "query", event.Text)
+	if !settings.Enabled {
+		slog.InfoContext(ctx, "Bot is disabled for this channel, ignoring mention", "channel", msg.Conversation, "team", msg.Workspace)
+		span.SetStatus(codes.Ok, "Bot disabled for channel")
+		return nil
+	}
 
-	if b.slackClient == nil {
-		slog.ErrorContext(ctx, "Slack client is nil, cannot send messages.")
-		span.RecordError(fmt.Errorf("slack client not initialized"))
-		span.SetStatus(codes.Error, "Slack client not initialized") 
-		return fmt.Errorf("slack client not initialized")
+	conversationKey := conversationKey(msg.Conversation, msg.ID)
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	conv.cancel = cancel
+	if !b.begin(conversationKey, conv) {
+		slog.InfoContext(ctx, "Bot is draining, turning away mention", "user", msg.Author.ID, "channel", msg.Conversation)
+		span.SetStatus(codes.Ok, "Bot draining")
+		if b.messenger != nil {
+			if err := b.messenger.Notify(ctx, msg.Conversation, msg.Author.ID, drainingMessage); err != nil {
+				slog.ErrorContext(ctx, "Failed to send draining message", "error", err)
+			}
+		}
+		return nil
 	}
+	defer b.end(ctx, conversationKey)
 
-	initialMessage := "Thinking..."
-	ts, err := b.slackClient.SendMessage(ctx, event.Channel, initialMessage)
+	receivedAt := time.Now()
+	telemetry.RecordMentionReceived(ctx)
+	telemetry.AddInFlightConversations(ctx, 1)
+	defer telemetry.AddInFlightConversations(ctx, -1)
+
+	slog.InfoContext(ctx, "Processing app mention", "user", msg.Author.ID, "channel", msg.Conversation, "query", msg.Text)
+
+	if b.messenger == nil {
+		slog.ErrorContext(ctx, "Messenger is nil, cannot send messages.")
+		span.RecordError(fmt.Errorf("messenger not initialized"))
+		span.SetStatus(codes.Error, "Messenger not initialized") 
+		telemetry.RecordMentionCompleted(ctx, telemetry.OutcomeSlackError)
+		return fmt.Errorf("messenger not initialized")
+	}
+
+	threadTS := ""
+	if settings.ThreadOnly {
+		threadTS = msg.Thread
+		if threadTS == "" {
+			threadTS = msg.ID
+		}
+	}
+
+	initialMessage := settings.Placeholder
+	ts := conv.ts
+	var err error
+	if ts == "" {
+		ts, err = b.messenger.Post(ctx, models.OutgoingMessage{Conversation: msg.Conversation, Thread: threadTS, Text: initialMessage})
+	} else {
+		err = b.update(ctx, msg.Conversation, ts, initialMessage)
+	}
 	if err != nil {
-		slog.ErrorContext(ctx, "Failed to send initial message to Slack", "error", err)
+		if b.stopped(ctx, msg.Conversation, ts) {
+			return nil
+		}
+		slog.ErrorContext(ctx, "Failed to send initial reply", "error", err, "platform", msg.Platform)
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "Failed to send initial message")
+		telemetry.RecordMentionCompleted(ctx, telemetry.OutcomeSlackError)
 		return fmt.Errorf("failed to send initial message: %w", err)
 	}
 
-	conversationKey := fmt.Sprintf("%s-%s", event.Channel, event.User)
 	b.mu.Lock()
-	b.ongoingConversations[conversationKey] = ts
+	conv.ts = ts
 	b.mu.Unlock()
+	b.persist(ctx, conversationKey, pendingConversation{
+		ReplyTs:   ts,
+		Message:   msg,
+		Settings:  settings,
+		StartedAt: receivedAt,
+	})
 
 	chatReq := models.ChatRequest{
-		UserID: event.User,
-		Query:  event.Text,
+		UserID:     msg.Author.ID,
+		Query:      msg.Text,
+		Language:   settings.Language,
+		BackendURL: settings.BackendURL,
 	}
 
 	backendRes, err := b.backendClient.SendChatRequest(ctx, chatReq)
 	if err != nil {
+		if b.stopped(ctx, msg.Conversation, ts) {
+			return nil
+		}
 		slog.ErrorContext(ctx, "Failed to get response from chat backend", "error", err)
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "Backend request failed")
 
-		updateErr := b.slackClient.UpdateMessage(ctx, event.Channel, ts, fmt.Sprintf("Apologies, I encountered an error: %v", err))
+		updateErr := b.update(ctx, msg.Conversation, ts, fmt.Sprintf("Apologies, I encountered an error: %v", err))
 		if updateErr != nil {
 			slog.ErrorContext(ctx, "Failed to update message with error", "error", updateErr)
 		}
+		telemetry.RecordMentionCompleted(ctx, telemetry.OutcomeBackendError)
 		return fmt.Errorf("backend communication failed: %w", err)
 	}
 
 	slog.InfoContext(ctx, "Received response from chat backend", "response_length", len(backendRes.FullResponse))
 
-	fullResponse := backendRes.FullResponse
+	fullResponse := truncateAnswer(backendRes.FullResponse, settings.MaxAnswerLength)
 	var currentResponse strings.Builder
-	sentences := splitIntoSentences(fullResponse)
+	var sentences []string
+	if settings.Streaming {
+		sentences = splitIntoSentences(fullResponse)
+	}
 
 	for i, sentence := range sentences {
 		currentResponse.WriteString(sentence)
@@ -112,32 +440,68 @@ func (b *ChatRelayBot) HandleAppMention(ctx context.Context, event models.SlackE
 			currentResponse.WriteString("...")
 		}
 
-		err := b.slackClient.UpdateMessage(ctx, event.Channel, ts, currentResponse.String())
+		err := b.update(ctx, msg.Conversation, ts, currentResponse.String())
 		if err != nil {
-			slog.ErrorContext(ctx, "Failed to update Slack message during streaming", "error", err)
+			slog.ErrorContext(ctx, "Failed to update reply during streaming", "error", err, "platform", msg.Platform)
 			span.RecordError(err)
+		} else if i == 0 {
+			telemetry.RecordTimeToFirstChunk(ctx, time.Since(receivedAt))
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Duration(b.streamUpdateInterval.Load())):
+		}
+		if b.stopped(ctx, msg.Conversation, ts) {
+			return nil
 		}
-		time.Sleep(500 * time.Millisecond)
 	}
 
-	finalMessage := fullResponse + "\n\n_Powered by ChatRelay_"
-	err = b.slackClient.UpdateMessage(ctx, event.Channel, ts, finalMessage)
+	finalMessage := fullResponse
+	if settings.Footer != "" {
+		finalMessage += "\n\n" + settings.Footer
+	}
+	err = b.update(ctx, msg.Conversation, ts, finalMessage)
 	if err != nil {
-		slog.ErrorContext(ctx, "Failed to send final Slack message", "error", err)
+		if b.stopped(ctx, msg.Conversation, ts) {
+			return nil
+		}
+		slog.ErrorContext(ctx, "Failed to send final reply", "error", err, "platform", msg.Platform)
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "Failed to send final message")
+		telemetry.RecordMentionCompleted(ctx, telemetry.OutcomeSlackError)
 		return fmt.Errorf("failed to send final message: %w", err)
 	}
+	if len(sentences) == 0 {
+		telemetry.RecordTimeToFirstChunk(ctx, time.Since(receivedAt))
+	}
 
-	slog.InfoContext(ctx, "Successfully relayed response to Slack", "user", event.User)
+	slog.InfoContext(ctx, "Successfully relayed response", "platform", msg.Platform, "user", msg.Author.ID)
 	span.SetStatus(codes.Ok, "Response relayed successfully")
-	b.mu.Lock()
-	delete(b.ongoingConversations, conversationKey)
-	b.mu.Unlock()
+	telemetry.RecordMentionCompleted(ctx, telemetry.OutcomeSuccess)
+	telemetry.RecordAnswerLength(ctx, len(fullResponse))
+	if b.answers != nil {
+		b.answers.AnswerCompleted(ctx, models.CompletedAnswer{
+			Message:  msg,
+			ReplyID:  ts,
+			Answer:   fullResponse,
+			Usage:    backendRes.Usage,
+			Duration: time.Since(receivedAt),
+		})
+	}
 
 	return nil
 }
 
+// truncateAnswer cuts text to at most limit runes, marking the cut with an
+// ellipsis. A limit of 0 leaves text unchanged.
+func truncateAnswer(text string, limit int) string {
+	runes := []rune(text)
+	if limit <= 0 || len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "…"
+}
+
 func splitIntoSentences(text string) []string {
 	sentences := regexp.MustCompile(`([.!?])\s+`).Split(text, -1)
 	cleanedSentences := make([]string, 0, len(sentences))
@@ -0,0 +1,557 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"chatrelay-bot/internal/slack/slacktest"
+	"chatrelay-bot/internal/store"
+	"chatrelay-bot/pkg/models"
+)
+
+const (
+	placeholder = "Thinking..."
+	footer      = "_Powered by ChatRelay_"
+)
+
+// fakeBackend answers every query with answers[query], or echoes it. Queries
+// listed in hold wait until release is closed or their context is done.
+type fakeBackend struct {
+	answers map[string]string
+	hold    map[string]bool
+	release chan struct{}
+	started chan models.ChatRequest
+
+	mu        sync.Mutex
+	requests  []models.ChatRequest
+	cancelled []string
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{
+		answers: make(map[string]string),
+		hold:    make(map[string]bool),
+		release: make(chan struct{}),
+		started: make(chan models.ChatRequest, 10),
+	}
+}
+
+func (f *fakeBackend) SendChatRequest(ctx context.Context, req models.ChatRequest) (models.ChatResponse, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+	f.started <- req
+
+	if f.hold[req.Query] {
+		select {
+		case <-f.release:
+		case <-ctx.Done():
+			f.mu.Lock()
+			f.cancelled = append(f.cancelled, req.Query)
+			f.mu.Unlock()
+			return models.ChatResponse{}, ctx.Err()
+		}
+	}
+	answer, ok := f.answers[req.Query]
+	if !ok {
+		answer = "You asked: " + req.Query
+	}
+	return models.ChatResponse{FullResponse: answer}, nil
+}
+
+func (f *fakeBackend) queries() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var qs []string
+	for _, r := range f.requests {
+		qs = append(qs, r.Query)
+	}
+	return qs
+}
+
+// waitStarted waits for the backend to receive query.
+func (f *fakeBackend) waitStarted(t *testing.T, query string) {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case req := <-f.started:
+			if req.Query == query {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("backend never received %q", query)
+		}
+	}
+}
+
+func newTestBot(backend *fakeBackend, interval time.Duration) (*ChatRelayBot, *slacktest.Messenger) {
+	m := slacktest.NewMessenger()
+	b := NewChatRelayBot(m, backend)
+	b.streamUpdateInterval.Store(int64(interval))
+	return b, m
+}
+
+func mention(id, text string) models.IncomingMessage {
+	return models.IncomingMessage{
+		Platform:     "slack",
+		ID:           id,
+		Workspace:    "T1",
+		Conversation: "C1",
+		Author:       models.Author{ID: "U1"},
+		Text:         text,
+	}
+}
+
+func channelSettings() models.ChannelSettings {
+	return models.ChannelSettings{Enabled: true, Placeholder: placeholder, Footer: footer}
+}
+
+// handle answers msg in the background and returns the result channel.
+func handle(b *ChatRelayBot, msg models.IncomingMessage, settings models.ChannelSettings) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- b.HandleMessage(context.Background(), msg, settings) }()
+	return done
+}
+
+func wait(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("answer did not finish")
+		return nil
+	}
+}
+
+func onlyMessage(t *testing.T, m *slacktest.Messenger) slacktest.Message {
+	t.Helper()
+	msgs := m.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("bot posted %d messages, want 1: %+v", len(msgs), msgs)
+	}
+	return msgs[0]
+}
+
+func TestStreamingEditsAreThrottled(t *testing.T) {
+	const interval = 40 * time.Millisecond
+	backend := newFakeBackend()
+	backend.answers["q"] = "One. Two! Three?"
+	b, m := newTestBot(backend, interval)
+
+	var mu sync.Mutex
+	var at []time.Time
+	m.OnChange = func(slacktest.Message) {
+		mu.Lock()
+		at = append(at, time.Now())
+		mu.Unlock()
+	}
+
+	settings := channelSettings()
+	settings.Streaming = true
+	if err := b.HandleMessage(context.Background(), mention("1.1", "q"), settings); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{placeholder, "One...", "One...Two...", "One...Two...Three?", "One. Two! Three?\n\n" + footer}
+	if got := onlyMessage(t, m).Revisions; !slices.Equal(got, want) {
+		t.Errorf("revisions = %q, want %q", got, want)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// Each streamed edit after the first waits out the interval.
+	for i := 2; i < len(at); i++ {
+		if gap := at[i].Sub(at[i-1]); gap < interval-5*time.Millisecond {
+			t.Errorf("edit %d came %v after the previous one, want at least %v", i, gap, interval)
+		}
+	}
+}
+
+func TestReplyFormatting(t *testing.T) {
+	tests := []struct {
+		name       string
+		answer     string
+		settings   func(*models.ChannelSettings)
+		msg        func(*models.IncomingMessage)
+		want       []string
+		wantThread string
+	}{
+		{
+			name:   "placeholder then answer with footer",
+			answer: "Hello. World.",
+			want:   []string{placeholder, "Hello. World.\n\n" + footer},
+		},
+		{
+			name:     "no footer",
+			answer:   "Hello.",
+			settings: func(s *models.ChannelSettings) { s.Footer = "" },
+			want:     []string{placeholder, "Hello."},
+		},
+		{
+			name:     "custom placeholder",
+			answer:   "Hello.",
+			settings: func(s *models.ChannelSettings) { s.Placeholder = "On it…" },
+			want:     []string{"On it…", "Hello.\n\n" + footer},
+		},
+		{
+			name:     "empty placeholder",
+			answer:   "Hello.",
+			settings: func(s *models.ChannelSettings) { s.Placeholder = "" },
+			want:     []string{"", "Hello.\n\n" + footer},
+		},
+		{
+			name:     "answer cut at max length before the footer",
+			answer:   "héllo wörld",
+			settings: func(s *models.ChannelSettings) { s.MaxAnswerLength = 5 },
+			want:     []string{placeholder, "héllo…\n\n" + footer},
+		},
+		{
+			name:       "thread only starts a thread",
+			answer:     "Hi.",
+			settings:   func(s *models.ChannelSettings) { s.ThreadOnly = true },
+			want:       []string{placeholder, "Hi.\n\n" + footer},
+			wantThread: "1.1",
+		},
+		{
+			name:       "thread only replies in the mention's thread",
+			answer:     "Hi.",
+			settings:   func(s *models.ChannelSettings) { s.ThreadOnly = true },
+			msg:        func(m *models.IncomingMessage) { m.Thread = "0.9" },
+			want:       []string{placeholder, "Hi.\n\n" + footer},
+			wantThread: "0.9",
+		},
+		{
+			name:   "replies in the channel by default",
+			answer: "Hi.",
+			msg:    func(m *models.IncomingMessage) { m.Thread = "0.9" },
+			want:   []string{placeholder, "Hi.\n\n" + footer},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newFakeBackend()
+			backend.answers["q"] = tt.answer
+			b, m := newTestBot(backend, time.Millisecond)
+			settings := channelSettings()
+			if tt.settings != nil {
+				tt.settings(&settings)
+			}
+			msg := mention("1.1", "q")
+			if tt.msg != nil {
+				tt.msg(&msg)
+			}
+			if err := b.HandleMessage(context.Background(), msg, settings); err != nil {
+				t.Fatal(err)
+			}
+			reply := onlyMessage(t, m)
+			if !slices.Equal(reply.Revisions, tt.want) {
+				t.Errorf("revisions = %q, want %q", reply.Revisions, tt.want)
+			}
+			if reply.ThreadTS != tt.wantThread {
+				t.Errorf("thread = %q, want %q", reply.ThreadTS, tt.wantThread)
+			}
+		})
+	}
+}
+
+func TestDisabledChannelIsIgnored(t *testing.T) {
+	backend := newFakeBackend()
+	b, m := newTestBot(backend, time.Millisecond)
+	settings := channelSettings()
+	settings.Enabled = false
+	if err := b.HandleMessage(context.Background(), mention("1.1", "q"), settings); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Messages()) != 0 || len(backend.queries()) != 0 {
+		t.Errorf("disabled channel got %d messages and %d backend requests", len(m.Messages()), len(backend.queries()))
+	}
+}
+
+func TestBackendErrorIsReported(t *testing.T) {
+	b, m := newTestBot(nil, time.Millisecond)
+	b.backendClient = failingBackend{}
+	if err := b.HandleMessage(context.Background(), mention("1.1", "q"), channelSettings()); err == nil {
+		t.Fatal("HandleMessage succeeded, want the backend error")
+	}
+	if got := onlyMessage(t, m).Text(); got != "Apologies, I encountered an error: backend down" {
+		t.Errorf("reply = %q", got)
+	}
+}
+
+type failingBackend struct{}
+
+func (failingBackend) SendChatRequest(context.Context, models.ChatRequest) (models.ChatResponse, error) {
+	return models.ChatResponse{}, errors.New("backend down")
+}
+
+func TestEditRestartsAnswerInSameReply(t *testing.T) {
+	backend := newFakeBackend()
+	backend.hold["first"] = true
+	b, m := newTestBot(backend, time.Millisecond)
+
+	done := handle(b, mention("1.1", "first"), channelSettings())
+	backend.waitStarted(t, "first")
+	b.HandleMessageEdited(context.Background(), mention("1.1", "second"))
+	if err := wait(t, done); err != nil {
+		t.Fatal(err)
+	}
+
+	reply := onlyMessage(t, m)
+	want := []string{placeholder, placeholder, "You asked: second\n\n" + footer}
+	if !slices.Equal(reply.Revisions, want) {
+		t.Errorf("revisions = %q, want %q", reply.Revisions, want)
+	}
+	if got := backend.queries(); !slices.Equal(got, []string{"first", "second"}) {
+		t.Errorf("backend queries = %q", got)
+	}
+	if !slices.Equal(backend.cancelled, []string{"first"}) {
+		t.Errorf("cancelled = %q, want the first request", backend.cancelled)
+	}
+}
+
+// refuser is a pipeline stage that turns every message away.
+type refuser struct {
+	m *slacktest.Messenger
+}
+
+func (r refuser) HandleMessage(ctx context.Context, msg models.IncomingMessage, settings models.ChannelSettings) error {
+	return r.m.Notify(ctx, msg.Conversation, msg.Author.ID, "no")
+}
+
+func TestRefusedEditRemovesReply(t *testing.T) {
+	backend := newFakeBackend()
+	backend.hold["first"] = true
+	b, m := newTestBot(backend, time.Millisecond)
+	b.SetHandler(refuser{m})
+
+	done := handle(b, mention("1.1", "first"), channelSettings())
+	backend.waitStarted(t, "first")
+	b.HandleMessageEdited(context.Background(), mention("1.1", "second"))
+	if err := wait(t, done); err != nil {
+		t.Fatal(err)
+	}
+
+	if reply := onlyMessage(t, m); !reply.Deleted {
+		t.Errorf("reply to the refused edit was kept: %q", reply.Revisions)
+	}
+	if got := backend.queries(); !slices.Equal(got, []string{"first"}) {
+		t.Errorf("backend queries = %q, want only the first", got)
+	}
+	if len(m.Ephemerals()) != 1 {
+		t.Errorf("ephemerals = %+v, want the refusal", m.Ephemerals())
+	}
+}
+
+func TestEditOfFinishedAnswerIsIgnored(t *testing.T) {
+	backend := newFakeBackend()
+	b, m := newTestBot(backend, time.Millisecond)
+	if err := b.HandleMessage(context.Background(), mention("1.1", "first"), channelSettings()); err != nil {
+		t.Fatal(err)
+	}
+	b.HandleMessageEdited(context.Background(), mention("1.1", "second"))
+	if got := onlyMessage(t, m).Text(); got != "You asked: first\n\n"+footer {
+		t.Errorf("reply = %q", got)
+	}
+	if got := backend.queries(); len(got) != 1 {
+		t.Errorf("backend queries = %q, want one", got)
+	}
+}
+
+func TestDeleteCancelsAnswerAndRemovesReply(t *testing.T) {
+	backend := newFakeBackend()
+	backend.hold["first"] = true
+	b, m := newTestBot(backend, time.Millisecond)
+
+	done := handle(b, mention("1.1", "first"), channelSettings())
+	backend.waitStarted(t, "first")
+	b.HandleMessageDeleted(context.Background(), "C1", "1.1")
+	if err := wait(t, done); err != nil {
+		t.Fatal(err)
+	}
+
+	if reply := onlyMessage(t, m); !reply.Deleted {
+		t.Errorf("reply was not deleted: %q", reply.Revisions)
+	}
+	if !slices.Equal(backend.cancelled, []string{"first"}) {
+		t.Errorf("cancelled = %q, want the request", backend.cancelled)
+	}
+}
+
+func TestDeleteDuringStreamingStopsEdits(t *testing.T) {
+	backend := newFakeBackend()
+	backend.answers["q"] = "One. Two. Three. Four."
+	b, m := newTestBot(backend, 50*time.Millisecond)
+	streamed := make(chan struct{}, 10)
+	m.OnChange = func(msg slacktest.Message) {
+		if msg.Text() == "One..." {
+			streamed <- struct{}{}
+		}
+	}
+
+	settings := channelSettings()
+	settings.Streaming = true
+	done := handle(b, mention("1.1", "q"), settings)
+	<-streamed
+	b.HandleMessageDeleted(context.Background(), "C1", "1.1")
+	if err := wait(t, done); err != nil {
+		t.Fatal(err)
+	}
+
+	reply := onlyMessage(t, m)
+	if !reply.Deleted {
+		t.Error("reply was not deleted")
+	}
+	if want := []string{placeholder, "One..."}; !slices.Equal(reply.Revisions, want) {
+		t.Errorf("revisions = %q, want %q", reply.Revisions, want)
+	}
+}
+
+func TestDrainWaitsForAnswers(t *testing.T) {
+	backend := newFakeBackend()
+	backend.hold["q"] = true
+	b, m := newTestBot(backend, time.Millisecond)
+
+	done := handle(b, mention("1.1", "q"), channelSettings())
+	backend.waitStarted(t, "q")
+
+	drained := make(chan struct{})
+	go func() {
+		b.Drain(context.Background())
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		t.Fatal("Drain returned while an answer was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(backend.release)
+	if err := wait(t, done); err != nil {
+		t.Fatal(err)
+	}
+	<-drained
+	if got := onlyMessage(t, m).Text(); got != "You asked: q\n\n"+footer {
+		t.Errorf("reply = %q", got)
+	}
+}
+
+func TestDrainDeadlineInterruptsAnswers(t *testing.T) {
+	backend := newFakeBackend()
+	backend.hold["q"] = true
+	b, m := newTestBot(backend, time.Millisecond)
+
+	done := handle(b, mention("1.1", "q"), channelSettings())
+	backend.waitStarted(t, "q")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	b.Drain(ctx)
+	if err := wait(t, done); err != nil {
+		t.Fatal(err)
+	}
+	if got := onlyMessage(t, m).Text(); got != interruptedMessage {
+		t.Errorf("reply = %q, want %q", got, interruptedMessage)
+	}
+}
+
+func TestDrainingTurnsAwayNewMentions(t *testing.T) {
+	backend := newFakeBackend()
+	b, m := newTestBot(backend, time.Millisecond)
+	b.Drain(context.Background())
+
+	if err := b.HandleMessage(context.Background(), mention("1.1", "q"), channelSettings()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(m.Messages()); n != 0 {
+		t.Errorf("bot posted %d messages while draining", n)
+	}
+	want := []slacktest.Ephemeral{{Channel: "C1", User: "U1", Text: drainingMessage}}
+	if got := m.Ephemerals(); !slices.Equal(got, want) {
+		t.Errorf("ephemerals = %+v, want %+v", got, want)
+	}
+}
+
+func TestRetryGoesThroughPipeline(t *testing.T) {
+	ctx := context.Background()
+	backend := newFakeBackend()
+	b, m := newTestBot(backend, time.Millisecond)
+	b.SetConversationStore(store.NewMemoryStore())
+
+	ts, err := m.Post(ctx, models.OutgoingMessage{Conversation: "C1", Text: placeholder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc := pendingConversation{ReplyTs: ts, Message: mention("1.1", "q"), Settings: channelSettings()}
+	b.offerRetry(ctx, "C1/1.1", pc)
+
+	// Turned away: nothing is asked and the offer stays.
+	b.SetHandler(refuser{m})
+	if err := b.HandleRetry(ctx, "C1", ts, "U1", "C1/1.1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.queries()) != 0 {
+		t.Fatalf("refused retry reached the backend")
+	}
+
+	// Let through: answered in the original reply.
+	b.SetHandler(nil)
+	if err := b.HandleRetry(ctx, "C1", ts, "U1", "C1/1.1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := onlyMessage(t, m).Text(); got != "You asked: q\n\n"+footer {
+		t.Errorf("reply = %q", got)
+	}
+	if ok, _ := store.GetJSON(ctx, b.store, retryPrefix+"C1/1.1", &pc); ok {
+		t.Error("retry offer kept after the retry was answered")
+	}
+}
+
+func TestRerunGoesThroughPipeline(t *testing.T) {
+	for _, refused := range []bool{true, false} {
+		t.Run(fmt.Sprintf("refused=%v", refused), func(t *testing.T) {
+			ctx := context.Background()
+			backend := newFakeBackend()
+			b, m := newTestBot(backend, time.Millisecond)
+			b.SetConversationStore(store.NewMemoryStore())
+			if refused {
+				b.SetHandler(refuser{m})
+			}
+
+			ts, err := m.Post(ctx, models.OutgoingMessage{Conversation: "C1", Text: placeholder})
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.persist(ctx, "C1/1.1", pendingConversation{ReplyTs: ts, Message: mention("1.1", "q"), Settings: channelSettings()})
+			if err := b.Recover(ctx, RecoveryRerun); err != nil {
+				t.Fatal(err)
+			}
+
+			// Turned away, the reply offers a retry; let through, it is
+			// answered in place.
+			want := "You asked: q\n\n" + footer
+			if refused {
+				want = apologyMessage
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for onlyMessage(t, m).Text() != want {
+				if time.Now().After(deadline) {
+					t.Fatalf("reply = %q, want %q", onlyMessage(t, m).Text(), want)
+				}
+				time.Sleep(time.Millisecond)
+			}
+			if refused && len(backend.queries()) != 0 {
+				t.Error("refused rerun reached the backend")
+			}
+			var pc pendingConversation
+			if ok, _ := store.GetJSON(ctx, b.store, retryPrefix+"C1/1.1", &pc); ok != refused {
+				t.Errorf("retry offer saved = %v, want %v", ok, refused)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package bot
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"chatrelay-bot/internal/adapter"
+	"chatrelay-bot/internal/store"
+	"chatrelay-bot/pkg/models"
+)
+
+// Recovery modes for replies left unfinished by a previous process.
+const (
+	RecoveryApologize = "apologize"
+	RecoveryRerun     = "rerun"
+)
+
+const (
+	conversationPrefix = "conversation/"
+	retryPrefix        = "retry/"
+	// retryOfferTTL is how long a retry button keeps working.
+	retryOfferTTL = 24 * time.Hour
+
+	apologyMessage = "Sorry, I was restarted before I could finish answering. Press Retry to ask again."
+)
+
+// pendingConversation is the persisted form of an ongoing conversation.
+type pendingConversation struct {
+	ReplyTs   string                 `json:"reply_ts"`
+	Message   models.IncomingMessage `json:"message"`
+	Settings  models.ChannelSettings `json:"settings"`
+	StartedAt time.Time              `json:"started_at"`
+}
+
+func (b *ChatRelayBot) persist(ctx context.Context, key string, pc pendingConversation) {
+	if b.store == nil {
+		return
+	}
+	if err := store.PutJSON(ctx, b.store, conversationPrefix+key, pc); err != nil {
+		slog.ErrorContext(ctx, "Failed to persist conversation", "error", err, "key", key)
+	}
+}
+
+func (b *ChatRelayBot) forget(ctx context.Context, key string) {
+	if b.store == nil {
+		return
+	}
+	if err := b.store.Delete(context.WithoutCancel(ctx), conversationPrefix+key); err != nil {
+		slog.ErrorContext(ctx, "Failed to remove persisted conversation", "error", err, "key", key)
+	}
+}
+
+// Recover finds replies that a previous process left unfinished and either
+// answers them again in place (RecoveryRerun) or replaces the placeholder
+// with an apology and a retry button. It must run before the bot starts
+// taking new mentions.
+func (b *ChatRelayBot) Recover(ctx context.Context, mode string) error {
+	if b.store == nil || b.messenger == nil {
+		return nil
+	}
+	tracer := otel.Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, "RecoverConversations", trace.WithAttributes(attribute.String("recovery.mode", mode)))
+	defer span.End()
+
+	b.pruneRetryOffers(ctx)
+
+	keys, err := b.store.List(ctx, conversationPrefix)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to list conversations")
+		return err
+	}
+	span.SetAttributes(attribute.Int("recovery.count", len(keys)))
+	if len(keys) > 0 {
+		slog.InfoContext(ctx, "Recovering unfinished replies", "count", len(keys), "mode", mode)
+	}
+
+	for _, storeKey := range keys {
+		var pc pendingConversation
+		ok, err := store.GetJSON(ctx, b.store, storeKey, &pc)
+		if err != nil || !ok {
+			slog.ErrorContext(ctx, "Failed to read persisted conversation", "error", err, "key", storeKey)
+			b.store.Delete(ctx, storeKey)
+			continue
+		}
+		if !b.owns(pc.Message) {
+			// Another platform's bot shares the store and recovers it.
+			continue
+		}
+		// The record belongs to the previous process; answer will write a
+		// fresh one if it runs again.
+		b.store.Delete(ctx, storeKey)
+
+		key := strings.TrimPrefix(storeKey, conversationPrefix)
+		if mode == RecoveryRerun {
+			slog.InfoContext(ctx, "Re-running unfinished conversation", "channel", pc.Message.Conversation, "timestamp", pc.ReplyTs)
+			go b.rerun(context.WithoutCancel(ctx), key, pc)
+			continue
+		}
+		b.offerRetry(ctx, key, pc)
+	}
+	span.SetStatus(codes.Ok, "Recovery complete")
+	return nil
+}
+
+// rerun answers a recovered conversation again in its original reply. The
+// message goes through the whole pipeline, like a new one; if it is turned
+// away, the reply offers a retry instead.
+func (b *ChatRelayBot) rerun(ctx context.Context, key string, pc pendingConversation) {
+	reached, err := b.reanswer(ctx, pc.Message, pc.Settings, pc.ReplyTs)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to re-run unfinished conversation", "error", err, "channel", pc.Message.Conversation, "timestamp", pc.ReplyTs)
+	}
+	if !reached {
+		b.offerRetry(ctx, key, pc)
+	}
+}
+
+// owns reports whether msg came in through this bot's adapter.
+func (b *ChatRelayBot) owns(msg models.IncomingMessage) bool {
+	a, ok := b.messenger.(adapter.Adapter)
+	return !ok || msg.Platform == "" || msg.Platform == a.Name()
+}
+
+func (b *ChatRelayBot) offerRetry(ctx context.Context, key string, pc pendingConversation) {
+	pc.StartedAt = time.Now()
+	if err := store.PutJSON(ctx, b.store, retryPrefix+key, pc); err != nil {
+		slog.ErrorContext(ctx, "Failed to save retry offer", "error", err, "key", key)
+		return
+	}
+	apology := models.OutgoingMessage{
+		Conversation: pc.Message.Conversation,
+		Text:         apologyMessage,
+		Actions:      []models.Action{{ID: adapter.RetryAction, Label: "Retry", Value: key}},
+	}
+	if err := b.messenger.Update(ctx, pc.ReplyTs, apology); err != nil {
+		slog.ErrorContext(ctx, "Failed to replace stale placeholder", "error", err, "channel", pc.Message.Conversation, "timestamp", pc.ReplyTs)
+		b.store.Delete(ctx, retryPrefix+key)
+		return
+	}
+	slog.InfoContext(ctx, "Replaced stale placeholder with retry offer", "channel", pc.Message.Conversation, "timestamp", pc.ReplyTs)
+}
+
+func (b *ChatRelayBot) pruneRetryOffers(ctx context.Context) {
+	keys, err := b.store.List(ctx, retryPrefix)
+	if err != nil {
+		return
+	}
+	for _, key := range keys {
+		var pc pendingConversation
+		if ok, err := store.GetJSON(ctx, b.store, key, &pc); err != nil || !ok || time.Since(pc.StartedAt) > retryOfferTTL {
+			b.store.Delete(ctx, key)
+		}
+	}
+}
+
+// HandleRetry answers a recovered conversation again in its original reply
+// when the user who asked presses its retry button. The retry goes through
+// the whole pipeline, like a new message.
+func (b *ChatRelayBot) HandleRetry(ctx context.Context, channelID, messageTs, userID, value string) error {
+	if b.store == nil {
+		return nil
+	}
+	var pc pendingConversation
+	ok, err := store.GetJSON(ctx, b.store, retryPrefix+value, &pc)
+	if err != nil {
+		return err
+	}
+	if !ok || pc.Message.Conversation != channelID || pc.ReplyTs != messageTs {
+		slog.WarnContext(ctx, "Retry requested for unknown or expired conversation", "channel", channelID, "timestamp", messageTs)
+		return b.messenger.Notify(ctx, channelID, userID, "This answer can no longer be retried. Please ask again.")
+	}
+	if userID != pc.Message.Author.ID {
+		return b.messenger.Notify(ctx, channelID, userID, "Only the person who asked can retry this answer.")
+	}
+	if err := b.store.Delete(ctx, retryPrefix+value); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Retrying recovered conversation", "channel", channelID, "timestamp", messageTs, "user", userID)
+	reached, err := b.reanswer(ctx, pc.Message, pc.Settings, pc.ReplyTs)
+	if !reached {
+		// Turned away, such as by a rate limit: keep the offer so the user
+		// can press Retry again later.
+		if err := store.PutJSON(ctx, b.store, retryPrefix+value, pc); err != nil {
+			slog.ErrorContext(ctx, "Failed to restore retry offer", "error", err, "key", value)
+		}
+	}
+	return err
+}
@@ -0,0 +1,136 @@
+package chatbackend
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"chatrelay-bot/internal/health"
+)
+
+var ErrCircuitOpen = errors.New("chat backend circuit is open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker fails chat requests fast once the backend has failed
+// threshold times in a row. After the cooldown a single trial request is let
+// through; its result closes or re-opens the circuit. A threshold of zero
+// disables the breaker.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	state     breakerState
+	openedAt  time.Time
+	trialSent bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	health.Register(health.Backend, "circuit closed")
+	health.Set(health.Backend, true, "circuit closed")
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// configure changes the threshold and cooldown without resetting the
+// current state. Disabling the breaker closes an open circuit.
+func (b *circuitBreaker) configure(threshold int, cooldown time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.threshold = threshold
+	b.cooldown = cooldown
+	if threshold <= 0 && b.state != breakerClosed {
+		b.failures = 0
+		b.trialSent = false
+		b.setState(breakerClosed)
+	}
+}
+
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 {
+		return nil
+	}
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return fmt.Errorf("%w: retry after %s", ErrCircuitOpen, b.cooldown-time.Since(b.openedAt).Round(time.Second))
+		}
+		b.setState(breakerHalfOpen)
+		b.trialSent = true
+		return nil
+	case breakerHalfOpen:
+		if b.trialSent {
+			return fmt.Errorf("%w: trial request in progress", ErrCircuitOpen)
+		}
+		b.trialSent = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+func (b *circuitBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 {
+		return
+	}
+	b.failures = 0
+	b.trialSent = false
+	if b.state != breakerClosed {
+		b.setState(breakerClosed)
+	}
+}
+
+func (b *circuitBreaker) recordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 {
+		return
+	}
+	b.failures++
+	b.trialSent = false
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		if b.state != breakerOpen {
+			b.setState(breakerOpen)
+		}
+	}
+}
+
+// recordCancelled releases a half-open trial whose request was abandoned by
+// the caller, without counting it for or against the backend.
+func (b *circuitBreaker) recordCancelled() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 {
+		return
+	}
+	b.trialSent = false
+}
+
+// setState must be called with b.mu held.
+func (b *circuitBreaker) setState(state breakerState) {
+	b.state = state
+	health.Set(health.Backend, state == breakerClosed, "circuit "+state.String())
+}
@@ -0,0 +1,148 @@
+package chatbackend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"chatrelay-bot/internal/health"
+	"chatrelay-bot/pkg/models"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := newCircuitBreaker(2, time.Hour)
+
+	b.recordFailure()
+	if err := b.allow(); err != nil {
+		t.Fatalf("allow after one failure = %v", err)
+	}
+	b.recordFailure()
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("allow after two failures = %v, want %v", err, ErrCircuitOpen)
+	}
+
+	// After the cooldown one trial request goes through at a time.
+	b.configure(2, 0)
+	if err := b.allow(); err != nil {
+		t.Fatalf("trial allow = %v", err)
+	}
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second allow during trial = %v, want %v", err, ErrCircuitOpen)
+	}
+	b.recordCancelled()
+	if err := b.allow(); err != nil {
+		t.Fatalf("allow after cancelled trial = %v", err)
+	}
+	b.recordFailure()
+	if b.state != breakerOpen {
+		t.Fatalf("state after failed trial = %v, want open", b.state)
+	}
+	b.allow()
+	b.recordSuccess()
+	if b.state != breakerClosed || b.failures != 0 {
+		t.Fatalf("state after successful trial = %v with %d failures, want closed", b.state, b.failures)
+	}
+
+	// Disabling the breaker closes an open circuit.
+	b.configure(1, time.Hour)
+	b.recordFailure()
+	b.configure(0, time.Hour)
+	if err := b.allow(); err != nil {
+		t.Errorf("allow with the breaker disabled = %v", err)
+	}
+	if b.state != breakerClosed {
+		t.Errorf("state with the breaker disabled = %v, want closed", b.state)
+	}
+}
+
+func TestOpenCircuitFailsFastAndReportsNotReady(t *testing.T) {
+	var calls atomic.Int64
+	var healthy atomic.Bool
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			http.Error(w, "down", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"full_response":"ok"}`)
+	}))
+	defer backend.Close()
+
+	c := NewClient(backend.URL, time.Second, 0, 0, 2, 50*time.Millisecond)
+	ctx := context.Background()
+	req := models.ChatRequest{UserID: "U1", Query: "hi"}
+	ready := func() bool { return health.Default().Report().Dependencies[health.Backend].Ready }
+	if !ready() {
+		t.Fatal("backend not ready before any request")
+	}
+
+	for range 2 {
+		if _, err := c.SendChatRequest(ctx, req); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("SendChatRequest = %v, want the backend's error", err)
+		}
+	}
+	if _, err := c.SendChatRequest(ctx, req); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("SendChatRequest with the circuit open = %v, want %v", err, ErrCircuitOpen)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("backend called %d times, want the open circuit to stop the third request", n)
+	}
+	if ready() {
+		t.Error("backend reported ready with the circuit open")
+	}
+
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	if _, err := c.SendChatRequest(ctx, req); err != nil {
+		t.Fatalf("trial request after the cooldown = %v", err)
+	}
+	if !ready() {
+		t.Error("backend not ready after a successful trial request")
+	}
+}
+
+// TestReloadDuringRequests is meant to be run with -race.
+func TestReloadDuringRequests(t *testing.T) {
+	var calls atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1)%3 == 0 {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"full_response":"ok"}`)
+	}))
+	defer backend.Close()
+
+	c := NewClient(backend.URL, time.Second, 0, 0, 2, time.Millisecond).(*httpClient)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				c.SendChatRequest(ctx, models.ChatRequest{UserID: fmt.Sprintf("U%d", i), Query: "hi"})
+			}
+		}()
+	}
+	for i := 0; ctx.Err() == nil; i++ {
+		c.ApplyConfig(&models.AppConfig{
+			RequestTimeout:          time.Second,
+			BackendBreakerThreshold: i % 3,
+			BackendBreakerCooldown:  time.Millisecond,
+		})
+		time.Sleep(time.Millisecond)
+	}
+	wg.Wait()
+	if calls.Load() == 0 {
+		t.Error("no requests reached the backend")
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"go.opentelemetry.io/otel"
@@ -15,6 +17,8 @@ import (
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 
+	"chatrelay-bot/internal/redact"
+	"chatrelay-bot/internal/telemetry"
 	"chatrelay-bot/pkg/models"
 )
 
@@ -25,21 +29,46 @@ type Client interface {
 }
 
 type httpClient struct {
-	baseURL    string
+	baseURL  string
+	settings atomic.Pointer[clientSettings]
+	breaker  *circuitBreaker
+}
+
+// clientSettings are the parts of the client that can be changed by a config
+// reload. Each request reads them once, so a reload never mixes old and new
+// values within a request.
+type clientSettings struct {
 	httpClient *http.Client
 	retryCount int
 	retryDelay time.Duration
 }
 
-func NewClient(baseURL string, timeout time.Duration, retryCount int, retryDelay time.Duration) Client {
-	return &httpClient{
+func NewClient(baseURL string, timeout time.Duration, retryCount int, retryDelay time.Duration, breakerThreshold int, breakerCooldown time.Duration) Client {
+	c := &httpClient{
 		baseURL: baseURL,
+		breaker: newCircuitBreaker(breakerThreshold, breakerCooldown),
+	}
+	c.settings.Store(&clientSettings{
 		httpClient: &http.Client{
 			Timeout: timeout,
 		},
 		retryCount: retryCount,
 		retryDelay: retryDelay,
-	}
+	})
+	return c
+}
+
+// ApplyConfig updates the timeout, retry and circuit breaker settings from a
+// reloaded configuration.
+func (c *httpClient) ApplyConfig(cfg *models.AppConfig) {
+	c.settings.Store(&clientSettings{
+		httpClient: &http.Client{
+			Timeout: cfg.RequestTimeout,
+		},
+		retryCount: cfg.BackendAPIRetryCount,
+		retryDelay: cfg.BackendAPIRetryDelay,
+	})
+	c.breaker.configure(cfg.BackendBreakerThreshold, cfg.BackendBreakerCooldown)
 }
 
 func (c *httpClient) SendChatRequest(ctx context.Context, req models.ChatRequest) (res models.ChatResponse, err error) {
@@ -47,28 +76,51 @@ func (c *httpClient) SendChatRequest(ctx context.Context, req models.ChatRequest
 	ctx, span := tracer.Start(ctx, "SendChatRequest",
 		trace.WithAttributes(
 			attribute.String("chat.user_id", req.UserID),
-			attribute.String("chat.query", req.Query),
+			redact.Attr("chat.query", req.Query),
 		),
 	)
+	start := time.Now()
 	defer func() {
+		switch {
+		case err == nil:
+			c.breaker.recordSuccess()
+		case errors.Is(err, ErrCircuitOpen):
+		case ctx.Err() != nil:
+			c.breaker.recordCancelled()
+		default:
+			c.breaker.recordFailure()
+		}
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
+			telemetry.RecordBackendLatency(ctx, time.Since(start), telemetry.OutcomeBackendError)
 		} else {
 			span.SetStatus(codes.Ok, "Chat request successful")
+			telemetry.RecordBackendLatency(ctx, time.Since(start), telemetry.OutcomeSuccess)
 		}
 		span.End()
 	}()
 
+	if err := c.breaker.allow(); err != nil {
+		slog.WarnContext(ctx, "Chat backend circuit is open, failing fast", "error", err)
+		return models.ChatResponse{}, err
+	}
+
+	settings := c.settings.Load()
+
 	requestBody, err := json.Marshal(req)
 	if err != nil {
 		slog.ErrorContext(ctx, "Failed to marshal chat request", "error", err)
 		return models.ChatResponse{}, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	url := fmt.Sprintf("%s/v1/chat/stream", c.baseURL)
+	baseURL := c.baseURL
+	if req.BackendURL != "" {
+		baseURL = req.BackendURL
+	}
+	url := fmt.Sprintf("%s/v1/chat/stream", baseURL)
 
-	for i := 0; i <= c.retryCount; i++ {
+	for i := 0; i <= settings.retryCount; i++ {
 		attemptCtx, attemptSpan := tracer.Start(ctx, "HTTP POST to Chat Backend",
 			trace.WithAttributes(
 				attribute.String("http.url", url),
@@ -88,17 +140,18 @@ func (c *httpClient) SendChatRequest(ctx context.Context, req models.ChatRequest
 
 		slog.InfoContext(attemptCtx, "Sending request to chat backend", "url", url, "attempt", i+1)
 
-		httpRes, err := c.httpClient.Do(httpReq)
+		httpRes, err := settings.httpClient.Do(httpReq)
 		if err != nil {
 			slog.ErrorContext(attemptCtx, "HTTP request failed", "error", err, "attempt", i+1)
 			attemptSpan.RecordError(err)
 			attemptSpan.SetStatus(codes.Error, fmt.Sprintf("HTTP request failed: %v", err))
 			attemptSpan.End()
-			if i < c.retryCount {
-				time.Sleep(c.retryDelay)
+			if i < settings.retryCount {
+				telemetry.RecordRetry(ctx, "backend", "chat.stream")
+				time.Sleep(settings.retryDelay)
 				continue
 			}
-			return models.ChatResponse{}, fmt.Errorf("HTTP request to chat backend failed after %d retries: %w", c.retryCount, err)
+			return models.ChatResponse{}, fmt.Errorf("HTTP request to chat backend failed after %d retries: %w", settings.retryCount, err)
 		}
 		defer httpRes.Body.Close()
 
@@ -111,11 +164,12 @@ func (c *httpClient) SendChatRequest(ctx context.Context, req models.ChatRequest
 			attemptSpan.RecordError(err)
 			attemptSpan.SetStatus(codes.Error, err.Error())
 			attemptSpan.End()
-			if i < c.retryCount {
-				time.Sleep(c.retryDelay)
+			if i < settings.retryCount {
+				telemetry.RecordRetry(ctx, "backend", "chat.stream")
+				time.Sleep(settings.retryDelay)
 				continue
 			}
-			return models.ChatResponse{}, fmt.Errorf("chat backend returned error status after %d retries: %w", c.retryCount, err)
+			return models.ChatResponse{}, fmt.Errorf("chat backend returned error status after %d retries: %w", settings.retryCount, err)
 		}
 
 		body, err := io.ReadAll(httpRes.Body)
@@ -142,5 +196,5 @@ func (c *httpClient) SendChatRequest(ctx context.Context, req models.ChatRequest
 		return res, nil
 	}
 
-	return models.ChatResponse{}, fmt.Errorf("failed to send chat request after %d retries", c.retryCount)
+	return models.ChatResponse{}, fmt.Errorf("failed to send chat request after %d retries", settings.retryCount)
 }
\ No newline at end of file
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ParseAPIKeys parses API_KEYS: comma-separated name:key pairs. It returns
+// a map from each key to the name of the client it belongs to.
+func ParseAPIKeys(s string) (map[string]string, error) {
+	keys := make(map[string]string)
+	names := make(map[string]bool)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(pair, ":")
+		name, key = strings.TrimSpace(name), strings.TrimSpace(key)
+		if !ok || name == "" || key == "" {
+			return nil, errors.New("entries must be name:key")
+		}
+		if names[name] {
+			return nil, fmt.Errorf("client %q is listed twice", name)
+		}
+		if _, dup := keys[key]; dup {
+			return nil, fmt.Errorf("client %q reuses another client's key", name)
+		}
+		names[name] = true
+		keys[key] = name
+	}
+	return keys, nil
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"sync/atomic"
+
+	"chatrelay-bot/pkg/models"
+)
+
+// ResolveChannelSettings resolves the behaviour for an event in channelID of
+// workspace teamID: global settings first, then the workspace override, then
+// the channel override. BackendURL stays empty unless an override sets it.
+func ResolveChannelSettings(cfg *models.AppConfig, teamID, channelID string) models.ChannelSettings {
+	settings := models.ChannelSettings{
+		Enabled:         cfg.BotEnabled,
+		Placeholder:     cfg.PlaceholderText,
+		Footer:          cfg.FooterText,
+		Streaming:       cfg.StreamingEnabled,
+		ThreadOnly:      cfg.ThreadOnlyReplies,
+		MaxAnswerLength: cfg.MaxAnswerLength,
+		Language:        cfg.AnswerLanguage,
+	}
+	if override, ok := cfg.WorkspaceOverrides[teamID]; ok && teamID != "" {
+		applyOverride(&settings, override)
+	}
+	if override, ok := cfg.ChannelOverrides[channelID]; ok && channelID != "" {
+		applyOverride(&settings, override)
+	}
+	return settings
+}
+
+func applyOverride(settings *models.ChannelSettings, o models.ChannelOverride) {
+	if o.Enabled != nil {
+		settings.Enabled = *o.Enabled
+	}
+	if o.Placeholder != nil {
+		settings.Placeholder = *o.Placeholder
+	}
+	if o.Footer != nil {
+		settings.Footer = *o.Footer
+	}
+	if o.BackendURL != nil {
+		settings.BackendURL = *o.BackendURL
+	}
+	if o.Streaming != nil {
+		settings.Streaming = *o.Streaming
+	}
+	if o.ThreadOnly != nil {
+		settings.ThreadOnly = *o.ThreadOnly
+	}
+	if o.MaxAnswerLength != nil {
+		settings.MaxAnswerLength = *o.MaxAnswerLength
+	}
+	if o.Language != nil {
+		settings.Language = *o.Language
+	}
+}
+
+// ChannelResolver resolves channel settings against the current
+// configuration and follows hot reloads.
+type ChannelResolver struct {
+	cfg atomic.Pointer[models.AppConfig]
+}
+
+func NewChannelResolver(cfg *models.AppConfig) *ChannelResolver {
+	r := &ChannelResolver{}
+	r.cfg.Store(cfg)
+	return r
+}
+
+func (r *ChannelResolver) Resolve(teamID, channelID string) models.ChannelSettings {
+	return ResolveChannelSettings(r.cfg.Load(), teamID, channelID)
+}
+
+func (r *ChannelResolver) ApplyConfig(cfg *models.AppConfig) {
+	r.cfg.Store(cfg)
+}
@@ -1,113 +1,400 @@
 package config
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"os"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"log/slog"
 
-	"github.com/joho/godotenv"
+	"chatrelay-bot/internal/redact"
+	"chatrelay-bot/internal/secrets"
 	"chatrelay-bot/pkg/models"
+	"github.com/joho/godotenv"
+)
+
+// Source records where the effective value of a setting came from.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceDotEnv  Source = ".env"
+	SourceEnv     Source = "env"
+	// SourceSecretFile and SourceSecretCommand mark secrets resolved through
+	// the NAME_FILE and NAME_COMMAND variants of a secret setting.
+	SourceSecretFile    Source = "secret file"
+	SourceSecretCommand Source = "secret command"
 )
 
+// ConfigPathEnv names the environment variable holding the optional config
+// file path.
+const ConfigPathEnv = "CHATRELAY_CONFIG"
+
+// Result is a loaded configuration together with the origin of each value,
+// keyed by environment variable name.
+type Result struct {
+	Config  *models.AppConfig
+	Path    string
+	Sources map[string]Source
+	// Secrets holds the provider of each secret setting that was read from
+	// a file or command, so it can be re-read when it rotates.
+	Secrets map[string]secrets.SecretProvider
+}
+
+// LoadConfig loads configuration using the file named by CHATRELAY_CONFIG,
+// if any. See Load for the precedence order.
 func LoadConfig() (*models.AppConfig, error) {
-	err := godotenv.Load()
+	res, err := Load(os.Getenv(ConfigPathEnv))
+	if err != nil {
+		return nil, err
+	}
+	return res.Config, nil
+}
+
+// Load builds the configuration from, in increasing order of precedence:
+//
+//  1. defaults from the `env` struct tags on models.AppConfig
+//  2. the YAML or TOML config file at path, if path is non-empty
+//  3. the .env file in the working directory
+//  4. process environment variables
+//
+// Every malformed value and failed validation rule is reported together in
+// the returned error.
+func Load(path string) (*Result, error) {
+	// .env is read rather than loaded into the process environment so that
+	// a reload picks up edits to it.
+	dotEnv, err := godotenv.Read()
 	if err != nil && !os.IsNotExist(err) {
 		slog.Warn("Error loading .env file", "error", err)
 	}
 
 	cfg := models.NewConfig()
+	res := &Result{Config: cfg, Path: path, Sources: make(map[string]Source), Secrets: make(map[string]secrets.SecretProvider)}
+	var errs []error
 
-	getEnv := func(key, defaultValue string) string {
-		if value, exists := os.LookupEnv(key); exists {
-			return value
+	fields := settingFields(cfg)
+	for _, f := range fields {
+		res.Sources[f.env] = SourceDefault
+		if f.defaultValue == "" {
+			continue
+		}
+		if err := f.set(f.defaultValue); err != nil {
+			errs = append(errs, fmt.Errorf("default for %s: %w", f.env, err))
 		}
-		return defaultValue
 	}
 
-	getRequiredEnv := func(key string) (string, error) {
-		if value, exists := os.LookupEnv(key); exists && value != "" {
-			return value, nil
+	fileValues := make(map[string]any)
+	if path != "" {
+		fileValues, err = readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		known := make(map[string]bool, len(fields))
+		for _, f := range fields {
+			key := f.fileKey()
+			known[key] = true
+			if f.secret {
+				known[key+"_file"] = true
+				known[key+"_command"] = true
+			}
+			raw, ok := fileValues[key]
+			if !ok {
+				continue
+			}
+			if err := f.setFromFile(raw); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s: %w", path, key, err))
+				continue
+			}
+			res.Sources[f.env] = SourceFile
+		}
+		for _, b := range blockFields(cfg) {
+			known[b.key] = true
+			raw, ok := fileValues[b.key]
+			if !ok || raw == nil {
+				continue
+			}
+			if err := decodeBlock(raw, b.value.Addr().Interface()); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s: %w", path, b.key, err))
+				continue
+			}
+			res.Sources[b.key] = SourceFile
+		}
+		for key := range fileValues {
+			if !known[key] {
+				errs = append(errs, fmt.Errorf("%s: unknown setting %q", path, key))
+			}
 		}
-		slog.Error("Missing required environment variable", "key", key)
-		return "", errors.New("required environment variable " + key + " not set")
 	}
 
-	cfg.SlackAppToken, err = getRequiredEnv("SLACK_APP_TOKEN")
-	if err != nil {
-		return nil, err
+	for _, f := range fields {
+		source := SourceEnv
+		value, exists := os.LookupEnv(f.env)
+		if !exists {
+			source = SourceDotEnv
+			value, exists = dotEnv[f.env]
+		}
+		if !exists {
+			continue
+		}
+		if err := f.set(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.env, err))
+			continue
+		}
+		res.Sources[f.env] = source
 	}
-	cfg.SlackBotToken, err = getRequiredEnv("SLACK_BOT_TOKEN")
-	if err != nil {
-		return nil, err
+
+	for _, f := range fields {
+		if !f.secret {
+			continue
+		}
+		provider, source, err := secretProvider(f, fileValues, dotEnv)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if provider == nil {
+			continue
+		}
+		value, err := provider.Fetch(context.Background())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.env, err))
+			continue
+		}
+		f.value.SetString(value)
+		res.Sources[f.env] = source
+		res.Secrets[f.env] = provider
 	}
-	cfg.ChatBackendURL, err = getRequiredEnv("CHAT_BACKEND_URL")
-	if err != nil {
-		return nil, err
+
+	for _, f := range fields {
+		if f.required && f.value.IsZero() {
+			errs = append(errs, &MissingSettingError{Name: f.env})
+		}
 	}
+	errs = append(errs, validate(cfg)...)
 
-	cfg.ListenPort = getEnv("LISTEN_PORT", "8080")
-	cfg.MockBackendPort = getEnv("MOCK_BACKEND_PORT", "8081")
-	cfg.TelemetryExporter = getEnv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
-	cfg.TelemetryEndpoint = getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "localhost:4317")
-	cfg.ServiceName = getEnv("OTEL_SERVICE_NAME", "chatrelay-bot")
+	if len(errs) > 0 {
+		return res, errors.Join(errs...)
+	}
+	return res, nil
+}
+
+// MissingSettingError reports a required setting that was not set.
+type MissingSettingError struct {
+	Name string
+}
 
-	if timeoutStr := getEnv("REQUEST_TIMEOUT", ""); timeoutStr != "" {
-		if timeout, err := time.ParseDuration(timeoutStr); err == nil {
-			cfg.RequestTimeout = timeout
-		} else {
-			slog.Warn("Invalid REQUEST_TIMEOUT format, using default", "value", timeoutStr, "error", err)
-			cfg.RequestTimeout = 30 * time.Second
+func (e *MissingSettingError) Error() string {
+	return "required setting " + e.Name + " not set"
+}
+
+// secretProvider returns the provider configured for a secret setting via
+// NAME_FILE or NAME_COMMAND, looked up with the same precedence as other
+// settings. Either variant takes precedence over NAME itself.
+func secretProvider(f field, fileValues map[string]any, dotEnv map[string]string) (secrets.SecretProvider, Source, error) {
+	lookup := func(key string) (string, bool) {
+		if value, ok := os.LookupEnv(key); ok && value != "" {
+			return value, true
+		}
+		if value, ok := dotEnv[key]; ok && value != "" {
+			return value, true
+		}
+		if value, ok := fileValues[strings.ToLower(key)]; ok && value != nil {
+			return fmt.Sprint(value), true
+		}
+		return "", false
+	}
+
+	filePath, hasFile := lookup(f.env + "_FILE")
+	command, hasCommand := lookup(f.env + "_COMMAND")
+	switch {
+	case hasFile && hasCommand:
+		return nil, "", fmt.Errorf("only one of %s_FILE and %s_COMMAND may be set", f.env, f.env)
+	case hasFile:
+		return secrets.NewFileProvider(filePath), SourceSecretFile, nil
+	case hasCommand:
+		return secrets.NewExecProvider(command), SourceSecretCommand, nil
+	default:
+		return nil, "", nil
+	}
+}
+
+// Setting is one effective configuration value as shown by
+// `chatrelay config check`. Secret values are redacted.
+type Setting struct {
+	Name   string
+	Value  string
+	Source Source
+}
+
+func (r *Result) Settings() []Setting {
+	fields := settingFields(r.Config)
+	settings := make([]Setting, 0, len(fields))
+	for _, f := range fields {
+		value := f.String()
+		if f.secret {
+			value = redact.Secret(value)
 		}
-	} else {
-		cfg.RequestTimeout = 30 * time.Second
+		settings = append(settings, Setting{Name: f.env, Value: value, Source: r.Sources[f.env]})
 	}
+	// Override blocks are listed by the IDs they cover.
+	for _, b := range blockFields(r.Config) {
+		source, ok := r.Sources[b.key]
+		if !ok {
+			source = SourceDefault
+		}
+		ids := make([]string, 0, b.value.Len())
+		for _, key := range b.value.MapKeys() {
+			ids = append(ids, key.String())
+		}
+		sort.Strings(ids)
+		settings = append(settings, Setting{Name: b.key, Value: strings.Join(ids, ","), Source: source})
+	}
+	return settings
+}
 
-	if retryStr := getEnv("SLACK_API_RETRY_COUNT", ""); retryStr != "" {
-		if count, err := strconv.Atoi(retryStr); err == nil {
-			cfg.SlackAPIRetryCount = count
-		} else {
-			slog.Warn("Invalid SLACK_API_RETRY_COUNT, using default", "value", retryStr, "error", err)
-			cfg.SlackAPIRetryCount = 3
+// Value returns the effective value of the named setting in its string
+// form, unredacted.
+func (r *Result) Value(name string) string {
+	for _, f := range settingFields(r.Config) {
+		if f.env == name {
+			return f.String()
 		}
-	} else {
-		cfg.SlackAPIRetryCount = 3
 	}
+	return ""
+}
+
+// field is one setting on models.AppConfig described by its `env` tag.
+type field struct {
+	env          string
+	required     bool
+	secret       bool
+	defaultValue string
+	value        reflect.Value
+}
 
-	if delayStr := getEnv("SLACK_API_RETRY_DELAY", ""); delayStr != "" {
-		if delay, err := time.ParseDuration(delayStr); err == nil {
-			cfg.SlackAPIRetryDelay = delay
-		} else {
-			slog.Warn("Invalid SLACK_API_RETRY_DELAY, using default", "value", delayStr, "error", err)
-			cfg.SlackAPIRetryDelay = 1 * time.Second
+func settingFields(cfg *models.AppConfig) []field {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	fields := make([]field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("env")
+		if !ok || tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		f := field{env: parts[0], value: v.Field(i), secret: sf.Tag.Get("secret") == "true"}
+		for _, opt := range parts[1:] {
+			switch {
+			case opt == "required":
+				f.required = true
+			case strings.HasPrefix(opt, "default="):
+				f.defaultValue = strings.TrimPrefix(opt, "default=")
+			}
 		}
-	} else {
-		cfg.SlackAPIRetryDelay = 1 * time.Second
+		fields = append(fields, f)
 	}
+	return fields
+}
+
+// blockField is a nested block on models.AppConfig that can only be set in
+// the config file, described by its `file` tag.
+type blockField struct {
+	key   string
+	value reflect.Value
+}
 
-	if retryStr := getEnv("BACKEND_API_RETRY_COUNT", ""); retryStr != "" {
-		if count, err := strconv.Atoi(retryStr); err == nil {
-			cfg.BackendAPIRetryCount = count
-		} else {
-			slog.Warn("Invalid BACKEND_API_RETRY_COUNT, using default", "value", retryStr, "error", err)
-			cfg.BackendAPIRetryCount = 3
+func blockFields(cfg *models.AppConfig) []blockField {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	var blocks []blockField
+	for i := 0; i < t.NumField(); i++ {
+		if key, ok := t.Field(i).Tag.Lookup("file"); ok {
+			blocks = append(blocks, blockField{key: key, value: v.Field(i)})
 		}
-	} else {
-		cfg.BackendAPIRetryCount = 3
 	}
+	return blocks
+}
+
+// fileKey is the key used for the setting in config files: the environment
+// variable name in lower case, e.g. request_timeout.
+func (f field) fileKey() string {
+	return strings.ToLower(f.env)
+}
 
-	if delayStr := getEnv("BACKEND_API_RETRY_DELAY", ""); delayStr != "" {
-		if delay, err := time.ParseDuration(delayStr); err == nil {
-			cfg.BackendAPIRetryDelay = delay
-		} else {
-			slog.Warn("Invalid BACKEND_API_RETRY_DELAY, using default", "value", delayStr, "error", err)
-			cfg.BackendAPIRetryDelay = 1 * time.Second
+func (f field) set(raw string) error {
+	switch f.value.Interface().(type) {
+	case string:
+		f.value.SetString(raw)
+	case time.Duration:
+		d, err := time.ParseDuration(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		f.value.SetInt(int64(d))
+	case int:
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
 		}
-	} else {
-		cfg.BackendAPIRetryDelay = 1 * time.Second
+		f.value.SetInt(int64(n))
+	case bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		f.value.SetBool(b)
+	case float64:
+		n, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		f.value.SetFloat(n)
+	case []string:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", f.value.Type())
 	}
+	return nil
+}
 
-	return cfg, nil
+func (f field) String() string {
+	switch v := f.value.Interface().(type) {
+	case []string:
+		return strings.Join(v, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// setFromFile accepts the scalar and list values produced by the YAML and
+// TOML decoders.
+func (f field) setFromFile(raw any) error {
+	switch v := raw.(type) {
+	case nil:
+		return nil
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		return f.set(strings.Join(items, ","))
+	case map[string]any:
+		return fmt.Errorf("expected a value, got a table")
+	default:
+		return f.set(fmt.Sprint(v))
+	}
 }
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setup runs the test in an empty directory, so no .env is read unless the
+// test writes one, with the settings every valid configuration needs.
+func setup(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("CHAT_BACKEND_URL", "http://localhost:8080")
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-test")
+	t.Setenv("SLACK_APP_TOKEN", "xapp-test")
+	return dir
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	tests := []struct {
+		name       string
+		file       string
+		dotEnv     string
+		env        string
+		want       time.Duration
+		wantSource Source
+	}{
+		{name: "default", want: 30 * time.Second, wantSource: SourceDefault},
+		{name: "file", file: "10s", want: 10 * time.Second, wantSource: SourceFile},
+		{name: ".env over file", file: "10s", dotEnv: "20s", want: 20 * time.Second, wantSource: SourceDotEnv},
+		{name: "env over .env", file: "10s", dotEnv: "20s", env: "40s", want: 40 * time.Second, wantSource: SourceEnv},
+		{name: "env over file", file: "10s", env: "40s", want: 40 * time.Second, wantSource: SourceEnv},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := setup(t)
+			path := ""
+			if tt.file != "" {
+				path = writeFile(t, dir, "chatrelay.yaml", "request_timeout: "+tt.file+"\n")
+			}
+			if tt.dotEnv != "" {
+				writeFile(t, dir, ".env", "REQUEST_TIMEOUT="+tt.dotEnv+"\n")
+			}
+			if tt.env != "" {
+				t.Setenv("REQUEST_TIMEOUT", tt.env)
+			}
+
+			res, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Config.RequestTimeout != tt.want {
+				t.Errorf("REQUEST_TIMEOUT = %s, want %s", res.Config.RequestTimeout, tt.want)
+			}
+			if got := res.Sources["REQUEST_TIMEOUT"]; got != tt.wantSource {
+				t.Errorf("source = %q, want %q", got, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		// wantErr, when set, is part of the error Load must return.
+		wantErr string
+	}{
+		{name: "YAML", file: "chatrelay.yaml", content: "placeholder_text: Working on it\nadmin_users: [A1, A2]\n"},
+		{name: "TOML", file: "chatrelay.toml", content: "placeholder_text = \"Working on it\"\nadmin_users = [\"A1\", \"A2\"]\n"},
+		{name: "unknown key", file: "chatrelay.yaml", content: "placeholder_txt: Working on it\n", wantErr: `unknown setting "placeholder_txt"`},
+		{
+			name: "unknown key in a channel override", file: "chatrelay.yaml",
+			content: "channels:\n  C1:\n    placholder: Working on it\n", wantErr: "channels",
+		},
+		{name: "secret file variant", file: "chatrelay.yaml", content: "webhook_secret_file: /nonexistent\n", wantErr: "WEBHOOK_SECRET"},
+		{name: "table for a value", file: "chatrelay.yaml", content: "placeholder_text:\n  text: Working on it\n", wantErr: "expected a value"},
+		{name: "unsupported extension", file: "chatrelay.json", content: "{}", wantErr: "unsupported config file extension"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := setup(t)
+			res, err := Load(writeFile(t, dir, tt.file, tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load = %v, want an error about %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Config.PlaceholderText != "Working on it" {
+				t.Errorf("PLACEHOLDER_TEXT = %q", res.Config.PlaceholderText)
+			}
+			if got := strings.Join(res.Config.AdminUsers, ","); got != "A1,A2" {
+				t.Errorf("ADMIN_USERS = %q", got)
+			}
+		})
+	}
+}
+
+func TestLoadReportsEveryError(t *testing.T) {
+	dir := setup(t)
+	t.Setenv("CHAT_BACKEND_URL", "")
+	t.Setenv("REQUEST_TIMEOUT", "soon")
+	t.Setenv("SLACK_API_RETRY_COUNT", "-1")
+	path := writeFile(t, dir, "chatrelay.yaml", "max_answer_lenght: 100\n")
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("Load succeeded")
+	}
+	for _, want := range []string{
+		`unknown setting "max_answer_lenght"`,
+		`REQUEST_TIMEOUT: invalid duration "soon"`,
+		"SLACK_API_RETRY_COUNT must not be negative",
+		"required setting CHAT_BACKEND_URL not set",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q:\n%v", want, err)
+		}
+	}
+	var missing *MissingSettingError
+	if !errors.As(err, &missing) || missing.Name != "CHAT_BACKEND_URL" {
+		t.Errorf("error = %v, want a MissingSettingError for CHAT_BACKEND_URL", err)
+	}
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// readFile decodes a YAML (.yaml, .yml) or TOML (.toml) config file into its
+// top-level keys.
+func readFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	values := make(map[string]any)
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML config file %s: %w", path, err)
+		}
+	case ".toml":
+		if err := toml.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("failed to parse TOML config file %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config file extension %q (want .yaml, .yml or .toml)", ext)
+	}
+	return values, nil
+}
+
+// decodeBlock decodes a nested config file block, such as the channel
+// override tables, into target. Unknown keys are rejected so typos surface
+// as errors instead of being ignored.
+func decodeBlock(raw any, target any) error {
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	return dec.Decode(target)
+}
@@ -0,0 +1,268 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"chatrelay-bot/internal/redact"
+	"chatrelay-bot/pkg/models"
+)
+
+// validate checks the semantic rules that go beyond parsing and returns
+// every violation.
+func validate(cfg *models.AppConfig) []error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	// Slack is served when either of its tokens is set, and is the platform
+	// asked for when none is configured.
+	if cfg.SlackBotToken != "" || cfg.SlackAppToken != "" || (cfg.DiscordBotToken == "" && cfg.MattermostBotToken == "" && cfg.TeamsAppID == "" && cfg.APIKeys == "") {
+		for _, token := range []struct{ env, value string }{
+			{"SLACK_BOT_TOKEN", cfg.SlackBotToken},
+			{"SLACK_APP_TOKEN", cfg.SlackAppToken},
+		} {
+			if token.value == "" {
+				errs = append(errs, &MissingSettingError{Name: token.env})
+			}
+		}
+	}
+	// Mattermost needs both its server URL and a bot token.
+	if cfg.MattermostURL != "" || cfg.MattermostBotToken != "" {
+		for _, setting := range []struct{ env, value string }{
+			{"MATTERMOST_URL", cfg.MattermostURL},
+			{"MATTERMOST_BOT_TOKEN", cfg.MattermostBotToken},
+		} {
+			if setting.value == "" {
+				errs = append(errs, &MissingSettingError{Name: setting.env})
+			}
+		}
+	}
+	// Teams needs both the app ID and its password.
+	if cfg.TeamsAppID != "" || cfg.TeamsAppPassword != "" {
+		for _, setting := range []struct{ env, value string }{
+			{"TEAMS_APP_ID", cfg.TeamsAppID},
+			{"TEAMS_APP_PASSWORD", cfg.TeamsAppPassword},
+		} {
+			if setting.value == "" {
+				errs = append(errs, &MissingSettingError{Name: setting.env})
+			}
+		}
+	}
+	if cfg.APIKeys != "" {
+		if _, err := ParseAPIKeys(cfg.APIKeys); err != nil {
+			fail("API_KEYS: %v", err)
+		}
+	}
+	// Webhook deliveries are always signed.
+	if cfg.WebhookURL != "" && cfg.WebhookSecret == "" {
+		errs = append(errs, &MissingSettingError{Name: "WEBHOOK_SECRET"})
+	}
+	if cfg.SlackBotToken != "" && !strings.HasPrefix(cfg.SlackBotToken, "xoxb-") {
+		fail("SLACK_BOT_TOKEN must be a bot token starting with xoxb-")
+	}
+	if cfg.SlackAppToken != "" && !strings.HasPrefix(cfg.SlackAppToken, "xapp-") {
+		fail("SLACK_APP_TOKEN must be an app-level token starting with xapp-")
+	}
+	if cfg.ChatBackendURL != "" {
+		if err := validateHTTPURL(cfg.ChatBackendURL); err != nil {
+			fail("CHAT_BACKEND_URL: %v", err)
+		}
+	}
+	if cfg.SlackAPIURL != "" {
+		if err := validateHTTPURL(cfg.SlackAPIURL); err != nil {
+			fail("SLACK_API_URL: %v", err)
+		}
+	}
+	if cfg.DiscordAPIURL != "" {
+		if err := validateHTTPURL(cfg.DiscordAPIURL); err != nil {
+			fail("DISCORD_API_URL: %v", err)
+		}
+	}
+	for _, u := range []struct{ env, value string }{
+		{"MATTERMOST_URL", cfg.MattermostURL},
+		{"MATTERMOST_ACTIONS_URL", cfg.MattermostActionsURL},
+		{"TEAMS_JWKS_URL", cfg.TeamsJWKSURL},
+		{"TEAMS_TOKEN_URL", cfg.TeamsTokenURL},
+		{"TEAMS_SERVICE_URL", cfg.TeamsServiceURL},
+		{"WEBHOOK_URL", cfg.WebhookURL},
+	} {
+		if u.value != "" {
+			if err := validateHTTPURL(u.value); err != nil {
+				fail("%s: %v", u.env, err)
+			}
+		}
+	}
+
+	for _, port := range []struct{ env, value string }{
+		{"LISTEN_PORT", cfg.ListenPort},
+		{"MOCK_BACKEND_PORT", cfg.MockBackendPort},
+	} {
+		if n, err := strconv.Atoi(port.value); err != nil || n < 1 || n > 65535 {
+			fail("%s must be a port number between 1 and 65535, got %q", port.env, port.value)
+		}
+	}
+
+	if cfg.RequestTimeout <= 0 {
+		fail("REQUEST_TIMEOUT must be positive, got %s", cfg.RequestTimeout)
+	}
+	if cfg.SlackAPIRetryCount < 0 {
+		fail("SLACK_API_RETRY_COUNT must not be negative, got %d", cfg.SlackAPIRetryCount)
+	}
+	if cfg.SlackAPIRetryDelay < 0 {
+		fail("SLACK_API_RETRY_DELAY must not be negative, got %s", cfg.SlackAPIRetryDelay)
+	}
+	if cfg.BackendAPIRetryCount < 0 {
+		fail("BACKEND_API_RETRY_COUNT must not be negative, got %d", cfg.BackendAPIRetryCount)
+	}
+	if cfg.BackendAPIRetryDelay < 0 {
+		fail("BACKEND_API_RETRY_DELAY must not be negative, got %s", cfg.BackendAPIRetryDelay)
+	}
+	if cfg.BackendBreakerThreshold < 0 {
+		fail("BACKEND_BREAKER_THRESHOLD must not be negative, got %d", cfg.BackendBreakerThreshold)
+	}
+	if cfg.BackendBreakerThreshold > 0 && cfg.BackendBreakerCooldown <= 0 {
+		fail("BACKEND_BREAKER_COOLDOWN must be positive when the breaker is enabled, got %s", cfg.BackendBreakerCooldown)
+	}
+
+	if cfg.SecretsRefreshInterval < 0 {
+		fail("SECRETS_REFRESH_INTERVAL must not be negative, got %s", cfg.SecretsRefreshInterval)
+	}
+	if cfg.StreamUpdateInterval < 0 {
+		fail("STREAM_UPDATE_INTERVAL must not be negative, got %s", cfg.StreamUpdateInterval)
+	}
+	switch cfg.RecoveryMode {
+	case "apologize", "rerun":
+	default:
+		fail("RECOVERY_MODE must be apologize or rerun, got %q", cfg.RecoveryMode)
+	}
+	if cfg.ShutdownDrainTimeout < 0 {
+		fail("SHUTDOWN_DRAIN_TIMEOUT must not be negative, got %s", cfg.ShutdownDrainTimeout)
+	}
+	if cfg.AccessUserGroupCacheTTL <= 0 {
+		fail("ACCESS_USERGROUP_CACHE_TTL must be positive, got %s", cfg.AccessUserGroupCacheTTL)
+	}
+	for _, limit := range []struct {
+		env   string
+		value int
+	}{
+		{"RATE_LIMIT_USER_PER_MINUTE", cfg.RateLimitUserPerMinute},
+		{"RATE_LIMIT_USER_BURST", cfg.RateLimitUserBurst},
+		{"RATE_LIMIT_CHANNEL_PER_MINUTE", cfg.RateLimitChannelPerMinute},
+		{"RATE_LIMIT_CHANNEL_BURST", cfg.RateLimitChannelBurst},
+		{"QUOTA_DAILY_REQUESTS", cfg.QuotaDailyRequests},
+		{"QUOTA_MONTHLY_REQUESTS", cfg.QuotaMonthlyRequests},
+		{"QUOTA_DAILY_TOKENS", cfg.QuotaDailyTokens},
+		{"QUOTA_MONTHLY_TOKENS", cfg.QuotaMonthlyTokens},
+	} {
+		if limit.value < 0 {
+			fail("%s must not be negative, got %d", limit.env, limit.value)
+		}
+	}
+	if cfg.RateLimitUserPerMinute > 0 && cfg.RateLimitUserBurst == 0 {
+		fail("RATE_LIMIT_USER_BURST must be at least 1 when RATE_LIMIT_USER_PER_MINUTE is set")
+	}
+	if cfg.RateLimitChannelPerMinute > 0 && cfg.RateLimitChannelBurst == 0 {
+		fail("RATE_LIMIT_CHANNEL_BURST must be at least 1 when RATE_LIMIT_CHANNEL_PER_MINUTE is set")
+	}
+
+	if cfg.PlaceholderText == "" {
+		fail("PLACEHOLDER_TEXT must not be empty")
+	}
+	if cfg.MaxAnswerLength < 0 {
+		fail("MAX_ANSWER_LENGTH must not be negative, got %d", cfg.MaxAnswerLength)
+	}
+	for _, block := range []struct {
+		name      string
+		overrides map[string]models.ChannelOverride
+	}{
+		{"workspaces", cfg.WorkspaceOverrides},
+		{"channels", cfg.ChannelOverrides},
+	} {
+		for _, id := range sortedKeys(block.overrides) {
+			o := block.overrides[id]
+			if o.BackendURL != nil {
+				if err := validateHTTPURL(*o.BackendURL); err != nil {
+					fail("%s.%s.backend_url: %v", block.name, id, err)
+				}
+			}
+			if o.MaxAnswerLength != nil && *o.MaxAnswerLength < 0 {
+				fail("%s.%s.max_answer_length must not be negative, got %d", block.name, id, *o.MaxAnswerLength)
+			}
+			if o.Placeholder != nil && *o.Placeholder == "" {
+				fail("%s.%s.placeholder must not be empty", block.name, id)
+			}
+		}
+	}
+
+	switch cfg.TelemetryExporter {
+	case "grpc", "http/protobuf", "console":
+	default:
+		fail("OTEL_EXPORTER_OTLP_PROTOCOL must be grpc, http/protobuf or console, got %q", cfg.TelemetryExporter)
+	}
+	switch cfg.MetricsExporter {
+	case "otlp", "prometheus":
+	default:
+		fail("OTEL_METRICS_EXPORTER must be otlp or prometheus, got %q", cfg.MetricsExporter)
+	}
+	switch strings.ToLower(cfg.TraceSampler) {
+	case "always", "always_on", "never", "always_off", "ratio", "traceidratio", "parent_ratio", "parentbased_traceidratio":
+	default:
+		fail("OTEL_TRACES_SAMPLER %q is not supported", cfg.TraceSampler)
+	}
+	if cfg.TraceSamplerRatio < 0 || cfg.TraceSamplerRatio > 1 {
+		fail("OTEL_TRACES_SAMPLER_ARG must be between 0 and 1, got %v", cfg.TraceSamplerRatio)
+	}
+	if (cfg.TelemetryClientCert == "") != (cfg.TelemetryClientKey == "") {
+		fail("OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE and OTEL_EXPORTER_OTLP_CLIENT_KEY must be set together")
+	}
+	for _, list := range []struct{ env, value string }{
+		{"OTEL_EXPORTER_OTLP_HEADERS", cfg.TelemetryHeaders},
+		{"OTEL_RESOURCE_ATTRIBUTES", cfg.ResourceAttributes},
+	} {
+		for _, pair := range strings.Split(list.value, ",") {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+			if key, _, ok := strings.Cut(pair, "="); !ok || strings.TrimSpace(key) == "" {
+				fail("%s entries must be key=value, got %q", list.env, pair)
+			}
+		}
+	}
+
+	if _, err := redact.ParseMode(cfg.RedactionMode); err != nil {
+		fail("REDACTION_MODE: %v", err)
+	}
+	if cfg.RedactionTruncateLength <= 0 {
+		fail("REDACTION_TRUNCATE_LENGTH must be positive, got %d", cfg.RedactionTruncateLength)
+	}
+
+	return errs
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func validateHTTPURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https, got %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("missing host in %q", raw)
+	}
+	return nil
+}
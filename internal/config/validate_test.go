@@ -0,0 +1,84 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"chatrelay-bot/pkg/models"
+)
+
+// validConfig is a configuration with every default applied that validate
+// accepts.
+func validConfig(t *testing.T) *models.AppConfig {
+	t.Helper()
+	cfg := models.NewConfig()
+	for _, f := range settingFields(cfg) {
+		if f.defaultValue != "" {
+			if err := f.set(f.defaultValue); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	cfg.ChatBackendURL = "http://localhost:8080"
+	cfg.SlackBotToken = "xoxb-test"
+	cfg.SlackAppToken = "xapp-test"
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*models.AppConfig)
+		// want, when set, is part of the only error validate must return.
+		want string
+	}{
+		{name: "valid", modify: func(*models.AppConfig) {}},
+		{name: "negative Slack retry count", modify: func(c *models.AppConfig) { c.SlackAPIRetryCount = -1 }, want: "SLACK_API_RETRY_COUNT must not be negative"},
+		{name: "negative backend retry count", modify: func(c *models.AppConfig) { c.BackendAPIRetryCount = -2 }, want: "BACKEND_API_RETRY_COUNT must not be negative"},
+		{name: "zero retry count", modify: func(c *models.AppConfig) { c.SlackAPIRetryCount, c.BackendAPIRetryCount = 0, 0 }},
+		{name: "backend URL without scheme", modify: func(c *models.AppConfig) { c.ChatBackendURL = "localhost:8080" }, want: "CHAT_BACKEND_URL"},
+		{name: "backend URL with another scheme", modify: func(c *models.AppConfig) { c.ChatBackendURL = "ftp://backend" }, want: "scheme must be http or https"},
+		{name: "backend URL without host", modify: func(c *models.AppConfig) { c.ChatBackendURL = "http://" }, want: "missing host"},
+		{name: "webhook URL", modify: func(c *models.AppConfig) { c.WebhookURL, c.WebhookSecret = "hooks.example.com", "s" }, want: "WEBHOOK_URL"},
+		{
+			name: "channel override backend URL",
+			modify: func(c *models.AppConfig) {
+				c.ChannelOverrides = map[string]models.ChannelOverride{"C1": {BackendURL: ptr("backend")}}
+			},
+			want: "channels.C1.backend_url",
+		},
+		{name: "user token for the bot token", modify: func(c *models.AppConfig) { c.SlackBotToken = "xoxp-test" }, want: "SLACK_BOT_TOKEN must be a bot token starting with xoxb-"},
+		{name: "bot token for the app token", modify: func(c *models.AppConfig) { c.SlackAppToken = "xoxb-test" }, want: "SLACK_APP_TOKEN must be an app-level token starting with xapp-"},
+		{name: "app token without bot token", modify: func(c *models.AppConfig) { c.SlackBotToken = "" }, want: "required setting SLACK_BOT_TOKEN not set"},
+		{
+			name: "Discord only",
+			modify: func(c *models.AppConfig) {
+				c.SlackBotToken, c.SlackAppToken, c.DiscordBotToken = "", "", "discord-token"
+			},
+		},
+		{name: "webhook without secret", modify: func(c *models.AppConfig) { c.WebhookURL = "https://hooks.example.com" }, want: "required setting WEBHOOK_SECRET not set"},
+		{name: "port out of range", modify: func(c *models.AppConfig) { c.ListenPort = "70000" }, want: "LISTEN_PORT must be a port number"},
+		{name: "unknown recovery mode", modify: func(c *models.AppConfig) { c.RecoveryMode = "retry" }, want: "RECOVERY_MODE must be apologize or rerun"},
+		{name: "rate without burst", modify: func(c *models.AppConfig) { c.RateLimitUserBurst = 0 }, want: "RATE_LIMIT_USER_BURST must be at least 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig(t)
+			tt.modify(cfg)
+			errs := validate(cfg)
+			if tt.want == "" {
+				if len(errs) > 0 {
+					t.Errorf("validate = %v, want no errors", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || !strings.Contains(errs[0].Error(), tt.want) {
+				t.Errorf("validate = %v, want one error about %q", errs, tt.want)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
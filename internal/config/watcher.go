@@ -0,0 +1,199 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"chatrelay-bot/pkg/models"
+)
+
+const watchInterval = 2 * time.Second
+
+// Reloadable is implemented by components that can take new settings from a
+// reloaded configuration without a restart.
+type Reloadable interface {
+	ApplyConfig(cfg *models.AppConfig)
+}
+
+// ReloadFunc adapts a function to Reloadable.
+type ReloadFunc func(cfg *models.AppConfig)
+
+func (f ReloadFunc) ApplyConfig(cfg *models.AppConfig) { f(cfg) }
+
+// Watcher reloads the configuration when the config file changes or the
+// process receives SIGHUP. Only settings tagged `reload:"live"` are applied;
+// changes to any other setting are logged as requiring a restart.
+type Watcher struct {
+	path    string
+	targets []Reloadable
+
+	mu      sync.Mutex
+	current *models.AppConfig
+	// loaded is the configuration most recently loaded, including settings
+	// that need a restart, so each of their changes is reported once.
+	loaded   *models.AppConfig
+	lastHash [sha256.Size]byte
+}
+
+func NewWatcher(path string, current *models.AppConfig, targets ...Reloadable) *Watcher {
+	w := &Watcher{path: path, current: current, loaded: current, targets: targets}
+	if path != "" {
+		if data, err := os.ReadFile(path); err == nil {
+			w.lastHash = sha256.Sum256(data)
+		}
+	}
+	return w
+}
+
+// Run watches for reload triggers until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	var tick <-chan time.Time
+	if w.path != "" {
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	slog.InfoContext(ctx, "Watching configuration for changes", "path", w.path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sighup:
+			w.Reload(ctx, "SIGHUP")
+		case <-tick:
+			if w.fileChanged() {
+				w.Reload(ctx, "config file changed")
+			}
+		}
+	}
+}
+
+func (w *Watcher) fileChanged() bool {
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return false
+	}
+	hash := sha256.Sum256(data)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if hash == w.lastHash {
+		return false
+	}
+	w.lastHash = hash
+	return true
+}
+
+// Reload loads and validates the configuration and, if it is valid, applies
+// its live settings to every target. An invalid configuration is rejected
+// and the running configuration is kept.
+func (w *Watcher) Reload(ctx context.Context, reason string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	res, err := Load(w.path)
+	if err != nil {
+		slog.ErrorContext(ctx, "Rejected configuration reload", "reason", reason, "error", err)
+		return err
+	}
+
+	if restart := RestartRequired(w.loaded, res.Config); len(restart) > 0 {
+		slog.WarnContext(ctx, "Configuration changes require a restart and were not applied", "settings", restart)
+	}
+	w.loaded = res.Config
+	next := mergeLive(w.current, res.Config)
+	changed := changedSettings(w.current, next)
+	if len(changed) == 0 {
+		slog.InfoContext(ctx, "Configuration reloaded, no live settings changed", "reason", reason)
+		return nil
+	}
+
+	for _, target := range w.targets {
+		target.ApplyConfig(next)
+	}
+	w.current = next
+	slog.InfoContext(ctx, "Configuration reloaded", "reason", reason, "changed", changed)
+	return nil
+}
+
+// Current returns the configuration most recently applied.
+func (w *Watcher) Current() *models.AppConfig {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Live reports whether the named setting is applied when the configuration
+// is reloaded.
+func Live(name string) bool {
+	live := false
+	cfg := &models.AppConfig{}
+	forEachSetting(cfg, cfg, func(env string, isLive bool, _, _ reflect.Value) {
+		if env == name {
+			live = isLive
+		}
+	})
+	return live
+}
+
+// RestartRequired lists settings that differ between old and next but cannot
+// be changed while the bot is running.
+func RestartRequired(old, next *models.AppConfig) []string {
+	var names []string
+	forEachSetting(old, next, func(env string, live bool, oldValue, newValue reflect.Value) {
+		if !live && !reflect.DeepEqual(oldValue.Interface(), newValue.Interface()) {
+			names = append(names, env)
+		}
+	})
+	return names
+}
+
+func changedSettings(old, next *models.AppConfig) []string {
+	var names []string
+	forEachSetting(old, next, func(env string, live bool, oldValue, newValue reflect.Value) {
+		if !reflect.DeepEqual(oldValue.Interface(), newValue.Interface()) {
+			names = append(names, env)
+		}
+	})
+	return names
+}
+
+// mergeLive returns a copy of old with the live settings taken from next.
+func mergeLive(old, next *models.AppConfig) *models.AppConfig {
+	merged := *old
+	mergedValue := reflect.ValueOf(&merged).Elem()
+	nextValue := reflect.ValueOf(next).Elem()
+	t := mergedValue.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("reload") == "live" {
+			mergedValue.Field(i).Set(nextValue.Field(i))
+		}
+	}
+	return &merged
+}
+
+func forEachSetting(old, next *models.AppConfig, fn func(env string, live bool, oldValue, newValue reflect.Value)) {
+	oldValue := reflect.ValueOf(old).Elem()
+	nextValue := reflect.ValueOf(next).Elem()
+	t := oldValue.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		env, _, _ := strings.Cut(sf.Tag.Get("env"), ",")
+		if env == "" {
+			env = sf.Tag.Get("file")
+		}
+		fn(env, sf.Tag.Get("reload") == "live", oldValue.Field(i), nextValue.Field(i))
+	}
+}
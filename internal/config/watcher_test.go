@@ -0,0 +1,122 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"chatrelay-bot/pkg/models"
+)
+
+// captureLogs sends the default logger's output to the returned buffer for
+// the rest of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestWatcherReload(t *testing.T) {
+	dir := setup(t)
+	path := writeFile(t, dir, "chatrelay.yaml", "placeholder_text: Thinking\nlisten_port: 8080\n")
+	res, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var applied []*models.AppConfig
+	w := NewWatcher(path, res.Config, ReloadFunc(func(cfg *models.AppConfig) { applied = append(applied, cfg) }))
+	logs := captureLogs(t)
+	ctx := context.Background()
+	const restartWarning = "require a restart"
+
+	// A live setting is applied; a restart-only one is reported and kept.
+	writeFile(t, dir, "chatrelay.yaml", "placeholder_text: Working\nlisten_port: 9090\n")
+	if err := w.Reload(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || applied[0].PlaceholderText != "Working" || applied[0].ListenPort != "8080" {
+		t.Fatalf("applied = %+v, want the new placeholder and the old port", applied)
+	}
+	if n := strings.Count(logs.String(), restartWarning); n != 1 || !strings.Contains(logs.String(), "LISTEN_PORT") {
+		t.Errorf("logged %d restart warnings, want 1 for LISTEN_PORT:\n%s", n, logs)
+	}
+
+	// Reloading the same file, as each secrets poll does, reports nothing
+	// new and applies nothing.
+	logs.Reset()
+	if err := w.Reload(ctx, "secrets rotated"); err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 {
+		t.Errorf("unchanged reload applied %d times, want once in total", len(applied))
+	}
+	if strings.Contains(logs.String(), restartWarning) {
+		t.Errorf("unchanged reload repeated the restart warning:\n%s", logs)
+	}
+
+	// Further live changes are applied without repeating the warning.
+	writeFile(t, dir, "chatrelay.yaml", "placeholder_text: Hmm\nlisten_port: 9090\n")
+	if err := w.Reload(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 || applied[1].PlaceholderText != "Hmm" || applied[1].ListenPort != "8080" {
+		t.Errorf("applied = %+v, want the new placeholder and the old port", applied)
+	}
+	if strings.Contains(logs.String(), restartWarning) {
+		t.Errorf("live change repeated the restart warning:\n%s", logs)
+	}
+
+	// A second restart-only change is reported again.
+	writeFile(t, dir, "chatrelay.yaml", "placeholder_text: Hmm\nlisten_port: 9091\n")
+	w.Reload(ctx, "test")
+	if !strings.Contains(logs.String(), restartWarning) {
+		t.Errorf("new restart-only change was not reported:\n%s", logs)
+	}
+	if w.Current().ListenPort != "8080" {
+		t.Errorf("current port = %s, want the one the bot started with", w.Current().ListenPort)
+	}
+}
+
+func TestWatcherRejectsInvalidConfig(t *testing.T) {
+	dir := setup(t)
+	path := writeFile(t, dir, "chatrelay.yaml", "placeholder_text: Thinking\n")
+	res, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied := 0
+	w := NewWatcher(path, res.Config, ReloadFunc(func(*models.AppConfig) { applied++ }))
+	captureLogs(t)
+
+	writeFile(t, dir, "chatrelay.yaml", "placeholder_text: Working\nrequest_timeout: -1s\n")
+	if err := w.Reload(context.Background(), "test"); err == nil {
+		t.Fatal("Reload accepted a negative REQUEST_TIMEOUT")
+	}
+	if applied != 0 || w.Current().PlaceholderText != "Thinking" {
+		t.Errorf("invalid configuration was applied")
+	}
+}
+
+func TestLive(t *testing.T) {
+	for name, want := range map[string]bool{
+		"SLACK_BOT_TOKEN":            true,
+		"DISCORD_BOT_TOKEN":          true,
+		"MATTERMOST_BOT_TOKEN":       true,
+		"TEAMS_APP_PASSWORD":         true,
+		"WEBHOOK_SECRET":             true,
+		"API_KEYS":                   true,
+		"SLACK_APP_TOKEN":            false,
+		"OTEL_EXPORTER_OTLP_HEADERS": false,
+		"LISTEN_PORT":                false,
+		"NO_SUCH_SETTING":            false,
+	} {
+		if got := Live(name); got != want {
+			t.Errorf("Live(%s) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+// Package discord is the Discord adapter. It receives messages over the
+// Discord Gateway and replies through the REST API: mentions in guild
+// channels and every direct message are passed to the bot, and answers are
+// edited in place as they stream, split over several messages when they
+// outgrow Discord's length limit.
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"chatrelay-bot/internal/adapter"
+	"chatrelay-bot/internal/health"
+	"chatrelay-bot/internal/redact"
+	"chatrelay-bot/pkg/models"
+)
+
+const (
+	tracerName   = "chatrelay/internal/discord"
+	platformName = "discord"
+	// maxRecent bounds how many incoming messages are remembered for edits
+	// and thread names.
+	maxRecent = 1024
+)
+
+// defaultSettings are used for messages when no SettingsResolver is set.
+var defaultSettings = models.ChannelSettings{
+	Enabled:     true,
+	Placeholder: "Thinking...",
+	Footer:      "_Powered by ChatRelay_",
+	Streaming:   true,
+}
+
+type Client struct {
+	rest     *rest
+	handler  adapter.Handler
+	resolver adapter.SettingsResolver
+	retries  adapter.RetryHandler
+	changes  adapter.ChangeHandler
+
+	mu        sync.Mutex
+	botUserID string
+	mention   *regexp.Regexp // matches a mention of botUserID
+	channels  map[string]channel
+	dms       map[string]string // user ID -> DM channel ID
+	recent    map[string]string // message ID -> text addressed to the bot
+	// overflow holds the IDs of the extra messages a reply was split into,
+	// by reply ID. Only replies longer than one message have an entry.
+	overflow map[string][]string
+
+	session gatewaySession
+}
+
+var (
+	_ adapter.Adapter   = (*Client)(nil)
+	_ adapter.Formatter = (*Client)(nil)
+)
+
+// NewClient creates a Discord client that passes messages addressed to the
+// bot to handler. apiURL overrides the REST API base URL, e.g. to point at
+// a local stand-in; leave it empty for discord.com.
+func NewClient(token string, handler adapter.Handler, apiURL string) *Client {
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	health.Register(health.DiscordGateway, "not connected")
+	return &Client{
+		rest:     newREST(apiURL, token),
+		handler:  handler,
+		channels: make(map[string]channel),
+		dms:      make(map[string]string),
+		recent:   make(map[string]string),
+		overflow: make(map[string][]string),
+	}
+}
+
+// ApplyConfig switches REST calls, and the next Gateway connection, to a
+// rotated bot token.
+func (c *Client) ApplyConfig(cfg *models.AppConfig) {
+	if token := cfg.DiscordBotToken; token != "" && token != *c.rest.token.Load() {
+		c.rest.token.Store(&token)
+		slog.Info("Discord bot token rotated", "bot_token", redact.Secret(token))
+	}
+}
+
+func (c *Client) SetSettingsResolver(r adapter.SettingsResolver) {
+	c.resolver = r
+}
+
+func (c *Client) SetRetryHandler(h adapter.RetryHandler) {
+	c.retries = h
+}
+
+func (c *Client) SetMentionChangeHandler(h adapter.ChangeHandler) {
+	c.changes = h
+}
+
+func (c *Client) Name() string {
+	return platformName
+}
+
+// dispatch handles one Gateway event.
+func (c *Client) dispatch(ctx context.Context, event string, data json.RawMessage) {
+	switch event {
+	case "READY":
+		var r ready
+		if err := json.Unmarshal(data, &r); err != nil {
+			slog.ErrorContext(ctx, "Failed to decode READY", "error", err)
+			return
+		}
+		mention := regexp.MustCompile(fmt.Sprintf(`<@!?%s>`, regexp.QuoteMeta(r.User.ID)))
+		c.mu.Lock()
+		c.botUserID = r.User.ID
+		c.mention = mention
+		c.mu.Unlock()
+		slog.InfoContext(ctx, "Connected to Discord", "user", r.User.Username, "user_id", r.User.ID)
+	case "GUILD_CREATE":
+		var g guildCreate
+		if err := json.Unmarshal(data, &g); err != nil {
+			return
+		}
+		c.mu.Lock()
+		for _, ch := range append(g.Channels, g.Threads...) {
+			ch.GuildID = g.ID
+			c.channels[ch.ID] = ch
+		}
+		c.mu.Unlock()
+	case "CHANNEL_CREATE", "CHANNEL_UPDATE", "THREAD_CREATE", "THREAD_UPDATE":
+		var ch channel
+		if err := json.Unmarshal(data, &ch); err == nil {
+			c.mu.Lock()
+			c.channels[ch.ID] = ch
+			c.mu.Unlock()
+		}
+	case "CHANNEL_DELETE", "THREAD_DELETE":
+		var ch channel
+		if err := json.Unmarshal(data, &ch); err == nil {
+			c.mu.Lock()
+			delete(c.channels, ch.ID)
+			c.mu.Unlock()
+		}
+	case "MESSAGE_CREATE":
+		var m message
+		if err := json.Unmarshal(data, &m); err != nil {
+			slog.ErrorContext(ctx, "Failed to decode MESSAGE_CREATE", "error", err)
+			return
+		}
+		text, ok := c.addressed(m)
+		if !ok {
+			return
+		}
+		c.remember(m.ID, text)
+		// Messages are answered concurrently, and outlive the Gateway
+		// connection so that a shutdown can drain them.
+		go c.handleMessage(context.WithoutCancel(ctx), m, text)
+	case "MESSAGE_UPDATE":
+		var m message
+		if err := json.Unmarshal(data, &m); err == nil {
+			c.handleMessageUpdate(ctx, m)
+		}
+	case "MESSAGE_DELETE":
+		var d messageDelete
+		if err := json.Unmarshal(data, &d); err == nil {
+			c.handleMessageDelete(ctx, d)
+		}
+	case "INTERACTION_CREATE":
+		var i interaction
+		if err := json.Unmarshal(data, &i); err == nil {
+			go c.handleInteraction(context.WithoutCancel(ctx), i)
+		}
+	}
+}
+
+func (c *Client) handleMessage(ctx context.Context, m message, text string) {
+	msg, err := c.incoming(ctx, m, text)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to look up Discord channel", "error", err, "channel", m.ChannelID)
+		return
+	}
+
+	tracer := otel.Tracer(tracerName)
+	slog.InfoContext(ctx, "Received Discord message", "text", text, "user", msg.Author.ID, "channel", msg.Conversation)
+	ctx, span := tracer.Start(ctx, "HandleDiscordMessage",
+		trace.WithAttributes(
+			attribute.String("discord.channel_id", msg.Conversation),
+			attribute.String("discord.user_id", msg.Author.ID),
+			attribute.Bool("discord.dm", msg.Workspace == ""),
+		),
+	)
+	defer span.End()
+
+	settings := defaultSettings
+	if c.resolver != nil {
+		settings = c.resolver.Resolve(msg.Workspace, c.settingsChannel(msg.Conversation))
+	}
+	if err := c.handler.HandleMessage(ctx, msg, settings); err != nil {
+		slog.ErrorContext(ctx, "Error handling Discord message", "error", err, "user", msg.Author.ID, "channel", msg.Conversation)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Error handling message")
+		c.Post(ctx, models.OutgoingMessage{Conversation: msg.Conversation, Text: fmt.Sprintf("Oops! Something went wrong: %v", err)})
+		return
+	}
+	span.SetStatus(codes.Ok, "Message handled successfully")
+}
+
+// handleMessageUpdate passes edits of messages addressed to the bot to the
+// ChangeHandler. Updates that leave the text unchanged, such as embeds
+// being added, are ignored; an edit that removes the mention is treated
+// like a deletion.
+func (c *Client) handleMessageUpdate(ctx context.Context, m message) {
+	if c.changes == nil || m.Content == nil || m.Author == nil {
+		return
+	}
+	c.mu.Lock()
+	previous, ok := c.recent[m.ID]
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	text, addressed := c.addressed(m)
+	if !addressed {
+		c.forget(m.ID)
+		c.changes.HandleMessageDeleted(ctx, m.ChannelID, m.ID)
+		return
+	}
+	if text == previous {
+		return
+	}
+	msg, err := c.incoming(ctx, m, text)
+	if err != nil {
+		return
+	}
+	c.remember(m.ID, text)
+	c.changes.HandleMessageEdited(ctx, msg)
+}
+
+func (c *Client) handleMessageDelete(ctx context.Context, d messageDelete) {
+	c.mu.Lock()
+	_, ok := c.recent[d.ID]
+	c.mu.Unlock()
+	if !ok || c.changes == nil {
+		return
+	}
+	c.forget(d.ID)
+	c.changes.HandleMessageDeleted(ctx, d.ChannelID, d.ID)
+}
+
+func (c *Client) handleInteraction(ctx context.Context, i interaction) {
+	if i.Type != interactionMessageComponent || i.Message == nil {
+		return
+	}
+	action, rest, _ := strings.Cut(i.Data.CustomID, ":")
+	conversation, value, ok := strings.Cut(rest, ":")
+	if action != adapter.RetryAction || !ok || c.retries == nil {
+		return
+	}
+	userID := ""
+	switch {
+	case i.Member != nil:
+		userID = i.Member.User.ID
+	case i.User != nil:
+		userID = i.User.ID
+	}
+
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "HandleRetryAction",
+		trace.WithAttributes(
+			attribute.String("discord.channel_id", i.ChannelID),
+			attribute.String("discord.user_id", userID),
+		),
+	)
+	defer span.End()
+	// Interactions must be acknowledged within three seconds.
+	ack := map[string]any{"type": callbackDeferredUpdate}
+	if err := c.rest.do(ctx, "POST", fmt.Sprintf("/interactions/%s/%s/callback", i.ID, i.Token), ack, nil); err != nil {
+		slog.ErrorContext(ctx, "Failed to acknowledge interaction", "error", err)
+	}
+	if err := c.retries.HandleRetry(ctx, conversation, replyID(i.ChannelID, i.Message.ID), userID, value); err != nil {
+		slog.ErrorContext(ctx, "Error handling retry action", "error", err, "user", userID, "channel", i.ChannelID)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Error handling retry action")
+	}
+}
+
+// addressed reports whether m is for the bot, and returns its text without
+// the mention. Every direct message is for the bot; in guild channels the
+// bot must be mentioned. Messages from bots are ignored.
+func (c *Client) addressed(m message) (string, bool) {
+	if m.Author == nil || m.Author.Bot || m.Content == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	botID, mention := c.botUserID, c.mention
+	c.mu.Unlock()
+	if botID == "" {
+		return "", false
+	}
+	mentioned := m.GuildID == ""
+	for _, u := range m.Mentions {
+		if u.ID == botID {
+			mentioned = true
+		}
+	}
+	if !mentioned {
+		return "", false
+	}
+	return strings.TrimSpace(mention.ReplaceAllString(*m.Content, "")), true
+}
+
+// incoming converts m to an IncomingMessage. A message in a thread has the
+// thread as both its conversation and its thread, so that the reply goes to
+// the same thread.
+func (c *Client) incoming(ctx context.Context, m message, text string) (models.IncomingMessage, error) {
+	msg := models.IncomingMessage{
+		Platform:     platformName,
+		ID:           m.ID,
+		Workspace:    m.GuildID,
+		Conversation: m.ChannelID,
+		Author:       models.Author{ID: m.Author.ID, Name: m.Author.name()},
+		Text:         text,
+	}
+	c.mu.Lock()
+	botID := c.botUserID
+	c.mu.Unlock()
+	for _, u := range m.Mentions {
+		if u.ID != botID {
+			msg.Mentions = append(msg.Mentions, models.Author{ID: u.ID, Name: u.name()})
+		}
+	}
+	for _, a := range m.Attachments {
+		msg.Attachments = append(msg.Attachments, models.Attachment{Name: a.Filename, URL: a.URL, MIMEType: a.ContentType, Size: a.Size})
+	}
+	if m.GuildID == "" {
+		c.mu.Lock()
+		c.channels[m.ChannelID] = channel{ID: m.ChannelID, Type: channelDM}
+		c.mu.Unlock()
+		return msg, nil
+	}
+	ch, err := c.channel(ctx, m.ChannelID)
+	if err != nil {
+		return msg, err
+	}
+	if isThread(ch.Type) {
+		msg.Thread = ch.ID
+	}
+	return msg, nil
+}
+
+// channel returns what is known about a channel, asking Discord if it has
+// not been seen on the Gateway.
+func (c *Client) channel(ctx context.Context, id string) (channel, error) {
+	c.mu.Lock()
+	ch, ok := c.channels[id]
+	c.mu.Unlock()
+	if ok {
+		return ch, nil
+	}
+	if err := c.rest.do(ctx, "GET", "/channels/"+id, nil, &ch); err != nil {
+		return ch, err
+	}
+	c.mu.Lock()
+	c.channels[id] = ch
+	c.mu.Unlock()
+	return ch, nil
+}
+
+// settingsChannel is the channel whose settings apply in conversation:
+// its parent channel for a thread.
+func (c *Client) settingsChannel(conversation string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ch, ok := c.channels[conversation]; ok && isThread(ch.Type) && ch.ParentID != "" {
+		return ch.ParentID
+	}
+	return conversation
+}
+
+func (c *Client) remember(id, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.recent) >= maxRecent {
+		clear(c.recent)
+	}
+	c.recent[id] = text
+}
+
+func (c *Client) forget(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.recent, id)
+}
+
+func isThread(channelType int) bool {
+	return channelType == channelPublicThread || channelType == channelPrivateThread || channelType == channelAnnouncementThread
+}
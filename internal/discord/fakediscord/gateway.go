@@ -0,0 +1,387 @@
+package fakediscord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Gateway opcodes.
+const (
+	opDispatch       = 0
+	opHeartbeat      = 1
+	opIdentify       = 2
+	opResume         = 6
+	opInvalidSession = 9
+	opHello          = 10
+	opHeartbeatAck   = 11
+)
+
+// closeUnknownError is the resumable close code Disconnect uses.
+const closeUnknownError = 4000
+
+type event struct {
+	seq  int64
+	name string
+	data any
+}
+
+// gatewayConn is one bot connection. Writes are serialized by gateway.gmu
+// for dispatches and by mu for everything else.
+type gatewayConn struct {
+	mu sync.Mutex
+	ws *websocket.Conn
+}
+
+func (c *gatewayConn) send(op int, d any, seq int64, name string) error {
+	p := map[string]any{"op": op, "d": d}
+	if op == opDispatch {
+		p["s"], p["t"] = seq, name
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ws.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	return c.ws.WriteJSON(p)
+}
+
+// gateway holds the Gateway session. Dispatches made while no connection
+// is ready are queued and delivered, in order, once one is.
+type gateway struct {
+	gmu       sync.Mutex
+	sessionID string
+	eventSeq  int64
+	// delivered is every event sent in the session, for resuming.
+	delivered []event
+	pending   []event
+	ready     map[*gatewayConn]bool
+	all       map[*gatewayConn]bool
+	connected chan struct{}
+	sessions  int
+}
+
+func (g *gateway) init() {
+	g.ready = make(map[*gatewayConn]bool)
+	g.all = make(map[*gatewayConn]bool)
+	g.connected = make(chan struct{})
+}
+
+// dispatch sends a Gateway event to the bot, or queues it until the bot is
+// connected.
+func (g *gateway) dispatch(name string, data any) {
+	g.gmu.Lock()
+	defer g.gmu.Unlock()
+	if len(g.ready) == 0 {
+		g.pending = append(g.pending, event{name: name, data: data})
+		return
+	}
+	g.deliver(event{name: name, data: data})
+}
+
+// deliver numbers ev and sends it to every ready connection. g.gmu must be
+// held.
+func (g *gateway) deliver(ev event) {
+	g.eventSeq++
+	ev.seq = g.eventSeq
+	g.delivered = append(g.delivered, ev)
+	for c := range g.ready {
+		if err := c.send(opDispatch, ev.data, ev.seq, ev.name); err != nil {
+			slog.Warn("fakediscord: failed to send event", "event", ev.name, "error", err)
+		}
+	}
+}
+
+// flush delivers queued events. g.gmu must be held.
+func (g *gateway) flush() {
+	pending := g.pending
+	g.pending = nil
+	for _, ev := range pending {
+		g.deliver(ev)
+	}
+}
+
+func (g *gateway) closeConnections() {
+	g.gmu.Lock()
+	defer g.gmu.Unlock()
+	for c := range g.all {
+		c.ws.Close()
+	}
+}
+
+// Disconnect drops the bot's Gateway connections with a resumable close
+// code, as Discord does now and then. Events until the bot resumes are
+// replayed on resume.
+func (s *Server) Disconnect() {
+	s.gmu.Lock()
+	defer s.gmu.Unlock()
+	for c := range s.all {
+		c.mu.Lock()
+		c.ws.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(closeUnknownError, "Unknown error"), time.Now().Add(time.Second))
+		c.mu.Unlock()
+		c.ws.Close()
+		delete(s.ready, c)
+	}
+}
+
+// WaitForConnection blocks until the bot has identified.
+func (s *Server) WaitForConnection(ctx context.Context) error {
+	select {
+	case <-s.connected:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var upgrader = websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+
+func (s *Server) serveGateway(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Error("fakediscord: websocket upgrade failed", "error", err)
+		return
+	}
+	c := &gatewayConn{ws: ws}
+	s.gmu.Lock()
+	s.all[c] = true
+	s.gmu.Unlock()
+	defer func() {
+		s.gmu.Lock()
+		delete(s.all, c)
+		delete(s.ready, c)
+		s.gmu.Unlock()
+		ws.Close()
+	}()
+
+	if err := c.send(opHello, map[string]any{"heartbeat_interval": s.HeartbeatInterval.Milliseconds()}, 0, ""); err != nil {
+		return
+	}
+	for {
+		var p struct {
+			Op int             `json:"op"`
+			D  json.RawMessage `json:"d"`
+		}
+		if err := ws.ReadJSON(&p); err != nil {
+			return
+		}
+		switch p.Op {
+		case opHeartbeat:
+			if c.send(opHeartbeatAck, nil, 0, "") != nil {
+				return
+			}
+		case opIdentify:
+			var id struct {
+				Token string `json:"token"`
+			}
+			json.Unmarshal(p.D, &id)
+			if id.Token == "" {
+				s.closeWith(c, 4004, "Authentication failed.")
+				return
+			}
+			s.identify(c, fmt.Sprintf("ws://%s/gateway", r.Host))
+		case opResume:
+			var res struct {
+				SessionID string `json:"session_id"`
+				Seq       int64  `json:"seq"`
+			}
+			json.Unmarshal(p.D, &res)
+			if !s.resume(c, res.SessionID, res.Seq) {
+				c.send(opInvalidSession, false, 0, "")
+			}
+		default:
+			slog.Warn("fakediscord: unexpected Gateway op", "op", p.Op)
+		}
+	}
+}
+
+func (s *Server) closeWith(c *gatewayConn, code int, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(time.Second))
+}
+
+// identify starts a new session on c.
+func (s *Server) identify(c *gatewayConn, resumeURL string) {
+	s.mu.Lock()
+	s.stats.Identifies++
+	s.mu.Unlock()
+
+	s.mu.Lock()
+	var channels []channel
+	for _, ch := range s.channels {
+		if ch.GuildID == GuildID && ch.Type == typeGuildText {
+			channels = append(channels, *ch)
+		}
+	}
+	s.mu.Unlock()
+
+	s.gmu.Lock()
+	defer s.gmu.Unlock()
+	s.sessions++
+	s.sessionID = fmt.Sprintf("fake-session-%d", s.sessions)
+	s.eventSeq = 0
+	s.delivered = nil
+	s.ready[c] = true
+	s.deliver(event{name: "READY", data: map[string]any{
+		"v":                  10,
+		"user":               map[string]any{"id": BotUser, "username": botName, "bot": true},
+		"session_id":         s.sessionID,
+		"resume_gateway_url": resumeURL,
+		"guilds":             []any{map[string]any{"id": GuildID, "unavailable": true}},
+		"application":        map[string]any{"id": ApplicationID},
+	}})
+	s.deliver(event{name: "GUILD_CREATE", data: map[string]any{
+		"id": GuildID, "name": "Fake Guild", "channels": channels, "threads": []any{},
+	}})
+	s.flush()
+	select {
+	case <-s.connected:
+	default:
+		close(s.connected)
+	}
+}
+
+// resume replays the events after seq in sessionID on c.
+func (s *Server) resume(c *gatewayConn, sessionID string, seq int64) bool {
+	s.gmu.Lock()
+	defer s.gmu.Unlock()
+	if sessionID == "" || sessionID != s.sessionID || seq > s.eventSeq {
+		return false
+	}
+	s.mu.Lock()
+	s.stats.Resumes++
+	s.mu.Unlock()
+	for _, ev := range s.delivered {
+		if ev.seq > seq {
+			c.send(opDispatch, ev.data, ev.seq, ev.name)
+		}
+	}
+	s.ready[c] = true
+	s.deliver(event{name: "RESUMED", data: nil})
+	s.flush()
+	return true
+}
+
+// Mention posts text from userID in channelID, addressed to the bot, and
+// returns the ID of the user's message. channelID may be a thread started
+// from another message.
+func (s *Server) Mention(channelID, userID, text string) string {
+	return s.post(channelID, userID, fmt.Sprintf("<@%s> %s", BotUser, text))
+}
+
+// DirectMessage sends text from userID to the bot in a direct message and
+// returns the ID of the user's message.
+func (s *Server) DirectMessage(userID, text string) string {
+	return s.post(s.dmChannel(userID).ID, userID, text)
+}
+
+// DMChannel returns the ID of the direct message channel between userID
+// and the bot.
+func (s *Server) DMChannel(userID string) string {
+	return s.dmChannel(userID).ID
+}
+
+func (s *Server) post(channelID, userID, content string) string {
+	s.mu.Lock()
+	ch, ok := s.channels[channelID]
+	if !ok {
+		ch = &channel{ID: channelID, Type: typeGuildText, GuildID: GuildID}
+		s.channels[channelID] = ch
+	}
+	id := s.nextID()
+	s.userMsgs[id] = userMessage{channelID: channelID, userID: userID, content: content}
+	guildID := ch.GuildID
+	s.mu.Unlock()
+
+	s.dispatch("MESSAGE_CREATE", messagePayload(id, channelID, guildID, author(userID), content))
+	return id
+}
+
+// EditMessage changes the text of a message sent with Mention or
+// DirectMessage. In a guild channel, the bot mention is kept unless text
+// already addresses someone.
+func (s *Server) EditMessage(channelID, id, text string) error {
+	s.mu.Lock()
+	m, ok := s.userMsgs[id]
+	if !ok || m.channelID != channelID {
+		s.mu.Unlock()
+		return fmt.Errorf("no user message %s in %s", id, channelID)
+	}
+	guildID := s.channels[channelID].GuildID
+	if guildID != "" && !strings.Contains(text, "<@") {
+		text = fmt.Sprintf("<@%s> %s", BotUser, text)
+	}
+	m.content = text
+	s.userMsgs[id] = m
+	s.mu.Unlock()
+
+	payload := messagePayload(id, channelID, guildID, author(m.userID), text)
+	payload["edited_timestamp"] = time.Now().UTC().Format(time.RFC3339)
+	s.dispatch("MESSAGE_UPDATE", payload)
+	return nil
+}
+
+// DeleteMessage deletes a message sent with Mention or DirectMessage.
+func (s *Server) DeleteMessage(channelID, id string) error {
+	s.mu.Lock()
+	m, ok := s.userMsgs[id]
+	if !ok || m.channelID != channelID {
+		s.mu.Unlock()
+		return fmt.Errorf("no user message %s in %s", id, channelID)
+	}
+	delete(s.userMsgs, id)
+	guildID := s.channels[channelID].GuildID
+	s.mu.Unlock()
+
+	d := map[string]any{"id": id, "channel_id": channelID}
+	if guildID != "" {
+		d["guild_id"] = guildID
+	}
+	s.dispatch("MESSAGE_DELETE", d)
+	return nil
+}
+
+// PressButton clicks the first button of the bot's message id in
+// channelID as userID.
+func (s *Server) PressButton(channelID, id, userID string) error {
+	s.mu.Lock()
+	m := s.find(channelID, id)
+	if m == nil || m.Deleted || len(m.Buttons) == 0 {
+		s.mu.Unlock()
+		return errors.New("no message with a button to press")
+	}
+	customID := m.Buttons[0]
+	guildID := s.channels[channelID].GuildID
+	interactionID := s.nextID()
+	s.mu.Unlock()
+
+	d := map[string]any{
+		"id":             interactionID,
+		"application_id": ApplicationID,
+		"type":           3,
+		"token":          "fake-token-" + interactionID,
+		"channel_id":     channelID,
+		"message":        map[string]any{"id": id, "channel_id": channelID},
+		"data":           map[string]any{"custom_id": customID, "component_type": 2},
+	}
+	if guildID != "" {
+		d["guild_id"] = guildID
+		d["member"] = map[string]any{"user": author(userID)}
+	} else {
+		d["user"] = author(userID)
+	}
+	s.dispatch("INTERACTION_CREATE", d)
+	return nil
+}
+
+func author(userID string) map[string]any {
+	return map[string]any{"id": userID, "username": "user" + userID[max(0, len(userID)-4):]}
+}
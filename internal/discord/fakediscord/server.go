@@ -0,0 +1,486 @@
+// Package fakediscord is a local stand-in for the Discord REST API and
+// Gateway, good enough to run the real bot end to end without a network.
+// It serves the message, thread, DM and interaction routes the bot calls,
+// with Discord-style per-channel rate limit buckets, and a Gateway that
+// pushes scripted messages, edits, deletions and button presses and
+// supports resuming.
+package fakediscord
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	GuildID       = "900000000000000001"
+	BotUser       = "900000000000000002"
+	ApplicationID = "900000000000000003"
+	// Channel and User are used by the cmd/fakediscord script when a step
+	// leaves them out.
+	Channel = "900000000000000010"
+	User    = "900000000000000020"
+
+	botName = "chatrelay"
+	// maxContent is Discord's message length limit.
+	maxContent = 2000
+)
+
+// Channel types.
+const (
+	typeGuildText    = 0
+	typeDM           = 1
+	typePublicThread = 11
+)
+
+// Message is a message the bot posted, with every text it has had in
+// order. Revisions[0] is the text it was posted with.
+type Message struct {
+	ID        string
+	ChannelID string
+	Revisions []string
+	// Buttons are the custom IDs of the message's buttons.
+	Buttons []string
+	Deleted bool
+}
+
+// Text is the current text of the message.
+func (m Message) Text() string {
+	return m.Revisions[len(m.Revisions)-1]
+}
+
+type channel struct {
+	ID       string `json:"id"`
+	Type     int    `json:"type"`
+	GuildID  string `json:"guild_id,omitempty"`
+	ParentID string `json:"parent_id,omitempty"`
+	Name     string `json:"name,omitempty"`
+}
+
+// userMessage is a message posted by a fake user, kept so edits, deletions
+// and button presses can refer to it.
+type userMessage struct {
+	channelID string
+	userID    string
+	content   string
+}
+
+// window is the state of one rate limit bucket.
+type window struct {
+	used  int
+	reset time.Time
+}
+
+// Stats counts what the bot did that the Discord API cares about.
+type Stats struct {
+	Identifies   int
+	Resumes      int
+	RateLimited  int
+	Interactions int
+}
+
+// Server is a fake Discord. Create it with NewServer and either mount it as
+// an http.Handler or call Start.
+type Server struct {
+	mux *http.ServeMux
+	// HeartbeatInterval is sent in Hello.
+	HeartbeatInterval time.Duration
+	// RateLimit requests per RateWindow are allowed on each channel's
+	// message routes; more get 429 Too Many Requests.
+	RateLimit  int
+	RateWindow time.Duration
+
+	mu       sync.Mutex
+	seq      int64
+	messages []*Message
+	userMsgs map[string]userMessage
+	channels map[string]*channel
+	dms      map[string]string
+	buckets  map[string]*window
+	stats    Stats
+
+	gateway
+
+	httpServer *httptest.Server
+}
+
+func NewServer() *Server {
+	s := &Server{
+		mux:               http.NewServeMux(),
+		HeartbeatInterval: 10 * time.Second,
+		RateLimit:         5,
+		RateWindow:        5 * time.Second,
+		userMsgs:          make(map[string]userMessage),
+		channels:          make(map[string]*channel),
+		dms:               make(map[string]string),
+		buckets:           make(map[string]*window),
+	}
+	s.gateway.init()
+	s.channels[Channel] = &channel{ID: Channel, Type: typeGuildText, GuildID: GuildID, Name: "general"}
+
+	s.mux.HandleFunc("GET /api/v10/gateway/bot", s.gatewayBot)
+	s.mux.HandleFunc("GET /api/v10/channels/{channel}", s.getChannel)
+	s.mux.HandleFunc("POST /api/v10/channels/{channel}/messages", s.createMessage)
+	s.mux.HandleFunc("PATCH /api/v10/channels/{channel}/messages/{message}", s.editMessage)
+	s.mux.HandleFunc("DELETE /api/v10/channels/{channel}/messages/{message}", s.deleteMessage)
+	s.mux.HandleFunc("POST /api/v10/channels/{channel}/messages/{message}/threads", s.startThread)
+	s.mux.HandleFunc("POST /api/v10/users/@me/channels", s.createDM)
+	s.mux.HandleFunc("POST /api/v10/interactions/{id}/{token}/callback", s.interactionCallback)
+	s.mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, 0, "404: Not Found")
+	})
+	s.mux.HandleFunc("/gateway", s.serveGateway)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/api/") && !strings.HasPrefix(r.Header.Get("Authorization"), "Bot ") {
+		writeError(w, http.StatusUnauthorized, 0, "401: Unauthorized")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// Start serves the fake on a random local port until Close.
+func (s *Server) Start() {
+	s.httpServer = httptest.NewServer(s)
+}
+
+func (s *Server) Close() {
+	s.closeConnections()
+	if s.httpServer != nil {
+		s.httpServer.Close()
+	}
+}
+
+// URL is the base URL of a started server.
+func (s *Server) URL() string {
+	return s.httpServer.URL
+}
+
+// APIURL is the REST API base URL to configure the bot with, e.g.
+// DISCORD_API_URL.
+func (s *Server) APIURL() string {
+	return s.URL() + "/api/v10"
+}
+
+// Messages returns copies of every message the bot has posted, in posting
+// order.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Message, len(s.messages))
+	for i, m := range s.messages {
+		out[i] = clone(m)
+	}
+	return out
+}
+
+// Message returns a copy of the bot's message with the given ID.
+func (s *Server) Message(channelID, id string) (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.find(channelID, id)
+	if m == nil {
+		return Message{}, false
+	}
+	return clone(m), true
+}
+
+// Thread returns the ID of the thread started from a message, if any.
+func (s *Server) Thread(messageID string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch, ok := s.channels[messageID]
+	if !ok || ch.Type != typePublicThread {
+		return "", false
+	}
+	return ch.ID, true
+}
+
+func (s *Server) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+func (s *Server) gatewayBot(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"url":    fmt.Sprintf("ws://%s/gateway", r.Host),
+		"shards": 1,
+		"session_start_limit": map[string]any{
+			"total": 1000, "remaining": 1000, "reset_after": 0, "max_concurrency": 1,
+		},
+	})
+}
+
+func (s *Server) getChannel(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	ch, ok := s.channels[r.PathValue("channel")]
+	var c channel
+	if ok {
+		c = *ch
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, 10003, "Unknown Channel")
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+type messageBody struct {
+	Content    string `json:"content"`
+	Components []struct {
+		Components []struct {
+			CustomID string `json:"custom_id"`
+		} `json:"components"`
+	} `json:"components"`
+}
+
+func (b messageBody) buttons() []string {
+	var ids []string
+	for _, row := range b.Components {
+		for _, c := range row.Components {
+			ids = append(ids, c.CustomID)
+		}
+	}
+	return ids
+}
+
+// decodeMessage reads and validates a create or edit message body.
+func decodeMessage(w http.ResponseWriter, r *http.Request) (messageBody, bool) {
+	var body messageBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, 50109, "The request body contains invalid JSON.")
+		return body, false
+	}
+	if n := len([]rune(body.Content)); n == 0 || n > maxContent {
+		writeError(w, http.StatusBadRequest, 50035, fmt.Sprintf("Invalid Form Body: content must be 1 to %d characters long, got %d", maxContent, n))
+		return body, false
+	}
+	return body, true
+}
+
+func (s *Server) createMessage(w http.ResponseWriter, r *http.Request) {
+	channelID := r.PathValue("channel")
+	if !s.limit(w, channelID) {
+		return
+	}
+	body, ok := decodeMessage(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	ch, known := s.channels[channelID]
+	if !known {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, 10003, "Unknown Channel")
+		return
+	}
+	m := &Message{ID: s.nextID(), ChannelID: channelID, Revisions: []string{body.Content}, Buttons: body.buttons()}
+	s.messages = append(s.messages, m)
+	guildID := ch.GuildID
+	s.mu.Unlock()
+
+	payload := messagePayload(m.ID, channelID, guildID, map[string]any{"id": BotUser, "username": botName, "bot": true}, body.Content)
+	s.dispatch("MESSAGE_CREATE", payload)
+	writeJSON(w, http.StatusOK, payload)
+}
+
+func (s *Server) editMessage(w http.ResponseWriter, r *http.Request) {
+	channelID, id := r.PathValue("channel"), r.PathValue("message")
+	if !s.limit(w, channelID) {
+		return
+	}
+	body, ok := decodeMessage(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	m := s.find(channelID, id)
+	if m == nil || m.Deleted {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, 10008, "Unknown Message")
+		return
+	}
+	m.Revisions = append(m.Revisions, body.Content)
+	m.Buttons = body.buttons()
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"id": id, "channel_id": channelID, "content": body.Content})
+}
+
+func (s *Server) deleteMessage(w http.ResponseWriter, r *http.Request) {
+	channelID, id := r.PathValue("channel"), r.PathValue("message")
+	if !s.limit(w, channelID) {
+		return
+	}
+	s.mu.Lock()
+	m := s.find(channelID, id)
+	if m == nil || m.Deleted {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, 10008, "Unknown Message")
+		return
+	}
+	m.Deleted = true
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) startThread(w http.ResponseWriter, r *http.Request) {
+	channelID, id := r.PathValue("channel"), r.PathValue("message")
+	var body struct {
+		Name string `json:"name"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	if n := len([]rune(body.Name)); n == 0 || n > 100 {
+		writeError(w, http.StatusBadRequest, 50035, "Invalid Form Body: name must be 1 to 100 characters long")
+		return
+	}
+
+	s.mu.Lock()
+	parent, ok := s.channels[channelID]
+	_, isUserMsg := s.userMsgs[id]
+	switch {
+	case !ok || parent.Type != typeGuildText:
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, 50024, "Cannot execute action on this channel type")
+		return
+	case !isUserMsg && s.find(channelID, id) == nil:
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, 10008, "Unknown Message")
+		return
+	case s.channels[id] != nil:
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, 160004, "A thread has already been created for this message")
+		return
+	}
+	thread := &channel{ID: id, Type: typePublicThread, GuildID: parent.GuildID, ParentID: channelID, Name: body.Name}
+	s.channels[id] = thread
+	c := *thread
+	s.mu.Unlock()
+
+	s.dispatch("THREAD_CREATE", c)
+	writeJSON(w, http.StatusCreated, c)
+}
+
+func (s *Server) createDM(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		RecipientID string `json:"recipient_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.RecipientID == "" {
+		writeError(w, http.StatusBadRequest, 50035, "Invalid Form Body")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.dmChannel(body.RecipientID))
+}
+
+func (s *Server) interactionCallback(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.stats.Interactions++
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// limit applies the rate limit of channelID's message bucket, writing the
+// rate limit headers, and a 429 response if the bucket is exhausted.
+func (s *Server) limit(w http.ResponseWriter, channelID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	b, ok := s.buckets[channelID]
+	if !ok || now.After(b.reset) {
+		b = &window{reset: now.Add(s.RateWindow)}
+		s.buckets[channelID] = b
+	}
+	resetAfter := b.reset.Sub(now).Seconds()
+	h := w.Header()
+	h.Set("X-RateLimit-Bucket", "fakemessages")
+	h.Set("X-RateLimit-Limit", fmt.Sprint(s.RateLimit))
+	h.Set("X-RateLimit-Reset-After", fmt.Sprintf("%.3f", resetAfter))
+	if b.used >= s.RateLimit {
+		s.stats.RateLimited++
+		h.Set("X-RateLimit-Remaining", "0")
+		h.Set("X-RateLimit-Scope", "user")
+		h.Set("Retry-After", fmt.Sprintf("%.0f", resetAfter+0.5))
+		writeJSON(w, http.StatusTooManyRequests, map[string]any{
+			"message": "You are being rate limited.", "retry_after": resetAfter, "global": false,
+		})
+		return false
+	}
+	b.used++
+	h.Set("X-RateLimit-Remaining", fmt.Sprint(s.RateLimit-b.used))
+	return true
+}
+
+func (s *Server) dmChannel(userID string) channel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.dms[userID]
+	if !ok {
+		id = s.nextID()
+		s.dms[userID] = id
+		s.channels[id] = &channel{ID: id, Type: typeDM}
+	}
+	return *s.channels[id]
+}
+
+// nextID returns a new snowflake-like ID. s.mu must be held.
+func (s *Server) nextID() string {
+	s.seq++
+	return fmt.Sprint(1_100_000_000_000_000_000 + s.seq)
+}
+
+// find returns the bot's message with the given ID. s.mu must be held.
+func (s *Server) find(channelID, id string) *Message {
+	for _, m := range s.messages {
+		if m.ChannelID == channelID && m.ID == id {
+			return m
+		}
+	}
+	return nil
+}
+
+func clone(m *Message) Message {
+	c := *m
+	c.Revisions = slices.Clone(m.Revisions)
+	c.Buttons = slices.Clone(m.Buttons)
+	return c
+}
+
+func messagePayload(id, channelID, guildID string, author map[string]any, content string) map[string]any {
+	p := map[string]any{
+		"id":         id,
+		"channel_id": channelID,
+		"author":     author,
+		"content":    content,
+		"timestamp":  time.Now().UTC().Format(time.RFC3339),
+		"mentions":   []any{},
+		"type":       0,
+	}
+	if strings.Contains(content, "<@"+BotUser+">") {
+		p["mentions"] = []any{map[string]any{"id": BotUser, "username": botName, "bot": true}}
+	}
+	if guildID != "" {
+		p["guild_id"] = guildID
+	}
+	return p
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("fakediscord: failed to write response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status, code int, message string) {
+	writeJSON(w, status, map[string]any{"code": code, "message": message})
+}
@@ -0,0 +1,247 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"chatrelay-bot/internal/health"
+)
+
+const maxReconnectDelay = time.Minute
+
+// gatewaySession is what a reconnect needs to resume where the previous
+// connection left off. Only seq is read outside Run's goroutine.
+type gatewaySession struct {
+	url       string // from GET /gateway/bot
+	id        string
+	resumeURL string
+	seq       atomic.Int64
+}
+
+// errFatal wraps Gateway close codes that reconnecting cannot fix, such as
+// an invalid token or disallowed intents.
+var errFatal = errors.New("discord gateway closed the connection")
+
+// Run connects to the Gateway and delivers messages until ctx is done,
+// reconnecting, and resuming the session where Discord allows, whenever the
+// connection drops.
+func (c *Client) Run(ctx context.Context) error {
+	delay := time.Second
+	for {
+		connected, err := c.connect(ctx)
+		health.Set(health.DiscordGateway, false, "disconnected")
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, errFatal) {
+			return err
+		}
+		if connected {
+			delay = time.Second
+		}
+		slog.WarnContext(ctx, "Discord Gateway connection lost, reconnecting", "error", err, "delay", delay, "resume", c.session.id != "")
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// connect runs one Gateway connection until it drops. connected reports
+// whether the session got as far as READY or RESUMED.
+func (c *Client) connect(ctx context.Context) (connected bool, err error) {
+	s := &c.session
+	if s.url == "" {
+		var gw struct {
+			URL string `json:"url"`
+		}
+		if err := c.rest.do(ctx, "GET", "/gateway/bot", nil, &gw); err != nil {
+			var apiErr *APIError
+			if errors.As(err, &apiErr) && apiErr.Status == 401 {
+				return false, fmt.Errorf("%w: invalid token: %v", errFatal, err)
+			}
+			return false, fmt.Errorf("failed to get Gateway URL: %w", err)
+		}
+		s.url = gw.URL
+	}
+	base := s.url
+	if s.id != "" && s.resumeURL != "" {
+		base = s.resumeURL
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return false, fmt.Errorf("invalid Gateway URL %q: %w", base, err)
+	}
+	q := u.Query()
+	q.Set("v", "10")
+	q.Set("encoding", "json")
+	u.RawQuery = q.Encode()
+
+	health.Set(health.DiscordGateway, false, "connecting")
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, u.String(), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to Gateway: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		conn.Close()
+	})
+	defer stop()
+
+	var first gatewayPayload
+	if err := conn.ReadJSON(&first); err != nil {
+		return false, fmt.Errorf("failed to read Hello: %w", err)
+	}
+	var h hello
+	if first.Op != opHello || json.Unmarshal(first.D, &h) != nil || h.HeartbeatInterval <= 0 {
+		return false, fmt.Errorf("expected Hello, got op %d", first.Op)
+	}
+
+	w := &gatewayWriter{conn: conn}
+	if s.id != "" {
+		err = w.send(opResume, resume{Token: *c.rest.token.Load(), SessionID: s.id, Seq: s.seq.Load()})
+	} else {
+		err = w.send(opIdentify, identify{
+			Token:      *c.rest.token.Load(),
+			Intents:    intents,
+			Properties: identifyProperties{OS: "linux", Browser: "chatrelay", Device: "chatrelay"},
+		})
+	}
+	if err != nil {
+		return false, err
+	}
+
+	hbCtx, stopHeartbeat := context.WithCancel(ctx)
+	defer stopHeartbeat()
+	acks := make(chan struct{}, 1)
+	go w.heartbeat(hbCtx, time.Duration(h.HeartbeatInterval)*time.Millisecond, acks, &s.seq)
+
+	for {
+		var p gatewayPayload
+		if err := conn.ReadJSON(&p); err != nil {
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				switch closeErr.Code {
+				case 4004, 4010, 4011, 4012, 4013, 4014:
+					return connected, fmt.Errorf("%w: %d %s", errFatal, closeErr.Code, closeErr.Text)
+				case 4007, 4009:
+					// Invalid sequence or session timed out: start afresh.
+					s.id = ""
+				}
+			}
+			return connected, err
+		}
+		switch p.Op {
+		case opDispatch:
+			if p.S != nil {
+				s.seq.Store(*p.S)
+			}
+			switch p.T {
+			case "READY":
+				var r ready
+				if err := json.Unmarshal(p.D, &r); err == nil {
+					s.id, s.resumeURL = r.SessionID, r.ResumeGatewayURL
+				}
+				connected = true
+				health.Set(health.DiscordGateway, true, "connected")
+			case "RESUMED":
+				connected = true
+				health.Set(health.DiscordGateway, true, "connected")
+				slog.InfoContext(ctx, "Resumed Discord Gateway session")
+			}
+			c.dispatch(ctx, p.T, p.D)
+		case opHeartbeat:
+			if err := w.send(opHeartbeat, lastSeq(&s.seq)); err != nil {
+				return connected, err
+			}
+		case opHeartbeatAck:
+			select {
+			case acks <- struct{}{}:
+			default:
+			}
+		case opReconnect:
+			return connected, errors.New("Gateway asked to reconnect")
+		case opInvalidSession:
+			var resumable bool
+			json.Unmarshal(p.D, &resumable)
+			if !resumable {
+				s.id, s.resumeURL = "", ""
+			}
+			// Discord asks for a random wait of 1 to 5 seconds before
+			// identifying again.
+			sleep(ctx, time.Second+rand.N(4*time.Second))
+			return connected, errors.New("Gateway session invalidated")
+		}
+	}
+}
+
+// gatewayWriter serializes writes to a Gateway connection.
+type gatewayWriter struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func (w *gatewayWriter) send(op int, d any) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err := w.conn.WriteJSON(outgoingPayload{Op: op, D: d}); err != nil {
+		return fmt.Errorf("failed to send op %d: %w", op, err)
+	}
+	return nil
+}
+
+// heartbeat sends a heartbeat every interval, the first after a random
+// fraction of it as Discord asks. If a heartbeat is not acknowledged before
+// the next is due, the connection is assumed dead and closed, which makes
+// the read loop reconnect.
+func (w *gatewayWriter) heartbeat(ctx context.Context, interval time.Duration, acks <-chan struct{}, seq *atomic.Int64) {
+	if err := sleep(ctx, rand.N(interval)); err != nil {
+		return
+	}
+	acked := true
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-acks:
+			acked = true
+			continue
+		default:
+		}
+		if !acked {
+			slog.WarnContext(ctx, "Discord heartbeat not acknowledged, reconnecting")
+			w.conn.Close()
+			return
+		}
+		acked = false
+		if err := w.send(opHeartbeat, lastSeq(seq)); err != nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// lastSeq is the heartbeat payload: the last sequence number received, or
+// null before any.
+func lastSeq(seq *atomic.Int64) any {
+	if n := seq.Load(); n > 0 {
+		return n
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"chatrelay-bot/pkg/models"
+)
+
+const (
+	maxThreadName = 100
+	// threadArchiveMinutes is how long a reply thread stays open without
+	// activity.
+	threadArchiveMinutes = 1440
+)
+
+// Post sends msg, split into several messages if it is too long. With a
+// Thread, the reply goes into the thread started from that message,
+// starting it if needed. The returned ID names both the channel and the
+// first message, as the channel is not always msg.Conversation.
+func (c *Client) Post(ctx context.Context, msg models.OutgoingMessage) (string, error) {
+	tracer := otel.Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, "PostMessageToDiscord",
+		trace.WithAttributes(
+			attribute.String("discord.channel_id", msg.Conversation),
+			attribute.String("discord.thread_id", msg.Thread),
+			attribute.Int("discord.message_length", len(msg.Text)),
+		),
+	)
+	defer span.End()
+
+	channelID, err := c.replyChannel(ctx, msg.Conversation, msg.Thread)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to start thread")
+		return "", err
+	}
+	chunks := splitMessage(msg.Text, maxMessageLength)
+	var ids []string
+	for i, chunk := range chunks {
+		id, err := c.createMessage(ctx, channelID, c.body(chunk, msg, i == len(chunks)-1))
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to send Discord message", "error", err, "channel", channelID)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Failed to send message")
+			return "", err
+		}
+		ids = append(ids, id)
+	}
+	id := replyID(channelID, ids[0])
+	if len(ids) > 1 {
+		c.mu.Lock()
+		c.overflow[id] = ids[1:]
+		c.mu.Unlock()
+	}
+	span.SetAttributes(attribute.Int("discord.message_count", len(ids)))
+	span.SetStatus(codes.Ok, "success")
+	return id, nil
+}
+
+// Update replaces the text of a reply, posting further messages when it
+// grows past the length limit and deleting them when it shrinks again.
+func (c *Client) Update(ctx context.Context, id string, msg models.OutgoingMessage) error {
+	tracer := otel.Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, "UpdateMessageInDiscord",
+		trace.WithAttributes(attribute.String("discord.reply_id", id)),
+	)
+	defer span.End()
+
+	channelID, messageID, err := splitReplyID(id)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	overflow := c.overflow[id]
+	c.mu.Unlock()
+
+	chunks := splitMessage(msg.Text, maxMessageLength)
+	var kept []string
+	for i, chunk := range chunks {
+		body := c.body(chunk, msg, i == len(chunks)-1)
+		switch {
+		case i == 0:
+			err = c.rest.do(ctx, "PATCH", fmt.Sprintf("/channels/%s/messages/%s", channelID, messageID), body, nil)
+		case i-1 < len(overflow):
+			err = c.rest.do(ctx, "PATCH", fmt.Sprintf("/channels/%s/messages/%s", channelID, overflow[i-1]), body, nil)
+			kept = append(kept, overflow[i-1])
+		default:
+			var extra string
+			extra, err = c.createMessage(ctx, channelID, body)
+			kept = append(kept, extra)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == nil && len(overflow) > len(kept) {
+		for _, extra := range overflow[len(kept):] {
+			if err = c.rest.do(ctx, "DELETE", fmt.Sprintf("/channels/%s/messages/%s", channelID, extra), nil, nil); err != nil {
+				kept = append(kept, extra)
+			}
+		}
+	}
+	c.setOverflow(id, kept)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to update Discord message", "error", err, "channel", channelID, "message", messageID)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to update message")
+		return fmt.Errorf("failed to update message: %w", err)
+	}
+	span.SetStatus(codes.Ok, "success")
+	return nil
+}
+
+// Delete deletes a reply and any further messages it was split into.
+func (c *Client) Delete(ctx context.Context, conversation, id string) error {
+	tracer := otel.Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, "DeleteMessageInDiscord",
+		trace.WithAttributes(attribute.String("discord.reply_id", id)),
+	)
+	defer span.End()
+
+	channelID, messageID, err := splitReplyID(id)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	overflow := c.overflow[id]
+	delete(c.overflow, id)
+	c.mu.Unlock()
+	for _, extra := range append(overflow, messageID) {
+		if err := c.rest.do(ctx, "DELETE", fmt.Sprintf("/channels/%s/messages/%s", channelID, extra), nil, nil); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Failed to delete message")
+			return fmt.Errorf("failed to delete message: %w", err)
+		}
+	}
+	span.SetStatus(codes.Ok, "success")
+	return nil
+}
+
+// Notify tells userID something privately. Discord has no messages only
+// one member of a channel can see outside of interactions, so outside a
+// direct message the notice goes to a direct message with the user.
+func (c *Client) Notify(ctx context.Context, conversation, userID, text string) error {
+	tracer := otel.Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, "NotifyUserInDiscord",
+		trace.WithAttributes(
+			attribute.String("discord.channel_id", conversation),
+			attribute.String("discord.user_id", userID),
+		),
+	)
+	defer span.End()
+
+	channelID := conversation
+	if ch, err := c.channel(ctx, conversation); err != nil || ch.Type != channelDM {
+		if channelID, err = c.dmChannel(ctx, userID); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Failed to open DM")
+			return fmt.Errorf("failed to open DM with %s: %w", userID, err)
+		}
+	}
+	if _, err := c.createMessage(ctx, channelID, c.body(text, models.OutgoingMessage{}, false)); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to send notice")
+		return err
+	}
+	span.SetStatus(codes.Ok, "success")
+	return nil
+}
+
+// Mention returns the <@ID> markup for user. Notices are sent with
+// mentions disabled, so it does not ping them.
+func (c *Client) Mention(user models.Author) string {
+	return fmt.Sprintf("<@%s>", user.ID)
+}
+
+// Time formats t as a Discord timestamp, which is shown in the reader's own
+// time zone.
+func (c *Client) Time(t time.Time) string {
+	if time.Until(t) < time.Hour {
+		return fmt.Sprintf("at <t:%d:T>", t.Unix())
+	}
+	return fmt.Sprintf("on <t:%d:f>", t.Unix())
+}
+
+func (c *Client) createMessage(ctx context.Context, channelID string, body messageBody) (string, error) {
+	var created message
+	if err := c.rest.do(ctx, "POST", fmt.Sprintf("/channels/%s/messages", channelID), body, &created); err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// body builds a message with text, and msg's actions as buttons if last.
+// Button custom IDs carry the conversation so that a press can be matched
+// to it even when the reply is in a thread.
+func (c *Client) body(text string, msg models.OutgoingMessage, last bool) messageBody {
+	body := messageBody{
+		Content:         text,
+		Components:      []component{},
+		AllowedMentions: &allowedMentions{Parse: []string{}},
+	}
+	if !last || len(msg.Actions) == 0 {
+		return body
+	}
+	row := component{Type: componentActionRow}
+	for _, action := range msg.Actions {
+		row.Components = append(row.Components, component{
+			Type:     componentButton,
+			Style:    buttonPrimary,
+			Label:    action.Label,
+			CustomID: action.ID + ":" + msg.Conversation + ":" + action.Value,
+		})
+	}
+	body.Components = []component{row}
+	return body
+}
+
+// replyChannel returns the channel a reply in thread goes to. thread is the
+// ID of the message to start a thread from, or the conversation itself
+// when the message was already in a thread. Direct messages have no
+// threads.
+func (c *Client) replyChannel(ctx context.Context, conversation, thread string) (string, error) {
+	if thread == "" || thread == conversation {
+		return conversation, nil
+	}
+	ch, err := c.channel(ctx, conversation)
+	if err != nil {
+		return "", err
+	}
+	if ch.Type == channelDM || ch.Type == channelGroupDM {
+		return conversation, nil
+	}
+
+	c.mu.Lock()
+	name := c.recent[thread]
+	c.mu.Unlock()
+	if name = strings.Join(strings.Fields(name), " "); name == "" {
+		name = "ChatRelay"
+	}
+	if r := []rune(name); len(r) > maxThreadName {
+		name = string(r[:maxThreadName-1]) + "…"
+	}
+
+	var started channel
+	err = c.rest.do(ctx, "POST", fmt.Sprintf("/channels/%s/messages/%s/threads", conversation, thread),
+		map[string]any{"name": name, "auto_archive_duration": threadArchiveMinutes}, &started)
+	switch {
+	case isAPIError(err, errThreadExists):
+		// A thread started from a message has the message's ID.
+		started = channel{ID: thread, Type: channelPublicThread, ParentID: conversation}
+	case err != nil:
+		return "", fmt.Errorf("failed to start thread: %w", err)
+	}
+	c.mu.Lock()
+	c.channels[started.ID] = started
+	c.mu.Unlock()
+	return started.ID, nil
+}
+
+func (c *Client) dmChannel(ctx context.Context, userID string) (string, error) {
+	c.mu.Lock()
+	id, ok := c.dms[userID]
+	c.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+	var ch channel
+	if err := c.rest.do(ctx, "POST", "/users/@me/channels", map[string]string{"recipient_id": userID}, &ch); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.dms[userID] = ch.ID
+	c.channels[ch.ID] = ch
+	c.mu.Unlock()
+	return ch.ID, nil
+}
+
+func (c *Client) setOverflow(id string, ids []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(ids) == 0 {
+		delete(c.overflow, id)
+		return
+	}
+	c.overflow[id] = ids
+}
+
+// replyID identifies a message the bot posted by its channel and ID.
+func replyID(channelID, messageID string) string {
+	return channelID + "/" + messageID
+}
+
+func splitReplyID(id string) (channelID, messageID string, err error) {
+	channelID, messageID, ok := strings.Cut(id, "/")
+	if !ok {
+		return "", "", fmt.Errorf("invalid Discord message ID %q", id)
+	}
+	return channelID, messageID, nil
+}
@@ -0,0 +1,282 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+
+	"chatrelay-bot/internal/telemetry"
+)
+
+// DefaultAPIURL is the Discord REST API base URL.
+const DefaultAPIURL = "https://discord.com/api/v10"
+
+const (
+	userAgent = "DiscordBot (https://github.com/chatrelay/chatrelay-bot, 1.0)"
+	// maxAttempts bounds how often a request is sent when Discord answers
+	// 429 or 5xx.
+	maxAttempts = 5
+)
+
+// APIError is an error response from the Discord REST API.
+type APIError struct {
+	Status  int
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("discord API error %d: %s (code %d)", e.Status, e.Message, e.Code)
+}
+
+// rest calls the Discord REST API, waiting out rate limits. Discord puts
+// each route in a bucket, named by the X-RateLimit-Bucket header and scoped
+// to the route's channel, guild or webhook. Requests in the same bucket are
+// sent one at a time, and none is sent while the bucket is exhausted.
+type rest struct {
+	baseURL string
+	token   atomic.Pointer[string]
+	http    *http.Client
+
+	mu      sync.Mutex
+	hashes  map[string]string // route -> bucket hash
+	buckets map[string]*bucket
+	global  time.Time // no requests until then
+}
+
+type bucket struct {
+	mu        sync.Mutex
+	remaining int
+	reset     time.Time
+}
+
+func newREST(baseURL, token string) *rest {
+	r := &rest{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http: &http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport,
+				otelhttp.WithTracerProvider(otel.GetTracerProvider()),
+				otelhttp.WithPropagators(otel.GetTextMapPropagator()),
+			),
+		},
+		hashes:  make(map[string]string),
+		buckets: make(map[string]*bucket),
+	}
+	r.token.Store(&token)
+	return r
+}
+
+// do sends body as JSON to path and decodes the response into out, if
+// both are non-nil.
+func (r *rest) do(ctx context.Context, method, path string, body, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+	route, major := routeOf(method, path)
+
+	for attempt := 1; ; attempt++ {
+		b := r.bucket(route, major)
+		b.mu.Lock()
+		if err := r.wait(ctx, b); err != nil {
+			b.mu.Unlock()
+			return err
+		}
+		resp, err := r.send(ctx, method, path, payload)
+		if err != nil {
+			b.mu.Unlock()
+			telemetry.RecordDiscordAPICall(ctx, route, "transport_error")
+			return fmt.Errorf("%s: %w", route, err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		telemetry.RecordDiscordAPICall(ctx, route, strconv.Itoa(resp.StatusCode))
+		retryAfter := r.update(route, major, b, resp, data)
+		b.mu.Unlock()
+
+		switch {
+		case resp.StatusCode < 300:
+			if out != nil && len(data) > 0 {
+				if err := json.Unmarshal(data, out); err != nil {
+					return fmt.Errorf("failed to decode %s response: %w", route, err)
+				}
+			}
+			return nil
+		case (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500) && attempt < maxAttempts:
+			slog.WarnContext(ctx, "Discord request will be retried", "route", route, "status", resp.StatusCode, "retry_after", retryAfter, "attempt", attempt)
+			telemetry.RecordRetry(ctx, "discord", route)
+			if resp.StatusCode >= 500 {
+				retryAfter = time.Duration(attempt) * time.Second
+			}
+			if err := sleep(ctx, retryAfter); err != nil {
+				return err
+			}
+		default:
+			apiErr := &APIError{Status: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+			json.Unmarshal(data, apiErr)
+			return apiErr
+		}
+	}
+}
+
+func (r *rest) send(ctx context.Context, method, path string, payload []byte) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, r.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bot "+*r.token.Load())
+	req.Header.Set("User-Agent", userAgent)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return r.http.Do(req)
+}
+
+// bucket returns the bucket a route is in, as far as it is known yet.
+func (r *rest) bucket(route, major string) *bucket {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := route
+	if hash, ok := r.hashes[route]; ok {
+		key = hash
+	}
+	key += "|" + major
+	b, ok := r.buckets[key]
+	if !ok {
+		b = &bucket{remaining: 1}
+		r.buckets[key] = b
+	}
+	return b
+}
+
+// wait blocks while the global limit or the bucket is exhausted. b.mu must
+// be held.
+func (r *rest) wait(ctx context.Context, b *bucket) error {
+	r.mu.Lock()
+	until := r.global
+	r.mu.Unlock()
+	if b.remaining <= 0 && b.reset.After(until) {
+		until = b.reset
+	}
+	if d := time.Until(until); d > 0 {
+		return sleep(ctx, d)
+	}
+	return nil
+}
+
+// update records the rate limit headers of resp and returns how long to
+// wait before retrying a 429. b.mu must be held.
+func (r *rest) update(route, major string, b *bucket, resp *http.Response, data []byte) time.Duration {
+	h := resp.Header
+	if remaining, err := strconv.Atoi(h.Get("X-RateLimit-Remaining")); err == nil {
+		b.remaining = remaining
+	}
+	if after, err := strconv.ParseFloat(h.Get("X-RateLimit-Reset-After"), 64); err == nil {
+		b.reset = time.Now().Add(seconds(after))
+	}
+	if hash := h.Get("X-RateLimit-Bucket"); hash != "" {
+		r.mu.Lock()
+		if r.hashes[route] != hash {
+			r.hashes[route] = hash
+			// Later requests on this route find b under its hash, unless
+			// another route in the bucket got there first.
+			if _, ok := r.buckets[hash+"|"+major]; !ok {
+				r.buckets[hash+"|"+major] = b
+			}
+		}
+		r.mu.Unlock()
+	}
+
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return 0
+	}
+	var limited struct {
+		RetryAfter float64 `json:"retry_after"`
+		Global     bool    `json:"global"`
+	}
+	json.Unmarshal(data, &limited)
+	retryAfter := seconds(limited.RetryAfter)
+	if retryAfter <= 0 {
+		if after, err := strconv.ParseFloat(h.Get("Retry-After"), 64); err == nil {
+			retryAfter = seconds(after)
+		} else {
+			retryAfter = time.Second
+		}
+	}
+	if limited.Global || h.Get("X-RateLimit-Global") == "true" {
+		r.mu.Lock()
+		r.global = time.Now().Add(retryAfter)
+		r.mu.Unlock()
+	} else {
+		b.remaining = 0
+		b.reset = time.Now().Add(retryAfter)
+	}
+	return retryAfter
+}
+
+// routeOf returns the rate limit route of a request, with IDs other than
+// the major parameter replaced by placeholders, and the major parameter:
+// the channel, guild or webhook the request is about.
+func routeOf(method, path string) (route, major string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 1; i < len(segments); i++ {
+		switch segments[i-1] {
+		case "channels", "guilds", "webhooks":
+			if major == "" {
+				major = segments[i]
+			}
+			segments[i] = "{id}"
+		case "messages", "users", "members", "interactions":
+			if segments[i] != "@me" {
+				segments[i] = ":id"
+			}
+		case ":id":
+			if segments[i-2] == "interactions" {
+				segments[i] = ":token"
+			}
+		}
+	}
+	return method + " /" + strings.Join(segments, "/"), major
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isAPIError reports whether err is a Discord API error with the given
+// code.
+func isAPIError(err error, code int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
@@ -0,0 +1,86 @@
+package discord
+
+import "strings"
+
+// maxMessageLength is the most characters Discord accepts in a message.
+const maxMessageLength = 2000
+
+// fence is the Markdown code fence marker.
+const fence = "```"
+
+// splitMessage breaks text into chunks of at most limit characters,
+// preferring to break at a newline, then at a space. A code block that is
+// split is closed at the end of one chunk and reopened, with its language,
+// at the start of the next, so every chunk renders on its own.
+func splitMessage(text string, limit int) []string {
+	if len([]rune(text)) <= limit {
+		return []string{text}
+	}
+	// Room for closing a code block that is open at the break.
+	budget := limit - len("\n"+fence)
+
+	var chunks []string
+	var reopen string
+	rest := []rune(text)
+	for len(rest) > 0 {
+		prefix := []rune(reopen)
+		if len(prefix)+len(rest) <= limit {
+			chunks = append(chunks, string(prefix)+string(rest))
+			break
+		}
+		window := rest[:budget-len(prefix)]
+		cut := breakPoint(window)
+		chunk := strings.TrimRight(string(prefix)+string(rest[:cut]), " \n")
+		rest = []rune(strings.TrimLeft(string(rest[cut:]), " \n"))
+
+		if chunk == "" {
+			continue
+		}
+		reopen = ""
+		if open, ok := openFence(chunk); ok {
+			chunk += "\n" + fence
+			reopen = open + "\n"
+			// A fence line too long to carry over would crowd out the
+			// text; reopen the block without its language instead.
+			if len([]rune(reopen)) > budget/2 {
+				reopen = fence + "\n"
+			}
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// breakPoint returns where to cut window: after its last newline, or else
+// its last space, if either is in the second half; otherwise at its end.
+func breakPoint(window []rune) int {
+	s := string(window)
+	for _, sep := range []string{"\n", " "} {
+		if i := strings.LastIndex(s, sep); i >= 0 {
+			if cut := len([]rune(s[:i])); cut > len(window)/2 {
+				return cut
+			}
+		}
+	}
+	return len(window)
+}
+
+// openFence reports whether chunk ends inside a code block, and returns the
+// line that opened it.
+func openFence(chunk string) (string, bool) {
+	var open string
+	inside := false
+	for _, line := range strings.Split(chunk, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, fence) {
+			continue
+		}
+		if inside {
+			inside = false
+			continue
+		}
+		inside = true
+		open = trimmed
+	}
+	return open, inside
+}
@@ -0,0 +1,118 @@
+package discord
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessage(t *testing.T) {
+	longFence := fence + strings.Repeat("x", 2100) + "\n" + strings.Repeat("some text ", 300)
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		// want, when set, is the exact split expected.
+		want []string
+		// check, when set, inspects the chunks further.
+		check func(t *testing.T, chunks []string)
+	}{
+		{
+			name: "short text", text: "hello", limit: 20,
+			want: []string{"hello"},
+		},
+		{
+			name: "exactly the limit", text: strings.Repeat("a", 20), limit: 20,
+			want: []string{strings.Repeat("a", 20)},
+		},
+		{
+			name: "one over the limit", text: strings.Repeat("a", 21), limit: 20,
+			want: []string{strings.Repeat("a", 16), "aaaaa"},
+		},
+		{
+			name: "breaks at a space", text: "aaaa bbbb cccc dddd eeee ffff", limit: 20,
+			want: []string{"aaaa bbbb cccc", "dddd eeee ffff"},
+		},
+		{
+			name: "prefers a newline to a space", text: "aaaaaaaaaa\nbbb ccccccccccc", limit: 20,
+			want: []string{"aaaaaaaaaa", "bbb ccccccccccc"},
+		},
+		{
+			name: "ignores breaks in the first half", text: "a bbbbbbbbbbbbbbbbbbbbbbb", limit: 20,
+			want: []string{"a bbbbbbbbbbbbbb", "bbbbbbbbb"},
+		},
+		{
+			name: "hard cut without a break", text: "abcdefghijklmnopqrstuvwxyz", limit: 20,
+			want: []string{"abcdefghijklmnop", "qrstuvwxyz"},
+		},
+		{
+			name: "no empty chunks", text: strings.Repeat(" ", 50) + "x", limit: 20,
+			want: []string{"x"},
+		},
+		{
+			name: "code block carried over with its language",
+			text: "```go\nfmt.Println(1)\nfmt.Println(2)\n```", limit: 30,
+			want: []string{"```go\nfmt.Println(1)\n```", "```go\nfmt.Println(2)\n```"},
+		},
+		{
+			name: "closed code block is not reopened",
+			text: "```\ncode\n```\nand then some prose to push it over", limit: 30,
+			want: []string{"```\ncode\n```\nand then", "some prose to push it over"},
+		},
+		{
+			name: "fence line longer than the limit", text: longFence, limit: maxMessageLength,
+			check: func(t *testing.T, chunks []string) {
+				if len(chunks) < 2 {
+					t.Fatalf("got %d chunks", len(chunks))
+				}
+				if !strings.HasSuffix(chunks[0], "\n"+fence) {
+					t.Errorf("first chunk does not close its code block: ...%q", chunks[0][len(chunks[0])-10:])
+				}
+				if !strings.HasPrefix(chunks[1], fence+"\n") {
+					t.Errorf("second chunk does not reopen the code block: %q...", chunks[1][:10])
+				}
+			},
+		},
+		{
+			name: "multi-byte runes at the limit", text: strings.Repeat("é", 20), limit: 20,
+			want: []string{strings.Repeat("é", 20)},
+		},
+		{
+			name: "multi-byte runes over the limit", text: strings.Repeat("é", 21), limit: 20,
+			want: []string{strings.Repeat("é", 16), strings.Repeat("é", 5)},
+		},
+		{
+			name: "multi-byte runes are never cut", text: strings.Repeat("日本語のテキスト ", 400), limit: maxMessageLength,
+			check: func(t *testing.T, chunks []string) {
+				for i, c := range chunks {
+					if !utf8.ValidString(c) {
+						t.Errorf("chunk %d is not valid UTF-8", i)
+					}
+				}
+				if got := strings.Join(chunks, " "); got != strings.Repeat("日本語のテキスト ", 400) {
+					t.Error("chunks do not add up to the text")
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := splitMessage(tt.text, tt.limit)
+			for i, c := range chunks {
+				if n := utf8.RuneCountInString(c); n > tt.limit {
+					t.Errorf("chunk %d has %d characters, over the limit of %d", i, n, tt.limit)
+				}
+				if c == "" {
+					t.Errorf("chunk %d is empty", i)
+				}
+			}
+			if tt.want != nil && !slices.Equal(chunks, tt.want) {
+				t.Errorf("splitMessage = %q, want %q", chunks, tt.want)
+			}
+			if tt.check != nil {
+				tt.check(t, chunks)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package discord
+
+import "encoding/json"
+
+// Gateway opcodes.
+const (
+	opDispatch       = 0
+	opHeartbeat      = 1
+	opIdentify       = 2
+	opResume         = 6
+	opReconnect      = 7
+	opInvalidSession = 9
+	opHello          = 10
+	opHeartbeatAck   = 11
+)
+
+// Gateway intents the bot identifies with. Message content is a privileged
+// intent and must be enabled for the application in the developer portal.
+const (
+	intentGuilds         = 1 << 0
+	intentGuildMessages  = 1 << 9
+	intentDirectMessages = 1 << 12
+	intentMessageContent = 1 << 15
+
+	intents = intentGuilds | intentGuildMessages | intentDirectMessages | intentMessageContent
+)
+
+// Channel types.
+const (
+	channelDM                 = 1
+	channelGroupDM            = 3
+	channelAnnouncementThread = 10
+	channelPublicThread       = 11
+	channelPrivateThread      = 12
+)
+
+// Component and interaction types.
+const (
+	componentActionRow = 1
+	componentButton    = 2
+	buttonPrimary      = 1
+
+	interactionMessageComponent = 3
+	// callbackDeferredUpdate acknowledges a button press without changing
+	// the message.
+	callbackDeferredUpdate = 6
+)
+
+// errThreadExists is the API error code for starting a thread on a
+// message that already has one.
+const errThreadExists = 160004
+
+type gatewayPayload struct {
+	Op int             `json:"op"`
+	D  json.RawMessage `json:"d"`
+	S  *int64          `json:"s,omitempty"`
+	T  string          `json:"t,omitempty"`
+}
+
+type outgoingPayload struct {
+	Op int `json:"op"`
+	D  any `json:"d"`
+}
+
+type hello struct {
+	HeartbeatInterval int64 `json:"heartbeat_interval"`
+}
+
+type identify struct {
+	Token      string             `json:"token"`
+	Intents    int                `json:"intents"`
+	Properties identifyProperties `json:"properties"`
+}
+
+type identifyProperties struct {
+	OS      string `json:"os"`
+	Browser string `json:"browser"`
+	Device  string `json:"device"`
+}
+
+type resume struct {
+	Token     string `json:"token"`
+	SessionID string `json:"session_id"`
+	Seq       int64  `json:"seq"`
+}
+
+type ready struct {
+	User             user   `json:"user"`
+	SessionID        string `json:"session_id"`
+	ResumeGatewayURL string `json:"resume_gateway_url"`
+}
+
+type user struct {
+	ID         string `json:"id"`
+	Username   string `json:"username"`
+	GlobalName string `json:"global_name,omitempty"`
+	Bot        bool   `json:"bot,omitempty"`
+}
+
+func (u user) name() string {
+	if u.GlobalName != "" {
+		return u.GlobalName
+	}
+	return u.Username
+}
+
+type channel struct {
+	ID       string `json:"id"`
+	Type     int    `json:"type"`
+	GuildID  string `json:"guild_id,omitempty"`
+	ParentID string `json:"parent_id,omitempty"`
+}
+
+type guildCreate struct {
+	ID       string    `json:"id"`
+	Channels []channel `json:"channels"`
+	Threads  []channel `json:"threads"`
+}
+
+type message struct {
+	ID          string       `json:"id"`
+	ChannelID   string       `json:"channel_id"`
+	GuildID     string       `json:"guild_id,omitempty"`
+	Author      *user        `json:"author,omitempty"`
+	Content     *string      `json:"content,omitempty"`
+	Mentions    []user       `json:"mentions,omitempty"`
+	Attachments []attachment `json:"attachments,omitempty"`
+}
+
+type attachment struct {
+	Filename    string `json:"filename"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size"`
+}
+
+type messageDelete struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"`
+}
+
+type interaction struct {
+	ID        string   `json:"id"`
+	Type      int      `json:"type"`
+	Token     string   `json:"token"`
+	ChannelID string   `json:"channel_id"`
+	Member    *member  `json:"member,omitempty"`
+	User      *user    `json:"user,omitempty"`
+	Message   *message `json:"message,omitempty"`
+	Data      struct {
+		CustomID string `json:"custom_id"`
+	} `json:"data"`
+}
+
+type member struct {
+	User user `json:"user"`
+}
+
+// messageBody is the JSON body of a create or edit message request.
+type messageBody struct {
+	Content         string           `json:"content"`
+	Components      []component      `json:"components"`
+	AllowedMentions *allowedMentions `json:"allowed_mentions,omitempty"`
+}
+
+type allowedMentions struct {
+	Parse []string `json:"parse"`
+}
+
+type component struct {
+	Type       int         `json:"type"`
+	Style      int         `json:"style,omitempty"`
+	Label      string      `json:"label,omitempty"`
+	CustomID   string      `json:"custom_id,omitempty"`
+	Components []component `json:"components,omitempty"`
+}
@@ -0,0 +1,119 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Dependency names reported on /readyz.
+const (
+	SlackAuth           = "slack_auth"
+	SlackSocket         = "slack_socket"
+	DiscordGateway      = "discord_gateway"
+	MattermostWebSocket = "mattermost_websocket"
+	TeamsJWKS           = "teams_jwks"
+	Backend             = "backend"
+)
+
+type DependencyStatus struct {
+	Ready       bool      `json:"ready"`
+	Detail      string    `json:"detail"`
+	LastChanged time.Time `json:"last_changed"`
+}
+
+type ReadinessReport struct {
+	Status       string                      `json:"status"`
+	Dependencies map[string]DependencyStatus `json:"dependencies"`
+}
+
+// Registry tracks the readiness of each dependency the bot needs to serve
+// mentions. The bot is ready only when every registered dependency is.
+type Registry struct {
+	mu   sync.RWMutex
+	deps map[string]DependencyStatus
+}
+
+func NewRegistry() *Registry {
+	return &Registry{deps: make(map[string]DependencyStatus)}
+}
+
+var defaultRegistry = NewRegistry()
+
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// Register adds a dependency in the not-ready state. Registering an existing
+// dependency keeps its current state.
+func (r *Registry) Register(name, detail string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.deps[name]; exists {
+		return
+	}
+	r.deps[name] = DependencyStatus{Ready: false, Detail: detail, LastChanged: time.Now()}
+}
+
+// Set records the dependency's state. LastChanged only moves when readiness
+// flips, so it reports how long the dependency has been up or down.
+func (r *Registry) Set(name string, ready bool, detail string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current, exists := r.deps[name]
+	if exists && current.Ready == ready {
+		current.Detail = detail
+		r.deps[name] = current
+		return
+	}
+	r.deps[name] = DependencyStatus{Ready: ready, Detail: detail, LastChanged: time.Now()}
+}
+
+func (r *Registry) Report() ReadinessReport {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	report := ReadinessReport{Status: "ready", Dependencies: make(map[string]DependencyStatus, len(r.deps))}
+	for name, status := range r.deps {
+		report.Dependencies[name] = status
+		if !status.Ready {
+			report.Status = "not_ready"
+		}
+	}
+	return report
+}
+
+func Register(name, detail string) {
+	defaultRegistry.Register(name, detail)
+}
+
+func Set(name string, ready bool, detail string) {
+	defaultRegistry.Set(name, ready, detail)
+}
+
+// LivenessHandler reports that the process is up and serving HTTP.
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "alive"})
+	})
+}
+
+// ReadinessHandler returns 200 when every dependency in the registry is
+// ready and 503 otherwise, with the per-dependency state in the body.
+func (r *Registry) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report := r.Report()
+		status := http.StatusOK
+		if report.Status != "ready" {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, report)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
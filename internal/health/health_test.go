@@ -0,0 +1,89 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	if got := r.Report().Status; got != "ready" {
+		t.Errorf("empty registry status = %q, want ready", got)
+	}
+
+	r.Register(SlackSocket, "not connected")
+	r.Register(Backend, "circuit closed")
+	r.Set(Backend, true, "circuit closed")
+	if got := r.Report().Status; got != "not_ready" {
+		t.Errorf("status with the socket down = %q, want not_ready", got)
+	}
+
+	r.Set(SlackSocket, true, "connected")
+	report := r.Report()
+	if report.Status != "ready" {
+		t.Errorf("status with everything up = %q, want ready", report.Status)
+	}
+	up := report.Dependencies[SlackSocket]
+	if !up.Ready || up.Detail != "connected" {
+		t.Errorf("socket = %+v, want ready and connected", up)
+	}
+
+	// Registering again, as a reconnecting adapter does, keeps the state.
+	r.Register(SlackSocket, "not connected")
+	if got := r.Report().Dependencies[SlackSocket]; got != up {
+		t.Errorf("socket after re-registering = %+v, want %+v", got, up)
+	}
+
+	// LastChanged only moves when readiness flips.
+	time.Sleep(time.Millisecond)
+	r.Set(SlackSocket, true, "still connected")
+	if got := r.Report().Dependencies[SlackSocket]; got.LastChanged != up.LastChanged || got.Detail != "still connected" {
+		t.Errorf("socket = %+v, want the new detail and the old LastChanged %s", got, up.LastChanged)
+	}
+	r.Set(SlackSocket, false, "disconnected")
+	if got := r.Report().Dependencies[SlackSocket]; !got.LastChanged.After(up.LastChanged) {
+		t.Errorf("LastChanged = %s after going down, want it after %s", got.LastChanged, up.LastChanged)
+	}
+}
+
+func TestReadinessHandler(t *testing.T) {
+	r := NewRegistry()
+	r.Register(SlackSocket, "not connected")
+
+	for _, tt := range []struct {
+		ready      bool
+		wantStatus int
+		wantBody   string
+	}{
+		{ready: false, wantStatus: http.StatusServiceUnavailable, wantBody: "not_ready"},
+		{ready: true, wantStatus: http.StatusOK, wantBody: "ready"},
+	} {
+		r.Set(SlackSocket, tt.ready, "")
+		w := httptest.NewRecorder()
+		r.ReadinessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if w.Code != tt.wantStatus {
+			t.Errorf("ready=%v: status = %d, want %d", tt.ready, w.Code, tt.wantStatus)
+		}
+		if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+			t.Errorf("Cache-Control = %q, want no-store", cc)
+		}
+		var report ReadinessReport
+		if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		if report.Status != tt.wantBody || report.Dependencies[SlackSocket].Ready != tt.ready {
+			t.Errorf("ready=%v: report = %+v", tt.ready, report)
+		}
+	}
+}
+
+func TestLivenessHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	LivenessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "{\"status\":\"alive\"}\n" {
+		t.Errorf("liveness = %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,61 @@
+package mattermost
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"chatrelay-bot/internal/adapter"
+)
+
+// ActionsPath is where ServeHTTP is mounted on the bot's HTTP server.
+const ActionsPath = "/mattermost/actions"
+
+// ServeHTTP receives button presses from the Mattermost server. The press
+// is acknowledged straight away and handled in the background, as a retry
+// can take as long as an answer.
+func (c *Client) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req actionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	want := c.actionToken(req.ChannelID, req.Context.Action, req.Context.Value)
+	if !hmac.Equal([]byte(req.Context.Token), []byte(want)) {
+		slog.WarnContext(r.Context(), "Rejected Mattermost action with an invalid token", "user", req.UserID, "channel", req.ChannelID)
+		http.Error(w, "Invalid action token", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{}"))
+
+	if req.Context.Action == adapter.RetryAction && c.retries != nil {
+		go c.handleRetry(context.WithoutCancel(r.Context()), req)
+	}
+}
+
+func (c *Client) handleRetry(ctx context.Context, req actionRequest) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "HandleRetryAction",
+		trace.WithAttributes(
+			attribute.String("mattermost.channel_id", req.ChannelID),
+			attribute.String("mattermost.user_id", req.UserID),
+		),
+	)
+	defer span.End()
+	if err := c.retries.HandleRetry(ctx, req.ChannelID, req.PostID, req.UserID, req.Context.Value); err != nil {
+		slog.ErrorContext(ctx, "Error handling retry action", "error", err, "user", req.UserID, "channel", req.ChannelID)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Error handling retry action")
+	}
+}
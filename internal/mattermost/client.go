@@ -0,0 +1,328 @@
+// Package mattermost is the Mattermost adapter. It receives posts over the
+// Mattermost WebSocket and replies through the REST API v4: posts that
+// mention the bot and every direct message are passed to the bot, answers
+// go into the post's thread via root_id, and they are patched in place as
+// they stream.
+package mattermost
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"chatrelay-bot/internal/adapter"
+	"chatrelay-bot/internal/health"
+	"chatrelay-bot/internal/redact"
+	"chatrelay-bot/pkg/models"
+)
+
+const (
+	tracerName   = "chatrelay/internal/mattermost"
+	platformName = "mattermost"
+	// maxRecent bounds how many incoming posts are remembered for edits.
+	maxRecent = 1024
+)
+
+// defaultSettings are used for posts when no SettingsResolver is set.
+var defaultSettings = models.ChannelSettings{
+	Enabled:     true,
+	Placeholder: "Thinking...",
+	Footer:      "_Powered by ChatRelay_",
+	Streaming:   true,
+}
+
+type Client struct {
+	rest      *rest
+	serverURL string
+	// actionKey signs button contexts. It is the bot token the client
+	// started with, kept when the token rotates so that buttons already
+	// posted stay valid.
+	actionKey  string
+	actionsURL string
+	handler    adapter.Handler
+	resolver   adapter.SettingsResolver
+	retries    adapter.RetryHandler
+	changes    adapter.ChangeHandler
+
+	mu       sync.Mutex
+	bot      user
+	mention  *regexp.Regexp
+	channels map[string]channel
+	names    map[string]string // user ID -> username
+	recent   map[string]string // post ID -> text addressed to the bot
+}
+
+var _ adapter.Adapter = (*Client)(nil)
+
+// NewClient creates a Mattermost client for the server at serverURL that
+// passes posts addressed to the bot to handler. actionsURL is where the
+// Mattermost server can reach the client's ServeHTTP for button presses;
+// without it, replies have no buttons.
+func NewClient(serverURL, token string, handler adapter.Handler, actionsURL string) *Client {
+	health.Register(health.MattermostWebSocket, "not connected")
+	return &Client{
+		rest:       newREST(serverURL, token),
+		serverURL:  strings.TrimSuffix(serverURL, "/"),
+		actionKey:  token,
+		actionsURL: actionsURL,
+		handler:    handler,
+		channels:   make(map[string]channel),
+		names:      make(map[string]string),
+		recent:     make(map[string]string),
+	}
+}
+
+// ApplyConfig switches REST calls, and the next WebSocket connection, to a
+// rotated bot token.
+func (c *Client) ApplyConfig(cfg *models.AppConfig) {
+	if token := cfg.MattermostBotToken; token != "" && token != *c.rest.token.Load() {
+		c.rest.token.Store(&token)
+		slog.Info("Mattermost bot token rotated", "bot_token", redact.Secret(token))
+	}
+}
+
+func (c *Client) SetSettingsResolver(r adapter.SettingsResolver) {
+	c.resolver = r
+}
+
+func (c *Client) SetRetryHandler(h adapter.RetryHandler) {
+	c.retries = h
+}
+
+func (c *Client) SetMentionChangeHandler(h adapter.ChangeHandler) {
+	c.changes = h
+}
+
+func (c *Client) Name() string {
+	return platformName
+}
+
+// authenticate looks up the bot's own user, which is how mentions of it
+// are recognized.
+func (c *Client) authenticate(ctx context.Context) error {
+	var me user
+	if err := c.rest.do(ctx, "GET", "/users/me", nil, &me); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.bot = me
+	c.mention = regexp.MustCompile(`(?i)(^|\s)@` + regexp.QuoteMeta(me.Username) + `\b`)
+	c.mu.Unlock()
+	slog.InfoContext(ctx, "Authenticated with Mattermost", "user", me.Username, "user_id", me.ID)
+	return nil
+}
+
+// dispatch handles one WebSocket event.
+func (c *Client) dispatch(ctx context.Context, ev event) {
+	switch ev.Event {
+	case "posted":
+		var d postedData
+		var p post
+		if err := json.Unmarshal(ev.Data, &d); err != nil || json.Unmarshal([]byte(d.Post), &p) != nil {
+			slog.ErrorContext(ctx, "Failed to decode posted event", "error", err)
+			return
+		}
+		c.mu.Lock()
+		c.channels[p.ChannelID] = channel{ID: p.ChannelID, TeamID: d.TeamID, Type: d.ChannelType}
+		if name := strings.TrimPrefix(d.SenderName, "@"); name != "" {
+			c.names[p.UserID] = name
+		}
+		c.mu.Unlock()
+
+		var mentions []string
+		json.Unmarshal([]byte(d.Mentions), &mentions)
+		text, ok := c.addressed(p, d.ChannelType, mentions)
+		if !ok {
+			return
+		}
+		c.remember(p.ID, text)
+		// Posts are answered concurrently, and outlive the WebSocket
+		// connection so that a shutdown can drain them.
+		go c.handlePost(context.WithoutCancel(ctx), p, text, mentions)
+	case "post_edited":
+		var d postData
+		var p post
+		if err := json.Unmarshal(ev.Data, &d); err == nil && json.Unmarshal([]byte(d.Post), &p) == nil {
+			c.handlePostEdited(ctx, p)
+		}
+	case "post_deleted":
+		var d postData
+		var p post
+		if err := json.Unmarshal(ev.Data, &d); err == nil && json.Unmarshal([]byte(d.Post), &p) == nil {
+			c.handlePostDeleted(ctx, p)
+		}
+	}
+}
+
+func (c *Client) handlePost(ctx context.Context, p post, text string, mentions []string) {
+	msg, err := c.incoming(ctx, p, text, mentions)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to look up Mattermost channel", "error", err, "channel", p.ChannelID)
+		return
+	}
+
+	tracer := otel.Tracer(tracerName)
+	slog.InfoContext(ctx, "Received Mattermost post", "text", text, "user", msg.Author.ID, "channel", msg.Conversation)
+	ctx, span := tracer.Start(ctx, "HandleMattermostPost",
+		trace.WithAttributes(
+			attribute.String("mattermost.channel_id", msg.Conversation),
+			attribute.String("mattermost.user_id", msg.Author.ID),
+			attribute.String("mattermost.root_id", msg.Thread),
+		),
+	)
+	defer span.End()
+
+	settings := defaultSettings
+	if c.resolver != nil {
+		settings = c.resolver.Resolve(msg.Workspace, msg.Conversation)
+	}
+	if err := c.handler.HandleMessage(ctx, msg, settings); err != nil {
+		slog.ErrorContext(ctx, "Error handling Mattermost post", "error", err, "user", msg.Author.ID, "channel", msg.Conversation)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Error handling post")
+		c.Post(ctx, models.OutgoingMessage{Conversation: msg.Conversation, Thread: msg.Thread, Text: fmt.Sprintf("Oops! Something went wrong: %v", err)})
+		return
+	}
+	span.SetStatus(codes.Ok, "Post handled successfully")
+}
+
+// handlePostEdited passes edits of posts addressed to the bot to the
+// ChangeHandler. Edits that leave the text unchanged are ignored; an edit
+// that removes the mention is treated like a deletion.
+func (c *Client) handlePostEdited(ctx context.Context, p post) {
+	if c.changes == nil {
+		return
+	}
+	c.mu.Lock()
+	previous, ok := c.recent[p.ID]
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	ch, err := c.channel(ctx, p.ChannelID)
+	if err != nil {
+		return
+	}
+	text, addressed := c.addressed(p, ch.Type, nil)
+	if !addressed {
+		c.forget(p.ID)
+		c.changes.HandleMessageDeleted(ctx, p.ChannelID, p.ID)
+		return
+	}
+	if text == previous {
+		return
+	}
+	msg, err := c.incoming(ctx, p, text, nil)
+	if err != nil {
+		return
+	}
+	c.remember(p.ID, text)
+	c.changes.HandleMessageEdited(ctx, msg)
+}
+
+func (c *Client) handlePostDeleted(ctx context.Context, p post) {
+	c.mu.Lock()
+	_, ok := c.recent[p.ID]
+	c.mu.Unlock()
+	if !ok || c.changes == nil {
+		return
+	}
+	c.forget(p.ID)
+	c.changes.HandleMessageDeleted(ctx, p.ChannelID, p.ID)
+}
+
+// addressed reports whether p is for the bot, and returns its text without
+// the mention. Every direct message is for the bot; elsewhere the bot must
+// be mentioned, either in mentions or by @username in the text. The bot's
+// own posts and system messages are ignored.
+func (c *Client) addressed(p post, channelType string, mentions []string) (string, bool) {
+	c.mu.Lock()
+	bot, mention := c.bot, c.mention
+	c.mu.Unlock()
+	if mention == nil || p.UserID == bot.ID || p.Type != "" {
+		return "", false
+	}
+	if channelType != channelDirect && !slices.Contains(mentions, bot.ID) && !mention.MatchString(p.Message) {
+		return "", false
+	}
+	return strings.TrimSpace(mention.ReplaceAllString(p.Message, "$1")), true
+}
+
+// incoming converts p to an IncomingMessage. A post in a thread keeps the
+// thread's root, so that the reply goes to the same thread. mentions are the
+// IDs of the users the post mentions; Mattermost only sends them for new
+// posts.
+func (c *Client) incoming(ctx context.Context, p post, text string, mentions []string) (models.IncomingMessage, error) {
+	ch, err := c.channel(ctx, p.ChannelID)
+	if err != nil {
+		return models.IncomingMessage{}, err
+	}
+	c.mu.Lock()
+	msg := models.IncomingMessage{
+		Platform:     platformName,
+		ID:           p.ID,
+		Workspace:    ch.TeamID,
+		Conversation: p.ChannelID,
+		Thread:       p.RootID,
+		Author:       models.Author{ID: p.UserID, Name: c.names[p.UserID]},
+		Text:         text,
+	}
+	for _, id := range mentions {
+		if id != c.bot.ID {
+			msg.Mentions = append(msg.Mentions, models.Author{ID: id, Name: c.names[id]})
+		}
+	}
+	c.mu.Unlock()
+	for _, f := range p.Metadata.Files {
+		msg.Attachments = append(msg.Attachments, models.Attachment{
+			Name:     f.Name,
+			URL:      c.serverURL + "/api/v4/files/" + f.ID,
+			MIMEType: f.MIMEType,
+			Size:     f.Size,
+		})
+	}
+	return msg, nil
+}
+
+// channel returns what is known about a channel, asking Mattermost if it
+// has not been seen on the WebSocket.
+func (c *Client) channel(ctx context.Context, id string) (channel, error) {
+	c.mu.Lock()
+	ch, ok := c.channels[id]
+	c.mu.Unlock()
+	if ok {
+		return ch, nil
+	}
+	if err := c.rest.do(ctx, "GET", "/channels/"+id, nil, &ch); err != nil {
+		return ch, err
+	}
+	c.mu.Lock()
+	c.channels[id] = ch
+	c.mu.Unlock()
+	return ch, nil
+}
+
+func (c *Client) remember(id, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.recent) >= maxRecent {
+		clear(c.recent)
+	}
+	c.recent[id] = text
+}
+
+func (c *Client) forget(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.recent, id)
+}
@@ -0,0 +1,264 @@
+package mattermost_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"chatrelay-bot/internal/adapter"
+	"chatrelay-bot/internal/mattermost"
+	"chatrelay-bot/internal/mattermost/fakemattermost"
+	"chatrelay-bot/pkg/models"
+)
+
+// recorder is the bot side of the test: it passes every post, edit,
+// deletion and retry the Mattermost client delivers to events.
+type recorder struct {
+	events chan string
+	msgs   chan models.IncomingMessage
+}
+
+func (r *recorder) HandleMessage(ctx context.Context, msg models.IncomingMessage, settings models.ChannelSettings) error {
+	r.msgs <- msg
+	r.events <- "post " + msg.ID + " " + msg.Text
+	if msg.Text == "fail" {
+		return errors.New("backend unavailable")
+	}
+	return nil
+}
+
+func (r *recorder) HandleMessageEdited(ctx context.Context, msg models.IncomingMessage) {
+	r.events <- "edit " + msg.ID + " " + msg.Text
+}
+
+func (r *recorder) HandleMessageDeleted(ctx context.Context, conversation, id string) {
+	r.events <- "delete " + id
+}
+
+func (r *recorder) HandleRetry(ctx context.Context, conversation, messageID, userID, value string) error {
+	r.events <- "retry " + messageID + " " + userID + " " + value
+	return nil
+}
+
+func (r *recorder) next(t *testing.T) string {
+	t.Helper()
+	select {
+	case e := <-r.events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("the Mattermost client delivered nothing")
+		return ""
+	}
+}
+
+// none checks that nothing more is delivered.
+func (r *recorder) none(t *testing.T) {
+	t.Helper()
+	select {
+	case e := <-r.events:
+		t.Errorf("unexpected delivery %q", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// connect runs the client against a started fake, with its button handler
+// served as Mattermost would reach it, until the test ends.
+func connect(t *testing.T) (*fakemattermost.Server, *mattermost.Client, *recorder) {
+	t.Helper()
+	fake := fakemattermost.NewServer()
+	fake.Start()
+	t.Cleanup(fake.Close)
+
+	rec := &recorder{events: make(chan string, 10), msgs: make(chan models.IncomingMessage, 10)}
+	var client *mattermost.Client
+	actions := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client.ServeHTTP(w, r)
+	}))
+	t.Cleanup(actions.Close)
+	client = mattermost.NewClient(fake.URL(), "bot-token", rec, actions.URL+mattermost.ActionsPath)
+	client.SetMentionChangeHandler(rec)
+	client.SetRetryHandler(rec)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	waitCtx, stop := context.WithTimeout(ctx, 5*time.Second)
+	defer stop()
+	if err := fake.WaitForConnection(waitCtx); err != nil {
+		t.Fatal(err)
+	}
+	return fake, client, rec
+}
+
+func TestPostsAddressedToTheBot(t *testing.T) {
+	fake, _, rec := connect(t)
+
+	id := fake.Mention(fakemattermost.Channel, fakemattermost.User, "what is up?")
+	if got, want := rec.next(t), "post "+id+" what is up?"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	msg := <-rec.msgs
+	if msg.Platform != "mattermost" || msg.Workspace != fakemattermost.TeamID || msg.Conversation != fakemattermost.Channel || msg.Author.ID != fakemattermost.User || msg.Author.Name == "" {
+		t.Errorf("message = %+v", msg)
+	}
+
+	reply := fake.MentionInThread(fakemattermost.Channel, fakemattermost.User, id, "and then?")
+	rec.next(t)
+	if msg := <-rec.msgs; msg.ID != reply || msg.Thread != id {
+		t.Errorf("reply = %+v, want it in thread %s", msg, id)
+	}
+
+	dm := fake.DirectMessage(fakemattermost.User, "no mention needed")
+	if got, want := rec.next(t), "post "+dm+" no mention needed"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	<-rec.msgs
+
+	// Edits of direct messages need no mention either.
+	if err := fake.EditPost(dm, "still no mention"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rec.next(t), "edit "+dm+" still no mention"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestEditsAndDeletes(t *testing.T) {
+	fake, _, rec := connect(t)
+
+	id := fake.Mention(fakemattermost.Channel, fakemattermost.User, "what is up?")
+	rec.next(t)
+	<-rec.msgs
+
+	if err := fake.EditPost(id, "what is down?"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rec.next(t), "edit "+id+" what is down?"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// An edit that keeps the text, or removes the mention, is not an edit
+	// of the question.
+	fake.EditPost(id, "what is down?")
+	rec.none(t)
+	fake.EditPost(id, "@someone else entirely")
+	if got, want := rec.next(t), "delete "+id; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	fake.DeletePost(id)
+	rec.none(t)
+
+	other := fake.Mention(fakemattermost.Channel, fakemattermost.User, "another")
+	rec.next(t)
+	<-rec.msgs
+	fake.DeletePost(other)
+	if got, want := rec.next(t), "delete "+other; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestReplies(t *testing.T) {
+	fake, client, rec := connect(t)
+	ctx := context.Background()
+
+	root := fake.Mention(fakemattermost.Channel, fakemattermost.User, "hello")
+	rec.next(t)
+	<-rec.msgs
+
+	retry := []models.Action{{ID: adapter.RetryAction, Label: "Retry", Value: "key-1"}}
+	id, err := client.Post(ctx, models.OutgoingMessage{Conversation: fakemattermost.Channel, Thread: root, Text: "Interrupted", Actions: retry})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Update(ctx, id, models.OutgoingMessage{Conversation: fakemattermost.Channel, Text: strings.Repeat("x", 20000)}); err != nil {
+		t.Fatalf("Update with an over-long answer = %v, want it cut short", err)
+	}
+	p, ok := fake.Post(id)
+	if !ok || p.RootID != root || len(p.Revisions) != 2 || len([]rune(p.Text())) != 16383 || !strings.HasSuffix(p.Text(), "…") {
+		t.Errorf("post = %+v, want a reply in thread %s cut to 16383 characters", p.ID, root)
+	}
+
+	if err := client.Notify(ctx, fakemattermost.Channel, fakemattermost.User, "Slow down"); err != nil {
+		t.Fatal(err)
+	}
+	if e := fake.Ephemerals(); len(e) != 1 || e[0].UserID != fakemattermost.User || e[0].Message != "Slow down" {
+		t.Errorf("ephemerals = %+v", e)
+	}
+	if err := client.Delete(ctx, fakemattermost.Channel, id); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := fake.Post(id); !p.Deleted {
+		t.Error("post not deleted")
+	}
+}
+
+func TestHandlerErrorIsReported(t *testing.T) {
+	fake, _, rec := connect(t)
+	fake.Mention(fakemattermost.Channel, fakemattermost.User, "fail")
+	rec.next(t)
+	<-rec.msgs
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, p := range fake.Posts() {
+			if p.ChannelID == fakemattermost.Channel && p.Text() == "Oops! Something went wrong: backend unavailable" {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("error was not posted in the channel: %+v", fake.Posts())
+}
+
+func TestRetryButton(t *testing.T) {
+	fake, client, rec := connect(t)
+	ctx := context.Background()
+
+	retry := []models.Action{{ID: adapter.RetryAction, Label: "Retry", Value: "key-1"}}
+	id, err := client.Post(ctx, models.OutgoingMessage{Conversation: fakemattermost.Channel, Text: "Interrupted", Actions: retry})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.PressButton(id, fakemattermost.User); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rec.next(t), "retry "+id+" "+fakemattermost.User+" key-1"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// A press whose context was not signed by the bot is refused.
+	body := `{"user_id":"u","channel_id":"` + fakemattermost.Channel + `","post_id":"` + id + `","context":{"action":"` + adapter.RetryAction + `","value":"key-2","token":"forged"}}`
+	w := httptest.NewRecorder()
+	client.ServeHTTP(w, httptest.NewRequest(http.MethodPost, mattermost.ActionsPath, strings.NewReader(body)))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("forged press = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	rec.none(t)
+}
+
+func TestRunStopsOnInvalidToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"id":"api.context.session_expired.app_error","message":"Invalid or expired session","status_code":401}`))
+	}))
+	defer server.Close()
+
+	client := mattermost.NewClient(server.URL, "bad-token", &recorder{}, "")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Run(ctx); err == nil || ctx.Err() != nil || !strings.Contains(err.Error(), "invalid token") {
+		t.Errorf("Run = %v, want it to give up on an invalid token", err)
+	}
+}
@@ -0,0 +1,416 @@
+// Package fakemattermost is a local stand-in for a Mattermost server, good
+// enough to run the real bot end to end without one. It serves the REST API
+// v4 routes the bot calls and a WebSocket that pushes scripted posts, edits
+// and deletions, and presses buttons by posting to their integration URL
+// the way Mattermost does.
+package fakemattermost
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TeamID      = "team0000000000000000000001"
+	BotUser     = "botuser0000000000000000001"
+	BotUsername = "chatrelay"
+	// Channel and User are used by the cmd/fakemattermost script when a
+	// step leaves them out.
+	Channel = "channel0000000000000000001"
+	User    = "user000000000000000000001a"
+
+	// maxMessage is Mattermost's default post length limit.
+	maxMessage = 16383
+)
+
+// Post is a post the bot made, with every text it has had in order.
+// Revisions[0] is the text it was posted with.
+type Post struct {
+	ID        string
+	ChannelID string
+	RootID    string
+	Revisions []string
+	Buttons   []Button
+	Deleted   bool
+}
+
+// Text is the current text of the post.
+func (p Post) Text() string {
+	return p.Revisions[len(p.Revisions)-1]
+}
+
+// Button is an interactive message button on a bot post.
+type Button struct {
+	Name    string
+	URL     string
+	Context map[string]any
+}
+
+// Ephemeral is an ephemeral post the bot sent to one user.
+type Ephemeral struct {
+	UserID    string
+	ChannelID string
+	Message   string
+}
+
+type channel struct {
+	ID     string `json:"id"`
+	TeamID string `json:"team_id"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+}
+
+// userPost is a post by a fake user, kept so edits and deletions can refer
+// to it.
+type userPost struct {
+	ChannelID string `json:"channel_id"`
+	UserID    string `json:"user_id"`
+	RootID    string `json:"root_id"`
+	Message   string `json:"message"`
+}
+
+// Server is a fake Mattermost server. Create it with NewServer and either
+// mount it as an http.Handler or call Start.
+type Server struct {
+	mux *http.ServeMux
+
+	mu         sync.Mutex
+	seq        int64
+	posts      []*Post
+	userPosts  map[string]userPost
+	channels   map[string]*channel
+	dms        map[string]string
+	ephemerals []Ephemeral
+	usernames  map[string]string
+
+	socket
+
+	httpServer *httptest.Server
+}
+
+func NewServer() *Server {
+	s := &Server{
+		mux:       http.NewServeMux(),
+		userPosts: make(map[string]userPost),
+		channels:  make(map[string]*channel),
+		dms:       make(map[string]string),
+		usernames: map[string]string{BotUser: BotUsername},
+	}
+	s.socket.init()
+	s.channels[Channel] = &channel{ID: Channel, TeamID: TeamID, Type: "O", Name: "town-square"}
+
+	s.mux.HandleFunc("GET /api/v4/users/me", s.me)
+	s.mux.HandleFunc("GET /api/v4/channels/{channel}", s.getChannel)
+	s.mux.HandleFunc("POST /api/v4/posts", s.createPost)
+	s.mux.HandleFunc("PUT /api/v4/posts/{post}/patch", s.patchPost)
+	s.mux.HandleFunc("DELETE /api/v4/posts/{post}", s.deletePost)
+	s.mux.HandleFunc("POST /api/v4/posts/ephemeral", s.ephemeral)
+	s.mux.HandleFunc("GET /api/v4/websocket", s.serveSocket)
+	s.mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "api.context.404.app_error", "Sorry, we could not find the page.")
+	})
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/api/") && !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		writeError(w, http.StatusUnauthorized, "api.context.session_expired.app_error", "Invalid or expired session, please login again.")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// Start serves the fake on a random local port until Close.
+func (s *Server) Start() {
+	s.httpServer = httptest.NewServer(s)
+}
+
+func (s *Server) Close() {
+	s.Disconnect()
+	if s.httpServer != nil {
+		s.httpServer.Close()
+	}
+}
+
+// URL is the server URL to configure the bot with, e.g. MATTERMOST_URL.
+func (s *Server) URL() string {
+	return s.httpServer.URL
+}
+
+// Posts returns copies of every post the bot has made, in posting order.
+func (s *Server) Posts() []Post {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Post, len(s.posts))
+	for i, p := range s.posts {
+		out[i] = clone(p)
+	}
+	return out
+}
+
+// Post returns a copy of the bot's post with the given ID.
+func (s *Server) Post(id string) (Post, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.find(id)
+	if p == nil {
+		return Post{}, false
+	}
+	return clone(p), true
+}
+
+// Ephemerals returns the ephemeral posts the bot has sent.
+func (s *Server) Ephemerals() []Ephemeral {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.ephemerals)
+}
+
+func (s *Server) me(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"id": BotUser, "username": BotUsername, "is_bot": true})
+}
+
+func (s *Server) getChannel(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	ch, ok := s.channels[r.PathValue("channel")]
+	var c channel
+	if ok {
+		c = *ch
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "app.channel.get.existing.app_error", "Unable to find the existing channel.")
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+type postBody struct {
+	ChannelID string `json:"channel_id"`
+	RootID    string `json:"root_id"`
+	Message   string `json:"message"`
+	Props     struct {
+		Attachments []struct {
+			Actions []struct {
+				Name        string `json:"name"`
+				Integration struct {
+					URL     string         `json:"url"`
+					Context map[string]any `json:"context"`
+				} `json:"integration"`
+			} `json:"actions"`
+		} `json:"attachments"`
+	} `json:"props"`
+}
+
+func (b postBody) buttons() []Button {
+	var buttons []Button
+	for _, a := range b.Props.Attachments {
+		for _, act := range a.Actions {
+			buttons = append(buttons, Button{Name: act.Name, URL: act.Integration.URL, Context: act.Integration.Context})
+		}
+	}
+	return buttons
+}
+
+// decodePost reads and validates a create or patch post body.
+func decodePost(w http.ResponseWriter, r *http.Request) (postBody, bool) {
+	var body postBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "api.context.invalid_body_param.app_error", "Invalid or missing post in request body.")
+		return body, false
+	}
+	if n := len([]rune(body.Message)); n > maxMessage {
+		writeError(w, http.StatusBadRequest, "model.post.is_valid.message_length.app_error",
+			fmt.Sprintf("Message property length should be less than %d characters, got %d.", maxMessage, n))
+		return body, false
+	}
+	return body, true
+}
+
+func (s *Server) createPost(w http.ResponseWriter, r *http.Request) {
+	body, ok := decodePost(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	ch, known := s.channels[body.ChannelID]
+	if !known {
+		s.mu.Unlock()
+		writeError(w, http.StatusForbidden, "api.context.permissions.app_error", "You do not have the appropriate permissions.")
+		return
+	}
+	if body.RootID != "" && !s.isRoot(body.RootID) {
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "api.post.create_post.root_id.app_error", "Invalid RootId parameter.")
+		return
+	}
+	p := &Post{ID: s.nextID("post"), ChannelID: body.ChannelID, RootID: body.RootID, Revisions: []string{body.Message}, Buttons: body.buttons()}
+	s.posts = append(s.posts, p)
+	c := *ch
+	s.mu.Unlock()
+
+	payload := postPayload(p.ID, BotUser, body.ChannelID, body.RootID, body.Message)
+	s.broadcast(postedEvent(payload, c, BotUsername, nil))
+	writeJSON(w, http.StatusCreated, payload)
+}
+
+func (s *Server) patchPost(w http.ResponseWriter, r *http.Request) {
+	body, ok := decodePost(w, r)
+	if !ok {
+		return
+	}
+	id := r.PathValue("post")
+	s.mu.Lock()
+	p := s.find(id)
+	if p == nil || p.Deleted {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "app.post.get.app_error", "Unable to get the post.")
+		return
+	}
+	p.Revisions = append(p.Revisions, body.Message)
+	p.Buttons = body.buttons()
+	payload := postPayload(p.ID, BotUser, p.ChannelID, p.RootID, body.Message)
+	s.mu.Unlock()
+
+	s.broadcast(postEvent("post_edited", payload))
+	writeJSON(w, http.StatusOK, payload)
+}
+
+func (s *Server) deletePost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("post")
+	s.mu.Lock()
+	p := s.find(id)
+	if p == nil || p.Deleted {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "app.post.get.app_error", "Unable to get the post.")
+		return
+	}
+	p.Deleted = true
+	payload := postPayload(p.ID, BotUser, p.ChannelID, p.RootID, "")
+	s.mu.Unlock()
+
+	s.broadcast(postEvent("post_deleted", payload))
+	writeJSON(w, http.StatusOK, map[string]string{"status": "OK"})
+}
+
+func (s *Server) ephemeral(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		UserID string   `json:"user_id"`
+		Post   postBody `json:"post"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.UserID == "" || body.Post.ChannelID == "" {
+		writeError(w, http.StatusBadRequest, "api.context.invalid_body_param.app_error", "Invalid or missing post in request body.")
+		return
+	}
+	s.mu.Lock()
+	s.ephemerals = append(s.ephemerals, Ephemeral{UserID: body.UserID, ChannelID: body.Post.ChannelID, Message: body.Post.Message})
+	id := s.nextID("ephm")
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, postPayload(id, BotUser, body.Post.ChannelID, "", body.Post.Message))
+}
+
+// PressButton presses the first button of the bot's post id as userID,
+// posting to the button's integration URL as Mattermost does.
+func (s *Server) PressButton(id, userID string) error {
+	s.mu.Lock()
+	p := s.find(id)
+	if p == nil || p.Deleted || len(p.Buttons) == 0 {
+		s.mu.Unlock()
+		return fmt.Errorf("no post %s with a button to press", id)
+	}
+	b := p.Buttons[0]
+	ch := s.channels[p.ChannelID]
+	req := map[string]any{
+		"user_id":    userID,
+		"user_name":  s.usernames[userID],
+		"channel_id": p.ChannelID,
+		"team_id":    ch.TeamID,
+		"post_id":    p.ID,
+		"trigger_id": s.nextID("trig"),
+		"type":       "",
+		"context":    b.Context,
+	}
+	s.mu.Unlock()
+
+	data, _ := json.Marshal(req)
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(b.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to post action to %s: %w", b.URL, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("action integration answered %s", resp.Status)
+	}
+	return nil
+}
+
+// isRoot reports whether id is a post that can be replied to. s.mu must be
+// held.
+func (s *Server) isRoot(id string) bool {
+	if up, ok := s.userPosts[id]; ok {
+		return up.RootID == ""
+	}
+	p := s.find(id)
+	return p != nil && !p.Deleted && p.RootID == ""
+}
+
+// nextID returns a new 26 character ID starting with prefix. s.mu must be
+// held.
+func (s *Server) nextID(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%s%0*d", prefix, 26-len(prefix), s.seq)
+}
+
+// find returns the bot's post with the given ID. s.mu must be held.
+func (s *Server) find(id string) *Post {
+	for _, p := range s.posts {
+		if p.ID == id {
+			return p
+		}
+	}
+	return nil
+}
+
+func clone(p *Post) Post {
+	c := *p
+	c.Revisions = slices.Clone(p.Revisions)
+	c.Buttons = slices.Clone(p.Buttons)
+	return c
+}
+
+func postPayload(id, userID, channelID, rootID, message string) map[string]any {
+	now := time.Now().UnixMilli()
+	return map[string]any{
+		"id":         id,
+		"create_at":  now,
+		"update_at":  now,
+		"user_id":    userID,
+		"channel_id": channelID,
+		"root_id":    rootID,
+		"message":    message,
+		"type":       "",
+		"props":      map[string]any{},
+		"metadata":   map[string]any{},
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("fakemattermost: failed to write response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, id, message string) {
+	writeJSON(w, status, map[string]any{"id": id, "message": message, "status_code": status})
+}
@@ -0,0 +1,237 @@
+package fakemattermost
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// socket holds the WebSocket connections. Events broadcast while no bot is
+// connected are queued and delivered, in order, once one is.
+type socket struct {
+	smu       sync.Mutex
+	seq       int64
+	conns     map[*websocket.Conn]bool
+	pending   []map[string]any
+	connected chan struct{}
+}
+
+func (s *socket) init() {
+	s.conns = make(map[*websocket.Conn]bool)
+	s.connected = make(chan struct{})
+}
+
+// broadcast sends ev to every connection, or queues it.
+func (s *socket) broadcast(ev map[string]any) {
+	s.smu.Lock()
+	defer s.smu.Unlock()
+	if len(s.conns) == 0 {
+		s.pending = append(s.pending, ev)
+		return
+	}
+	s.send(ev)
+}
+
+// send numbers ev and writes it to every connection. s.smu must be held.
+func (s *socket) send(ev map[string]any) {
+	ev["seq"] = s.seq
+	s.seq++
+	for conn := range s.conns {
+		conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.WriteJSON(ev); err != nil {
+			slog.Warn("fakemattermost: failed to send event", "event", ev["event"], "error", err)
+		}
+	}
+}
+
+// Disconnect drops every WebSocket connection, as a server restart would.
+func (s *socket) Disconnect() {
+	s.smu.Lock()
+	defer s.smu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+}
+
+// WaitForConnection blocks until the bot has connected.
+func (s *socket) WaitForConnection(ctx context.Context) error {
+	select {
+	case <-s.connected:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var upgrader = websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+
+func (s *Server) serveSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Error("fakemattermost: websocket upgrade failed", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	s.smu.Lock()
+	s.seq = 0
+	s.conns[conn] = true
+	s.send(map[string]any{
+		"event":     "hello",
+		"data":      map[string]any{"server_version": "9.11.0.fake", "connection_id": fmt.Sprintf("conn%d", time.Now().UnixNano())},
+		"broadcast": map[string]any{"user_id": BotUser},
+	})
+	pending := s.pending
+	s.pending = nil
+	for _, ev := range pending {
+		s.send(ev)
+	}
+	select {
+	case <-s.connected:
+	default:
+		close(s.connected)
+	}
+	s.smu.Unlock()
+
+	defer func() {
+		s.smu.Lock()
+		delete(s.conns, conn)
+		s.smu.Unlock()
+	}()
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// Mention posts text from userID in channelID, mentioning the bot, and
+// returns the ID of the post.
+func (s *Server) Mention(channelID, userID, text string) string {
+	return s.MentionInThread(channelID, userID, "", text)
+}
+
+// MentionInThread is Mention as a reply in the thread rooted at rootID.
+func (s *Server) MentionInThread(channelID, userID, rootID, text string) string {
+	return s.post(channelID, userID, rootID, fmt.Sprintf("@%s %s", BotUsername, text), []string{BotUser})
+}
+
+// DirectMessage sends text from userID to the bot in a direct message and
+// returns the ID of the post.
+func (s *Server) DirectMessage(userID, text string) string {
+	return s.post(s.DMChannel(userID), userID, "", text, nil)
+}
+
+// DMChannel returns the ID of the direct message channel between userID
+// and the bot.
+func (s *Server) DMChannel(userID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.dms[userID]
+	if !ok {
+		id = s.nextID("dm")
+		s.dms[userID] = id
+		s.channels[id] = &channel{ID: id, Type: "D", Name: BotUser + "__" + userID}
+	}
+	return id
+}
+
+func (s *Server) post(channelID, userID, rootID, message string, mentions []string) string {
+	s.mu.Lock()
+	ch, ok := s.channels[channelID]
+	if !ok {
+		ch = &channel{ID: channelID, TeamID: TeamID, Type: "O", Name: channelID}
+		s.channels[channelID] = ch
+	}
+	if _, ok := s.usernames[userID]; !ok {
+		s.usernames[userID] = "user" + userID[max(0, len(userID)-4):]
+	}
+	id := s.nextID("post")
+	s.userPosts[id] = userPost{ChannelID: channelID, UserID: userID, RootID: rootID, Message: message}
+	c, name := *ch, s.usernames[userID]
+	s.mu.Unlock()
+
+	s.broadcast(postedEvent(postPayload(id, userID, channelID, rootID, message), c, name, mentions))
+	return id
+}
+
+// EditPost changes the text of a post sent with Mention or DirectMessage.
+// Outside direct messages, the bot mention is kept unless text already
+// mentions someone.
+func (s *Server) EditPost(id, text string) error {
+	s.mu.Lock()
+	up, ok := s.userPosts[id]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("no user post %s", id)
+	}
+	if s.channels[up.ChannelID].Type != "D" && !strings.Contains(text, "@") {
+		text = fmt.Sprintf("@%s %s", BotUsername, text)
+	}
+	up.Message = text
+	s.userPosts[id] = up
+	s.mu.Unlock()
+
+	payload := postPayload(id, up.UserID, up.ChannelID, up.RootID, text)
+	payload["edit_at"] = time.Now().UnixMilli()
+	s.broadcast(postEvent("post_edited", payload))
+	return nil
+}
+
+// DeletePost deletes a post sent with Mention or DirectMessage.
+func (s *Server) DeletePost(id string) error {
+	s.mu.Lock()
+	up, ok := s.userPosts[id]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("no user post %s", id)
+	}
+	delete(s.userPosts, id)
+	s.mu.Unlock()
+
+	payload := postPayload(id, up.UserID, up.ChannelID, up.RootID, "")
+	payload["delete_at"] = time.Now().UnixMilli()
+	s.broadcast(postEvent("post_deleted", payload))
+	return nil
+}
+
+// postedEvent builds a posted event. Mattermost encodes the post and the
+// mentions as JSON strings inside the event.
+func postedEvent(payload map[string]any, c channel, sender string, mentions []string) map[string]any {
+	post, _ := json.Marshal(payload)
+	data := map[string]any{
+		"channel_display_name": c.Name,
+		"channel_name":         c.Name,
+		"channel_type":         c.Type,
+		"post":                 string(post),
+		"sender_name":          "@" + sender,
+		"team_id":              c.TeamID,
+		"set_online":           true,
+	}
+	if len(mentions) > 0 {
+		m, _ := json.Marshal(mentions)
+		data["mentions"] = string(m)
+	}
+	return map[string]any{
+		"event":     "posted",
+		"data":      data,
+		"broadcast": map[string]any{"channel_id": c.ID, "team_id": "", "user_id": ""},
+	}
+}
+
+func postEvent(name string, payload map[string]any) map[string]any {
+	post, _ := json.Marshal(payload)
+	return map[string]any{
+		"event":     name,
+		"data":      map[string]any{"post": string(post)},
+		"broadcast": map[string]any{"channel_id": payload["channel_id"], "team_id": "", "user_id": ""},
+	}
+}
@@ -0,0 +1,146 @@
+package mattermost
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"chatrelay-bot/pkg/models"
+)
+
+// maxPostLength is Mattermost's default limit on the length of a post, in
+// characters. Longer answers are cut short.
+const maxPostLength = 16383
+
+// Post sends msg, as a reply in the thread rooted at msg.Thread if set.
+func (c *Client) Post(ctx context.Context, msg models.OutgoingMessage) (string, error) {
+	tracer := otel.Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, "PostMessageToMattermost",
+		trace.WithAttributes(
+			attribute.String("mattermost.channel_id", msg.Conversation),
+			attribute.String("mattermost.root_id", msg.Thread),
+			attribute.Int("mattermost.message_length", len(msg.Text)),
+		),
+	)
+	defer span.End()
+
+	body := c.body(msg)
+	body.ChannelID = msg.Conversation
+	body.RootID = msg.Thread
+	var created post
+	if err := c.rest.do(ctx, "POST", "/posts", body, &created); err != nil {
+		slog.ErrorContext(ctx, "Failed to send Mattermost post", "error", err, "channel", msg.Conversation)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to send post")
+		return "", err
+	}
+	span.SetStatus(codes.Ok, "success")
+	return created.ID, nil
+}
+
+// Update replaces the text and buttons of a post.
+func (c *Client) Update(ctx context.Context, id string, msg models.OutgoingMessage) error {
+	tracer := otel.Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, "UpdateMessageInMattermost",
+		trace.WithAttributes(attribute.String("mattermost.post_id", id)),
+	)
+	defer span.End()
+
+	if err := c.rest.do(ctx, "PUT", "/posts/"+id+"/patch", c.body(msg), nil); err != nil {
+		slog.ErrorContext(ctx, "Failed to update Mattermost post", "error", err, "post", id)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to update post")
+		return fmt.Errorf("failed to update post: %w", err)
+	}
+	span.SetStatus(codes.Ok, "success")
+	return nil
+}
+
+func (c *Client) Delete(ctx context.Context, conversation, id string) error {
+	tracer := otel.Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, "DeleteMessageInMattermost",
+		trace.WithAttributes(attribute.String("mattermost.post_id", id)),
+	)
+	defer span.End()
+
+	if err := c.rest.do(ctx, "DELETE", "/posts/"+id, nil, nil); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to delete post")
+		return fmt.Errorf("failed to delete post: %w", err)
+	}
+	span.SetStatus(codes.Ok, "success")
+	return nil
+}
+
+// Notify sends userID an ephemeral post in conversation.
+func (c *Client) Notify(ctx context.Context, conversation, userID, text string) error {
+	tracer := otel.Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, "NotifyUserInMattermost",
+		trace.WithAttributes(
+			attribute.String("mattermost.channel_id", conversation),
+			attribute.String("mattermost.user_id", userID),
+		),
+	)
+	defer span.End()
+
+	body := map[string]any{
+		"user_id": userID,
+		"post":    postBody{ChannelID: conversation, Message: text, Props: map[string]any{}},
+	}
+	if err := c.rest.do(ctx, "POST", "/posts/ephemeral", body, nil); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to send ephemeral post")
+		return fmt.Errorf("failed to send ephemeral post: %w", err)
+	}
+	span.SetStatus(codes.Ok, "success")
+	return nil
+}
+
+// body builds a post with msg's text and its actions as buttons. Buttons
+// need an actions URL for Mattermost to report presses to.
+func (c *Client) body(msg models.OutgoingMessage) postBody {
+	text := msg.Text
+	if r := []rune(text); len(r) > maxPostLength {
+		text = string(r[:maxPostLength-1]) + "…"
+	}
+	body := postBody{Message: text, Props: map[string]any{}}
+	if len(msg.Actions) == 0 || c.actionsURL == "" {
+		return body
+	}
+	a := attachment{}
+	for _, act := range msg.Actions {
+		a.Actions = append(a.Actions, action{
+			// Mattermost action IDs may only contain letters and digits.
+			ID:    fmt.Sprintf("chatrelay%d", len(a.Actions)),
+			Name:  act.Label,
+			Type:  "button",
+			Style: "primary",
+			Integration: integration{
+				URL: c.actionsURL,
+				Context: actionContext{
+					Action: act.ID,
+					Value:  act.Value,
+					Token:  c.actionToken(msg.Conversation, act.ID, act.Value),
+				},
+			},
+		})
+	}
+	body.Props["attachments"] = []attachment{a}
+	return body
+}
+
+// actionToken signs a button's context with the action key, so that presses
+// reported to the actions URL can be told from forged requests.
+func (c *Client) actionToken(channelID, action, value string) string {
+	mac := hmac.New(sha256.New, []byte(c.actionKey))
+	fmt.Fprintf(mac, "%s\x00%s\x00%s", channelID, action, value)
+	return hex.EncodeToString(mac.Sum(nil))
+}
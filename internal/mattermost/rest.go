@@ -0,0 +1,175 @@
+package mattermost
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+
+	"chatrelay-bot/internal/telemetry"
+)
+
+// maxAttempts bounds how often a request is sent when Mattermost answers
+// 429 or 5xx.
+const maxAttempts = 5
+
+// APIError is an error response from the Mattermost REST API.
+type APIError struct {
+	Status  int
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("mattermost API error %d: %s (%s)", e.Status, e.Message, e.ID)
+}
+
+// rest calls the Mattermost REST API. Mattermost rate limits per user
+// rather than per route, so a 429 is simply waited out and retried.
+type rest struct {
+	baseURL string
+	token   atomic.Pointer[string]
+	http    *http.Client
+}
+
+func newREST(serverURL, token string) *rest {
+	r := &rest{
+		baseURL: strings.TrimSuffix(serverURL, "/") + "/api/v4",
+		http: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: otelhttp.NewTransport(http.DefaultTransport,
+				otelhttp.WithTracerProvider(otel.GetTracerProvider()),
+				otelhttp.WithPropagators(otel.GetTextMapPropagator()),
+			),
+		},
+	}
+	r.token.Store(&token)
+	return r
+}
+
+// do sends body as JSON to path and decodes the response into out, if
+// both are non-nil.
+func (r *rest) do(ctx context.Context, method, path string, body, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+	route := routeOf(method, path)
+
+	for attempt := 1; ; attempt++ {
+		resp, err := r.send(ctx, method, path, payload)
+		if err != nil {
+			telemetry.RecordMattermostAPICall(ctx, route, "transport_error")
+			return fmt.Errorf("%s: %w", route, err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		telemetry.RecordMattermostAPICall(ctx, route, strconv.Itoa(resp.StatusCode))
+
+		switch {
+		case resp.StatusCode < 300:
+			if out != nil && len(data) > 0 {
+				if err := json.Unmarshal(data, out); err != nil {
+					return fmt.Errorf("failed to decode %s response: %w", route, err)
+				}
+			}
+			return nil
+		case (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500) && attempt < maxAttempts:
+			wait := time.Duration(attempt) * time.Second
+			if resp.StatusCode == http.StatusTooManyRequests {
+				wait = retryAfter(resp.Header)
+			}
+			slog.WarnContext(ctx, "Mattermost request will be retried", "route", route, "status", resp.StatusCode, "retry_after", wait, "attempt", attempt)
+			telemetry.RecordRetry(ctx, "mattermost", route)
+			if err := sleep(ctx, wait); err != nil {
+				return err
+			}
+		default:
+			apiErr := &APIError{Status: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+			json.Unmarshal(data, apiErr)
+			return apiErr
+		}
+	}
+}
+
+func (r *rest) send(ctx context.Context, method, path string, payload []byte) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, r.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+*r.token.Load())
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return r.http.Do(req)
+}
+
+// retryAfter reads how long to wait from a 429 response: Retry-After, or
+// the seconds until the rate limit resets.
+func retryAfter(h http.Header) time.Duration {
+	for _, name := range []string{"Retry-After", "X-Ratelimit-Reset"} {
+		if n, err := strconv.Atoi(h.Get(name)); err == nil && n >= 0 {
+			return max(time.Duration(n)*time.Second, 100*time.Millisecond)
+		}
+	}
+	return time.Second
+}
+
+// routeOf returns method and path with IDs replaced by ":id", for metrics.
+func routeOf(method, path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if isID(part) {
+			parts[i] = ":id"
+		}
+	}
+	return method + " " + strings.Join(parts, "/")
+}
+
+// isID reports whether s looks like a Mattermost ID: 26 lower case letters
+// and digits.
+func isID(s string) bool {
+	if len(s) != 26 {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func isAPIError(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Status == status
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
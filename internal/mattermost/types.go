@@ -0,0 +1,116 @@
+package mattermost
+
+import "encoding/json"
+
+// channelDirect is the type of a direct message channel. Others are "O"
+// (public), "P" (private) and "G" (group message).
+const channelDirect = "D"
+
+// event is one message on the Mattermost WebSocket.
+type event struct {
+	Event     string          `json:"event"`
+	Data      json.RawMessage `json:"data"`
+	Broadcast struct {
+		ChannelID string `json:"channel_id"`
+		TeamID    string `json:"team_id"`
+	} `json:"broadcast"`
+	Seq int64 `json:"seq"`
+}
+
+type hello struct {
+	ServerVersion string `json:"server_version"`
+	ConnectionID  string `json:"connection_id"`
+}
+
+// postedData is the data of a posted event. Post and Mentions are JSON
+// encoded a second time.
+type postedData struct {
+	Post        string `json:"post"`
+	ChannelType string `json:"channel_type"`
+	SenderName  string `json:"sender_name"`
+	TeamID      string `json:"team_id"`
+	Mentions    string `json:"mentions,omitempty"`
+}
+
+// postData is the data of post_edited and post_deleted events.
+type postData struct {
+	Post string `json:"post"`
+}
+
+type post struct {
+	ID        string         `json:"id"`
+	UserID    string         `json:"user_id"`
+	ChannelID string         `json:"channel_id"`
+	RootID    string         `json:"root_id"`
+	Message   string         `json:"message"`
+	Type      string         `json:"type"`
+	Props     map[string]any `json:"props,omitempty"`
+	Metadata  struct {
+		Files []fileInfo `json:"files"`
+	} `json:"metadata"`
+}
+
+type fileInfo struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	MIMEType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+}
+
+type user struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+type channel struct {
+	ID     string `json:"id"`
+	TeamID string `json:"team_id"`
+	Type   string `json:"type"`
+}
+
+// postBody is the JSON body of a create or patch post request. Props are
+// always sent, so that a patch without actions removes the buttons.
+type postBody struct {
+	ChannelID string         `json:"channel_id,omitempty"`
+	RootID    string         `json:"root_id,omitempty"`
+	Message   string         `json:"message"`
+	Props     map[string]any `json:"props"`
+}
+
+// attachment is a message attachment, used to carry buttons.
+type attachment struct {
+	Text    string   `json:"text,omitempty"`
+	Actions []action `json:"actions"`
+}
+
+type action struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Style       string      `json:"style,omitempty"`
+	Integration integration `json:"integration"`
+}
+
+// integration is where Mattermost posts a button press, with Context
+// passed back unchanged.
+type integration struct {
+	URL     string        `json:"url"`
+	Context actionContext `json:"context"`
+}
+
+type actionContext struct {
+	Action string `json:"action"`
+	Value  string `json:"value"`
+	// Token proves that the context came from this bot.
+	Token string `json:"token"`
+}
+
+// actionRequest is what Mattermost posts to an integration URL.
+type actionRequest struct {
+	UserID    string        `json:"user_id"`
+	UserName  string        `json:"user_name"`
+	ChannelID string        `json:"channel_id"`
+	TeamID    string        `json:"team_id"`
+	PostID    string        `json:"post_id"`
+	Context   actionContext `json:"context"`
+}
@@ -0,0 +1,142 @@
+package mattermost
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"chatrelay-bot/internal/health"
+)
+
+const (
+	maxReconnectDelay = time.Minute
+	// pingInterval is how often the connection is pinged; it is considered
+	// dead when nothing, pongs included, arrives for two intervals.
+	pingInterval = 30 * time.Second
+)
+
+// errFatal wraps failures that reconnecting cannot fix, such as an invalid
+// token.
+var errFatal = errors.New("mattermost rejected the bot")
+
+// Run connects to the Mattermost WebSocket and delivers posts until ctx is
+// done, reconnecting whenever the connection drops.
+func (c *Client) Run(ctx context.Context) error {
+	delay := time.Second
+	for {
+		connected, err := c.connect(ctx)
+		health.Set(health.MattermostWebSocket, false, "disconnected")
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, errFatal) {
+			return err
+		}
+		if connected {
+			delay = time.Second
+		}
+		slog.WarnContext(ctx, "Mattermost WebSocket connection lost, reconnecting", "error", err, "delay", delay)
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// connect runs one WebSocket connection until it drops. connected reports
+// whether the server got as far as saying hello.
+func (c *Client) connect(ctx context.Context) (connected bool, err error) {
+	c.mu.Lock()
+	authenticated := c.mention != nil
+	c.mu.Unlock()
+	if !authenticated {
+		if err := c.authenticate(ctx); err != nil {
+			if isAPIError(err, http.StatusUnauthorized) {
+				return false, fmt.Errorf("%w: invalid token: %v", errFatal, err)
+			}
+			return false, fmt.Errorf("failed to look up bot user: %w", err)
+		}
+	}
+
+	health.Set(health.MattermostWebSocket, false, "connecting")
+	header := http.Header{"Authorization": {"Bearer " + *c.rest.token.Load()}}
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, websocketURL(c.serverURL), header)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			return false, fmt.Errorf("%w: WebSocket authentication failed", errFatal)
+		}
+		return false, fmt.Errorf("failed to connect to WebSocket: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		conn.Close()
+	})
+	defer stop()
+
+	alive := func() {
+		conn.SetReadDeadline(time.Now().Add(2 * pingInterval))
+	}
+	alive()
+	conn.SetPongHandler(func(string) error {
+		alive()
+		return nil
+	})
+	pingCtx, stopPing := context.WithCancel(ctx)
+	defer stopPing()
+	go ping(pingCtx, conn)
+
+	for {
+		var ev event
+		if err := conn.ReadJSON(&ev); err != nil {
+			return connected, err
+		}
+		alive()
+		switch ev.Event {
+		case "hello":
+			var h hello
+			json.Unmarshal(ev.Data, &h)
+			connected = true
+			health.Set(health.MattermostWebSocket, true, "connected")
+			slog.InfoContext(ctx, "Connected to Mattermost", "server_version", h.ServerVersion)
+		case "":
+			// Replies to WebSocket actions; the client sends none.
+		default:
+			c.dispatch(ctx, ev)
+		}
+	}
+}
+
+func ping(ctx context.Context, conn *websocket.Conn) {
+	t := time.NewTicker(pingInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// websocketURL is the WebSocket endpoint of the server at serverURL.
+func websocketURL(serverURL string) string {
+	u := serverURL
+	switch {
+	case strings.HasPrefix(u, "https://"):
+		u = "wss://" + strings.TrimPrefix(u, "https://")
+	case strings.HasPrefix(u, "http://"):
+		u = "ws://" + strings.TrimPrefix(u, "http://")
+	}
+	return u + "/api/v4/websocket"
+}
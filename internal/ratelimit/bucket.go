@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// buckets is a set of token buckets keyed by user or channel ID. A bucket
+// holds up to burst tokens and refills at perMinute tokens per minute.
+type buckets struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newBuckets() *buckets {
+	return &buckets{buckets: make(map[string]*bucket)}
+}
+
+// take removes a token from the bucket for key. When the bucket is empty it
+// reports false and the time the next token becomes available. A perMinute
+// of 0 disables the limit.
+func (b *buckets) take(key string, perMinute, burst int, now time.Time) (bool, time.Time) {
+	if perMinute <= 0 {
+		return true, time.Time{}
+	}
+	ratePerSecond := float64(perMinute) / 60
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sweep(now, ratePerSecond, burst)
+
+	bk, ok := b.buckets[key]
+	if !ok {
+		bk = &bucket{tokens: float64(burst), last: now}
+		b.buckets[key] = bk
+	}
+	bk.tokens = min(float64(burst), bk.tokens+now.Sub(bk.last).Seconds()*ratePerSecond)
+	bk.last = now
+
+	if bk.tokens >= 1 {
+		bk.tokens--
+		return true, time.Time{}
+	}
+	wait := time.Duration((1 - bk.tokens) / ratePerSecond * float64(time.Second))
+	return false, now.Add(wait)
+}
+
+// refund puts back a token taken from the bucket for key, for a mention
+// that another limit then refused.
+func (b *buckets) refund(key string, perMinute, burst int) {
+	if perMinute <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if bk, ok := b.buckets[key]; ok {
+		bk.tokens = min(float64(burst), bk.tokens+1)
+	}
+}
+
+// sweep drops buckets that have been idle long enough to refill completely,
+// at most once a minute. b.mu must be held.
+func (b *buckets) sweep(now time.Time, ratePerSecond float64, burst int) {
+	if now.Sub(b.lastSweep) < time.Minute {
+		return
+	}
+	b.lastSweep = now
+	full := time.Duration(float64(burst) / ratePerSecond * float64(time.Second))
+	for key, bk := range b.buckets {
+		if now.Sub(bk.last) > full {
+			delete(b.buckets, key)
+		}
+	}
+}
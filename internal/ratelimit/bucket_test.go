@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// clock is a fake time source for driving limits step by step.
+type clock struct {
+	now time.Time
+}
+
+func newClock() *clock {
+	return &clock{now: time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *clock) advance(d time.Duration) time.Time {
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+func TestBucketsTake(t *testing.T) {
+	type step struct {
+		advance time.Duration
+		key     string
+		ok      bool
+		// retryIn is when the next token is due, relative to the start.
+		retryIn time.Duration
+	}
+	tests := []struct {
+		name      string
+		perMinute int
+		burst     int
+		steps     []step
+	}{
+		{
+			name: "burst then refill", perMinute: 6, burst: 2,
+			steps: []step{
+				{key: "U1", ok: true},
+				{key: "U1", ok: true},
+				{key: "U1", ok: false, retryIn: 10 * time.Second},
+				{advance: 5 * time.Second, key: "U1", ok: false, retryIn: 10 * time.Second},
+				{advance: 5 * time.Second, key: "U1", ok: true},
+				{key: "U1", ok: false, retryIn: 20 * time.Second},
+			},
+		},
+		{
+			name: "refill is capped at burst", perMinute: 60, burst: 2,
+			steps: []step{
+				{key: "U1", ok: true},
+				{advance: time.Hour, key: "U1", ok: true},
+				{key: "U1", ok: true},
+				{key: "U1", ok: false, retryIn: time.Hour + time.Second},
+			},
+		},
+		{
+			name: "keys are independent", perMinute: 1, burst: 1,
+			steps: []step{
+				{key: "U1", ok: true},
+				{key: "U1", ok: false, retryIn: time.Minute},
+				{key: "U2", ok: true},
+				{key: "U2", ok: false, retryIn: time.Minute},
+			},
+		},
+		{
+			name: "zero rate disables the limit", perMinute: 0, burst: 0,
+			steps: []step{
+				{key: "U1", ok: true},
+				{key: "U1", ok: true},
+				{key: "U1", ok: true},
+			},
+		},
+		{
+			name: "zero burst never allows", perMinute: 60, burst: 0,
+			steps: []step{
+				{key: "U1", ok: false, retryIn: time.Second},
+				{advance: time.Minute, key: "U1", ok: false, retryIn: time.Minute + time.Second},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBuckets()
+			clk := newClock()
+			start := clk.now
+			for i, s := range tt.steps {
+				now := clk.advance(s.advance)
+				ok, retryAt := b.take(s.key, tt.perMinute, tt.burst, now)
+				if ok != s.ok {
+					t.Fatalf("step %d: take = %v, want %v", i, ok, s.ok)
+				}
+				if ok {
+					if !retryAt.IsZero() {
+						t.Errorf("step %d: retryAt = %v for an allowed take", i, retryAt)
+					}
+					continue
+				}
+				if got := retryAt.Sub(start); (got - s.retryIn).Abs() > time.Millisecond {
+					t.Errorf("step %d: retry in %v, want %v", i, got, s.retryIn)
+				}
+			}
+		})
+	}
+}
+
+func TestBucketsSweep(t *testing.T) {
+	// One token a minute with a burst of two: a bucket refills completely
+	// in two minutes.
+	b := newBuckets()
+	clk := newClock()
+	b.take("idle", 1, 2, clk.now)
+	b.take("busy", 1, 2, clk.advance(30*time.Second))
+	b.take("busy", 1, 2, clk.now)
+
+	// A sweep 130s in drops "idle", which has refilled completely. "busy"
+	// is kept with the tokens it has regained rather than starting over
+	// full.
+	b.take("busy", 1, 2, clk.advance(100*time.Second))
+	if _, ok := b.buckets["idle"]; ok {
+		t.Error("idle bucket was not swept")
+	}
+	if busy := b.buckets["busy"]; busy == nil || busy.tokens >= 1 {
+		t.Errorf("busy bucket was swept: %+v", busy)
+	}
+
+	// Sweeps run at most once a minute.
+	b.take("idle", 60, 2, clk.now)
+	b.take("busy", 60, 2, clk.advance(10*time.Second))
+	if _, ok := b.buckets["idle"]; !ok {
+		t.Error("idle bucket was swept twice within a minute")
+	}
+}
@@ -0,0 +1,234 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"chatrelay-bot/internal/adapter"
+	"chatrelay-bot/internal/chatbackend"
+	"chatrelay-bot/internal/telemetry"
+	"chatrelay-bot/pkg/models"
+)
+
+const tracerName = "chatrelay/internal/ratelimit"
+
+// resetCommand matches the admin command "admin quota reset @user". The
+// user is taken from the message's mentions, which each adapter reads from
+// its platform's own markup.
+var resetCommand = regexp.MustCompile(`(?i)^admin\s+quota\s+reset(\s|$)`)
+
+// quotaUserKey carries the quota key of the user a mention is answered
+// for to the metered backend.
+type quotaUserKey struct{}
+
+type limits struct {
+	userPerMinute    int
+	userBurst        int
+	channelPerMinute int
+	channelBurst     int
+	admins           []string
+}
+
+// Limiter applies per-user and per-channel token bucket rate limits and
+// per-user quotas before passing mentions on to the next handler. It also
+// handles the admin quota reset command.
+type Limiter struct {
+	next      adapter.Handler
+	messenger adapter.Messenger
+	quotas    *Quotas
+	users     *buckets
+	channels  *buckets
+	limits    atomic.Pointer[limits]
+}
+
+func NewLimiter(next adapter.Handler, quotas *Quotas, cfg *models.AppConfig) *Limiter {
+	l := &Limiter{
+		next:     next,
+		quotas:   quotas,
+		users:    newBuckets(),
+		channels: newBuckets(),
+	}
+	l.ApplyConfig(cfg)
+	return l
+}
+
+func (l *Limiter) SetMessenger(m adapter.Messenger) {
+	l.messenger = m
+}
+
+func (l *Limiter) ApplyConfig(cfg *models.AppConfig) {
+	l.limits.Store(&limits{
+		userPerMinute:    cfg.RateLimitUserPerMinute,
+		userBurst:        cfg.RateLimitUserBurst,
+		channelPerMinute: cfg.RateLimitChannelPerMinute,
+		channelBurst:     cfg.RateLimitChannelBurst,
+		admins:           cfg.AdminUsers,
+	})
+}
+
+func (l *Limiter) HandleMessage(ctx context.Context, msg models.IncomingMessage, settings models.ChannelSettings) error {
+	tracer := otel.Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, "RateLimitAppMention",
+		trace.WithAttributes(
+			attribute.String("chat.conversation", msg.Conversation),
+			attribute.String("chat.user", msg.Author.ID),
+		),
+	)
+
+	if resetCommand.MatchString(msg.Text) {
+		defer span.End()
+		return l.resetQuota(ctx, msg)
+	}
+
+	limit, retryAt, err := l.check(ctx, msg)
+	if err != nil {
+		// A broken store must not take the bot down; let the mention through.
+		slog.ErrorContext(ctx, "Failed to check quota, allowing mention", "error", err, "user", msg.Author.ID)
+		span.RecordError(err)
+	}
+	if limit == "" {
+		span.End()
+		ctx = context.WithValue(ctx, quotaUserKey{}, userKey(msg.Platform, msg.Author.ID))
+		return l.next.HandleMessage(ctx, msg, settings)
+	}
+	defer span.End()
+
+	span.SetAttributes(attribute.String("ratelimit.limit", limit), attribute.String("ratelimit.retry_at", retryAt.Format(time.RFC3339)))
+	span.SetStatus(codes.Ok, "Rate limited")
+	telemetry.RecordRateLimited(ctx, limit)
+	slog.WarnContext(ctx, "Mention rate limited", "limit", limit, "retry_at", retryAt, "user", msg.Author.ID, "channel", msg.Conversation)
+
+	l.sendEphemeral(ctx, msg, limitMessage(limit, l.formatTime(retryAt)))
+	return nil
+}
+
+// check returns the first limit the mention exceeds and when the user can
+// ask again, or an empty limit when the mention may proceed. A refused
+// mention uses up nothing: tokens taken before a later limit refuses it
+// are put back.
+func (l *Limiter) check(ctx context.Context, msg models.IncomingMessage) (string, time.Time, error) {
+	lim := l.limits.Load()
+	now := time.Now()
+	user := userKey(msg.Platform, msg.Author.ID)
+	channel := userKey(msg.Platform, msg.Conversation)
+
+	if ok, retryAt := l.users.take(user, lim.userPerMinute, lim.userBurst, now); !ok {
+		return LimitUserRate, retryAt, nil
+	}
+	if ok, retryAt := l.channels.take(channel, lim.channelPerMinute, lim.channelBurst, now); !ok {
+		l.users.refund(user, lim.userPerMinute, lim.userBurst)
+		return LimitChannelRate, retryAt, nil
+	}
+	limit, retryAt, err := l.quotas.Acquire(ctx, user, now)
+	if limit != "" {
+		l.users.refund(user, lim.userPerMinute, lim.userBurst)
+		l.channels.refund(channel, lim.channelPerMinute, lim.channelBurst)
+	}
+	return limit, retryAt, err
+}
+
+func (l *Limiter) resetQuota(ctx context.Context, msg models.IncomingMessage) error {
+	var target models.Author
+	if len(msg.Mentions) == 1 {
+		target = msg.Mentions[0]
+	}
+	if !slices.Contains(l.limits.Load().admins, msg.Author.ID) {
+		slog.WarnContext(ctx, "Quota reset refused for non-admin", "audit", true, "user", msg.Author.ID, "target_user", target.ID, "channel", msg.Conversation)
+		l.sendEphemeral(ctx, msg, "Only ChatRelay admins can reset quotas.")
+		return nil
+	}
+	if target.ID == "" {
+		l.sendEphemeral(ctx, msg, "Mention exactly one user to reset: admin quota reset @user")
+		return nil
+	}
+	if err := l.quotas.Reset(ctx, userKey(msg.Platform, target.ID)); err != nil {
+		return fmt.Errorf("failed to reset quota: %w", err)
+	}
+	slog.InfoContext(ctx, "Quota reset", "audit", true, "user", msg.Author.ID, "target_user", target.ID, "channel", msg.Conversation)
+	l.sendEphemeral(ctx, msg, fmt.Sprintf("Quota for %s has been reset.", l.mention(target)))
+	return nil
+}
+
+func (l *Limiter) sendEphemeral(ctx context.Context, msg models.IncomingMessage, text string) {
+	if l.messenger == nil {
+		return
+	}
+	if err := l.messenger.Notify(ctx, msg.Conversation, msg.Author.ID, text); err != nil {
+		slog.ErrorContext(ctx, "Failed to send rate limit message", "error", err, "user", msg.Author.ID, "channel", msg.Conversation)
+	}
+}
+
+func limitMessage(limit, when string) string {
+	var reason string
+	switch limit {
+	case LimitUserRate:
+		reason = "You're asking questions faster than I can keep up with."
+	case LimitChannelRate:
+		reason = "This channel is asking questions faster than I can keep up with."
+	case LimitDailyRequests, LimitDailyTokens:
+		reason = "You've reached your daily ChatRelay quota."
+	case LimitMonthlyRequests, LimitMonthlyTokens:
+		reason = "You've reached your monthly ChatRelay quota."
+	}
+	return fmt.Sprintf("%s You can ask again %s.", reason, when)
+}
+
+// mention refers to user the way the messenger's platform marks up
+// mentions, or by name.
+func (l *Limiter) mention(user models.Author) string {
+	if f, ok := l.messenger.(adapter.Formatter); ok {
+		return f.Mention(user)
+	}
+	if user.Name != "" {
+		return user.Name
+	}
+	return user.ID
+}
+
+// formatTime formats t in the reader's own time zone where the messenger's
+// platform can show that, and in UTC otherwise.
+func (l *Limiter) formatTime(t time.Time) string {
+	if f, ok := l.messenger.(adapter.Formatter); ok {
+		return f.Time(t)
+	}
+	if time.Until(t) < time.Hour {
+		return "at " + t.UTC().Format("15:04:05 UTC")
+	}
+	return "on " + t.UTC().Format("Jan 2 at 15:04 UTC")
+}
+
+type meteredBackend struct {
+	next   chatbackend.Client
+	quotas *Quotas
+}
+
+// MeterTokens wraps a backend client so that token usage reported in its
+// responses counts against the requesting user's quotas.
+func MeterTokens(next chatbackend.Client, quotas *Quotas) chatbackend.Client {
+	return &meteredBackend{next: next, quotas: quotas}
+}
+
+func (m *meteredBackend) SendChatRequest(ctx context.Context, req models.ChatRequest) (models.ChatResponse, error) {
+	res, err := m.next.SendChatRequest(ctx, req)
+	if err != nil || res.Usage == nil {
+		return res, err
+	}
+	user := req.UserID
+	if key, ok := ctx.Value(quotaUserKey{}).(string); ok {
+		user = key
+	}
+	if err := m.quotas.RecordTokens(ctx, user, res.Usage.TotalTokens, time.Now()); err != nil {
+		slog.ErrorContext(ctx, "Failed to record token usage", "error", err, "user", req.UserID)
+	}
+	return res, nil
+}
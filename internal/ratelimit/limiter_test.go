@@ -0,0 +1,262 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"chatrelay-bot/internal/store"
+	"chatrelay-bot/pkg/models"
+)
+
+// notices is an adapter.Messenger that records the notices sent to users.
+type notices struct {
+	texts []string
+}
+
+func (n *notices) Post(ctx context.Context, msg models.OutgoingMessage) (string, error) {
+	return "", nil
+}
+
+func (n *notices) Update(ctx context.Context, id string, msg models.OutgoingMessage) error {
+	return nil
+}
+
+func (n *notices) Delete(ctx context.Context, conversation, id string) error {
+	return nil
+}
+
+func (n *notices) Notify(ctx context.Context, conversation, userID, text string) error {
+	n.texts = append(n.texts, text)
+	return nil
+}
+
+// markup is a notices with platform markup for mentions and times.
+type markup struct {
+	notices
+}
+
+func (m *markup) Mention(user models.Author) string {
+	return "<@" + user.ID + ">"
+}
+
+func (m *markup) Time(t time.Time) string {
+	return fmt.Sprintf("at <t:%d>", t.Unix())
+}
+
+type counter struct {
+	calls int
+}
+
+func (c *counter) HandleMessage(ctx context.Context, msg models.IncomingMessage, settings models.ChannelSettings) error {
+	c.calls++
+	return nil
+}
+
+func TestLimiterQuotaReset(t *testing.T) {
+	tests := []struct {
+		name      string
+		author    string
+		text      string
+		mentions  []models.Author
+		formatter bool
+		wantReset bool
+		want      string
+	}{
+		{
+			name: "admin", author: "A1", text: "admin quota reset <@U1>",
+			mentions:  []models.Author{{ID: "U1", Name: "jane"}},
+			wantReset: true, want: "Quota for jane has been reset.",
+		},
+		{
+			name: "platform mention markup", author: "A1", text: "Admin Quota Reset <@U1>",
+			mentions:  []models.Author{{ID: "U1", Name: "jane"}},
+			formatter: true, wantReset: true, want: "Quota for <@U1> has been reset.",
+		},
+		{
+			name: "unnamed user", author: "A1", text: "admin quota reset @8xk3",
+			mentions:  []models.Author{{ID: "U1"}},
+			wantReset: true, want: "Quota for U1 has been reset.",
+		},
+		{
+			name: "non-admin", author: "U2", text: "admin quota reset <@U1>",
+			mentions: []models.Author{{ID: "U1"}},
+			want:     "Only ChatRelay admins can reset quotas.",
+		},
+		{
+			name: "no mention", author: "A1", text: "admin quota reset",
+			want: "Mention exactly one user to reset: admin quota reset @user",
+		},
+		{
+			name: "several mentions", author: "A1", text: "admin quota reset <@U1> <@U2>",
+			mentions: []models.Author{{ID: "U1"}, {ID: "U2"}},
+			want:     "Mention exactly one user to reset: admin quota reset @user",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &models.AppConfig{QuotaDailyRequests: 1, AdminUsers: []string{"A1"}}
+			quotas := NewQuotas(store.NewMemoryStore(), cfg)
+			quotas.Acquire(ctx, userKey("slack", "U1"), time.Now())
+			next := &counter{}
+			l := NewLimiter(next, quotas, cfg)
+			m := &markup{}
+			if tt.formatter {
+				l.SetMessenger(m)
+			} else {
+				l.SetMessenger(&m.notices)
+			}
+
+			msg := models.IncomingMessage{Platform: "slack", Conversation: "C1", Author: models.Author{ID: tt.author}, Text: tt.text, Mentions: tt.mentions}
+			if err := l.HandleMessage(ctx, msg, models.ChannelSettings{}); err != nil {
+				t.Fatal(err)
+			}
+			if next.calls != 0 {
+				t.Error("reset command was passed on to the bot")
+			}
+			if len(m.texts) != 1 || m.texts[0] != tt.want {
+				t.Errorf("notices = %q, want %q", m.texts, tt.want)
+			}
+			limit, _, _ := quotas.Acquire(ctx, userKey("slack", "U1"), time.Now())
+			if reset := limit == ""; reset != tt.wantReset {
+				t.Errorf("quota reset = %v, want %v", reset, tt.wantReset)
+			}
+		})
+	}
+}
+
+func TestLimiterNotice(t *testing.T) {
+	tests := []struct {
+		name      string
+		formatter bool
+		want      string
+	}{
+		{name: "plain", want: "You're asking questions faster than I can keep up with. You can ask again at "},
+		{name: "platform time markup", formatter: true, want: "You're asking questions faster than I can keep up with. You can ask again at <t:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &models.AppConfig{RateLimitUserPerMinute: 1, RateLimitUserBurst: 1}
+			next := &counter{}
+			l := NewLimiter(next, NewQuotas(store.NewMemoryStore(), cfg), cfg)
+			m := &markup{}
+			if tt.formatter {
+				l.SetMessenger(m)
+			} else {
+				l.SetMessenger(&m.notices)
+			}
+
+			msg := models.IncomingMessage{Conversation: "C1", Author: models.Author{ID: "U1"}, Text: "hello"}
+			l.HandleMessage(ctx, msg, models.ChannelSettings{})
+			l.HandleMessage(ctx, msg, models.ChannelSettings{})
+			if next.calls != 1 {
+				t.Errorf("next handler called %d times, want 1", next.calls)
+			}
+			if len(m.texts) != 1 || !strings.HasPrefix(m.texts[0], tt.want) {
+				t.Errorf("notices = %q, want one starting %q", m.texts, tt.want)
+			}
+			if !tt.formatter && !strings.HasSuffix(m.texts[0], " UTC.") {
+				t.Errorf("notice %q does not give the time in UTC", m.texts[0])
+			}
+		})
+	}
+}
+
+func TestLimiterRefusalSpendsNothing(t *testing.T) {
+	ctx := context.Background()
+	ask := func(l *Limiter, platform, channel, user string) {
+		l.HandleMessage(ctx, models.IncomingMessage{Platform: platform, Conversation: channel, Author: models.Author{ID: user}, Text: "hello"}, models.ChannelSettings{})
+	}
+
+	t.Run("channel rate", func(t *testing.T) {
+		cfg := &models.AppConfig{RateLimitUserPerMinute: 1, RateLimitUserBurst: 1, RateLimitChannelPerMinute: 1, RateLimitChannelBurst: 1}
+		next := &counter{}
+		l := NewLimiter(next, NewQuotas(store.NewMemoryStore(), cfg), cfg)
+		ask(l, "slack", "C1", "U1")
+		// C1 is out of tokens, so U2 is refused there, but keeps its own
+		// token for another channel.
+		ask(l, "slack", "C1", "U2")
+		ask(l, "slack", "C2", "U2")
+		if next.calls != 2 {
+			t.Errorf("next handler called %d times, want 2", next.calls)
+		}
+	})
+
+	t.Run("quota", func(t *testing.T) {
+		cfg := &models.AppConfig{RateLimitUserPerMinute: 1, RateLimitUserBurst: 1, RateLimitChannelPerMinute: 1, RateLimitChannelBurst: 1, QuotaDailyRequests: 1}
+		quotas := NewQuotas(store.NewMemoryStore(), cfg)
+		quotas.Acquire(ctx, userKey("slack", "U1"), time.Now())
+		next := &counter{}
+		l := NewLimiter(next, quotas, cfg)
+		// U1's quota is used up; the refusal leaves C1's token for U2.
+		ask(l, "slack", "C1", "U1")
+		ask(l, "slack", "C1", "U2")
+		if next.calls != 1 {
+			t.Errorf("next handler called %d times, want 1", next.calls)
+		}
+		// Once U1's quota is reset, U1 still has a rate limit token.
+		quotas.Reset(ctx, userKey("slack", "U1"))
+		ask(l, "slack", "C2", "U1")
+		if next.calls != 2 {
+			t.Errorf("next handler called %d times after the reset, want 2", next.calls)
+		}
+	})
+}
+
+func TestLimiterKeysByPlatform(t *testing.T) {
+	ctx := context.Background()
+	cfg := &models.AppConfig{RateLimitUserPerMinute: 1, RateLimitUserBurst: 1, RateLimitChannelPerMinute: 1, RateLimitChannelBurst: 1, QuotaDailyRequests: 1}
+	quotas := NewQuotas(store.NewMemoryStore(), cfg)
+	next := &counter{}
+	l := NewLimiter(next, quotas, cfg)
+
+	// The same IDs on two platforms are different users and channels.
+	for _, platform := range []string{"slack", "discord"} {
+		msg := models.IncomingMessage{Platform: platform, Conversation: "1", Author: models.Author{ID: "42"}, Text: "hello"}
+		l.HandleMessage(ctx, msg, models.ChannelSettings{})
+	}
+	if next.calls != 2 {
+		t.Errorf("next handler called %d times, want once per platform", next.calls)
+	}
+}
+
+// tokens is a backend that reports the usage of every answer.
+type tokens struct{}
+
+func (tokens) SendChatRequest(ctx context.Context, req models.ChatRequest) (models.ChatResponse, error) {
+	return models.ChatResponse{FullResponse: "answer", Usage: &models.Usage{TotalTokens: 10}}, nil
+}
+
+// asker asks the backend for each mention, as the bot does.
+type asker struct {
+	backend interface {
+		SendChatRequest(context.Context, models.ChatRequest) (models.ChatResponse, error)
+	}
+}
+
+func (a asker) HandleMessage(ctx context.Context, msg models.IncomingMessage, settings models.ChannelSettings) error {
+	_, err := a.backend.SendChatRequest(ctx, models.ChatRequest{UserID: msg.Author.ID, Query: msg.Text})
+	return err
+}
+
+func TestMeterTokensCountsAgainstPlatformUser(t *testing.T) {
+	ctx := context.Background()
+	cfg := &models.AppConfig{QuotaDailyTokens: 10}
+	quotas := NewQuotas(store.NewMemoryStore(), cfg)
+	l := NewLimiter(asker{backend: MeterTokens(tokens{}, quotas)}, quotas, cfg)
+
+	msg := models.IncomingMessage{Platform: "discord", Conversation: "1", Author: models.Author{ID: "42"}, Text: "hello"}
+	if err := l.HandleMessage(ctx, msg, models.ChannelSettings{}); err != nil {
+		t.Fatal(err)
+	}
+	if limit, _, _ := quotas.Acquire(ctx, userKey("discord", "42"), time.Now()); limit != LimitDailyTokens {
+		t.Errorf("discord user's limit = %q, want %q", limit, LimitDailyTokens)
+	}
+	if limit, _, _ := quotas.Acquire(ctx, userKey("slack", "42"), time.Now()); limit != "" {
+		t.Errorf("slack user with the same ID was limited: %q", limit)
+	}
+}
@@ -0,0 +1,187 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"chatrelay-bot/internal/store"
+	"chatrelay-bot/pkg/models"
+)
+
+// Quota limits, recorded on the rate limited metric and used to pick the
+// message shown to the user.
+const (
+	LimitUserRate        = "user_rate"
+	LimitChannelRate     = "channel_rate"
+	LimitDailyRequests   = "daily_requests"
+	LimitMonthlyRequests = "monthly_requests"
+	LimitDailyTokens     = "daily_tokens"
+	LimitMonthlyTokens   = "monthly_tokens"
+)
+
+// Usage is the request and token count of one user for one quota period.
+type Usage struct {
+	Requests int `json:"requests"`
+	Tokens   int `json:"tokens"`
+}
+
+type quotaLimits struct {
+	dailyRequests   int
+	monthlyRequests int
+	dailyTokens     int
+	monthlyTokens   int
+}
+
+// Quotas tracks daily and monthly per-user usage in the conversation store.
+// Periods follow UTC calendar days and months.
+type Quotas struct {
+	store  store.Store
+	mu     sync.Mutex
+	limits atomic.Pointer[quotaLimits]
+}
+
+func NewQuotas(st store.Store, cfg *models.AppConfig) *Quotas {
+	q := &Quotas{store: st}
+	q.ApplyConfig(cfg)
+	return q
+}
+
+func (q *Quotas) ApplyConfig(cfg *models.AppConfig) {
+	q.limits.Store(&quotaLimits{
+		dailyRequests:   cfg.QuotaDailyRequests,
+		monthlyRequests: cfg.QuotaMonthlyRequests,
+		dailyTokens:     cfg.QuotaDailyTokens,
+		monthlyTokens:   cfg.QuotaMonthlyTokens,
+	})
+}
+
+// Acquire counts a request against the user's quotas. When a quota is
+// already used up it counts nothing and returns the exceeded limit and the
+// start of the next period.
+func (q *Quotas) Acquire(ctx context.Context, userID string, now time.Time) (string, time.Time, error) {
+	limits := q.limits.Load()
+	now = now.UTC()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	day, err := q.usage(ctx, dayKey(userID, now))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	month, err := q.usage(ctx, monthKey(userID, now))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	switch {
+	case limits.monthlyRequests > 0 && month.Requests >= limits.monthlyRequests:
+		return LimitMonthlyRequests, nextMonth(now), nil
+	case limits.monthlyTokens > 0 && month.Tokens >= limits.monthlyTokens:
+		return LimitMonthlyTokens, nextMonth(now), nil
+	case limits.dailyRequests > 0 && day.Requests >= limits.dailyRequests:
+		return LimitDailyRequests, nextDay(now), nil
+	case limits.dailyTokens > 0 && day.Tokens >= limits.dailyTokens:
+		return LimitDailyTokens, nextDay(now), nil
+	}
+
+	day.Requests++
+	month.Requests++
+	return "", time.Time{}, q.save(ctx, userID, now, day, month)
+}
+
+// RecordTokens adds tokens reported by the backend to the user's usage.
+func (q *Quotas) RecordTokens(ctx context.Context, userID string, tokens int, now time.Time) error {
+	if tokens <= 0 {
+		return nil
+	}
+	now = now.UTC()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	day, err := q.usage(ctx, dayKey(userID, now))
+	if err != nil {
+		return err
+	}
+	month, err := q.usage(ctx, monthKey(userID, now))
+	if err != nil {
+		return err
+	}
+	day.Tokens += tokens
+	month.Tokens += tokens
+	return q.save(ctx, userID, now, day, month)
+}
+
+// Reset clears all recorded usage for the user.
+func (q *Quotas) Reset(ctx context.Context, userID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	keys, err := q.store.List(ctx, store.Key("quota", userID)+"/")
+	if err != nil {
+		return fmt.Errorf("failed to list quota usage for %s: %w", userID, err)
+	}
+	for _, key := range keys {
+		if err := q.store.Delete(ctx, key); err != nil {
+			return fmt.Errorf("failed to reset quota usage for %s: %w", userID, err)
+		}
+	}
+	return nil
+}
+
+func (q *Quotas) usage(ctx context.Context, key string) (Usage, error) {
+	var u Usage
+	if _, err := store.GetJSON(ctx, q.store, key, &u); err != nil {
+		return Usage{}, fmt.Errorf("failed to read quota usage: %w", err)
+	}
+	return u, nil
+}
+
+// save writes the usage for the current periods and drops usage kept for
+// earlier periods. q.mu must be held.
+func (q *Quotas) save(ctx context.Context, userID string, now time.Time, day, month Usage) error {
+	current := map[string]Usage{dayKey(userID, now): day, monthKey(userID, now): month}
+	for key, u := range current {
+		if err := store.PutJSON(ctx, q.store, key, u); err != nil {
+			return fmt.Errorf("failed to save quota usage: %w", err)
+		}
+	}
+	keys, err := q.store.List(ctx, store.Key("quota", userID)+"/")
+	if err != nil {
+		return nil
+	}
+	for _, key := range keys {
+		if _, ok := current[key]; !ok {
+			q.store.Delete(ctx, key)
+		}
+	}
+	return nil
+}
+
+// userKey identifies a user in limits shared by every platform, where user
+// IDs from different platforms could collide.
+func userKey(platform, userID string) string {
+	return platform + ":" + userID
+}
+
+func dayKey(userID string, now time.Time) string {
+	return store.Key("quota", userID, "day", now.Format(time.DateOnly))
+}
+
+func monthKey(userID string, now time.Time) string {
+	return store.Key("quota", userID, "month", now.Format("2006-01"))
+}
+
+func nextDay(now time.Time) time.Time {
+	y, m, d := now.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+}
+
+func nextMonth(now time.Time) time.Time {
+	y, m, _ := now.Date()
+	return time.Date(y, m+1, 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,155 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chatrelay-bot/internal/store"
+	"chatrelay-bot/pkg/models"
+)
+
+func TestQuotasAcquire(t *testing.T) {
+	type step struct {
+		at time.Time
+		// tokens, when set, are recorded instead of acquiring a request.
+		tokens    int
+		wantLimit string
+		wantRetry time.Time
+	}
+	day := func(month time.Month, d, hour int) time.Time {
+		return time.Date(2024, month, d, hour, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name  string
+		cfg   models.AppConfig
+		steps []step
+	}{
+		{
+			name: "daily requests roll over at midnight UTC",
+			cfg:  models.AppConfig{QuotaDailyRequests: 2},
+			steps: []step{
+				{at: day(1, 31, 22)},
+				{at: day(1, 31, 23)},
+				{at: day(1, 31, 23), wantLimit: LimitDailyRequests, wantRetry: day(2, 1, 0)},
+				{at: day(2, 1, 0)},
+				{at: day(2, 1, 1)},
+				{at: day(2, 1, 2), wantLimit: LimitDailyRequests, wantRetry: day(2, 2, 0)},
+			},
+		},
+		{
+			name: "monthly requests span days and roll over on the first",
+			cfg:  models.AppConfig{QuotaMonthlyRequests: 3},
+			steps: []step{
+				{at: day(2, 1, 9)},
+				{at: day(2, 14, 9)},
+				{at: day(2, 29, 9)},
+				{at: day(2, 29, 23), wantLimit: LimitMonthlyRequests, wantRetry: day(3, 1, 0)},
+				{at: day(3, 1, 0)},
+			},
+		},
+		{
+			name: "monthly limits are reported before daily ones",
+			cfg:  models.AppConfig{QuotaDailyRequests: 1, QuotaMonthlyRequests: 1},
+			steps: []step{
+				{at: day(5, 10, 9)},
+				{at: day(5, 10, 10), wantLimit: LimitMonthlyRequests, wantRetry: day(6, 1, 0)},
+			},
+		},
+		{
+			name: "daily tokens",
+			cfg:  models.AppConfig{QuotaDailyTokens: 100},
+			steps: []step{
+				{at: day(4, 1, 9)},
+				{at: day(4, 1, 9), tokens: 60},
+				{at: day(4, 1, 10)},
+				{at: day(4, 1, 10), tokens: 40},
+				{at: day(4, 1, 11), wantLimit: LimitDailyTokens, wantRetry: day(4, 2, 0)},
+				{at: day(4, 2, 0)},
+			},
+		},
+		{
+			name: "monthly tokens roll over at the end of the year",
+			cfg:  models.AppConfig{QuotaMonthlyTokens: 50},
+			steps: []step{
+				{at: day(12, 30, 9), tokens: 50},
+				{at: day(12, 31, 23), wantLimit: LimitMonthlyTokens, wantRetry: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)},
+				{at: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			name: "times are taken in UTC",
+			cfg:  models.AppConfig{QuotaDailyRequests: 1},
+			steps: []step{
+				{at: day(7, 1, 23)},
+				// 01:30 on July 2 in Berlin is still July 1 in UTC.
+				{at: time.Date(2024, time.July, 2, 1, 30, 0, 0, time.FixedZone("CEST", 2*60*60)), wantLimit: LimitDailyRequests, wantRetry: day(7, 2, 0)},
+			},
+		},
+		{
+			name: "no limits",
+			steps: []step{
+				{at: day(1, 1, 0)},
+				{at: day(1, 1, 0), tokens: 1_000_000},
+				{at: day(1, 1, 0)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			q := NewQuotas(store.NewMemoryStore(), &tt.cfg)
+			for i, s := range tt.steps {
+				if s.tokens > 0 {
+					if err := q.RecordTokens(ctx, "U1", s.tokens, s.at); err != nil {
+						t.Fatalf("step %d: RecordTokens: %v", i, err)
+					}
+					continue
+				}
+				limit, retryAt, err := q.Acquire(ctx, "U1", s.at)
+				if err != nil {
+					t.Fatalf("step %d: Acquire: %v", i, err)
+				}
+				if limit != s.wantLimit || !retryAt.Equal(s.wantRetry) {
+					t.Errorf("step %d: Acquire = %q, %v, want %q, %v", i, limit, retryAt, s.wantLimit, s.wantRetry)
+				}
+			}
+		})
+	}
+}
+
+func TestQuotasDropOldPeriods(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemoryStore()
+	q := NewQuotas(st, &models.AppConfig{QuotaDailyRequests: 10})
+
+	q.Acquire(ctx, "U1", time.Date(2024, time.January, 31, 12, 0, 0, 0, time.UTC))
+	q.Acquire(ctx, "U1", time.Date(2024, time.February, 1, 12, 0, 0, 0, time.UTC))
+
+	keys, err := st.List(ctx, "quota/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{store.Key("quota", "U1", "day", "2024-02-01"), store.Key("quota", "U1", "month", "2024-02")}
+	if len(keys) != len(want) || keys[0] != want[0] || keys[1] != want[1] {
+		t.Errorf("stored keys = %v, want %v", keys, want)
+	}
+}
+
+func TestQuotasReset(t *testing.T) {
+	ctx := context.Background()
+	q := NewQuotas(store.NewMemoryStore(), &models.AppConfig{QuotaDailyRequests: 1})
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	q.Acquire(ctx, "U1", now)
+	q.Acquire(ctx, "U2", now)
+	if err := q.Reset(ctx, "U1"); err != nil {
+		t.Fatal(err)
+	}
+	if limit, _, _ := q.Acquire(ctx, "U1", now); limit != "" {
+		t.Errorf("U1 limited by %q after reset", limit)
+	}
+	if limit, _, _ := q.Acquire(ctx, "U2", now); limit != LimitDailyRequests {
+		t.Errorf("U2 limited by %q, want %q: reset must only clear U1", limit, LimitDailyRequests)
+	}
+}
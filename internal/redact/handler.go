@@ -0,0 +1,80 @@
+package redact
+
+import (
+	"context"
+	"log/slog"
+)
+
+// contentKeys are the slog attribute keys that carry user queries, answers or
+// raw payloads. Their values go through Content; error values are scrubbed
+// for PII since backend error bodies can echo the request.
+var contentKeys = map[string]bool{
+	"query":         true,
+	"text":          true,
+	"answer":        true,
+	"body":          true,
+	"response_text": true,
+	"response_body": true,
+	"raw_data":      true,
+	"data":          true,
+}
+
+type handler struct {
+	next slog.Handler
+}
+
+// NewHandler wraps next so that user content in log attributes is redacted
+// according to the current policy.
+func NewHandler(next slog.Handler) slog.Handler {
+	return &handler{next: next}
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	if CurrentPolicy().Mode == ModeOff {
+		return h.next.Handle(ctx, r)
+	}
+	redacted := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactAttr(a)
+	}
+	return &handler{next: h.next.WithAttrs(redacted)}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{next: h.next.WithGroup(name)}
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	if CurrentPolicy().Mode == ModeOff {
+		return a
+	}
+	v := a.Value.Resolve()
+	switch {
+	case v.Kind() == slog.KindGroup:
+		group := v.Group()
+		redacted := make([]any, len(group))
+		for i, ga := range group {
+			redacted[i] = redactAttr(ga)
+		}
+		return slog.Group(a.Key, redacted...)
+	case contentKeys[a.Key]:
+		return slog.String(a.Key, Content(v.String()))
+	case a.Key == "error":
+		return slog.String(a.Key, Scrub(v.String()))
+	default:
+		return a
+	}
+}
@@ -0,0 +1,76 @@
+package redact
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	defer SetPolicy(CurrentPolicy())
+
+	tests := []struct {
+		name    string
+		mode    Mode
+		log     func(*slog.Logger)
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "content keys",
+			mode:    ModeDrop,
+			log:     func(l *slog.Logger) { l.Info("mention", "query", "secret plans", "user", "U1") },
+			want:    []string{"query=[redacted]", "user=U1"},
+			notWant: []string{"secret plans"},
+		},
+		{
+			name:    "errors are scrubbed in every mode but off",
+			mode:    ModeDrop,
+			log:     func(l *slog.Logger) { l.Error("failed", "error", errors.New("bad request from jane@example.com")) },
+			want:    []string{`error="bad request from [EMAIL]"`},
+			notWant: []string{"jane@example.com"},
+		},
+		{
+			name:    "groups",
+			mode:    ModeHash,
+			log:     func(l *slog.Logger) { l.Info("answer", slog.Group("res", "answer", "hello")) },
+			want:    []string{"res.answer=sha256:2cf24dba5fb0"},
+			notWant: []string{"hello"},
+		},
+		{
+			name:    "with attrs",
+			mode:    ModeDrop,
+			log:     func(l *slog.Logger) { l.With("text", "private").Info("posted") },
+			want:    []string{"text=[redacted]"},
+			notWant: []string{"private"},
+		},
+		{
+			name: "off",
+			mode: ModeOff,
+			log: func(l *slog.Logger) {
+				l.Info("mention", "query", "secret plans", "error", errors.New("jane@example.com"))
+			},
+			want: []string{`query="secret plans"`, "error=jane@example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetPolicy(Policy{Mode: tt.mode})
+			var buf bytes.Buffer
+			tt.log(slog.New(NewHandler(slog.NewTextHandler(&buf, nil))))
+			out := buf.String()
+			for _, s := range tt.want {
+				if !strings.Contains(out, s) {
+					t.Errorf("log %q does not contain %q", out, s)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(out, s) {
+					t.Errorf("log %q contains %q", out, s)
+				}
+			}
+		})
+	}
+}
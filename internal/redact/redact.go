@@ -0,0 +1,152 @@
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type Mode string
+
+const (
+	// ModeOff records user content as-is.
+	ModeOff Mode = "off"
+	// ModeHash replaces user content with a short SHA-256 digest so equal
+	// queries can still be correlated.
+	ModeHash Mode = "hash"
+	// ModeTruncate masks detected PII and keeps only the first few characters.
+	ModeTruncate Mode = "truncate"
+	// ModeDrop replaces user content with a fixed placeholder.
+	ModeDrop Mode = "drop"
+)
+
+const droppedPlaceholder = "[redacted]"
+
+type Policy struct {
+	Mode           Mode
+	TruncateLength int
+}
+
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(strings.ToLower(strings.TrimSpace(s))); m {
+	case ModeOff, ModeHash, ModeTruncate, ModeDrop:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unsupported redaction mode %q (want off, hash, truncate or drop)", s)
+	}
+}
+
+var current atomic.Pointer[Policy]
+
+func init() {
+	SetPolicy(Policy{Mode: ModeTruncate, TruncateLength: 64})
+}
+
+// SetPolicy replaces the process-wide redaction policy used by Content,
+// Attr and the slog handler.
+func SetPolicy(p Policy) {
+	if p.TruncateLength <= 0 {
+		p.TruncateLength = 64
+	}
+	current.Store(&p)
+}
+
+func CurrentPolicy() Policy {
+	return *current.Load()
+}
+
+type detector struct {
+	name    string
+	pattern *regexp.Regexp
+	valid   func(match string) bool
+}
+
+var detectors = []detector{
+	{name: "TOKEN", pattern: regexp.MustCompile(`\b(?:xox[abposr]|xapp)-[A-Za-z0-9-]{8,}|\bsk-[A-Za-z0-9_-]{20,}|\bgh[pousr]_[A-Za-z0-9]{30,}|\bAKIA[0-9A-Z]{16}\b|(?i:bearer)\s+[A-Za-z0-9._~+/-]{16,}=*`)},
+	{name: "EMAIL", pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	{name: "CARD", pattern: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), valid: luhnValid},
+	{name: "PHONE", pattern: regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?\(?\b\d{3}\)?[\s.-]\d{3}[\s.-]\d{4}\b|\+\d{8,15}\b`)},
+}
+
+// Scrub masks emails, phone numbers, credit card numbers and API tokens in s,
+// regardless of the configured mode.
+func Scrub(s string) string {
+	for _, d := range detectors {
+		s = d.pattern.ReplaceAllStringFunc(s, func(match string) string {
+			if d.valid != nil && !d.valid(match) {
+				return match
+			}
+			return "[" + d.name + "]"
+		})
+	}
+	return s
+}
+
+// Content applies the current policy to user-supplied text such as queries
+// and answers before it is logged or attached to a span.
+func Content(s string) string {
+	p := CurrentPolicy()
+	switch p.Mode {
+	case ModeOff:
+		return s
+	case ModeHash:
+		if s == "" {
+			return s
+		}
+		sum := sha256.Sum256([]byte(s))
+		return "sha256:" + hex.EncodeToString(sum[:6])
+	case ModeDrop:
+		return droppedPlaceholder
+	default:
+		scrubbed := []rune(Scrub(s))
+		if len(scrubbed) <= p.TruncateLength {
+			return string(scrubbed)
+		}
+		return string(scrubbed[:p.TruncateLength]) + "…"
+	}
+}
+
+// Attr builds a span attribute for user-supplied text under the current
+// policy.
+func Attr(key, value string) attribute.KeyValue {
+	return attribute.String(key, Content(value))
+}
+
+// Secret renders a credential for display, keeping only the token-type
+// prefix such as "xoxb-" so operators can tell which kind was configured.
+func Secret(s string) string {
+	if s == "" {
+		return ""
+	}
+	if prefix, _, ok := strings.Cut(s, "-"); ok && len(prefix) <= 4 {
+		return prefix + "-" + strings.Repeat("*", 8)
+	}
+	return strings.Repeat("*", 8)
+}
+
+func luhnValid(match string) bool {
+	sum, digits := 0, 0
+	double := false
+	for i := len(match) - 1; i >= 0; i-- {
+		c := match[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+		double = !double
+	}
+	return digits >= 13 && sum%10 == 0
+}
@@ -0,0 +1,194 @@
+// Package repl is a terminal front end for the bot, so prompts, routing
+// and rendering can be tried without Slack. Each line typed is delivered to
+// the bot as an app mention and the answer is drawn as it streams in.
+package repl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"chatrelay-bot/internal/adapter"
+	"chatrelay-bot/pkg/models"
+)
+
+const help = `Type a question to ask the bot. Commands:
+  /new          start a new thread with the next question
+  /thread <n>   continue thread n
+  /threads      list threads
+  /top          leave the thread
+  /channel <id> switch channel (channel and workspace overrides apply)
+  /settings     show the settings resolved for the channel
+  /quit         exit
+`
+
+// thread is a thread-like session: a root question and its replies.
+type thread struct {
+	channel string
+	rootTS  string
+	title   string
+}
+
+// Session reads questions and commands from a reader and hands questions
+// to the bot.
+type Session struct {
+	handler  adapter.Handler
+	resolver adapter.SettingsResolver
+	term     *Terminal
+
+	teamID  string
+	channel string
+	userID  string
+
+	seq     int
+	threads []thread
+	// current is the index of the active thread, or -1 at the top level.
+	current   int
+	newThread bool
+}
+
+func NewSession(handler adapter.Handler, resolver adapter.SettingsResolver, term *Terminal, teamID, channelID, userID string) *Session {
+	return &Session{
+		handler:  handler,
+		resolver: resolver,
+		term:     term,
+		teamID:   teamID,
+		channel:  channelID,
+		userID:   userID,
+		current:  -1,
+	}
+}
+
+// Run reads lines from in until it is exhausted, /quit is entered or ctx
+// is cancelled.
+func (s *Session) Run(ctx context.Context, in io.Reader) error {
+	s.term.Printf("%s", help)
+	lines := make(chan string)
+	errc := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		errc <- scanner.Err()
+		close(lines)
+	}()
+
+	for {
+		s.term.Printf("%s", s.prompt())
+		var line string
+		select {
+		case <-ctx.Done():
+			s.term.Printf("\n")
+			return nil
+		case l, ok := <-lines:
+			if !ok {
+				s.term.Printf("\n")
+				return <-errc
+			}
+			line = strings.TrimSpace(l)
+		}
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "/") {
+			if quit := s.command(line); quit {
+				return nil
+			}
+			continue
+		}
+		s.ask(ctx, line)
+	}
+}
+
+func (s *Session) prompt() string {
+	switch {
+	case s.newThread:
+		return fmt.Sprintf("%s (new thread) you> ", s.channel)
+	case s.current >= 0:
+		return fmt.Sprintf("%s (thread %d) you> ", s.channel, s.current+1)
+	default:
+		return fmt.Sprintf("%s you> ", s.channel)
+	}
+}
+
+func (s *Session) command(line string) (quit bool) {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case "/quit", "/exit":
+		return true
+	case "/help":
+		s.term.Printf("%s", help)
+	case "/new":
+		s.newThread = true
+		s.current = -1
+	case "/top":
+		s.newThread = false
+		s.current = -1
+	case "/threads":
+		if len(s.threads) == 0 {
+			s.term.Printf("No threads yet; start one with /new.\n")
+		}
+		for i, t := range s.threads {
+			s.term.Printf("  %d. [%s] %s\n", i+1, t.channel, t.title)
+		}
+	case "/thread":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 || n > len(s.threads) {
+			s.term.Printf("Unknown thread %q; see /threads.\n", arg)
+			break
+		}
+		s.newThread = false
+		s.current = n - 1
+		s.channel = s.threads[n-1].channel
+	case "/channel":
+		if arg == "" {
+			s.term.Printf("Usage: /channel <id>\n")
+			break
+		}
+		s.channel = arg
+		s.newThread = false
+		s.current = -1
+	case "/settings":
+		st := s.resolver.Resolve(s.teamID, s.channel)
+		s.term.Printf("  enabled=%t streaming=%t thread_only=%t max_answer_length=%d language=%q backend_url=%q\n  placeholder=%q footer=%q\n",
+			st.Enabled, st.Streaming, st.ThreadOnly, st.MaxAnswerLength, st.Language, st.BackendURL, st.Placeholder, st.Footer)
+	default:
+		s.term.Printf("Unknown command %s; see /help.\n", name)
+	}
+	return false
+}
+
+// ask delivers text to the bot as a mention and waits for the answer.
+func (s *Session) ask(ctx context.Context, text string) {
+	s.seq++
+	msg := models.IncomingMessage{
+		Platform:     "repl",
+		ID:           fmt.Sprintf("1600000000.%06d", s.seq),
+		Workspace:    s.teamID,
+		Conversation: s.channel,
+		Author:       models.Author{ID: s.userID},
+		Text:         text,
+	}
+	switch {
+	case s.newThread:
+		s.threads = append(s.threads, thread{channel: s.channel, rootTS: msg.ID, title: text})
+		s.current = len(s.threads) - 1
+		s.newThread = false
+	case s.current >= 0:
+		msg.Thread = s.threads[s.current].rootTS
+	}
+
+	settings := s.resolver.Resolve(s.teamID, s.channel)
+	if err := s.handler.HandleMessage(ctx, msg, settings); err != nil {
+		s.term.Printf("  (error: %v)\n", err)
+	}
+	s.term.Flush()
+	if !settings.Enabled {
+		s.term.Printf("  (the bot is disabled in %s)\n", s.channel)
+	}
+}
@@ -0,0 +1,141 @@
+package repl
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"chatrelay-bot/pkg/models"
+)
+
+// echoBot answers each mention in its thread, and records the mentions.
+type echoBot struct {
+	term *Terminal
+	msgs []models.IncomingMessage
+}
+
+func (b *echoBot) HandleMessage(ctx context.Context, msg models.IncomingMessage, settings models.ChannelSettings) error {
+	b.msgs = append(b.msgs, msg)
+	if !settings.Enabled {
+		return nil
+	}
+	if msg.Text == "fail" {
+		return errors.New("backend unavailable")
+	}
+	thread := msg.Thread
+	if thread == "" {
+		thread = msg.ID
+	}
+	_, err := b.term.Post(ctx, models.OutgoingMessage{Conversation: msg.Conversation, Thread: thread, Text: "You asked: " + msg.Text})
+	return err
+}
+
+// resolver disables the bot in channel COFF.
+type resolver struct{}
+
+func (resolver) Resolve(workspace, conversation string) models.ChannelSettings {
+	return models.ChannelSettings{Enabled: conversation != "COFF", Streaming: true, Placeholder: "Thinking..."}
+}
+
+func runSession(t *testing.T, input string) (*echoBot, string) {
+	t.Helper()
+	var out strings.Builder
+	term := NewTerminal(&out)
+	bot := &echoBot{term: term}
+	s := NewSession(bot, resolver{}, term, "T1", "C1", "U1")
+	if err := s.Run(context.Background(), strings.NewReader(input)); err != nil {
+		t.Fatal(err)
+	}
+	return bot, out.String()
+}
+
+func TestSessionThreads(t *testing.T) {
+	bot, out := runSession(t, strings.Join([]string{
+		"hello",
+		"/new",
+		"first thread",
+		"follow up",
+		"/top",
+		"/new",
+		"second thread",
+		"/thread 1",
+		"back in the first",
+		"/threads",
+		"/thread 3",
+	}, "\n"))
+
+	want := []struct{ text, thread string }{
+		{"hello", ""},
+		{"first thread", ""},
+		{"follow up", "1600000000.000002"},
+		{"second thread", ""},
+		{"back in the first", "1600000000.000002"},
+	}
+	if len(bot.msgs) != len(want) {
+		t.Fatalf("bot got %d mentions, want %d: %+v", len(bot.msgs), len(want), bot.msgs)
+	}
+	for i, w := range want {
+		m := bot.msgs[i]
+		if m.Text != w.text || m.Thread != w.thread || m.Platform != "repl" || m.Conversation != "C1" || m.Author.ID != "U1" {
+			t.Errorf("mention %d = %+v, want %q in thread %q", i, m, w.text, w.thread)
+		}
+	}
+	for _, line := range []string{
+		"bot> You asked: hello\n",
+		"C1 (new thread) you> ",
+		"C1 (thread 1) you> ",
+		"  1. [C1] first thread\n  2. [C1] second thread\n",
+		`Unknown thread "3"; see /threads.`,
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("output does not contain %q:\n%s", line, out)
+		}
+	}
+}
+
+func TestSessionCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		want     string
+		mentions int
+	}{
+		{name: "help", input: "/help", want: "/thread <n>   continue thread n"},
+		{name: "no threads", input: "/threads", want: "No threads yet; start one with /new."},
+		{name: "channel usage", input: "/channel", want: "Usage: /channel <id>"},
+		{name: "switch channel", input: "/channel C2\nhello", want: "C2 you> ", mentions: 1},
+		{name: "settings", input: "/channel COFF\n/settings", want: "enabled=false streaming=true"},
+		{name: "disabled channel", input: "/channel COFF\nhello", want: "(the bot is disabled in COFF)", mentions: 1},
+		{name: "error", input: "fail", want: "(error: backend unavailable)", mentions: 1},
+		{name: "unknown command", input: "/frobnicate", want: "Unknown command /frobnicate; see /help."},
+		{name: "quit stops reading", input: "/quit\nhello", want: "C1 you> "},
+		{name: "blank lines", input: "\n   \n", want: "C1 you> "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, out := runSession(t, tt.input)
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("output does not contain %q:\n%s", tt.want, out)
+			}
+			if len(bot.msgs) != tt.mentions {
+				t.Errorf("bot got %d mentions, want %d", len(bot.msgs), tt.mentions)
+			}
+		})
+	}
+}
+
+func TestSessionStopsOnCancel(t *testing.T) {
+	var out strings.Builder
+	term := NewTerminal(&out)
+	s := NewSession(&echoBot{term: term}, resolver{}, term, "T1", "C1", "U1")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// Nothing is ever typed.
+	in, w := io.Pipe()
+	defer w.Close()
+	if err := s.Run(ctx, in); err != nil {
+		t.Errorf("Run = %v, want nil on cancel", err)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package repl
+
+import "os"
+
+func terminalWidth(f *os.File) (int, bool) {
+	return 0, false
+}
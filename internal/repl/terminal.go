@@ -0,0 +1,185 @@
+package repl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"chatrelay-bot/internal/adapter"
+	"chatrelay-bot/pkg/models"
+)
+
+// Terminal is an adapter.Messenger that renders the bot's messages on a
+// terminal. Updates to the most recent message are redrawn in place, so
+// streamed answers grow where they are; updates to older messages are
+// printed again below. When the output is not a terminal only each
+// message's final text is written, once the answer is done.
+type Terminal struct {
+	out         io.Writer
+	interactive bool
+	width       func() int
+
+	mu       sync.Mutex
+	seq      int
+	messages map[string]*message
+	order    []string
+	// last is the message at the bottom of the screen and rows the number
+	// of screen rows it takes up.
+	last string
+	rows int
+}
+
+type message struct {
+	channel  string
+	threadTS string
+	text     string
+	retry    bool
+	deleted  bool
+}
+
+var _ adapter.Messenger = (*Terminal)(nil)
+
+// NewTerminal renders to out. If out is a terminal, updates are drawn in
+// place.
+func NewTerminal(out io.Writer) *Terminal {
+	t := &Terminal{out: out, messages: make(map[string]*message)}
+	if f, ok := out.(*os.File); ok {
+		if _, ok := terminalWidth(f); ok {
+			t.interactive = true
+			t.width = func() int {
+				w, _ := terminalWidth(f)
+				return w
+			}
+		}
+	}
+	return t
+}
+
+func (t *Terminal) Post(_ context.Context, msg models.OutgoingMessage) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seq++
+	ts := fmt.Sprintf("1700000000.%06d", t.seq)
+	t.messages[ts] = &message{channel: msg.Conversation, threadTS: msg.Thread, text: msg.Text, retry: len(msg.Actions) > 0}
+	t.order = append(t.order, ts)
+	if t.interactive {
+		t.draw(ts, false)
+	}
+	return ts, nil
+}
+
+func (t *Terminal) Update(_ context.Context, id string, msg models.OutgoingMessage) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	m, ok := t.messages[id]
+	if !ok || m.channel != msg.Conversation || m.deleted {
+		return fmt.Errorf("message_not_found: %s/%s", msg.Conversation, id)
+	}
+	m.text = msg.Text
+	m.retry = len(msg.Actions) > 0
+	if t.interactive {
+		t.draw(id, id == t.last)
+	}
+	return nil
+}
+
+func (t *Terminal) Delete(_ context.Context, conversation, id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	m, ok := t.messages[id]
+	if !ok || m.channel != conversation {
+		return fmt.Errorf("message_not_found: %s/%s", conversation, id)
+	}
+	m.deleted = true
+	t.print("  (bot deleted a message)\n")
+	return nil
+}
+
+func (t *Terminal) Notify(_ context.Context, conversation, userID, text string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.print(fmt.Sprintf("  (only visible to you) %s\n", text))
+	return nil
+}
+
+// Flush writes the final text of every message posted since the last
+// Flush. It is only needed when the output is not a terminal.
+func (t *Terminal) Flush() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.interactive {
+		return
+	}
+	for _, ts := range t.order {
+		if m := t.messages[ts]; !m.deleted {
+			io.WriteString(t.out, render(m))
+		}
+	}
+	t.order = nil
+}
+
+// Printf writes to the terminal below the bot's messages.
+func (t *Terminal) Printf(format string, args ...any) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.print(fmt.Sprintf(format, args...))
+}
+
+// draw writes message ts, first erasing the rows it took up when it is
+// still at the bottom of the screen.
+func (t *Terminal) draw(ts string, inPlace bool) {
+	text := render(t.messages[ts])
+	if inPlace && t.rows > 0 {
+		fmt.Fprintf(t.out, "\r\x1b[%dA\x1b[J", t.rows)
+	}
+	io.WriteString(t.out, text)
+	t.last = ts
+	t.rows = rows(text, t.width())
+}
+
+// print writes text below the last message, which can then no longer be
+// redrawn in place.
+func (t *Terminal) print(text string) {
+	io.WriteString(t.out, text)
+	t.last = ""
+	t.rows = 0
+}
+
+func render(m *message) string {
+	var b strings.Builder
+	for i, line := range strings.Split(m.text, "\n") {
+		switch {
+		case i == 0:
+			b.WriteString("bot> ")
+		case line == "":
+			b.WriteString("\n")
+			continue
+		default:
+			b.WriteString("\n     ")
+		}
+		b.WriteString(line)
+	}
+	if m.retry {
+		b.WriteString("  [Retry]")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// rows counts the screen rows text takes up at the given terminal width.
+func rows(text string, width int) int {
+	n := 0
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		cols := utf8.RuneCountInString(line)
+		if width <= 0 || cols == 0 {
+			n++
+			continue
+		}
+		n += (cols + width - 1) / width
+	}
+	return n
+}
@@ -0,0 +1,112 @@
+package repl
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"chatrelay-bot/pkg/models"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  message
+		want string
+	}{
+		{name: "single line", msg: message{text: "Hello"}, want: "bot> Hello\n"},
+		{name: "lines are indented", msg: message{text: "Hello\nthere"}, want: "bot> Hello\n     there\n"},
+		{name: "blank lines stay blank", msg: message{text: "Hello\n\nthere"}, want: "bot> Hello\n\n     there\n"},
+		{name: "retry button", msg: message{text: "Interrupted", retry: true}, want: "bot> Interrupted  [Retry]\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := render(&tt.msg); got != tt.want {
+				t.Errorf("render = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRows(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		width int
+		want  int
+	}{
+		{name: "short", text: "bot> hi\n", width: 80, want: 1},
+		{name: "wraps", text: strings.Repeat("x", 25) + "\n", width: 10, want: 3},
+		{name: "exact width", text: strings.Repeat("x", 20) + "\n", width: 10, want: 2},
+		{name: "blank line", text: "bot> a\n\n     b\n", width: 80, want: 3},
+		{name: "runes not bytes", text: strings.Repeat("é", 10) + "\n", width: 10, want: 1},
+		{name: "unknown width", text: strings.Repeat("x", 200) + "\n", width: 0, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rows(tt.text, tt.width); got != tt.want {
+				t.Errorf("rows = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTerminalWritesFinalTextWhenNotInteractive(t *testing.T) {
+	var out strings.Builder
+	term := NewTerminal(&out)
+	ctx := context.Background()
+
+	ts, _ := term.Post(ctx, models.OutgoingMessage{Conversation: "C1", Text: "Thinking..."})
+	term.Update(ctx, ts, models.OutgoingMessage{Conversation: "C1", Text: "The"})
+	term.Update(ctx, ts, models.OutgoingMessage{Conversation: "C1", Text: "The answer"})
+	gone, _ := term.Post(ctx, models.OutgoingMessage{Conversation: "C1", Text: "Thinking..."})
+	term.Delete(ctx, "C1", gone)
+	if got := out.String(); got != "  (bot deleted a message)\n" {
+		t.Errorf("before Flush wrote %q, want only the deletion notice", got)
+	}
+
+	term.Flush()
+	if got, want := out.String(), "  (bot deleted a message)\nbot> The answer\n"; got != want {
+		t.Errorf("wrote %q, want %q", got, want)
+	}
+	term.Flush()
+	if strings.Count(out.String(), "The answer") != 1 {
+		t.Errorf("second Flush wrote the answer again: %q", out.String())
+	}
+
+	if err := term.Update(ctx, ts, models.OutgoingMessage{Conversation: "C2", Text: "x"}); err == nil {
+		t.Error("Update in another channel succeeded")
+	}
+	if err := term.Update(ctx, gone, models.OutgoingMessage{Conversation: "C1", Text: "x"}); err == nil {
+		t.Error("Update of a deleted message succeeded")
+	}
+}
+
+func TestTerminalRedrawsInPlace(t *testing.T) {
+	var out strings.Builder
+	term := &Terminal{out: &out, interactive: true, width: func() int { return 20 }, messages: make(map[string]*message)}
+	ctx := context.Background()
+
+	ts, _ := term.Post(ctx, models.OutgoingMessage{Conversation: "C1", Text: "Thinking..."})
+	out.Reset()
+	term.Update(ctx, ts, models.OutgoingMessage{Conversation: "C1", Text: "A longer answer that wraps"})
+	if got, want := out.String(), "\r\x1b[1A\x1b[Jbot> A longer answer that wraps\n"; got != want {
+		t.Errorf("update of the last message wrote %q, want %q", got, want)
+	}
+
+	// The wrapped answer takes two rows, which the next redraw erases.
+	out.Reset()
+	term.Update(ctx, ts, models.OutgoingMessage{Conversation: "C1", Text: "Done"})
+	if got := out.String(); !strings.HasPrefix(got, "\r\x1b[2A\x1b[J") {
+		t.Errorf("update wrote %q, want it to erase two rows first", got)
+	}
+
+	// Once something is printed below it, the message is drawn again
+	// instead of in place.
+	term.Notify(ctx, "C1", "U1", "Slow down")
+	out.Reset()
+	term.Update(ctx, ts, models.OutgoingMessage{Conversation: "C1", Text: "Edited"})
+	if got, want := out.String(), "bot> Edited\n"; got != want {
+		t.Errorf("update after a notice wrote %q, want %q", got, want)
+	}
+}
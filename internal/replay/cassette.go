@@ -0,0 +1,179 @@
+// Package replay records chat backend traffic to cassette files and serves
+// it back, so the bot can be run against real backend output, with its
+// original timing, without calling the model.
+package replay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const cassetteVersion = 1
+
+// Interaction is one recorded request and its response.
+type Interaction struct {
+	Key        string    `json:"key"`
+	RecordedAt time.Time `json:"recorded_at"`
+	Request    Request   `json:"request"`
+	Response   Response  `json:"response"`
+}
+
+type Request struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Body   string `json:"body"`
+}
+
+type Response struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Chunks are the body as it arrived from the backend, each with its
+	// offset from the start of the request, so streams replay at their
+	// recorded pace.
+	Chunks []Chunk `json:"chunks,omitempty"`
+	// Error is set when the backend could not be reached or the body was
+	// cut off; replay ends the connection at that point.
+	Error string `json:"error,omitempty"`
+}
+
+type Chunk struct {
+	Offset time.Duration `json:"offset_ns"`
+	Data   string        `json:"data"`
+}
+
+// Body returns the whole recorded response body.
+func (r Response) Body() string {
+	var b strings.Builder
+	for _, c := range r.Chunks {
+		b.WriteString(c.Data)
+	}
+	return b.String()
+}
+
+// Cassette is a file of recorded interactions. It is safe for concurrent
+// use.
+type Cassette struct {
+	path string
+
+	mu           sync.Mutex
+	interactions []Interaction
+}
+
+type cassetteFile struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Open loads the cassette at path. A missing file is an empty cassette.
+func Open(path string) (*Cassette, error) {
+	c := &Cassette{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	var f cassetteFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	if f.Version != cassetteVersion {
+		return nil, fmt.Errorf("cassette %s has unsupported version %d", path, f.Version)
+	}
+	c.interactions = f.Interactions
+	return c, nil
+}
+
+func (c *Cassette) Interactions() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Interaction(nil), c.interactions...)
+}
+
+// Add appends an interaction and saves the cassette, so a recording
+// survives the recorder being killed.
+func (c *Cassette) Add(i Interaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interactions = append(c.interactions, i)
+	return c.save()
+}
+
+func (c *Cassette) save() error {
+	data, err := json.MarshalIndent(cassetteFile{Version: cassetteVersion, Interactions: c.interactions}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// Matcher derives the key requests are matched on.
+type Matcher struct {
+	// Ignore lists top-level JSON body fields left out of the key, e.g.
+	// user_id so a production recording matches a local user.
+	Ignore []string
+}
+
+// Key normalizes a request to its key: method and path, plus the body with
+// JSON object keys sorted, runs of whitespace in strings collapsed, and
+// ignored fields removed. Bodies that are not JSON are used as they are.
+func (m Matcher) Key(method, path string, body []byte) string {
+	normalized := bytes.TrimSpace(body)
+	var v any
+	if err := json.Unmarshal(body, &v); err == nil {
+		if obj, ok := v.(map[string]any); ok {
+			for _, field := range m.Ignore {
+				delete(obj, field)
+			}
+		}
+		// json.Marshal sorts map keys.
+		if out, err := json.Marshal(normalize(v)); err == nil {
+			normalized = out
+		}
+	}
+	sum := sha256.Sum256(normalized)
+	return fmt.Sprintf("%s %s %s", method, path, hex.EncodeToString(sum[:8]))
+}
+
+func normalize(v any) any {
+	switch v := v.(type) {
+	case string:
+		return strings.Join(strings.Fields(v), " ")
+	case map[string]any:
+		for k, item := range v {
+			v[k] = normalize(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = normalize(item)
+		}
+	}
+	return v
+}
@@ -0,0 +1,105 @@
+package replay
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatcherKey(t *testing.T) {
+	const base = `{"user_id":"U1","query":"what is up?"}`
+	tests := []struct {
+		name    string
+		ignore  []string
+		method  string
+		body    string
+		matches bool
+	}{
+		{name: "same", body: base, matches: true},
+		{name: "key order and spacing", body: "{ \"query\": \"what  is\\n up?\",\n \"user_id\": \"U1\" }", matches: true},
+		{name: "different query", body: `{"user_id":"U1","query":"what is down?"}`},
+		{name: "different user", body: `{"user_id":"U2","query":"what is up?"}`},
+		{name: "ignored user", ignore: []string{"user_id"}, body: `{"user_id":"U2","query":"what is up?"}`, matches: true},
+		{name: "different method", method: "PUT", body: base},
+		{name: "not JSON", body: "what is up?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Matcher{Ignore: tt.ignore}
+			method := tt.method
+			if method == "" {
+				method = "POST"
+			}
+			want := m.Key("POST", "/v1/chat/stream", []byte(base))
+			got := m.Key(method, "/v1/chat/stream", []byte(tt.body))
+			if (got == want) != tt.matches {
+				t.Errorf("Key = %q, base key = %q, want match %v", got, want, tt.matches)
+			}
+		})
+	}
+
+	m := Matcher{}
+	if a, b := m.Key("POST", "/", []byte(" plain \n")), m.Key("POST", "/", []byte("plain")); a != b {
+		t.Errorf("Key of a body that is not JSON depends on surrounding whitespace: %q != %q", a, b)
+	}
+}
+
+func TestCassetteRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backend.json")
+	c, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(c.Interactions()); n != 0 {
+		t.Fatalf("new cassette has %d interactions", n)
+	}
+	want := Interaction{
+		Key:     "POST /v1/chat/stream abc",
+		Request: Request{Method: "POST", Path: "/v1/chat/stream", Body: `{"query":"hi"}`},
+		Response: Response{
+			Status:  200,
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Chunks:  []Chunk{{Offset: time.Millisecond, Data: `{"full_`}, {Offset: 2 * time.Millisecond, Data: `response":"hello"}`}},
+		},
+	}
+	if err := c.Add(want); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := reopened.Interactions()
+	if len(got) != 1 || got[0].Key != want.Key || got[0].Response.Body() != `{"full_response":"hello"}` || got[0].Response.Chunks[1].Offset != 2*time.Millisecond {
+		t.Errorf("reopened cassette = %+v, want %+v", got, want)
+	}
+	if tmp, _ := filepath.Glob(path + ".tmp-*"); len(tmp) > 0 {
+		t.Errorf("temporary files left behind: %q", tmp)
+	}
+}
+
+func TestOpenRejectsBadCassettes(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "not JSON", content: "interactions:", wantErr: "failed to parse cassette"},
+		{name: "other version", content: `{"version": 2, "interactions": []}`, wantErr: "unsupported version 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "_")+".json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Open(path); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Open = %v, want an error about %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recordedHeaders are the response headers kept in cassettes.
+var recordedHeaders = []string{"Content-Type", "Retry-After"}
+
+// Recorder proxies requests to a backend and records every exchange to a
+// cassette.
+type Recorder struct {
+	backendURL string
+	cassette   *Cassette
+	matcher    Matcher
+	client     *http.Client
+}
+
+func NewRecorder(backendURL string, cassette *Cassette, matcher Matcher) *Recorder {
+	return &Recorder{
+		backendURL: strings.TrimSuffix(backendURL, "/"),
+		cassette:   cassette,
+		matcher:    matcher,
+		client:     &http.Client{},
+	}
+}
+
+func (rec *Recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	start := time.Now()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	interaction := Interaction{
+		Key:        rec.matcher.Key(r.Method, r.URL.Path, body),
+		RecordedAt: start.UTC(),
+		Request:    Request{Method: r.Method, Path: r.URL.Path, Body: string(body)},
+	}
+	defer func() {
+		if err := rec.cassette.Add(interaction); err != nil {
+			slog.ErrorContext(ctx, "Failed to save interaction", "error", err, "key", interaction.Key)
+			return
+		}
+		slog.InfoContext(ctx, "Recorded interaction", "key", interaction.Key, "status", interaction.Response.Status,
+			"chunks", len(interaction.Response.Chunks), "duration", time.Since(start))
+	}()
+
+	upstream, err := http.NewRequestWithContext(ctx, r.Method, rec.backendURL+r.URL.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		interaction.Response.Error = err.Error()
+		http.Error(w, "Failed to create backend request", http.StatusInternalServerError)
+		return
+	}
+	upstream.Header = r.Header.Clone()
+
+	res, err := rec.client.Do(upstream)
+	if err != nil {
+		slog.ErrorContext(ctx, "Backend request failed", "error", err)
+		interaction.Response.Error = err.Error()
+		panic(http.ErrAbortHandler)
+	}
+	defer res.Body.Close()
+
+	interaction.Response.Status = res.StatusCode
+	for _, name := range recordedHeaders {
+		if value := res.Header.Get(name); value != "" {
+			if interaction.Response.Headers == nil {
+				interaction.Response.Headers = make(map[string]string)
+			}
+			interaction.Response.Headers[name] = value
+			w.Header().Set(name, value)
+		}
+	}
+	w.WriteHeader(res.StatusCode)
+	flusher, _ := w.(http.Flusher)
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := res.Body.Read(buf)
+		if n > 0 {
+			interaction.Response.Chunks = append(interaction.Response.Chunks, Chunk{Offset: time.Since(start), Data: string(buf[:n])})
+			w.Write(buf[:n])
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Backend response cut off", "error", err)
+			interaction.Response.Error = err.Error()
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// Player serves recorded responses. Requests with the same key get the
+// recorded responses in order; once they run out the last one repeats.
+type Player struct {
+	matcher Matcher
+	speed   float64
+
+	mu     sync.Mutex
+	byKey  map[string][]Interaction
+	served map[string]int
+}
+
+// NewPlayer serves the interactions in cassette. speed scales the recorded
+// timing: 1 replays in real time, 2 twice as fast and 0 without delays.
+func NewPlayer(cassette *Cassette, matcher Matcher, speed float64) *Player {
+	p := &Player{
+		matcher: matcher,
+		speed:   speed,
+		byKey:   make(map[string][]Interaction),
+		served:  make(map[string]int),
+	}
+	for _, i := range cassette.Interactions() {
+		// Re-key in case the cassette was recorded with other ignored fields.
+		key := matcher.Key(i.Request.Method, i.Request.Path, []byte(i.Request.Body))
+		p.byKey[key] = append(p.byKey[key], i)
+	}
+	return p
+}
+
+// Keys reports how many distinct requests the player can answer.
+func (p *Player) Keys() int {
+	return len(p.byKey)
+}
+
+func (p *Player) next(key string) (Interaction, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	recorded := p.byKey[key]
+	if len(recorded) == 0 {
+		return Interaction{}, false
+	}
+	n := p.served[key]
+	p.served[key]++
+	return recorded[min(n, len(recorded)-1)], true
+}
+
+func (p *Player) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	start := time.Now()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	key := p.matcher.Key(r.Method, r.URL.Path, body)
+	interaction, ok := p.next(key)
+	if !ok {
+		slog.WarnContext(ctx, "No recorded interaction for request", "key", key, "body", string(body))
+		w.Header().Set("X-Replay-Miss", "true")
+		http.Error(w, fmt.Sprintf("no recorded interaction for %s", key), http.StatusNotFound)
+		return
+	}
+	slog.InfoContext(ctx, "Replaying interaction", "key", key, "status", interaction.Response.Status, "recorded_at", interaction.RecordedAt)
+
+	res := interaction.Response
+	if res.Status == 0 {
+		// The backend was never reached while recording.
+		panic(http.ErrAbortHandler)
+	}
+	for name, value := range res.Headers {
+		w.Header().Set(name, value)
+	}
+	w.WriteHeader(res.Status)
+	flusher, _ := w.(http.Flusher)
+	for _, chunk := range res.Chunks {
+		if !p.wait(ctx, start, chunk.Offset) {
+			return
+		}
+		w.Write([]byte(chunk.Data))
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if res.Error != "" {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// wait sleeps until offset, scaled by the replay speed, has passed since
+// start.
+func (p *Player) wait(ctx context.Context, start time.Time, offset time.Duration) bool {
+	if p.speed <= 0 {
+		return true
+	}
+	d := time.Until(start.Add(time.Duration(float64(offset) / p.speed)))
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,166 @@
+package replay
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// post sends body to url and returns the status, Retry-After header and
+// response body, or the error reading it.
+func post(t *testing.T, url, body string) (int, string, string, error) {
+	t.Helper()
+	resp, err := http.Post(url+"/v1/chat/stream", "application/json", strings.NewReader(body))
+	if err != nil {
+		return 0, "", "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, resp.Header.Get("Retry-After"), string(data), err
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	var calls atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "busy") {
+			w.Header().Set("Retry-After", "3")
+			http.Error(w, "overloaded", http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprintf(w, `{"full_response":"answer %d"}`, n)
+	}))
+	defer backend.Close()
+
+	path := filepath.Join(t.TempDir(), "backend.json")
+	cassette, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matcher := Matcher{Ignore: []string{"user_id"}}
+	recorder := httptest.NewServer(NewRecorder(backend.URL, cassette, matcher))
+	defer recorder.Close()
+
+	for _, body := range []string{
+		`{"user_id":"U1","query":"hello"}`,
+		`{"user_id":"U1","query":"hello"}`,
+		`{"user_id":"U1","query":"busy"}`,
+	} {
+		if _, _, _, err := post(t, recorder.URL, body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	player := NewPlayer(reopened, matcher, 0)
+	if player.Keys() != 2 {
+		t.Errorf("player has %d keys, want 2", player.Keys())
+	}
+	server := httptest.NewServer(player)
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantRetry  string
+		wantBody   string
+	}{
+		{name: "first recording", body: `{"user_id":"U9","query":"hello"}`, wantStatus: http.StatusOK, wantBody: `{"full_response":"answer 1"}`},
+		{name: "second recording", body: `{"user_id":"U9","query":"hello"}`, wantStatus: http.StatusOK, wantBody: `{"full_response":"answer 2"}`},
+		{name: "last recording repeats", body: `{"user_id":"U9","query":"hello"}`, wantStatus: http.StatusOK, wantBody: `{"full_response":"answer 2"}`},
+		{name: "error status", body: `{"query":"busy"}`, wantStatus: http.StatusTooManyRequests, wantRetry: "3", wantBody: "overloaded\n"},
+		{name: "miss", body: `{"query":"goodbye"}`, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, retry, body, err := post(t, server.URL, tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != tt.wantStatus || retry != tt.wantRetry {
+				t.Errorf("status = %d, Retry-After = %q, want %d, %q", status, retry, tt.wantStatus, tt.wantRetry)
+			}
+			if tt.wantBody != "" && body != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("backend called %d times, want only while recording", n)
+	}
+}
+
+func TestRecordCutOffResponse(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, `{"full_response":"par`)
+	}))
+	defer backend.Close()
+
+	cassette, _ := Open(filepath.Join(t.TempDir(), "backend.json"))
+	recorder := httptest.NewServer(NewRecorder(backend.URL, cassette, Matcher{}))
+	defer recorder.Close()
+	if _, _, _, err := post(t, recorder.URL, `{"query":"hello"}`); err == nil {
+		t.Error("recorder passed on a cut-off response without an error")
+	}
+
+	recorded := cassette.Interactions()
+	if len(recorded) != 1 || recorded[0].Response.Error == "" || recorded[0].Response.Body() != `{"full_response":"par` {
+		t.Fatalf("recorded = %+v, want the partial body and the error", recorded)
+	}
+
+	server := httptest.NewServer(NewPlayer(cassette, Matcher{}, 0))
+	defer server.Close()
+	if _, _, body, err := post(t, server.URL, `{"query":"hello"}`); err == nil {
+		t.Errorf("replay of a cut-off response read %q without an error", body)
+	}
+}
+
+func TestReplayTiming(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backend.json")
+	cassette, _ := Open(path)
+	cassette.Add(Interaction{
+		Request: Request{Method: "POST", Path: "/v1/chat/stream", Body: `{"query":"hello"}`},
+		Response: Response{Status: http.StatusOK, Chunks: []Chunk{
+			{Offset: 0, Data: `{"full_`},
+			{Offset: 200 * time.Millisecond, Data: `response":"hi"}`},
+		}},
+	})
+
+	tests := []struct {
+		name     string
+		speed    float64
+		min, max time.Duration
+	}{
+		{name: "real time", speed: 1, min: 200 * time.Millisecond, max: time.Second},
+		{name: "double speed", speed: 2, min: 100 * time.Millisecond, max: time.Second},
+		{name: "no delays", speed: 0, max: 200 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(NewPlayer(cassette, Matcher{}, tt.speed))
+			defer server.Close()
+			start := time.Now()
+			_, _, body, err := post(t, server.URL, `{"query":"hello"}`)
+			elapsed := time.Since(start)
+			if err != nil || body != `{"full_response":"hi"}` {
+				t.Fatalf("body = %q, %v", body, err)
+			}
+			if elapsed < tt.min || elapsed >= tt.max {
+				t.Errorf("replay took %s, want between %s and %s", elapsed, tt.min, tt.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package secrets
+
+import (
+	"context"
+	"crypto/sha256"
+	"log/slog"
+	"time"
+)
+
+// Rotator polls secret providers and calls OnChange when any of them
+// returns a different value than the last poll.
+type Rotator struct {
+	interval  time.Duration
+	providers map[string]SecretProvider
+	hashes    map[string][sha256.Size]byte
+	onChange  func(ctx context.Context, changed []string)
+}
+
+func NewRotator(interval time.Duration, onChange func(ctx context.Context, changed []string)) *Rotator {
+	return &Rotator{
+		interval:  interval,
+		providers: make(map[string]SecretProvider),
+		hashes:    make(map[string][sha256.Size]byte),
+		onChange:  onChange,
+	}
+}
+
+// Add registers the provider for the named secret along with the value it
+// was loaded with.
+func (r *Rotator) Add(name string, provider SecretProvider, current string) {
+	r.providers[name] = provider
+	r.hashes[name] = sha256.Sum256([]byte(current))
+}
+
+// Run polls until ctx is cancelled. It returns immediately when there is
+// nothing to watch or the interval is not positive.
+func (r *Rotator) Run(ctx context.Context) {
+	if len(r.providers) == 0 || r.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if changed := r.poll(ctx); len(changed) > 0 {
+				slog.InfoContext(ctx, "Secrets rotated", "secrets", changed)
+				r.onChange(ctx, changed)
+			}
+		}
+	}
+}
+
+func (r *Rotator) poll(ctx context.Context) []string {
+	var changed []string
+	for name, provider := range r.providers {
+		value, err := provider.Fetch(ctx)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to refresh secret, keeping current value", "secret", name, "provider", provider.Describe(), "error", err)
+			continue
+		}
+		hash := sha256.Sum256([]byte(value))
+		if hash != r.hashes[name] {
+			r.hashes[name] = hash
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
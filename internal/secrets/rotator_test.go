@@ -0,0 +1,119 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fake is a SecretProvider whose value the test sets.
+type fake struct {
+	mu    sync.Mutex
+	value string
+	err   error
+}
+
+func (f *fake) set(value string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.value, f.err = value, err
+}
+
+func (f *fake) Fetch(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.value, f.err
+}
+
+func (f *fake) Describe() string {
+	return "fake"
+}
+
+func TestRotatorPoll(t *testing.T) {
+	bot, app := &fake{value: "xoxb-1"}, &fake{value: "xapp-1"}
+	r := NewRotator(time.Minute, nil)
+	r.Add("SLACK_BOT_TOKEN", bot, "xoxb-1")
+	r.Add("SLACK_APP_TOKEN", app, "xapp-1")
+	ctx := context.Background()
+
+	if changed := r.poll(ctx); len(changed) != 0 {
+		t.Errorf("poll = %q, want no changes", changed)
+	}
+	bot.set("xoxb-2", nil)
+	if changed := r.poll(ctx); !slices.Equal(changed, []string{"SLACK_BOT_TOKEN"}) {
+		t.Errorf("poll = %q, want SLACK_BOT_TOKEN", changed)
+	}
+	if changed := r.poll(ctx); len(changed) != 0 {
+		t.Errorf("poll = %q, want the rotation reported once", changed)
+	}
+
+	// A failed fetch keeps the current value, so the secret is not reported
+	// as changed when the provider recovers with it.
+	app.set("", errors.New("vault sealed"))
+	if changed := r.poll(ctx); len(changed) != 0 {
+		t.Errorf("poll = %q, want no changes while the provider fails", changed)
+	}
+	app.set("xapp-1", nil)
+	if changed := r.poll(ctx); len(changed) != 0 {
+		t.Errorf("poll = %q, want no changes after the provider recovered", changed)
+	}
+}
+
+func TestRotatorRun(t *testing.T) {
+	token := &fake{value: "xoxb-1"}
+	changes := make(chan []string, 1)
+	r := NewRotator(5*time.Millisecond, func(ctx context.Context, changed []string) {
+		changes <- changed
+	})
+	r.Add("SLACK_BOT_TOKEN", token, "xoxb-1")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.Run(ctx)
+	}()
+
+	token.set("xoxb-2", nil)
+	select {
+	case changed := <-changes:
+		if !slices.Equal(changed, []string{"SLACK_BOT_TOKEN"}) {
+			t.Errorf("changed = %q, want SLACK_BOT_TOKEN", changed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("rotation was not reported")
+	}
+	cancel()
+	<-done
+}
+
+func TestRotatorRunReturnsWithNothingToDo(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		add      bool
+	}{
+		{name: "no providers", interval: time.Millisecond},
+		{name: "polling disabled", add: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRotator(tt.interval, nil)
+			if tt.add {
+				r.Add("SLACK_BOT_TOKEN", &fake{value: "xoxb-1"}, "xoxb-1")
+			}
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				r.Run(context.Background())
+			}()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("Run did not return")
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const defaultExecTimeout = 10 * time.Second
+
+// SecretProvider fetches the current value of one secret. Implementations
+// are called again on every refresh, so a rotated secret is picked up
+// without a restart.
+type SecretProvider interface {
+	Fetch(ctx context.Context) (string, error)
+	// Describe identifies the provider in logs without revealing the secret.
+	Describe() string
+}
+
+// FileProvider reads a secret from a file, such as a Docker or Kubernetes
+// secret mount. Surrounding whitespace, including the trailing newline most
+// editors add, is trimmed.
+type FileProvider struct {
+	Path string
+}
+
+func NewFileProvider(path string) *FileProvider {
+	return &FileProvider{Path: path}
+}
+
+func (p *FileProvider) Fetch(ctx context.Context) (string, error) {
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file %s: %w", p.Path, err)
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return "", fmt.Errorf("secret file %s is empty", p.Path)
+	}
+	return value, nil
+}
+
+func (p *FileProvider) Describe() string {
+	return "file " + p.Path
+}
+
+// ExecProvider runs a shell command and uses its trimmed standard output as
+// the secret, e.g. `vault kv get -field=token secret/chatrelay`.
+type ExecProvider struct {
+	Command string
+	Timeout time.Duration
+}
+
+func NewExecProvider(command string) *ExecProvider {
+	return &ExecProvider{Command: command, Timeout: defaultExecTimeout}
+}
+
+func (p *ExecProvider) Fetch(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", p.Command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Don't wait on children of the shell that outlive it and hold its
+	// output open.
+	cmd.WaitDelay = time.Second
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("secret command %q failed: %w: %s", p.Command, err, strings.TrimSpace(stderr.String()))
+	}
+	value := strings.TrimSpace(stdout.String())
+	if value == "" {
+		return "", fmt.Errorf("secret command %q produced no output", p.Command)
+	}
+	return value, nil
+}
+
+func (p *ExecProvider) Describe() string {
+	return "command " + p.Command
+}
@@ -0,0 +1,95 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content *string
+		want    string
+		// wantErr, when set, is part of the error Fetch must return.
+		wantErr string
+	}{
+		{name: "trailing newline", content: ptr("xoxb-1\n"), want: "xoxb-1"},
+		{name: "surrounding whitespace", content: ptr("  xoxb-1 \r\n"), want: "xoxb-1"},
+		{name: "empty", content: ptr(" \n"), wantErr: "is empty"},
+		{name: "missing", wantErr: "failed to read secret file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "_"))
+			if tt.content != nil {
+				if err := os.WriteFile(path, []byte(*tt.content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := NewFileProvider(path).Fetch(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Fetch = %q, %v, want an error about %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Fetch = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecProvider(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		timeout time.Duration
+		want    string
+		wantErr string
+	}{
+		{name: "output", command: "echo xoxb-1", want: "xoxb-1"},
+		{name: "shell syntax", command: "printf '%s\\n' xoxb-1 | tr x y", want: "yoyb-1"},
+		{name: "failure", command: "echo denied >&2; exit 3", wantErr: "denied"},
+		{name: "no output", command: "true", wantErr: "produced no output"},
+		{name: "timeout", command: "sleep 5", timeout: 50 * time.Millisecond, wantErr: "failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewExecProvider(tt.command)
+			if tt.timeout > 0 {
+				p.Timeout = tt.timeout
+			}
+			got, err := p.Fetch(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Fetch = %q, %v, want an error about %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Fetch = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescribeDoesNotRevealSecret(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token")
+	os.WriteFile(path, []byte("xoxb-secret"), 0o600)
+	for _, p := range []SecretProvider{NewFileProvider(path), NewExecProvider("cat " + path)} {
+		if d := p.Describe(); strings.Contains(d, "xoxb-secret") {
+			t.Errorf("Describe = %q reveals the secret", d)
+		}
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+// Server is the bot's operational HTTP server on LISTEN_PORT. Metrics, health
+// and admin routes are registered on it before Run is called.
+type Server struct {
+	mux        *http.ServeMux
+	httpServer *http.Server
+}
+
+func New(port string) *Server {
+	mux := http.NewServeMux()
+	return &Server{
+		mux: mux,
+		httpServer: &http.Server{
+			Addr:              ":" + port,
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+			IdleTimeout:       60 * time.Second,
+		},
+	}
+}
+
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+func (s *Server) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	s.mux.HandleFunc(pattern, handler)
+}
+
+// Run serves until ctx is cancelled and then shuts the server down, giving
+// open requests a few seconds to complete.
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.httpServer.Addr, err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		slog.InfoContext(ctx, "HTTP server listening", "addr", listener.Addr().String())
+		errCh <- s.httpServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return fmt.Errorf("HTTP server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	slog.InfoContext(ctx, "Shutting down HTTP server...")
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+	defer cancel()
+	if err := s.httpServer.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("HTTP server shutdown failed: %w", err)
+	}
+	slog.InfoContext(ctx, "HTTP server stopped gracefully.")
+	return nil
+}
@@ -0,0 +1,102 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"chatrelay-bot/internal/adapter"
+	"chatrelay-bot/pkg/models"
+)
+
+const platformName = "slack"
+
+var (
+	_ adapter.Adapter   = (*Client)(nil)
+	_ adapter.Formatter = (*Client)(nil)
+	_ adapter.Directory = (*Client)(nil)
+)
+
+// userMention matches a user mention, <@U123> or <@U123|name>.
+var userMention = regexp.MustCompile(`<@([A-Z0-9]+)(?:\|([^>]*))?>`)
+
+func (c *Client) Name() string {
+	return platformName
+}
+
+// Run connects over Socket Mode and delivers mentions until ctx is done.
+func (c *Client) Run(ctx context.Context) error {
+	return c.ConnectAndListen(ctx)
+}
+
+// Post sends msg to its channel, in its thread if it has one. The returned
+// ID is the message timestamp.
+func (c *Client) Post(ctx context.Context, msg models.OutgoingMessage) (string, error) {
+	return c.postMessage(ctx, msg.Conversation, msg.Thread, msg.Text, actionBlocks(msg.Text, msg.Actions))
+}
+
+func (c *Client) Update(ctx context.Context, id string, msg models.OutgoingMessage) error {
+	return c.updateMessage(ctx, msg.Conversation, id, msg.Text, actionBlocks(msg.Text, msg.Actions))
+}
+
+func (c *Client) Delete(ctx context.Context, conversation, id string) error {
+	return c.DeleteMessage(ctx, conversation, id)
+}
+
+// Notify sends an ephemeral message only userID can see.
+func (c *Client) Notify(ctx context.Context, conversation, userID, text string) error {
+	return c.SendEphemeral(ctx, conversation, userID, text)
+}
+
+// actionBlocks lays out text followed by a button per action, or returns
+// nil when there are no actions so that plain text is sent.
+func actionBlocks(text string, actions []models.Action) []slack.Block {
+	if len(actions) == 0 {
+		return nil
+	}
+	buttons := make([]slack.BlockElement, len(actions))
+	for i, action := range actions {
+		buttons[i] = slack.NewButtonBlockElement(action.ID, action.Value, slack.NewTextBlockObject(slack.PlainTextType, action.Label, false, false))
+	}
+	return []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+		slack.NewActionBlock("", buttons...),
+	}
+}
+
+// attachments describes files shared with a message. Their URLs need the
+// bot token to download.
+func attachments(files []slack.File) []models.Attachment {
+	var out []models.Attachment
+	for _, f := range files {
+		out = append(out, models.Attachment{Name: f.Name, URL: f.URLPrivate, MIMEType: f.Mimetype, Size: int64(f.Size)})
+	}
+	return out
+}
+
+// Mention returns the <@ID> markup for user.
+func (c *Client) Mention(user models.Author) string {
+	return fmt.Sprintf("<@%s>", user.ID)
+}
+
+// Time formats t so Slack shows it in the reader's own time zone.
+func (c *Client) Time(t time.Time) string {
+	if time.Until(t) < time.Hour {
+		return fmt.Sprintf("at <!date^%d^{time_secs}|%s>", t.Unix(), t.UTC().Format("15:04:05 UTC"))
+	}
+	return fmt.Sprintf("<!date^%d^{date_short_pretty} at {time}|on %s>", t.Unix(), t.UTC().Format("Jan 2 at 15:04 UTC"))
+}
+
+// mentions returns the users mentioned in text, other than the bot.
+func mentions(text, botUserID string) []models.Author {
+	var out []models.Author
+	for _, m := range userMention.FindAllStringSubmatch(text, -1) {
+		if m[1] != botUserID {
+			out = append(out, models.Author{ID: m[1], Name: m[2]})
+		}
+	}
+	return out
+}
@@ -2,12 +2,14 @@ package slack
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
 	"regexp"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/slack-go/slack"
@@ -19,54 +21,120 @@ import (
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 
+	"chatrelay-bot/internal/adapter"
+	"chatrelay-bot/internal/health"
+	"chatrelay-bot/internal/redact"
+	"chatrelay-bot/internal/telemetry"
 	"chatrelay-bot/pkg/models"
 )
 
 const tracerName = "chatrelay/internal/slack"
 
-type EventHandler interface {
-	HandleAppMention(ctx context.Context, event models.SlackEvent) error
+// RetryActionID is the action ID of the Retry button on recovered replies.
+const RetryActionID = adapter.RetryAction
+
+// defaultSettings are used for events when no SettingsResolver is set.
+var defaultSettings = models.ChannelSettings{
+	Enabled:     true,
+	Placeholder: "Thinking...",
+	Footer:      "_Powered by ChatRelay_",
+	Streaming:   true,
 }
 
 type Client struct {
-	api          *slack.Client
+	api          atomic.Pointer[slack.Client]
+	botToken     atomic.Pointer[string]
+	appToken     string
+	apiURL       string
+	logger       *log.Logger
 	socketClient *socketmode.Client
-	eventHandler EventHandler
+	handler      adapter.Handler
+	resolver     adapter.SettingsResolver
+	retryHandler adapter.RetryHandler
+	changes      adapter.ChangeHandler
 	botUserID    string
-	retryCount   int
-	retryDelay   time.Duration
+	retryPolicy  atomic.Pointer[retryPolicy]
+}
+
+type retryPolicy struct {
+	count int
+	delay time.Duration
 }
 
-func NewClient(botToken, appToken string, handler EventHandler, retryCount int, retryDelay time.Duration) *Client {
+// NewClient creates a Slack client. apiURL overrides the Slack Web API base
+// URL, e.g. to point at a local stand-in; leave it empty for slack.com.
+func NewClient(botToken, appToken string, handler adapter.Handler, retryCount int, retryDelay time.Duration, apiURL string) *Client {
 	slackGoLogger := log.New(log.Writer(), "[slack-go] ", log.LstdFlags)
 
-	api := slack.New(
-		botToken,
-		slack.OptionAppLevelToken(appToken),
-		slack.OptionLog(slackGoLogger),
-		slack.OptionHTTPClient(NewHTTPClientWithTracing()),
-	)
+	api := newWebAPI(botToken, appToken, apiURL, slackGoLogger)
 
 	socketClient := socketmode.New(
 		api,
 		socketmode.OptionLog(slackGoLogger),
 	)
 
-	return &Client{
-		api:          api,
+	health.Register(health.SlackAuth, "not authenticated")
+	health.Register(health.SlackSocket, "not connected")
+
+	c := &Client{
+		appToken:     appToken,
+		apiURL:       apiURL,
+		logger:       slackGoLogger,
 		socketClient: socketClient,
-		eventHandler: handler,
+		handler:      handler,
 		botUserID:    "",
-		retryCount:   retryCount,
-		retryDelay:   retryDelay,
 	}
+	c.api.Store(api)
+	c.botToken.Store(&botToken)
+	c.retryPolicy.Store(&retryPolicy{count: retryCount, delay: retryDelay})
+	return c
+}
+
+func newWebAPI(botToken, appToken, apiURL string, logger *log.Logger) *slack.Client {
+	options := []slack.Option{
+		slack.OptionAppLevelToken(appToken),
+		slack.OptionLog(logger),
+		slack.OptionHTTPClient(NewHTTPClientWithTracing()),
+	}
+	if apiURL != "" {
+		// slack-go appends method names directly to the base URL.
+		options = append(options, slack.OptionAPIURL(strings.TrimSuffix(apiURL, "/")+"/"))
+	}
+	return slack.New(botToken, options...)
+}
+
+// ApplyConfig updates the Slack API retry policy from a reloaded
+// configuration and switches Web API calls to a rotated bot token. The
+// Socket Mode connection keeps the app-level token it started with.
+func (c *Client) ApplyConfig(cfg *models.AppConfig) {
+	c.retryPolicy.Store(&retryPolicy{count: cfg.SlackAPIRetryCount, delay: cfg.SlackAPIRetryDelay})
+	if token := cfg.SlackBotToken; token != *c.botToken.Load() {
+		c.api.Store(newWebAPI(token, c.appToken, c.apiURL, c.logger))
+		c.botToken.Store(&token)
+		slog.Info("Slack bot token rotated", "bot_token", redact.Secret(token))
+	}
+}
+
+func (c *Client) SetSettingsResolver(r adapter.SettingsResolver) {
+	c.resolver = r
+}
+
+func (c *Client) SetRetryHandler(h adapter.RetryHandler) {
+	c.retryHandler = h
+}
+
+func (c *Client) SetMentionChangeHandler(h adapter.ChangeHandler) {
+	c.changes = h
 }
 
 func (c *Client) ConnectAndListen(ctx context.Context) error {
-	authTest, err := c.api.AuthTestContext(ctx)
+	authTest, err := c.api.Load().AuthTestContext(ctx)
+	telemetry.RecordSlackAPICall(ctx, "auth.test", slackErrorCode(err))
 	if err != nil {
+		health.Set(health.SlackAuth, false, "auth.test failed: "+slackErrorCode(err))
 		return fmt.Errorf("failed to authenticate with Slack: %w", err)
 	}
+	health.Set(health.SlackAuth, true, "authenticated as "+authTest.User)
 	c.botUserID = authTest.UserID
 	slog.InfoContext(ctx, "Slack bot connected", "bot_id", c.botUserID, "bot_name", authTest.User)
 
@@ -87,12 +155,16 @@ func (c *Client) listenForEvents(ctx context.Context) {
 		switch evt.Type {
 		case socketmode.EventTypeConnecting:
 			slog.InfoContext(eventCtx, "Connecting to Slack with Socket Mode...", "attempt", evt.Data)
+			health.Set(health.SlackSocket, false, "connecting")
 		case socketmode.EventTypeConnectionError:
 			slog.ErrorContext(eventCtx, "Connection error to Slack Socket Mode", "error", evt.Data)
+			health.Set(health.SlackSocket, false, "connection error")
 		case socketmode.EventTypeConnected:
 			slog.InfoContext(eventCtx, "Successfully connected to Slack Socket Mode.")
+			health.Set(health.SlackSocket, true, "connected")
 		case socketmode.EventTypeDisconnect:
 			slog.WarnContext(eventCtx, "Disconnected from Slack Socket Mode.")
+			health.Set(health.SlackSocket, false, "disconnected")
 		case socketmode.EventTypeEventsAPI:
 			c.socketClient.Ack(*evt.Request)
 			eventsAPIEvent, ok := evt.Data.(slackevents.EventsAPIEvent)
@@ -110,6 +182,9 @@ func (c *Client) listenForEvents(ctx context.Context) {
 			eventSpan.End()
 		case socketmode.EventTypeInteractive:
 			c.socketClient.Ack(*evt.Request)
+			if callback, ok := evt.Data.(slack.InteractionCallback); ok {
+				c.handleInteraction(eventCtx, callback)
+			}
 		default:
 			slog.InfoContext(eventCtx, "Unhandled event type", "event_type", evt.Type, "data", evt.Data)
 		}
@@ -118,42 +193,17 @@ func (c *Client) listenForEvents(ctx context.Context) {
 }
 
 func (c *Client) handleEventsAPIEvent(ctx context.Context, eventsAPIEvent slackevents.EventsAPIEvent) {
-	tracer := otel.Tracer(tracerName)
-
 	switch eventsAPIEvent.Type {
 	case slackevents.CallbackEvent:
 		innerEvent := eventsAPIEvent.InnerEvent
 		switch ev := innerEvent.Data.(type) {
 		case *slackevents.AppMentionEvent:
-			slog.InfoContext(ctx, "Received App Mention Event", "text", ev.Text, "user", ev.User, "channel", ev.Channel)
-			mentionCtx, mentionSpan := tracer.Start(ctx, "HandleAppMentionEvent",
-				trace.WithAttributes(
-					attribute.String("slack.event.type", "app_mention"),
-					attribute.String("slack.event.channel", ev.Channel),
-					attribute.String("slack.event.user", ev.User),
-				),
-			)
-			defer mentionSpan.End()
-
-			botMentionRegex := regexp.MustCompile(fmt.Sprintf("<@%s>", c.botUserID))
-			query := strings.TrimSpace(botMentionRegex.ReplaceAllString(ev.Text, ""))
-
-			slackEvent := models.SlackEvent{
-				Type:    innerEvent.Type,
-				Channel: ev.Channel,
-				User:    ev.User,
-				Text:    query,
-				Ts:      ev.TimeStamp,
-			}
-
-			if err := c.eventHandler.HandleAppMention(mentionCtx, slackEvent); err != nil {
-				slog.ErrorContext(mentionCtx, "Error handling app mention event", "error", err, "user", ev.User, "channel", ev.Channel)
-				mentionSpan.RecordError(err)
-				mentionSpan.SetStatus(codes.Error, "Error handling app mention")
-				c.SendMessage(ctx, ev.Channel, fmt.Sprintf("Oops! Something went wrong: %v", err))
-			} else {
-				mentionSpan.SetStatus(codes.Ok, "App mention handled successfully")
-			}
+			// Mentions are answered concurrently, and outlive the listener
+			// context so that a shutdown can drain them instead of aborting
+			// them mid-answer.
+			go c.handleAppMention(context.WithoutCancel(ctx), eventsAPIEvent.TeamID, ev)
+		case *slackevents.MessageEvent:
+			c.handleMessageChange(ctx, eventsAPIEvent.TeamID, ev)
 		default:
 			slog.InfoContext(ctx, "Unhandled inner event type", "type", innerEvent.Type)
 		}
@@ -162,11 +212,129 @@ func (c *Client) handleEventsAPIEvent(ctx context.Context, eventsAPIEvent slacke
 	}
 }
 
+func (c *Client) handleAppMention(ctx context.Context, teamID string, ev *slackevents.AppMentionEvent) {
+	tracer := otel.Tracer(tracerName)
+
+	slog.InfoContext(ctx, "Received App Mention Event", "text", ev.Text, "user", ev.User, "channel", ev.Channel)
+	mentionCtx, mentionSpan := tracer.Start(ctx, "HandleAppMentionEvent",
+		trace.WithAttributes(
+			attribute.String("slack.event.type", "app_mention"),
+			attribute.String("slack.event.channel", ev.Channel),
+			attribute.String("slack.event.user", ev.User),
+		),
+	)
+	defer mentionSpan.End()
+
+	botMentionRegex := regexp.MustCompile(fmt.Sprintf("<@%s>", c.botUserID))
+	query := strings.TrimSpace(botMentionRegex.ReplaceAllString(ev.Text, ""))
+
+	msg := models.IncomingMessage{
+		Platform:     platformName,
+		ID:           ev.TimeStamp,
+		Workspace:    teamID,
+		Conversation: ev.Channel,
+		Thread:       ev.ThreadTimeStamp,
+		Author:       models.Author{ID: ev.User},
+		Text:         query,
+		Mentions:     mentions(query, c.botUserID),
+	}
+
+	settings := defaultSettings
+	if c.resolver != nil {
+		settings = c.resolver.Resolve(msg.Workspace, msg.Conversation)
+	}
+
+	if err := c.handler.HandleMessage(mentionCtx, msg, settings); err != nil {
+		slog.ErrorContext(mentionCtx, "Error handling app mention event", "error", err, "user", ev.User, "channel", ev.Channel)
+		mentionSpan.RecordError(err)
+		mentionSpan.SetStatus(codes.Error, "Error handling app mention")
+		c.SendMessage(ctx, ev.Channel, fmt.Sprintf("Oops! Something went wrong: %v", err))
+	} else {
+		mentionSpan.SetStatus(codes.Ok, "App mention handled successfully")
+	}
+}
+
+// handleMessageChange passes edits and deletions of messages that mention
+// the bot to the ChangeHandler. Edits that leave the text unchanged,
+// such as link unfurls, are ignored; an edit that removes the mention is
+// treated like a deletion.
+func (c *Client) handleMessageChange(ctx context.Context, teamID string, ev *slackevents.MessageEvent) {
+	if c.changes == nil {
+		return
+	}
+	mention := fmt.Sprintf("<@%s>", c.botUserID)
+
+	switch ev.SubType {
+	case "message_changed":
+		if ev.Message == nil || ev.PreviousMessage == nil || ev.Message.Text == ev.PreviousMessage.Text {
+			return
+		}
+		if !strings.Contains(ev.PreviousMessage.Text, mention) {
+			return
+		}
+		if !strings.Contains(ev.Message.Text, mention) {
+			c.changes.HandleMessageDeleted(ctx, ev.Channel, ev.Message.Timestamp)
+			return
+		}
+		c.changes.HandleMessageEdited(ctx, models.IncomingMessage{
+			Platform:     platformName,
+			ID:           ev.Message.Timestamp,
+			Workspace:    teamID,
+			Conversation: ev.Channel,
+			Thread:       ev.Message.ThreadTimestamp,
+			Author:       models.Author{ID: ev.Message.User},
+			Text:         strings.TrimSpace(strings.ReplaceAll(ev.Message.Text, mention, "")),
+			Attachments:  attachments(ev.Message.Files),
+			Mentions:     mentions(ev.Message.Text, c.botUserID),
+		})
+	case "message_deleted":
+		ts := ev.DeletedTimeStamp
+		if ts == "" && ev.PreviousMessage != nil {
+			ts = ev.PreviousMessage.Timestamp
+		}
+		if ts != "" {
+			c.changes.HandleMessageDeleted(ctx, ev.Channel, ts)
+		}
+	}
+}
+
+func (c *Client) handleInteraction(ctx context.Context, callback slack.InteractionCallback) {
+	if callback.Type != slack.InteractionTypeBlockActions || c.retryHandler == nil {
+		return
+	}
+	for _, action := range callback.ActionCallback.BlockActions {
+		if action.ActionID != RetryActionID {
+			continue
+		}
+		go func(value string) {
+			ctx, span := otel.Tracer(tracerName).Start(context.WithoutCancel(ctx), "HandleRetryAction",
+				trace.WithAttributes(
+					attribute.String("slack.channel_id", callback.Channel.ID),
+					attribute.String("slack.user_id", callback.User.ID),
+				),
+			)
+			defer span.End()
+			if err := c.retryHandler.HandleRetry(ctx, callback.Channel.ID, callback.Message.Timestamp, callback.User.ID, value); err != nil {
+				slog.ErrorContext(ctx, "Error handling retry action", "error", err, "user", callback.User.ID, "channel", callback.Channel.ID)
+				span.RecordError(err)
+				span.SetStatus(codes.Error, "Error handling retry action")
+			}
+		}(action.Value)
+	}
+}
+
 func (c *Client) SendMessage(ctx context.Context, channelID, text string) (string, error) {
+	return c.postMessage(ctx, channelID, "", text, nil)
+}
+
+// postMessage posts text as a reply in the thread rooted at threadTS, or to
+// the channel itself when threadTS is empty.
+func (c *Client) postMessage(ctx context.Context, channelID, threadTS, text string, blocks []slack.Block) (string, error) {
 	tracer := otel.Tracer(tracerName)
 	ctx, span := tracer.Start(ctx, "SendMessageToSlack",
 		trace.WithAttributes(
 			attribute.String("slack.channel_id", channelID),
+			attribute.String("slack.thread_ts", threadTS),
 			attribute.Int("slack.message_length", len(text)),
 		),
 	)
@@ -174,8 +342,18 @@ func (c *Client) SendMessage(ctx context.Context, channelID, text string) (strin
 
 	slog.InfoContext(ctx, "Attempting to send message", "channel", channelID, "text", text)
 
-	for i := 0; i <= c.retryCount; i++ {
-		_, ts, err := c.api.PostMessageContext(ctx, channelID, slack.MsgOptionText(text, false))
+	options := []slack.MsgOption{slack.MsgOptionText(text, false)}
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	if len(blocks) > 0 {
+		options = append(options, slack.MsgOptionBlocks(blocks...))
+	}
+
+	policy := c.retryPolicy.Load()
+	for i := 0; i <= policy.count; i++ {
+		_, ts, err := c.api.Load().PostMessageContext(ctx, channelID, options...)
+		telemetry.RecordSlackAPICall(ctx, "chat.postMessage", slackErrorCode(err))
 		if err == nil {
 			slog.InfoContext(ctx, "Message sent successfully", "channel", channelID, "timestamp", ts)
 			span.SetStatus(codes.Ok, "success")
@@ -186,16 +364,23 @@ func (c *Client) SendMessage(ctx context.Context, channelID, text string) (strin
 			attribute.Int("attempt", i+1),
 			attribute.String("error", err.Error()),
 		))
-		time.Sleep(c.retryDelay)
+		if i < policy.count {
+			telemetry.RecordRetry(ctx, "slack", "chat.postMessage")
+		}
+		time.Sleep(policy.delay)
 	}
 
-	err := fmt.Errorf("failed to send message after %d retries", c.retryCount)
+	err := fmt.Errorf("failed to send message after %d retries", policy.count)
 	span.RecordError(err)
 	span.SetStatus(codes.Error, err.Error())
 	return "", err
 }
 
 func (c *Client) UpdateMessage(ctx context.Context, channelID, timestamp, text string) error {
+	return c.updateMessage(ctx, channelID, timestamp, text, nil)
+}
+
+func (c *Client) updateMessage(ctx context.Context, channelID, timestamp, text string, blocks []slack.Block) error {
 	tracer := otel.Tracer(tracerName)
 	ctx, span := tracer.Start(ctx, "UpdateMessageInSlack",
 		trace.WithAttributes(
@@ -207,8 +392,12 @@ func (c *Client) UpdateMessage(ctx context.Context, channelID, timestamp, text s
 
 	slog.InfoContext(ctx, "Attempting to update message", "channel", channelID, "timestamp", timestamp, "text", text)
 
-	for i := 0; i <= c.retryCount; i++ {
-		_, _, _, err := c.api.UpdateMessageContext(ctx, channelID, timestamp, slack.MsgOptionText(text, false))
+	policy := c.retryPolicy.Load()
+	for i := 0; i <= policy.count; i++ {
+		// Always sending blocks, even an empty list, clears any retry button
+		// left on the message.
+		_, _, _, err := c.api.Load().UpdateMessageContext(ctx, channelID, timestamp, slack.MsgOptionText(text, false), slack.MsgOptionBlocks(append([]slack.Block{}, blocks...)...))
+		telemetry.RecordSlackAPICall(ctx, "chat.update", slackErrorCode(err))
 		if err == nil {
 			slog.InfoContext(ctx, "Message updated successfully", "channel", channelID, "timestamp", timestamp)
 			span.SetStatus(codes.Ok, "success")
@@ -219,15 +408,107 @@ func (c *Client) UpdateMessage(ctx context.Context, channelID, timestamp, text s
 			attribute.Int("attempt", i+1),
 			attribute.String("error", err.Error()),
 		))
-		time.Sleep(c.retryDelay)
+		if i < policy.count {
+			telemetry.RecordRetry(ctx, "slack", "chat.update")
+		}
+		time.Sleep(policy.delay)
 	}
 
-	err := fmt.Errorf("failed to update message after %d retries", c.retryCount)
+	err := fmt.Errorf("failed to update message after %d retries", policy.count)
 	span.RecordError(err)
 	span.SetStatus(codes.Error, err.Error())
 	return err
 }
 
+// SendEphemeral posts text visible only to userID in channelID.
+func (c *Client) SendEphemeral(ctx context.Context, channelID, userID, text string) error {
+	tracer := otel.Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, "SendEphemeralToSlack",
+		trace.WithAttributes(
+			attribute.String("slack.channel_id", channelID),
+			attribute.String("slack.user_id", userID),
+		),
+	)
+	defer span.End()
+
+	_, err := c.api.Load().PostEphemeralContext(ctx, channelID, userID, slack.MsgOptionText(text, false))
+	telemetry.RecordSlackAPICall(ctx, "chat.postEphemeral", slackErrorCode(err))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to send ephemeral message")
+		return fmt.Errorf("failed to send ephemeral message: %w", err)
+	}
+	span.SetStatus(codes.Ok, "success")
+	return nil
+}
+
+// UserGroupMembers lists the user IDs in a Slack user group via
+// usergroups.users.list.
+func (c *Client) UserGroupMembers(ctx context.Context, groupID string) ([]string, error) {
+	tracer := otel.Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, "ListUserGroupMembers",
+		trace.WithAttributes(attribute.String("slack.usergroup_id", groupID)),
+	)
+	defer span.End()
+
+	members, err := c.api.Load().GetUserGroupMembersContext(ctx, groupID)
+	telemetry.RecordSlackAPICall(ctx, "usergroups.users.list", slackErrorCode(err))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to list user group members")
+		return nil, fmt.Errorf("failed to list members of user group %s: %w", groupID, err)
+	}
+	span.SetAttributes(attribute.Int("slack.usergroup_size", len(members)))
+	span.SetStatus(codes.Ok, "success")
+	return members, nil
+}
+
+func (c *Client) DeleteMessage(ctx context.Context, channelID, timestamp string) error {
+	tracer := otel.Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, "DeleteMessageInSlack",
+		trace.WithAttributes(
+			attribute.String("slack.channel_id", channelID),
+			attribute.String("slack.message_ts", timestamp),
+		),
+	)
+	defer span.End()
+
+	_, _, err := c.api.Load().DeleteMessageContext(ctx, channelID, timestamp)
+	telemetry.RecordSlackAPICall(ctx, "chat.delete", slackErrorCode(err))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to delete message")
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+	slog.InfoContext(ctx, "Message deleted", "channel", channelID, "timestamp", timestamp)
+	span.SetStatus(codes.Ok, "success")
+	return nil
+}
+
+// slackErrorCode maps an error returned by slack-go to a low-cardinality
+// label for the Slack API call metric.
+func slackErrorCode(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	var slackErr slack.SlackErrorResponse
+	if errors.As(err, &slackErr) {
+		return slackErr.Err
+	}
+	var rateLimitErr *slack.RateLimitedError
+	if errors.As(err, &rateLimitErr) {
+		return "ratelimited"
+	}
+	var statusErr slack.StatusCodeError
+	if errors.As(err, &statusErr) {
+		return fmt.Sprintf("http_%d", statusErr.Code)
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return "context_done"
+	}
+	return "transport_error"
+}
+
 func NewHTTPClientWithTracing() *http.Client {
 	return &http.Client{
 		Transport: otelhttp.NewTransport(http.DefaultTransport,
@@ -0,0 +1,246 @@
+// Package fakeslack is a local stand-in for the Slack Web API and Socket
+// Mode, good enough to run the real bot end to end without a network. It
+// serves auth.test, apps.connections.open, a Socket Mode WebSocket that
+// pushes scripted events and checks their acks, and the chat and user group
+// methods the bot calls. Posted messages are recorded in a
+// slacktest.Messenger.
+package fakeslack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"chatrelay-bot/internal/slack/slacktest"
+)
+
+const (
+	TeamID   = "T0FAKE"
+	BotID    = "B0FAKE"
+	AppID    = "A0FAKE"
+	BotUser  = "UBOTFAKE"
+	teamName = "Fake Team"
+	botName  = "chatrelay"
+)
+
+// Server is a fake Slack. Create it with NewServer and either mount it as an
+// http.Handler or call Start.
+type Server struct {
+	messenger *slacktest.Messenger
+	mux       *http.ServeMux
+	// PingInterval is how often the Socket Mode connection is pinged. The
+	// slack-go client reconnects if it sees no ping for 30 seconds.
+	PingInterval time.Duration
+
+	mu        sync.Mutex
+	seq       int
+	pending   []envelope
+	wake      chan struct{}
+	sent      map[string]time.Time
+	acked     map[string]time.Time
+	ackWait   *sync.Cond
+	conns     int
+	connected chan struct{}
+	userMsgs  map[string]userMessage
+
+	httpServer *httptest.Server
+}
+
+func NewServer() *Server {
+	s := &Server{
+		messenger:    slacktest.NewMessenger(),
+		mux:          http.NewServeMux(),
+		PingInterval: 5 * time.Second,
+		wake:         make(chan struct{}, 1),
+		sent:         make(map[string]time.Time),
+		acked:        make(map[string]time.Time),
+		connected:    make(chan struct{}),
+		userMsgs:     make(map[string]userMessage),
+	}
+	s.ackWait = sync.NewCond(&s.mu)
+
+	s.mux.HandleFunc("/api/auth.test", s.authTest)
+	s.mux.HandleFunc("/api/apps.connections.open", s.connectionsOpen)
+	s.mux.HandleFunc("/api/chat.postMessage", s.postMessage)
+	s.mux.HandleFunc("/api/chat.update", s.update)
+	s.mux.HandleFunc("/api/chat.delete", s.delete)
+	s.mux.HandleFunc("/api/chat.postEphemeral", s.postEphemeral)
+	s.mux.HandleFunc("/api/usergroups.users.list", s.userGroupMembers)
+	s.mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"ok": false, "error": "unknown_method"})
+	})
+	s.mux.HandleFunc("/socket", s.socket)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Start serves the fake on a random local port until Close.
+func (s *Server) Start() {
+	s.httpServer = httptest.NewServer(s)
+}
+
+func (s *Server) Close() {
+	if s.httpServer != nil {
+		s.httpServer.Close()
+	}
+}
+
+// URL is the base URL of a started server.
+func (s *Server) URL() string {
+	return s.httpServer.URL
+}
+
+// APIURL is the Web API base URL to configure the bot with, e.g.
+// SLACK_API_URL.
+func (s *Server) APIURL() string {
+	return s.URL() + "/api/"
+}
+
+// Messenger gives access to everything the bot has posted.
+func (s *Server) Messenger() *slacktest.Messenger {
+	return s.messenger
+}
+
+func (s *Server) authTest(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, "xoxb-") {
+		writeJSON(w, map[string]any{"ok": false, "error": "invalid_auth"})
+		return
+	}
+	writeJSON(w, map[string]any{
+		"ok":      true,
+		"url":     "https://fake.slack.com/",
+		"team":    teamName,
+		"user":    botName,
+		"team_id": TeamID,
+		"user_id": BotUser,
+		"bot_id":  BotID,
+	})
+}
+
+func (s *Server) connectionsOpen(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, "xapp-") {
+		writeJSON(w, map[string]any{"ok": false, "error": "invalid_auth"})
+		return
+	}
+	writeJSON(w, map[string]any{
+		"ok":  true,
+		"url": fmt.Sprintf("ws://%s/socket?ticket=fake", r.Host),
+	})
+}
+
+func (s *Server) postMessage(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	channel := r.PostForm.Get("channel")
+	ts, err := s.messenger.PostMessage(r.Context(), channel, r.PostForm.Get("thread_ts"), r.PostForm.Get("text"), retryValue(r.PostForm.Get("blocks")))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, map[string]any{"ok": true, "channel": channel, "ts": ts, "message": map[string]any{"text": r.PostForm.Get("text"), "ts": ts}})
+}
+
+func (s *Server) update(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	channel, ts, text := r.PostForm.Get("channel"), r.PostForm.Get("ts"), r.PostForm.Get("text")
+	var err error
+	if value := retryValue(r.PostForm.Get("blocks")); value != "" {
+		err = s.messenger.UpdateMessageWithRetry(r.Context(), channel, ts, text, value)
+	} else {
+		err = s.messenger.UpdateMessage(r.Context(), channel, ts, text)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, map[string]any{"ok": true, "channel": channel, "ts": ts, "text": text})
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	channel, ts := r.PostForm.Get("channel"), r.PostForm.Get("ts")
+	if err := s.messenger.DeleteMessage(r.Context(), channel, ts); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, map[string]any{"ok": true, "channel": channel, "ts": ts})
+}
+
+func (s *Server) postEphemeral(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	if err := s.messenger.SendEphemeral(r.Context(), r.PostForm.Get("channel"), r.PostForm.Get("user"), r.PostForm.Get("text")); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, map[string]any{"ok": true, "message_ts": fmt.Sprintf("%d.000000", time.Now().Unix())})
+}
+
+func (s *Server) userGroupMembers(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	members, err := s.messenger.UserGroupMembers(r.Context(), r.PostForm.Get("usergroup"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, map[string]any{"ok": true, "users": members})
+}
+
+// authorized checks for a token of the expected kind in the Authorization
+// header or the token form field.
+func authorized(r *http.Request, prefix string) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		r.ParseForm()
+		token = r.PostForm.Get("token")
+	}
+	return strings.HasPrefix(token, prefix)
+}
+
+// retryValue finds the value of a button in a chat.update blocks payload.
+func retryValue(blocks string) string {
+	if blocks == "" {
+		return ""
+	}
+	var parsed []struct {
+		Elements []struct {
+			Type  string `json:"type"`
+			Value string `json:"value"`
+		} `json:"elements"`
+	}
+	if err := json.Unmarshal([]byte(blocks), &parsed); err != nil {
+		return ""
+	}
+	for _, block := range parsed {
+		for _, el := range block.Elements {
+			if el.Type == "button" {
+				return el.Value
+			}
+		}
+	}
+	return ""
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("fakeslack: failed to write response", "error", err)
+	}
+}
+
+// writeError reports err the way Slack does, as ok=false with the first
+// word of the error as the error code.
+func writeError(w http.ResponseWriter, err error) {
+	code, _, _ := strings.Cut(err.Error(), ":")
+	if code == context.Canceled.Error() {
+		code = "request_cancelled"
+	}
+	writeJSON(w, map[string]any{"ok": false, "error": code})
+}
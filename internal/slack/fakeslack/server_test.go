@@ -0,0 +1,213 @@
+package fakeslack_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"chatrelay-bot/internal/slack"
+	"chatrelay-bot/internal/slack/fakeslack"
+	"chatrelay-bot/pkg/models"
+)
+
+// recorder is the bot side of the test: it passes every mention, edit,
+// deletion and retry the Slack client delivers to events.
+type recorder struct {
+	events chan string
+}
+
+func (r *recorder) HandleMessage(ctx context.Context, msg models.IncomingMessage, settings models.ChannelSettings) error {
+	r.events <- "mention " + msg.Conversation + " " + msg.Author.ID + " " + msg.Text
+	return nil
+}
+
+func (r *recorder) HandleMessageEdited(ctx context.Context, msg models.IncomingMessage) {
+	r.events <- "edit " + msg.ID + " " + msg.Text
+}
+
+func (r *recorder) HandleMessageDeleted(ctx context.Context, conversation, id string) {
+	r.events <- "delete " + id
+}
+
+func (r *recorder) HandleRetry(ctx context.Context, conversation, messageID, userID, value string) error {
+	r.events <- "retry " + messageID + " " + userID + " " + value
+	return nil
+}
+
+func (r *recorder) next(t *testing.T) string {
+	t.Helper()
+	select {
+	case e := <-r.events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("the Slack client delivered nothing")
+		return ""
+	}
+}
+
+// connect runs the real Slack client against a started fake until the test
+// ends.
+func connect(t *testing.T) (*fakeslack.Server, *slack.Client, *recorder) {
+	t.Helper()
+	fake := fakeslack.NewServer()
+	fake.Start()
+	t.Cleanup(fake.Close)
+
+	rec := &recorder{events: make(chan string, 10)}
+	client := slack.NewClient("xoxb-test", "xapp-test", rec, 0, 0, fake.APIURL())
+	client.SetMentionChangeHandler(rec)
+	client.SetRetryHandler(rec)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	waitCtx, stop := context.WithTimeout(ctx, 5*time.Second)
+	defer stop()
+	if err := fake.WaitForConnection(waitCtx); err != nil {
+		t.Fatal(err)
+	}
+	return fake, client, rec
+}
+
+func TestMentionEditAndDelete(t *testing.T) {
+	fake, _, rec := connect(t)
+
+	ts := fake.Mention("C1", "U1", "what is up?")
+	if got, want := rec.next(t), "mention C1 U1 what is up?"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if err := fake.EditMessage("C1", ts, "<@"+fakeslack.BotUser+"> what is down?"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rec.next(t), "edit "+ts+" what is down?"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if err := fake.DeleteMessage("C1", ts); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rec.next(t), "delete "+ts; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := fake.WaitForAcks(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sent, acked := fake.AckStats(); sent != 3 || acked != 3 {
+		t.Errorf("delivered %d envelopes and got %d acks, want 3 of each", sent, acked)
+	}
+	if err := fake.DeleteMessage("C1", ts); err == nil {
+		t.Error("deleting a deleted message succeeded")
+	}
+}
+
+func TestRepliesAreRecorded(t *testing.T) {
+	fake, client, rec := connect(t)
+	ctx := context.Background()
+
+	fake.Mention("C1", "U1", "hello")
+	rec.next(t)
+	retry := []models.Action{{ID: slack.RetryActionID, Label: "Retry", Value: "key-1"}}
+	id, err := client.Post(ctx, models.OutgoingMessage{Conversation: "C1", Thread: "1.0", Text: "Interrupted", Actions: retry})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Update(ctx, id, models.OutgoingMessage{Conversation: "C1", Text: "Answer"}); err != nil {
+		t.Fatal(err)
+	}
+	msg, ok := fake.Messenger().Message("C1", id)
+	if !ok {
+		t.Fatalf("reply %s was not recorded", id)
+	}
+	if msg.Text() != "Answer" || msg.ThreadTS != "1.0" || len(msg.Revisions) != 2 {
+		t.Errorf("reply = %+v, want Answer in thread 1.0 after two revisions", msg)
+	}
+
+	if err := client.Notify(ctx, "C1", "U1", "Slow down"); err != nil {
+		t.Fatal(err)
+	}
+	if e := fake.Messenger().Ephemerals(); len(e) != 1 || e[0].User != "U1" || e[0].Text != "Slow down" {
+		t.Errorf("ephemerals = %+v, want one for U1", e)
+	}
+
+	if err := client.Delete(ctx, "C1", id); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Delete(ctx, "C1", id); err == nil {
+		t.Error("deleting a deleted reply succeeded")
+	}
+}
+
+func TestPressButton(t *testing.T) {
+	fake, client, rec := connect(t)
+	ctx := context.Background()
+
+	retry := []models.Action{{ID: slack.RetryActionID, Label: "Retry", Value: "key-1"}}
+	id, err := client.Post(ctx, models.OutgoingMessage{Conversation: "C1", Text: "Interrupted", Actions: retry})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.PressButton("C1", id, "U2", slack.RetryActionID); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rec.next(t), "retry "+id+" U2 key-1"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if err := fake.PressButton("C1", "0.0", "U2", slack.RetryActionID); err == nil {
+		t.Error("pressing a button on a missing message succeeded")
+	}
+}
+
+func TestWebAPIAuthAndErrors(t *testing.T) {
+	fake := fakeslack.NewServer()
+	fake.Start()
+	defer fake.Close()
+	fake.Messenger().SetUserGroup("S1", "U1", "U2")
+
+	tests := []struct {
+		name   string
+		method string
+		form   url.Values
+		// wantError is the Slack error code, or empty for ok=true.
+		wantError string
+	}{
+		{name: "bot token", method: "auth.test", form: url.Values{"token": {"xoxb-test"}}},
+		{name: "app token for auth.test", method: "auth.test", form: url.Values{"token": {"xapp-test"}}, wantError: "invalid_auth"},
+		{name: "bot token for connections.open", method: "apps.connections.open", form: url.Values{"token": {"xoxb-test"}}, wantError: "invalid_auth"},
+		{name: "user group", method: "usergroups.users.list", form: url.Values{"usergroup": {"S1"}}},
+		{name: "update of a missing message", method: "chat.update", form: url.Values{"channel": {"C1"}, "ts": {"1.0"}, "text": {"x"}}, wantError: "message_not_found"},
+		{name: "unknown method", method: "reactions.add", wantError: "unknown_method"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(fake.APIURL()+tt.method, "application/x-www-form-urlencoded", strings.NewReader(tt.form.Encode()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			var body struct {
+				OK    bool   `json:"ok"`
+				Error string `json:"error"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.OK != (tt.wantError == "") || body.Error != tt.wantError {
+				t.Errorf("ok = %v, error = %q, want error %q", body.OK, body.Error, tt.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,335 @@
+package fakeslack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// envelope is one Socket Mode request pushed to the bot.
+type envelope struct {
+	ID      string `json:"envelope_id"`
+	Type    string `json:"type"`
+	Payload any    `json:"payload"`
+	// AcceptsResponsePayload and RetryAttempt are always sent by Slack.
+	AcceptsResponsePayload bool `json:"accepts_response_payload"`
+	RetryAttempt           int  `json:"retry_attempt"`
+}
+
+// userMessage is a message posted by a fake user, kept so edits can carry
+// the previous text the way Slack does.
+type userMessage struct {
+	channel  string
+	user     string
+	text     string
+	threadTS string
+}
+
+var upgrader = websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+
+func (s *Server) socket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Error("fakeslack: websocket upgrade failed", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	hello := map[string]any{
+		"type":            "hello",
+		"num_connections": 1,
+		"debug_info":      map[string]any{"host": "fakeslack"},
+		"connection_info": map[string]any{"app_id": AppID},
+	}
+	if err := conn.WriteJSON(hello); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.conns++
+	if s.conns == 1 {
+		close(s.connected)
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go s.readAcks(conn, done)
+
+	ping := time.NewTicker(s.PingInterval)
+	defer ping.Stop()
+	s.signal()
+	for {
+		select {
+		case <-done:
+			return
+		case <-r.Context().Done():
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(time.Second)); err != nil {
+				return
+			}
+		case <-s.wake:
+			for _, env := range s.takePending() {
+				if err := conn.WriteJSON(env); err != nil {
+					// Put it back for the next connection.
+					s.mu.Lock()
+					s.pending = append([]envelope{env}, s.pending...)
+					s.mu.Unlock()
+					return
+				}
+				s.mu.Lock()
+				s.sent[env.ID] = time.Now()
+				s.mu.Unlock()
+			}
+		}
+	}
+}
+
+// readAcks records the envelope IDs the bot acknowledges until the
+// connection closes.
+func (s *Server) readAcks(conn *websocket.Conn, done chan<- struct{}) {
+	defer close(done)
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var ack struct {
+			EnvelopeID string `json:"envelope_id"`
+		}
+		if err := json.Unmarshal(data, &ack); err != nil || ack.EnvelopeID == "" {
+			slog.Warn("fakeslack: unexpected socket message", "message", string(data))
+			continue
+		}
+		s.mu.Lock()
+		if _, ok := s.sent[ack.EnvelopeID]; !ok {
+			slog.Warn("fakeslack: ack for unknown envelope", "envelope_id", ack.EnvelopeID)
+		}
+		s.acked[ack.EnvelopeID] = time.Now()
+		s.ackWait.Broadcast()
+		s.mu.Unlock()
+	}
+}
+
+func (s *Server) takePending() []envelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := s.pending
+	s.pending = nil
+	return pending
+}
+
+func (s *Server) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// push queues a request for the bot and returns its envelope ID. Requests
+// queued before the bot connects are delivered once it does.
+func (s *Server) push(envType string, payload func(id string) any) string {
+	s.mu.Lock()
+	s.seq++
+	id := fmt.Sprintf("env-%06d", s.seq)
+	s.pending = append(s.pending, envelope{ID: id, Type: envType, Payload: payload(id)})
+	s.mu.Unlock()
+	s.signal()
+	return id
+}
+
+func (s *Server) pushEvent(event map[string]any) string {
+	return s.push("events_api", func(id string) any {
+		return map[string]any{
+			"token":      "fake-verification-token",
+			"team_id":    TeamID,
+			"api_app_id": AppID,
+			"type":       "event_callback",
+			"event_id":   "Ev" + id,
+			"event_time": time.Now().Unix(),
+			"event":      event,
+		}
+	})
+}
+
+func (s *Server) nextTS() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	return fmt.Sprintf("1600000000.%06d", s.seq)
+}
+
+// Mention posts text from userID in channelID, addressed to the bot, and
+// returns the timestamp of the user's message.
+func (s *Server) Mention(channelID, userID, text string) string {
+	return s.MentionInThread(channelID, userID, "", text)
+}
+
+// MentionInThread is Mention as a reply in the thread rooted at threadTS.
+func (s *Server) MentionInThread(channelID, userID, threadTS, text string) string {
+	ts := s.nextTS()
+	text = fmt.Sprintf("<@%s> %s", BotUser, text)
+	s.mu.Lock()
+	s.userMsgs[channelID+"/"+ts] = userMessage{channel: channelID, user: userID, text: text, threadTS: threadTS}
+	s.mu.Unlock()
+
+	event := map[string]any{
+		"type":    "app_mention",
+		"user":    userID,
+		"text":    text,
+		"ts":      ts,
+		"channel": channelID,
+		"team":    TeamID,
+	}
+	if threadTS != "" {
+		event["thread_ts"] = threadTS
+	}
+	s.pushEvent(event)
+	return ts
+}
+
+// EditMessage changes the text of a message sent with Mention, keeping the
+// bot mention unless text already addresses someone.
+func (s *Server) EditMessage(channelID, ts, text string) error {
+	s.mu.Lock()
+	msg, ok := s.userMsgs[channelID+"/"+ts]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("message_not_found: %s/%s", channelID, ts)
+	}
+	previous := msg.text
+	msg.text = text
+	s.userMsgs[channelID+"/"+ts] = msg
+	s.mu.Unlock()
+
+	s.pushEvent(map[string]any{
+		"type":     "message",
+		"subtype":  "message_changed",
+		"channel":  channelID,
+		"hidden":   true,
+		"ts":       s.nextTS(),
+		"event_ts": ts,
+		"message": map[string]any{
+			"type": "message", "user": msg.user, "text": text, "ts": ts, "thread_ts": msg.threadTS,
+		},
+		"previous_message": map[string]any{
+			"type": "message", "user": msg.user, "text": previous, "ts": ts, "thread_ts": msg.threadTS,
+		},
+	})
+	return nil
+}
+
+// DeleteMessage deletes a message sent with Mention.
+func (s *Server) DeleteMessage(channelID, ts string) error {
+	s.mu.Lock()
+	msg, ok := s.userMsgs[channelID+"/"+ts]
+	delete(s.userMsgs, channelID+"/"+ts)
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("message_not_found: %s/%s", channelID, ts)
+	}
+
+	s.pushEvent(map[string]any{
+		"type":       "message",
+		"subtype":    "message_deleted",
+		"channel":    channelID,
+		"hidden":     true,
+		"ts":         s.nextTS(),
+		"deleted_ts": ts,
+		"previous_message": map[string]any{
+			"type": "message", "user": msg.user, "text": msg.text, "ts": ts,
+		},
+	})
+	return nil
+}
+
+// PressButton clicks the button with actionID on the bot's message at ts as
+// userID, e.g. the Retry button offered after a restart.
+func (s *Server) PressButton(channelID, ts, userID, actionID string) error {
+	msg, ok := s.messenger.Message(channelID, ts)
+	if !ok {
+		return fmt.Errorf("message_not_found: %s/%s", channelID, ts)
+	}
+	s.push("interactive", func(id string) any {
+		return map[string]any{
+			"type":       "block_actions",
+			"team":       map[string]any{"id": TeamID},
+			"user":       map[string]any{"id": userID},
+			"api_app_id": AppID,
+			"channel":    map[string]any{"id": channelID},
+			"container":  map[string]any{"type": "message", "message_ts": ts, "channel_id": channelID},
+			"message":    map[string]any{"type": "message", "ts": ts, "text": msg.Text()},
+			"actions": []map[string]any{{
+				"type":      "button",
+				"action_id": actionID,
+				"block_id":  "retry",
+				"value":     msg.RetryValue,
+				"action_ts": fmt.Sprintf("%d.000000", time.Now().Unix()),
+			}},
+		}
+	})
+	return nil
+}
+
+// WaitForConnection blocks until the bot has opened a Socket Mode
+// connection.
+func (s *Server) WaitForConnection(ctx context.Context) error {
+	select {
+	case <-s.connected:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WaitForAcks blocks until every queued request has been delivered and
+// acknowledged.
+func (s *Server) WaitForAcks(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		s.mu.Lock()
+		s.ackWait.Broadcast()
+		s.mu.Unlock()
+	})
+	defer stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.pending) > 0 || len(s.unackedLocked()) > 0 {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("waiting for acks: %d pending, %d unacked: %w", len(s.pending), len(s.unackedLocked()), err)
+		}
+		s.ackWait.Wait()
+	}
+	return nil
+}
+
+// Unacked lists the envelopes delivered to the bot but not acknowledged.
+func (s *Server) Unacked() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.unackedLocked()
+}
+
+func (s *Server) unackedLocked() []string {
+	var ids []string
+	for id := range s.sent {
+		if _, ok := s.acked[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// AckStats reports how many envelopes were delivered and acknowledged.
+func (s *Server) AckStats() (sent, acked int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sent), len(s.acked)
+}
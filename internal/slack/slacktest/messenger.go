@@ -0,0 +1,268 @@
+// Package slacktest provides an in-memory stand-in for the Slack Web API so
+// the bot can be exercised without a workspace.
+package slacktest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"chatrelay-bot/internal/adapter"
+	"chatrelay-bot/pkg/models"
+)
+
+// Message is a message posted through the fake, with every text it has had
+// in order. Revisions[0] is the text it was posted with.
+type Message struct {
+	Channel    string
+	TS         string
+	ThreadTS   string
+	Revisions  []string
+	RetryValue string
+	Deleted    bool
+}
+
+// Text is the current text of the message.
+func (m Message) Text() string {
+	return m.Revisions[len(m.Revisions)-1]
+}
+
+type Ephemeral struct {
+	Channel string
+	User    string
+	Text    string
+}
+
+// Messenger is an in-memory adapter.Messenger and adapter.Directory, with
+// the Slack Web API operations fakeslack serves. It is safe for concurrent
+// use.
+type Messenger struct {
+	mu         sync.Mutex
+	seq        int
+	messages   []*Message
+	ephemerals []Ephemeral
+	groups     map[string][]string
+	failures   map[string][]error
+	// OnChange, if set, is called after every post, update or delete with
+	// a copy of the affected message.
+	OnChange func(Message)
+}
+
+var (
+	_ adapter.Messenger = (*Messenger)(nil)
+	_ adapter.Directory = (*Messenger)(nil)
+)
+
+func NewMessenger() *Messenger {
+	return &Messenger{
+		groups:   make(map[string][]string),
+		failures: make(map[string][]error),
+	}
+}
+
+// SetUserGroup sets the members returned for a user group.
+func (m *Messenger) SetUserGroup(groupID string, members ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.groups[groupID] = members
+}
+
+// FailNext makes the next call to method, such as "UpdateMessage", return
+// err instead of doing anything. Calls queue up in order.
+func (m *Messenger) FailNext(method string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures[method] = append(m.failures[method], err)
+}
+
+// Messages returns copies of every message posted so far, in posting order.
+func (m *Messenger) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]Message, len(m.messages))
+	for i, msg := range m.messages {
+		out[i] = clone(msg)
+	}
+	return out
+}
+
+// Message returns a copy of the message with the given timestamp.
+func (m *Messenger) Message(channelID, ts string) (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msg := m.find(channelID, ts)
+	if msg == nil {
+		return Message{}, false
+	}
+	return clone(msg), true
+}
+
+func (m *Messenger) Ephemerals() []Ephemeral {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.ephemerals)
+}
+
+func (m *Messenger) SendMessage(ctx context.Context, channelID, text string) (string, error) {
+	return m.PostMessage(ctx, channelID, "", text, "")
+}
+
+// PostMessage posts text in the thread rooted at threadTS, or to the
+// channel when threadTS is empty, with a Retry button carrying retryValue
+// if it is set.
+func (m *Messenger) PostMessage(ctx context.Context, channelID, threadTS, text, retryValue string) (string, error) {
+	m.mu.Lock()
+	if err := m.fail(ctx, "SendMessage"); err != nil {
+		m.mu.Unlock()
+		return "", err
+	}
+	m.seq++
+	msg := &Message{
+		Channel:    channelID,
+		TS:         fmt.Sprintf("1700000000.%06d", m.seq),
+		ThreadTS:   threadTS,
+		Revisions:  []string{text},
+		RetryValue: retryValue,
+	}
+	m.messages = append(m.messages, msg)
+	changed := clone(msg)
+	m.mu.Unlock()
+
+	m.notify(changed)
+	return changed.TS, nil
+}
+
+func (m *Messenger) UpdateMessage(ctx context.Context, channelID, timestamp, text string) error {
+	return m.update(ctx, "UpdateMessage", channelID, timestamp, text, "")
+}
+
+func (m *Messenger) UpdateMessageWithRetry(ctx context.Context, channelID, timestamp, text, retryValue string) error {
+	return m.update(ctx, "UpdateMessageWithRetry", channelID, timestamp, text, retryValue)
+}
+
+func (m *Messenger) update(ctx context.Context, method, channelID, timestamp, text, retryValue string) error {
+	m.mu.Lock()
+	if err := m.fail(ctx, method); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	msg := m.find(channelID, timestamp)
+	if msg == nil || msg.Deleted {
+		m.mu.Unlock()
+		return fmt.Errorf("message_not_found: %s/%s", channelID, timestamp)
+	}
+	msg.Revisions = append(msg.Revisions, text)
+	msg.RetryValue = retryValue
+	changed := clone(msg)
+	m.mu.Unlock()
+
+	m.notify(changed)
+	return nil
+}
+
+func (m *Messenger) DeleteMessage(ctx context.Context, channelID, timestamp string) error {
+	m.mu.Lock()
+	if err := m.fail(ctx, "DeleteMessage"); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	msg := m.find(channelID, timestamp)
+	if msg == nil || msg.Deleted {
+		m.mu.Unlock()
+		return fmt.Errorf("message_not_found: %s/%s", channelID, timestamp)
+	}
+	msg.Deleted = true
+	changed := clone(msg)
+	m.mu.Unlock()
+
+	m.notify(changed)
+	return nil
+}
+
+func (m *Messenger) SendEphemeral(ctx context.Context, channelID, userID, text string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.fail(ctx, "SendEphemeral"); err != nil {
+		return err
+	}
+	m.ephemerals = append(m.ephemerals, Ephemeral{Channel: channelID, User: userID, Text: text})
+	return nil
+}
+
+// Post records the value of the first action, if any, as RetryValue.
+func (m *Messenger) Post(ctx context.Context, msg models.OutgoingMessage) (string, error) {
+	return m.PostMessage(ctx, msg.Conversation, msg.Thread, msg.Text, retryValue(msg.Actions))
+}
+
+// Update records the value of the first action, if any, as RetryValue.
+func (m *Messenger) Update(ctx context.Context, id string, msg models.OutgoingMessage) error {
+	if value := retryValue(msg.Actions); value != "" {
+		return m.UpdateMessageWithRetry(ctx, msg.Conversation, id, msg.Text, value)
+	}
+	return m.UpdateMessage(ctx, msg.Conversation, id, msg.Text)
+}
+
+func retryValue(actions []models.Action) string {
+	if len(actions) == 0 {
+		return ""
+	}
+	return actions[0].Value
+}
+
+func (m *Messenger) Delete(ctx context.Context, conversation, id string) error {
+	return m.DeleteMessage(ctx, conversation, id)
+}
+
+func (m *Messenger) Notify(ctx context.Context, conversation, userID, text string) error {
+	return m.SendEphemeral(ctx, conversation, userID, text)
+}
+
+func (m *Messenger) UserGroupMembers(ctx context.Context, groupID string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.fail(ctx, "UserGroupMembers"); err != nil {
+		return nil, err
+	}
+	members, ok := m.groups[groupID]
+	if !ok {
+		return nil, fmt.Errorf("no_such_subteam: %s", groupID)
+	}
+	return slices.Clone(members), nil
+}
+
+// fail returns the queued failure for method, or the context error if ctx
+// is already done, like the real client would. m.mu must be held.
+func (m *Messenger) fail(ctx context.Context, method string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	queued := m.failures[method]
+	if len(queued) == 0 {
+		return nil
+	}
+	m.failures[method] = queued[1:]
+	return queued[0]
+}
+
+// find returns the message with the given timestamp. m.mu must be held.
+func (m *Messenger) find(channelID, ts string) *Message {
+	for _, msg := range m.messages {
+		if msg.Channel == channelID && msg.TS == ts {
+			return msg
+		}
+	}
+	return nil
+}
+
+func (m *Messenger) notify(msg Message) {
+	if m.OnChange != nil {
+		m.OnChange(msg)
+	}
+}
+
+func clone(msg *Message) Message {
+	c := *msg
+	c.Revisions = slices.Clone(msg.Revisions)
+	return c
+}
@@ -0,0 +1,50 @@
+package slacktest
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"chatrelay-bot/pkg/models"
+)
+
+func TestPostAndUpdateRecordEachRevisionOnce(t *testing.T) {
+	m := NewMessenger()
+	ctx := context.Background()
+	retry := []models.Action{{ID: "retry", Label: "Retry", Value: "key-1"}}
+
+	ts, err := m.Post(ctx, models.OutgoingMessage{Conversation: "C1", Thread: "1.0", Text: "Interrupted", Actions: retry})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Update(ctx, ts, models.OutgoingMessage{Conversation: "C1", Text: "Answer"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Update(ctx, ts, models.OutgoingMessage{Conversation: "C1", Text: "Interrupted again", Actions: retry}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, ok := m.Message("C1", ts)
+	if !ok {
+		t.Fatal("message not recorded")
+	}
+	if want := []string{"Interrupted", "Answer", "Interrupted again"}; !slices.Equal(msg.Revisions, want) {
+		t.Errorf("revisions = %q, want %q", msg.Revisions, want)
+	}
+	if msg.ThreadTS != "1.0" || msg.RetryValue != "key-1" {
+		t.Errorf("message = %+v, want it in thread 1.0 with retry value key-1", msg)
+	}
+}
+
+func TestUpdateClearsRetryValue(t *testing.T) {
+	m := NewMessenger()
+	ctx := context.Background()
+	ts, _ := m.Post(ctx, models.OutgoingMessage{Conversation: "C1", Text: "Interrupted", Actions: []models.Action{{Value: "key-1"}}})
+	if msg, _ := m.Message("C1", ts); msg.RetryValue != "key-1" {
+		t.Fatalf("retry value = %q after posting with a button", msg.RetryValue)
+	}
+	m.Update(ctx, ts, models.OutgoingMessage{Conversation: "C1", Text: "Answer"})
+	if msg, _ := m.Message("C1", ts); msg.RetryValue != "" {
+		t.Errorf("retry value = %q after an update without a button", msg.RetryValue)
+	}
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fileStore keeps the whole store in memory and rewrites a single JSON file
+// on every change. It suits the small amount of state a single bot instance
+// keeps.
+type fileStore struct {
+	path   string
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+// NewFileStore opens the JSON file store at path, creating it on first
+// write.
+func NewFileStore(path string) (Store, error) {
+	s := &fileStore{path: path, values: make(map[string][]byte)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read store %s: %w", path, err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse store %s: %w", path, err)
+	}
+	for key, value := range raw {
+		s.values[key] = value
+	}
+	return s, nil
+}
+
+func (s *fileStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), value...), nil
+}
+
+func (s *fileStore) Put(_ context.Context, key string, value []byte) error {
+	if !json.Valid(value) {
+		return fmt.Errorf("store: value for %s is not valid JSON", key)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = append([]byte(nil), value...)
+	return s.flush()
+}
+
+func (s *fileStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.values[key]; !ok {
+		return nil
+	}
+	delete(s.values, key)
+	return s.flush()
+}
+
+func (s *fileStore) List(_ context.Context, prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedKeys(s.values, prefix), nil
+}
+
+func (s *fileStore) Close() error {
+	return nil
+}
+
+// flush writes the store to a temporary file and renames it into place so
+// a crash never leaves a partial file behind. s.mu must be held.
+func (s *fileStore) flush() error {
+	raw := make(map[string]json.RawMessage, len(s.values))
+	for key, value := range s.values {
+		raw[key] = value
+	}
+	data, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode store: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write store: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write store: %w", err)
+	}
+	return nil
+}
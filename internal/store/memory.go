@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type memoryStore struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+// NewMemoryStore returns a Store that keeps everything in memory and loses
+// it on restart.
+func NewMemoryStore() Store {
+	return &memoryStore{values: make(map[string][]byte)}
+}
+
+func (s *memoryStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), value...), nil
+}
+
+func (s *memoryStore) Put(_ context.Context, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (s *memoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	return nil
+}
+
+func (s *memoryStore) List(_ context.Context, prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedKeys(s.values, prefix), nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+func sortedKeys(values map[string][]byte, prefix string) []string {
+	var keys []string
+	for key := range values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
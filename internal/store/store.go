@@ -0,0 +1,61 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotFound is returned by Get when a key has no value.
+var ErrNotFound = errors.New("store: key not found")
+
+// Store is the conversation store: a small key-value store for state that
+// should outlive a single event, such as quota usage. Keys are
+// slash-separated paths like "quota/U123/day/2026-10-18".
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, key string) error
+	// List returns the keys starting with prefix, in sorted order.
+	List(ctx context.Context, prefix string) ([]string, error)
+	Close() error
+}
+
+// New opens the file-backed store at path, or an in-memory store when path
+// is empty.
+func New(path string) (Store, error) {
+	if path == "" {
+		return NewMemoryStore(), nil
+	}
+	return NewFileStore(path)
+}
+
+// GetJSON reads key into v. It reports false when the key has no value.
+func GetJSON(ctx context.Context, s Store, key string, v any) (bool, error) {
+	data, err := s.Get(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+	return true, nil
+}
+
+func PutJSON(ctx context.Context, s Store, key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	return s.Put(ctx, key, data)
+}
+
+// Key joins parts into a store key.
+func Key(parts ...string) string {
+	return strings.Join(parts, "/")
+}
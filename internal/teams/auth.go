@@ -0,0 +1,325 @@
+package teams
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultJWKSURL is where the Bot Framework publishes the keys that
+	// sign its requests to the bot.
+	DefaultJWKSURL = "https://login.botframework.com/v1/.well-known/keys"
+	// DefaultTokenURL issues the bot's own tokens for the connector API.
+	DefaultTokenURL = "https://login.microsoftonline.com/botframework.com/oauth2/v2.0/token"
+	// Issuer is the issuer of the Bot Framework's tokens.
+	Issuer = "https://api.botframework.com"
+	// tokenScope is the scope of the bot's tokens for the connector API.
+	tokenScope = "https://api.botframework.com/.default"
+	// clockSkew is how far token lifetimes are stretched for clock drift.
+	clockSkew = 5 * time.Minute
+	// minKeyRefresh stops a token with an unknown key ID from making every
+	// request fetch the keys again.
+	minKeyRefresh = time.Minute
+)
+
+var errUnauthorized = errors.New("unauthorized")
+
+// keySet is the Bot Framework's JSON Web Key Set.
+type keySet struct {
+	url  string
+	http *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]signingKey
+	fetched time.Time
+}
+
+type signingKey struct {
+	key *rsa.PublicKey
+	// endorsements are the channels, such as "msteams", whose requests the
+	// key may sign. A key without endorsements may sign any.
+	endorsements []string
+}
+
+type jwk struct {
+	Kty          string   `json:"kty"`
+	Kid          string   `json:"kid"`
+	N            string   `json:"n"`
+	E            string   `json:"e"`
+	Endorsements []string `json:"endorsements"`
+}
+
+// refresh fetches the keys.
+func (s *keySet) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]signingKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		pub, err := rsaKey(k.N, k.E)
+		if err != nil {
+			return fmt.Errorf("invalid JWKS key %s: %w", k.Kid, err)
+		}
+		keys[k.Kid] = signingKey{key: pub, endorsements: k.Endorsements}
+	}
+	if len(keys) == 0 {
+		return errors.New("JWKS has no RSA keys")
+	}
+	s.mu.Lock()
+	s.keys = keys
+	s.fetched = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// key returns the key with ID kid, fetching the keys again if it is not
+// known, as the Bot Framework rotates them.
+func (s *keySet) key(ctx context.Context, kid string) (signingKey, error) {
+	s.mu.Lock()
+	k, ok := s.keys[kid]
+	stale := time.Since(s.fetched) > minKeyRefresh
+	s.mu.Unlock()
+	if ok {
+		return k, nil
+	}
+	if stale {
+		if err := s.refresh(ctx); err != nil {
+			return k, err
+		}
+		s.mu.Lock()
+		k, ok = s.keys[kid]
+		s.mu.Unlock()
+		if ok {
+			return k, nil
+		}
+	}
+	return k, fmt.Errorf("%w: unknown signing key %q", errUnauthorized, kid)
+}
+
+func rsaKey(n, e string) (*rsa.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, fmt.Errorf("modulus: %w", err)
+	}
+	eb, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, fmt.Errorf("exponent: %w", err)
+	}
+	exp := new(big.Int).SetBytes(eb)
+	if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+		return nil, errors.New("unsupported exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(nb), E: int(exp.Int64())}, nil
+}
+
+// claims are the parts of a Bot Framework token that are checked.
+type claims struct {
+	Issuer     string          `json:"iss"`
+	Audience   json.RawMessage `json:"aud"`
+	Expiry     float64         `json:"exp"`
+	NotBefore  float64         `json:"nbf"`
+	ServiceURL string          `json:"serviceurl"`
+}
+
+func (c claims) hasAudience(aud string) bool {
+	var one string
+	if json.Unmarshal(c.Audience, &one) == nil {
+		return one == aud
+	}
+	var many []string
+	return json.Unmarshal(c.Audience, &many) == nil && slices.Contains(many, aud)
+}
+
+// verify checks the Authorization header of a request carrying a, as the
+// Bot Framework requires: an RS256 token signed by a current key endorsed
+// for a's channel, issued by the Bot Framework to appID, in its lifetime,
+// and for a's service URL.
+func (s *keySet) verify(ctx context.Context, authorization, appID string, a activity) error {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return fmt.Errorf("%w: no bearer token", errUnauthorized)
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("%w: malformed token", errUnauthorized)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return fmt.Errorf("%w: malformed token header", errUnauthorized)
+	}
+	if header.Alg != "RS256" {
+		return fmt.Errorf("%w: unsupported algorithm %q", errUnauthorized, header.Alg)
+	}
+	k, err := s.key(ctx, header.Kid)
+	if err != nil {
+		return err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("%w: malformed signature", errUnauthorized)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(k.key, crypto.SHA256, digest[:], sig); err != nil {
+		return fmt.Errorf("%w: invalid signature", errUnauthorized)
+	}
+	if len(k.endorsements) > 0 && !slices.Contains(k.endorsements, a.ChannelID) {
+		return fmt.Errorf("%w: key not endorsed for channel %q", errUnauthorized, a.ChannelID)
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return fmt.Errorf("%w: malformed token claims", errUnauthorized)
+	}
+	now := time.Now()
+	switch {
+	case c.Issuer != Issuer:
+		return fmt.Errorf("%w: unexpected issuer %q", errUnauthorized, c.Issuer)
+	case !c.hasAudience(appID):
+		return fmt.Errorf("%w: token is not for this bot", errUnauthorized)
+	case c.Expiry == 0 || now.After(time.Unix(int64(c.Expiry), 0).Add(clockSkew)):
+		return fmt.Errorf("%w: token expired", errUnauthorized)
+	case c.NotBefore != 0 && now.Before(time.Unix(int64(c.NotBefore), 0).Add(-clockSkew)):
+		return fmt.Errorf("%w: token not yet valid", errUnauthorized)
+	case !sameServiceURL(c.ServiceURL, a.ServiceURL):
+		return fmt.Errorf("%w: token is for service URL %q", errUnauthorized, c.ServiceURL)
+	}
+	return nil
+}
+
+func decodeSegment(seg string, out any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func sameServiceURL(a, b string) bool {
+	return strings.TrimSuffix(a, "/") == strings.TrimSuffix(b, "/")
+}
+
+// tokenSource gets the bot's access tokens for the connector API with the
+// OAuth client credentials flow, and reuses each until shortly before it
+// expires.
+type tokenSource struct {
+	url   string
+	appID string
+	http  *http.Client
+
+	mu       sync.Mutex
+	password string
+	token    string
+	expiry   time.Time
+}
+
+// tokenError is an error response from the token endpoint. Status 400 and
+// 401 mean the app ID or password is wrong.
+type tokenError struct {
+	Status      int
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *tokenError) Error() string {
+	return fmt.Sprintf("token request failed with status %d: %s %s", e.Status, e.Code, e.Description)
+}
+
+func (t *tokenSource) get(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && time.Until(t.expiry) > clockSkew {
+		return t.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {t.appID},
+		"client_secret": {t.password},
+		"scope":         {tokenScope},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", t.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := t.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		tokErr := &tokenError{Status: resp.StatusCode}
+		json.Unmarshal(data, tokErr)
+		return "", tokErr
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(data, &tok); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if tok.AccessToken == "" {
+		return "", errors.New("token response has no access token")
+	}
+	t.token = tok.AccessToken
+	t.expiry = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return t.token, nil
+}
+
+// setPassword makes the next token request use a rotated app password. The
+// current token was issued before the rotation and stays valid until it
+// expires. It reports whether the password changed.
+func (t *tokenSource) setPassword(password string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if password == "" || password == t.password {
+		return false
+	}
+	t.password = password
+	return true
+}
+
+// invalidate drops the current token, after the connector rejected it.
+func (t *tokenSource) invalidate() {
+	t.mu.Lock()
+	t.token = ""
+	t.mu.Unlock()
+}
@@ -0,0 +1,232 @@
+package teams
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testAppID      = "app-id"
+	testServiceURL = "https://smba.example.com/teams/"
+)
+
+// issuer signs tokens as the Bot Framework would, and serves its keys.
+type issuer struct {
+	key      *rsa.PrivateKey
+	fetches  atomic.Int32
+	server   *httptest.Server
+	endorsed []string
+}
+
+func newIssuer(t *testing.T, endorsements ...string) *issuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &issuer{key: key, endorsed: endorsements}
+	iss.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		iss.fetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"keys": []jwk{{
+			Kty:          "RSA",
+			Kid:          "key-1",
+			N:            base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:            base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			Endorsements: iss.endorsed,
+		}}})
+	}))
+	t.Cleanup(iss.server.Close)
+	return iss
+}
+
+func (iss *issuer) keySet() *keySet {
+	return &keySet{url: iss.server.URL, http: iss.server.Client()}
+}
+
+// token signs claims with header, which defaults to RS256 and key-1.
+func (iss *issuer) token(t *testing.T, header, claims map[string]any) string {
+	t.Helper()
+	if header == nil {
+		header = map[string]any{"alg": "RS256", "kid": "key-1"}
+	}
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, iss.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// validClaims are claims verify accepts, issued a minute ago for an hour.
+func validClaims() map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss":        Issuer,
+		"aud":        testAppID,
+		"nbf":        now.Add(-time.Minute).Unix(),
+		"exp":        now.Add(time.Hour).Unix(),
+		"serviceurl": testServiceURL,
+	}
+}
+
+func testActivity() activity {
+	return activity{Type: "message", ChannelID: "msteams", ServiceURL: testServiceURL}
+}
+
+func TestVerify(t *testing.T) {
+	iss := newIssuer(t, "msteams")
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	with := func(key string, value any) map[string]any {
+		c := validClaims()
+		if value == nil {
+			delete(c, key)
+		} else {
+			c[key] = value
+		}
+		return c
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name          string
+		authorization string
+		activity      func(*activity)
+		// wantErr, when set, is part of the error verify must return.
+		wantErr string
+	}{
+		{name: "valid", authorization: "Bearer " + iss.token(t, nil, validClaims())},
+		{name: "audience in a list", authorization: "Bearer " + iss.token(t, nil, with("aud", []string{"other", testAppID}))},
+		{name: "service URL without trailing slash", authorization: "Bearer " + iss.token(t, nil, with("serviceurl", "https://smba.example.com/teams"))},
+		{name: "no bearer token", authorization: iss.token(t, nil, validClaims()), wantErr: "no bearer token"},
+		{name: "malformed token", authorization: "Bearer abc.def", wantErr: "malformed token"},
+		{name: "none algorithm", authorization: "Bearer " + iss.token(t, map[string]any{"alg": "none", "kid": "key-1"}, validClaims()), wantErr: "unsupported algorithm"},
+		{name: "HMAC algorithm", authorization: "Bearer " + iss.token(t, map[string]any{"alg": "HS256", "kid": "key-1"}, validClaims()), wantErr: "unsupported algorithm"},
+		{
+			name:          "signed by another key",
+			authorization: "Bearer " + (&issuer{key: other}).token(t, nil, validClaims()),
+			wantErr:       "invalid signature",
+		},
+		{
+			name:          "tampered claims",
+			authorization: "Bearer " + tamper(iss.token(t, nil, validClaims()), with("aud", "attacker")),
+			wantErr:       "invalid signature",
+		},
+		{
+			name:          "key not endorsed for channel",
+			authorization: "Bearer " + iss.token(t, nil, validClaims()),
+			activity:      func(a *activity) { a.ChannelID = "webchat" },
+			wantErr:       "not endorsed",
+		},
+		{name: "wrong issuer", authorization: "Bearer " + iss.token(t, nil, with("iss", "https://sts.example.com")), wantErr: "unexpected issuer"},
+		{name: "wrong audience", authorization: "Bearer " + iss.token(t, nil, with("aud", "other-app")), wantErr: "not for this bot"},
+		{name: "no audience", authorization: "Bearer " + iss.token(t, nil, with("aud", nil)), wantErr: "not for this bot"},
+		{name: "expired within clock skew", authorization: "Bearer " + iss.token(t, nil, with("exp", now.Add(-4*time.Minute).Unix()))},
+		{name: "expired", authorization: "Bearer " + iss.token(t, nil, with("exp", now.Add(-6*time.Minute).Unix())), wantErr: "token expired"},
+		{name: "no expiry", authorization: "Bearer " + iss.token(t, nil, with("exp", nil)), wantErr: "token expired"},
+		{name: "not yet valid within clock skew", authorization: "Bearer " + iss.token(t, nil, with("nbf", now.Add(4*time.Minute).Unix()))},
+		{name: "not yet valid", authorization: "Bearer " + iss.token(t, nil, with("nbf", now.Add(6*time.Minute).Unix())), wantErr: "not yet valid"},
+		{name: "no not before", authorization: "Bearer " + iss.token(t, nil, with("nbf", nil))},
+		{name: "service URL mismatch", authorization: "Bearer " + iss.token(t, nil, with("serviceurl", "https://attacker.example.com/")), wantErr: "service URL"},
+		{
+			name:          "activity from another service URL",
+			authorization: "Bearer " + iss.token(t, nil, validClaims()),
+			activity:      func(a *activity) { a.ServiceURL = "https://attacker.example.com/" },
+			wantErr:       "service URL",
+		},
+	}
+	keys := iss.keySet()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testActivity()
+			if tt.activity != nil {
+				tt.activity(&a)
+			}
+			err := keys.verify(context.Background(), tt.authorization, testAppID, a)
+			if tt.wantErr != "" {
+				if !errors.Is(err, errUnauthorized) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("verify = %v, want an unauthorized error for %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("verify = %v", err)
+			}
+		})
+	}
+}
+
+// tamper replaces the claims of a signed token, keeping its signature.
+func tamper(token string, claims map[string]any) string {
+	c, _ := json.Marshal(claims)
+	parts := strings.Split(token, ".")
+	return parts[0] + "." + base64.RawURLEncoding.EncodeToString(c) + "." + parts[2]
+}
+
+func TestVerifyUnendorsedKeySignsAnyChannel(t *testing.T) {
+	iss := newIssuer(t)
+	a := testActivity()
+	a.ChannelID = "webchat"
+	if err := iss.keySet().verify(context.Background(), "Bearer "+iss.token(t, nil, validClaims()), testAppID, a); err != nil {
+		t.Errorf("verify = %v", err)
+	}
+}
+
+func TestVerifyUnknownKeyRefreshesAtMostOnceAMinute(t *testing.T) {
+	iss := newIssuer(t, "msteams")
+	keys := iss.keySet()
+	ctx := context.Background()
+	unknown := "Bearer " + iss.token(t, map[string]any{"alg": "RS256", "kid": "key-2"}, validClaims())
+
+	if err := keys.verify(ctx, "Bearer "+iss.token(t, nil, validClaims()), testAppID, testActivity()); err != nil {
+		t.Fatalf("verify = %v", err)
+	}
+	if n := iss.fetches.Load(); n != 1 {
+		t.Fatalf("keys fetched %d times, want 1", n)
+	}
+
+	// The keys were just fetched, so an unknown key ID does not fetch them
+	// again, however often it is sent.
+	for range 3 {
+		if err := keys.verify(ctx, unknown, testAppID, testActivity()); !errors.Is(err, errUnauthorized) {
+			t.Fatalf("verify = %v, want an unauthorized error", err)
+		}
+	}
+	if n := iss.fetches.Load(); n != 1 {
+		t.Errorf("keys fetched %d times after unknown key IDs, want 1", n)
+	}
+
+	// Once they are a minute old, an unknown key ID fetches them again, in
+	// case the key was rotated in.
+	keys.mu.Lock()
+	keys.fetched = time.Now().Add(-minKeyRefresh - time.Second)
+	keys.mu.Unlock()
+	if err := keys.verify(ctx, unknown, testAppID, testActivity()); !errors.Is(err, errUnauthorized) {
+		t.Fatalf("verify = %v, want an unauthorized error", err)
+	}
+	if n := iss.fetches.Load(); n != 2 {
+		t.Errorf("keys fetched %d times, want 2", n)
+	}
+	if err := keys.verify(ctx, unknown, testAppID, testActivity()); !errors.Is(err, errUnauthorized) {
+		t.Fatalf("verify = %v, want an unauthorized error", err)
+	}
+	if n := iss.fetches.Load(); n != 2 {
+		t.Errorf("keys fetched %d times, want 2", n)
+	}
+}
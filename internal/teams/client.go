@@ -0,0 +1,429 @@
+// Package teams is the Microsoft Teams adapter. Teams delivers activities
+// through the Bot Framework to the bot's /api/messages endpoint, signed
+// with a JWT that is checked against the Bot Framework's JWKS. Messages
+// that @mention the bot, and every message in a personal chat, are passed
+// to the bot; answers are sent through the connector API and updated in
+// place as they stream.
+package teams
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"chatrelay-bot/internal/adapter"
+	"chatrelay-bot/internal/health"
+	"chatrelay-bot/internal/redact"
+	"chatrelay-bot/pkg/models"
+)
+
+const (
+	tracerName   = "chatrelay/internal/teams"
+	platformName = "teams"
+	// MessagesPath is where ServeHTTP is mounted on the bot's HTTP server.
+	MessagesPath = "/api/messages"
+	// DefaultServiceURL is the connector used for conversations that no
+	// activity has come from since the bot started, such as those of
+	// replies recovered after a restart.
+	DefaultServiceURL = "https://smba.trafficmanager.net/teams/"
+	// maxRecent bounds how many incoming messages are remembered for edits.
+	maxRecent = 1024
+	// maxBody bounds the size of an incoming activity.
+	maxBody = 1 << 20
+	// keyRefreshInterval is how often the JWKS is fetched again.
+	keyRefreshInterval = 24 * time.Hour
+	maxRetryDelay      = time.Minute
+)
+
+// defaultSettings are used for messages when no SettingsResolver is set.
+var defaultSettings = models.ChannelSettings{
+	Enabled:     true,
+	Placeholder: "Thinking...",
+	Footer:      "_Powered by ChatRelay_",
+	Streaming:   true,
+}
+
+// tags matches the HTML tags Teams may leave in message text.
+var tags = regexp.MustCompile(`<[^>]+>`)
+
+type Client struct {
+	appID      string
+	keys       *keySet
+	connector  *connector
+	serviceURL string
+	handler    adapter.Handler
+	resolver   adapter.SettingsResolver
+	retries    adapter.RetryHandler
+	changes    adapter.ChangeHandler
+
+	mu            sync.Mutex
+	botID         string
+	conversations map[string]conversationInfo
+	personal      map[string]string // user ID -> personal conversation ID
+	recent        map[string]string // activity ID -> text addressed to the bot
+}
+
+// conversationInfo is what replies to a conversation need from the
+// activities that came from it.
+type conversationInfo struct {
+	serviceURL string
+	tenantID   string
+	kind       string
+}
+
+var _ adapter.Adapter = (*Client)(nil)
+
+// NewClient creates a Teams client for the Bot Framework app appID that
+// passes messages addressed to the bot to handler. Empty URLs select the
+// Bot Framework's own JWKS, token endpoint and connector.
+func NewClient(appID, appPassword string, handler adapter.Handler, jwksURL, tokenURL, serviceURL string) *Client {
+	if jwksURL == "" {
+		jwksURL = DefaultJWKSURL
+	}
+	if tokenURL == "" {
+		tokenURL = DefaultTokenURL
+	}
+	if serviceURL == "" {
+		serviceURL = DefaultServiceURL
+	}
+	health.Register(health.TeamsJWKS, "keys not fetched")
+	httpClient := newHTTPClient()
+	return &Client{
+		appID: appID,
+		keys:  &keySet{url: jwksURL, http: httpClient},
+		connector: &connector{
+			tokens: &tokenSource{url: tokenURL, appID: appID, password: appPassword, http: httpClient},
+			http:   httpClient,
+		},
+		serviceURL:    serviceURL,
+		handler:       handler,
+		conversations: make(map[string]conversationInfo),
+		personal:      make(map[string]string),
+		recent:        make(map[string]string),
+	}
+}
+
+// ApplyConfig makes connector token requests use a rotated app password.
+func (c *Client) ApplyConfig(cfg *models.AppConfig) {
+	if c.connector.tokens.setPassword(cfg.TeamsAppPassword) {
+		slog.Info("Teams app password rotated", "app_password", redact.Secret(cfg.TeamsAppPassword))
+	}
+}
+
+func (c *Client) SetSettingsResolver(r adapter.SettingsResolver) {
+	c.resolver = r
+}
+
+func (c *Client) SetRetryHandler(h adapter.RetryHandler) {
+	c.retries = h
+}
+
+func (c *Client) SetMentionChangeHandler(h adapter.ChangeHandler) {
+	c.changes = h
+}
+
+func (c *Client) Name() string {
+	return platformName
+}
+
+// Run checks the app's credentials and fetches the keys that sign incoming
+// activities, then fetches them again daily until ctx is done. Activities
+// themselves arrive through ServeHTTP.
+func (c *Client) Run(ctx context.Context) error {
+	if _, err := c.connector.tokens.get(ctx); err != nil {
+		var tokErr *tokenError
+		if errors.As(err, &tokErr) && (tokErr.Status == http.StatusBadRequest || tokErr.Status == http.StatusUnauthorized) {
+			return fmt.Errorf("teams rejected the app credentials: %w", err)
+		}
+		slog.WarnContext(ctx, "Failed to get a Teams connector token, will retry when replying", "error", err)
+	}
+
+	delay := time.Second
+	for {
+		err := c.keys.refresh(ctx)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		health.Set(health.TeamsJWKS, false, err.Error())
+		slog.WarnContext(ctx, "Failed to fetch Teams signing keys, retrying", "error", err, "delay", delay)
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+	health.Set(health.TeamsJWKS, true, "keys fetched")
+	slog.InfoContext(ctx, "Fetched Teams signing keys", "url", c.keys.url)
+
+	ticker := time.NewTicker(keyRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			// Keys that fail to refresh are kept until the next attempt.
+			if err := c.keys.refresh(ctx); err != nil {
+				slog.WarnContext(ctx, "Failed to refresh Teams signing keys", "error", err)
+			}
+		}
+	}
+}
+
+// ServeHTTP receives activities from the Bot Framework. Each is
+// authenticated and acknowledged straight away, and handled in the
+// background, as an answer can take longer than the Bot Framework waits.
+func (c *Client) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	var a activity
+	if err := json.Unmarshal(data, &a); err != nil || a.Conversation == nil || a.From == nil || a.Recipient == nil {
+		http.Error(w, "Invalid activity", http.StatusBadRequest)
+		return
+	}
+	if err := c.keys.verify(r.Context(), r.Header.Get("Authorization"), c.appID, a); err != nil {
+		slog.WarnContext(r.Context(), "Rejected Teams activity", "error", err, "type", a.Type, "service_url", a.ServiceURL)
+		if errors.Is(err, errUnauthorized) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		} else {
+			http.Error(w, "Failed to verify request", http.StatusServiceUnavailable)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	c.learn(a)
+	// Activities outlive the request, so that a shutdown can drain them.
+	c.dispatch(context.WithoutCancel(r.Context()), a)
+}
+
+// learn remembers where replies to a's conversation go.
+func (c *Client) learn(a activity) {
+	base, _ := splitConversation(a.Conversation.ID)
+	info := conversationInfo{serviceURL: a.ServiceURL, tenantID: a.Conversation.TenantID, kind: a.Conversation.ConversationType}
+	if info.tenantID == "" && a.ChannelData != nil && a.ChannelData.Tenant != nil {
+		info.tenantID = a.ChannelData.Tenant.ID
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.botID = a.Recipient.ID
+	c.conversations[base] = info
+	if info.kind == conversationPersonal {
+		c.personal[a.From.ID] = base
+	}
+}
+
+func (c *Client) dispatch(ctx context.Context, a activity) {
+	switch a.Type {
+	case "message":
+		if len(a.Value) > 0 {
+			var data submitData
+			if json.Unmarshal(a.Value, &data) == nil && data.Action != "" {
+				go c.handleSubmit(ctx, a, data)
+			}
+			return
+		}
+		text, ok := c.addressed(a)
+		if !ok {
+			return
+		}
+		c.remember(a.ID, text)
+		go c.handleMessage(ctx, a, text)
+	case "messageUpdate":
+		c.handleMessageUpdate(ctx, a)
+	case "messageDelete":
+		c.handleMessageDelete(ctx, a)
+	}
+}
+
+func (c *Client) handleMessage(ctx context.Context, a activity, text string) {
+	msg := c.incoming(a, text)
+
+	tracer := otel.Tracer(tracerName)
+	slog.InfoContext(ctx, "Received Teams message", "text", text, "user", msg.Author.ID, "conversation", msg.Conversation)
+	ctx, span := tracer.Start(ctx, "HandleTeamsMessage",
+		trace.WithAttributes(
+			attribute.String("teams.conversation_id", msg.Conversation),
+			attribute.String("teams.user_id", msg.Author.ID),
+			attribute.String("teams.thread_id", msg.Thread),
+		),
+	)
+	defer span.End()
+
+	settings := defaultSettings
+	if c.resolver != nil {
+		settings = c.resolver.Resolve(msg.Workspace, msg.Conversation)
+	}
+	if err := c.handler.HandleMessage(ctx, msg, settings); err != nil {
+		slog.ErrorContext(ctx, "Error handling Teams message", "error", err, "user", msg.Author.ID, "conversation", msg.Conversation)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Error handling message")
+		c.Post(ctx, models.OutgoingMessage{Conversation: msg.Conversation, Thread: msg.Thread, Text: fmt.Sprintf("Oops! Something went wrong: %v", err)})
+		return
+	}
+	span.SetStatus(codes.Ok, "Message handled successfully")
+}
+
+// handleSubmit handles a press of a button on one of the bot's messages,
+// which Teams reports as a message replying to it.
+func (c *Client) handleSubmit(ctx context.Context, a activity, data submitData) {
+	if data.Action != adapter.RetryAction || c.retries == nil {
+		return
+	}
+	conversation, _ := splitConversation(a.Conversation.ID)
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "HandleRetryAction",
+		trace.WithAttributes(
+			attribute.String("teams.conversation_id", conversation),
+			attribute.String("teams.user_id", a.From.ID),
+		),
+	)
+	defer span.End()
+	if err := c.retries.HandleRetry(ctx, conversation, a.ReplyToID, a.From.ID, data.Value); err != nil {
+		slog.ErrorContext(ctx, "Error handling retry action", "error", err, "user", a.From.ID, "conversation", conversation)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Error handling retry action")
+	}
+}
+
+// handleMessageUpdate passes edits of messages addressed to the bot to the
+// ChangeHandler. Edits that leave the text unchanged are ignored; an edit
+// that removes the mention is treated like a deletion.
+func (c *Client) handleMessageUpdate(ctx context.Context, a activity) {
+	c.mu.Lock()
+	previous, ok := c.recent[a.ID]
+	c.mu.Unlock()
+	if !ok || c.changes == nil {
+		return
+	}
+	conversation, _ := splitConversation(a.Conversation.ID)
+	text, addressed := c.addressed(a)
+	if !addressed {
+		c.forget(a.ID)
+		c.changes.HandleMessageDeleted(ctx, conversation, a.ID)
+		return
+	}
+	if text == previous {
+		return
+	}
+	c.remember(a.ID, text)
+	c.changes.HandleMessageEdited(ctx, c.incoming(a, text))
+}
+
+func (c *Client) handleMessageDelete(ctx context.Context, a activity) {
+	c.mu.Lock()
+	_, ok := c.recent[a.ID]
+	c.mu.Unlock()
+	if !ok || c.changes == nil {
+		return
+	}
+	c.forget(a.ID)
+	conversation, _ := splitConversation(a.Conversation.ID)
+	c.changes.HandleMessageDeleted(ctx, conversation, a.ID)
+}
+
+// addressed reports whether a is for the bot, and returns its text without
+// the mention. Every message in a personal chat is for the bot; elsewhere
+// the bot must be @mentioned.
+func (c *Client) addressed(a activity) (string, bool) {
+	if a.From.ID == a.Recipient.ID {
+		return "", false
+	}
+	mentioned := a.Conversation.ConversationType == conversationPersonal
+	text := a.Text
+	for _, e := range a.Entities {
+		if e.Type == "mention" && e.Mentioned != nil && e.Mentioned.ID == a.Recipient.ID {
+			mentioned = true
+			text = strings.ReplaceAll(text, e.Text, "")
+		}
+	}
+	if !mentioned {
+		return "", false
+	}
+	text = html.UnescapeString(tags.ReplaceAllString(text, ""))
+	return strings.TrimSpace(strings.ReplaceAll(text, "\u00a0", " ")), true
+}
+
+// incoming converts a to an IncomingMessage. A message in a channel thread
+// keeps the thread's root, so that the reply can go to the same thread.
+func (c *Client) incoming(a activity, text string) models.IncomingMessage {
+	conversation, thread := splitConversation(a.Conversation.ID)
+	if thread == a.ID {
+		thread = ""
+	}
+	workspace := a.Conversation.TenantID
+	if a.ChannelData != nil && a.ChannelData.Team != nil {
+		workspace = a.ChannelData.Team.ID
+	}
+	msg := models.IncomingMessage{
+		Platform:     platformName,
+		ID:           a.ID,
+		Workspace:    workspace,
+		Conversation: conversation,
+		Thread:       thread,
+		Author:       models.Author{ID: a.From.ID, Name: a.From.Name},
+		Text:         text,
+	}
+	for _, e := range a.Entities {
+		if e.Type == "mention" && e.Mentioned != nil && e.Mentioned.ID != a.Recipient.ID {
+			msg.Mentions = append(msg.Mentions, models.Author{ID: e.Mentioned.ID, Name: e.Mentioned.Name})
+		}
+	}
+	for _, att := range a.Attachments {
+		// Teams repeats the message as HTML, and cards have no file.
+		if att.ContentURL == "" || att.ContentType == "text/html" {
+			continue
+		}
+		msg.Attachments = append(msg.Attachments, models.Attachment{
+			Name:     att.Name,
+			URL:      att.ContentURL,
+			MIMEType: att.ContentType,
+		})
+	}
+	return msg
+}
+
+// splitConversation splits a channel conversation ID into the channel and
+// the ID of the thread's root message, which Teams appends as
+// ";messageid=".
+func splitConversation(id string) (conversation, thread string) {
+	conversation, thread, _ = strings.Cut(id, ";messageid=")
+	return conversation, thread
+}
+
+func (c *Client) remember(id, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.recent) >= maxRecent {
+		clear(c.recent)
+	}
+	c.recent[id] = text
+}
+
+func (c *Client) forget(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.recent, id)
+}
@@ -0,0 +1,161 @@
+package teams
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+
+	"chatrelay-bot/internal/telemetry"
+)
+
+// maxAttempts bounds how often a request is sent when the connector
+// answers 429 or 5xx.
+const maxAttempts = 5
+
+// APIError is an error response from the Bot Framework connector API.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("teams connector error %d: %s (%s)", e.Status, e.Message, e.Code)
+}
+
+// connector calls the Bot Framework connector API at the service URL each
+// conversation came from.
+type connector struct {
+	tokens *tokenSource
+	http   *http.Client
+}
+
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: otelhttp.NewTransport(http.DefaultTransport,
+			otelhttp.WithTracerProvider(otel.GetTracerProvider()),
+			otelhttp.WithPropagators(otel.GetTextMapPropagator()),
+		),
+	}
+}
+
+// do sends body as JSON to serviceURL followed by path, built from
+// segments that are escaped in turn, and decodes the response into out, if
+// both are non-nil.
+func (c *connector) do(ctx context.Context, method, serviceURL string, segments []string, body, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+	path, route := buildPath(segments)
+	route = method + " " + route
+	endpoint := strings.TrimSuffix(serviceURL, "/") + path
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(ctx, method, endpoint, payload)
+		if err != nil {
+			telemetry.RecordTeamsAPICall(ctx, route, "transport_error")
+			return fmt.Errorf("%s: %w", route, err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		telemetry.RecordTeamsAPICall(ctx, route, strconv.Itoa(resp.StatusCode))
+
+		switch {
+		case resp.StatusCode < 300:
+			if out != nil && len(data) > 0 {
+				if err := json.Unmarshal(data, out); err != nil {
+					return fmt.Errorf("failed to decode %s response: %w", route, err)
+				}
+			}
+			return nil
+		case resp.StatusCode == http.StatusUnauthorized && attempt == 1:
+			// The token may have been revoked early; get a new one.
+			c.tokens.invalidate()
+		case (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500) && attempt < maxAttempts:
+			wait := time.Duration(attempt) * time.Second
+			if n, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && n >= 0 {
+				wait = max(time.Duration(n)*time.Second, 100*time.Millisecond)
+			}
+			slog.WarnContext(ctx, "Teams connector request will be retried", "route", route, "status", resp.StatusCode, "retry_after", wait, "attempt", attempt)
+			telemetry.RecordRetry(ctx, "teams", route)
+			if err := sleep(ctx, wait); err != nil {
+				return err
+			}
+		default:
+			var body struct {
+				Error struct {
+					Code    string `json:"code"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			json.Unmarshal(data, &body)
+			apiErr := &APIError{Status: resp.StatusCode, Code: body.Error.Code, Message: body.Error.Message}
+			if apiErr.Message == "" {
+				apiErr.Message = http.StatusText(resp.StatusCode)
+			}
+			return apiErr
+		}
+	}
+}
+
+func (c *connector) send(ctx context.Context, method, endpoint string, payload []byte) (*http.Response, error) {
+	token, err := c.tokens.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.http.Do(req)
+}
+
+// buildPath joins segments into a path, escaping each, and returns it with
+// a route for metrics in which the IDs following "conversations" and
+// "activities" are replaced by ":id".
+func buildPath(segments []string) (path, route string) {
+	var p, r strings.Builder
+	for i, seg := range segments {
+		p.WriteString("/" + url.PathEscape(seg))
+		if i > 0 && (segments[i-1] == "conversations" || segments[i-1] == "activities") {
+			seg = ":id"
+		}
+		r.WriteString("/" + seg)
+	}
+	return p.String(), r.String()
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,202 @@
+package faketeams
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WaitForBot blocks until the bot has fetched the keys, which it does when
+// it starts.
+func (s *Server) WaitForBot(ctx context.Context) error {
+	select {
+	case <-s.keysServed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Mention posts text from userID as a new message in channelID that
+// @mentions the bot, and returns the ID of the message.
+func (s *Server) Mention(channelID, userID, text string) (string, error) {
+	return s.MentionInThread(channelID, userID, "", text)
+}
+
+// MentionInThread is Mention as a reply in the thread rooted at rootID.
+func (s *Server) MentionInThread(channelID, userID, rootID, text string) (string, error) {
+	s.mu.Lock()
+	id := s.nextID()
+	if rootID == "" {
+		rootID = id
+	}
+	conversation := channelID + ";messageid=" + rootID
+	s.users[id] = userMessage{Conversation: conversation, Kind: "channel", User: userID, Text: text}
+	s.mu.Unlock()
+	return id, s.deliver(s.message("message", id, conversation, "channel", userID, text))
+}
+
+// PersonalMessage sends text from userID to the bot in their personal chat
+// and returns the ID of the message.
+func (s *Server) PersonalMessage(userID, text string) (string, error) {
+	s.mu.Lock()
+	id := s.nextID()
+	conversation := personalConversation(userID)
+	s.users[id] = userMessage{Conversation: conversation, Kind: "personal", User: userID, Text: text}
+	s.mu.Unlock()
+	return id, s.deliver(s.message("message", id, conversation, "personal", userID, text))
+}
+
+// EditMessage changes the text of a message sent with Mention or
+// PersonalMessage. The bot mention is kept unless mention is false.
+func (s *Server) EditMessage(id, text string, mention bool) error {
+	s.mu.Lock()
+	m, ok := s.users[id]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("no user message %s", id)
+	}
+	m.Text = text
+	s.users[id] = m
+	s.mu.Unlock()
+
+	a := s.message("messageUpdate", id, m.Conversation, m.Kind, m.User, text)
+	if !mention {
+		a["text"] = text
+		delete(a, "entities")
+	}
+	a["channelData"].(map[string]any)["eventType"] = "editMessage"
+	return s.deliver(a)
+}
+
+// DeleteMessage deletes a message sent with Mention or PersonalMessage.
+func (s *Server) DeleteMessage(id string) error {
+	s.mu.Lock()
+	m, ok := s.users[id]
+	delete(s.users, id)
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no user message %s", id)
+	}
+	a := s.message("messageDelete", id, m.Conversation, m.Kind, m.User, "")
+	delete(a, "text")
+	delete(a, "entities")
+	a["channelData"].(map[string]any)["eventType"] = "softDeleteMessage"
+	return s.deliver(a)
+}
+
+// PressButton presses the first button of the bot's activity id as
+// userID. Teams reports the press as a message replying to the activity,
+// with the button's data as its value.
+func (s *Server) PressButton(id, userID string) error {
+	s.mu.Lock()
+	a := s.find(id)
+	if a == nil || a.Deleted || len(a.Buttons) == 0 {
+		s.mu.Unlock()
+		return fmt.Errorf("no activity %s with a button to press", id)
+	}
+	b := a.Buttons[0]
+	kind := "channel"
+	if strings.HasPrefix(a.Conversation, "a:") {
+		kind = "personal"
+	}
+	pressID, conversation := s.nextID(), a.Conversation
+	s.mu.Unlock()
+
+	press := s.message("message", pressID, conversation, kind, userID, "")
+	delete(press, "text")
+	delete(press, "entities")
+	press["replyToId"] = id
+	press["value"] = b.Data
+	return s.deliver(press)
+}
+
+// message builds an activity from userID. In channels, text gets an
+// @mention of the bot in front.
+func (s *Server) message(typ, id, conversation, kind, userID, text string) map[string]any {
+	a := map[string]any{
+		"type":       typ,
+		"id":         id,
+		"timestamp":  time.Now().UTC().Format(time.RFC3339Nano),
+		"serviceUrl": s.ServiceURL(),
+		"channelId":  ChannelID,
+		"from":       map[string]any{"id": userID, "name": "User " + userID[max(0, len(userID)-4):], "aadObjectId": "aad-" + userID},
+		"conversation": map[string]any{
+			"id":               conversation,
+			"conversationType": kind,
+			"tenantId":         TenantID,
+			"isGroup":          kind != "personal",
+		},
+		"recipient":   map[string]any{"id": "28:" + AppID, "name": BotName},
+		"text":        text,
+		"textFormat":  "plain",
+		"channelData": map[string]any{"tenant": map[string]any{"id": TenantID}},
+	}
+	if kind == "channel" {
+		channelID, _, _ := strings.Cut(conversation, ";")
+		a["channelData"] = map[string]any{
+			"tenant":  map[string]any{"id": TenantID},
+			"team":    map[string]any{"id": TeamID},
+			"channel": map[string]any{"id": channelID},
+		}
+		mention := "<at>" + BotName + "</at>"
+		a["text"] = mention + " " + text
+		a["entities"] = []map[string]any{{
+			"type":      "mention",
+			"text":      mention,
+			"mentioned": map[string]any{"id": "28:" + AppID, "name": BotName},
+		}}
+	}
+	return a
+}
+
+// deliver posts a to the bot with a signed Bot Framework token.
+func (s *Server) deliver(a map[string]any) error {
+	data, _ := json.Marshal(a)
+	req, err := http.NewRequest("POST", s.botURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.sign())
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to deliver activity to %s: %w", s.botURL, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("bot answered %s", resp.Status)
+	}
+	return nil
+}
+
+// sign returns an RS256 token as the Bot Framework issues for requests to
+// the bot.
+func (s *Server) sign() string {
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": KeyID, "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":        Issuer,
+		"aud":        AppID,
+		"nbf":        now.Add(-time.Minute).Unix(),
+		"exp":        now.Add(time.Hour).Unix(),
+		"serviceurl": s.ServiceURL(),
+	})
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(fmt.Sprintf("faketeams: failed to sign token: %v", err))
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
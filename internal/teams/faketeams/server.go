@@ -0,0 +1,401 @@
+// Package faketeams is a local stand-in for Microsoft Teams and the Bot
+// Framework, good enough to run the real bot end to end without them. It
+// serves a JWKS, a token endpoint and the connector API routes the bot
+// calls, and delivers scripted messages, edits, deletions and button
+// presses to the bot's /api/messages endpoint, signed with its own key the
+// way the Bot Framework signs them.
+package faketeams
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AppID       = "00000000-0000-0000-0000-0000c4a7b075"
+	AppPassword = "fake-app-password"
+	BotName     = "ChatRelay"
+	TenantID    = "fake-tenant"
+	TeamID      = "19:fake-team@thread.tacv2"
+	// Channel and User are used by the cmd/faketeams script when a step
+	// leaves them out.
+	Channel = "19:general@thread.tacv2"
+	User    = "29:fake-user"
+
+	// KeyID is the ID of the key that signs activities.
+	KeyID = "fake-key"
+	// Issuer is the Bot Framework's token issuer.
+	Issuer = "https://api.botframework.com"
+	// ChannelID is the Bot Framework channel ID of Teams, which the key is
+	// endorsed for.
+	ChannelID = "msteams"
+)
+
+// Activity is a message the bot sent, with every text it has had in order.
+// Revisions[0] is the text it was sent with. Conversation includes the
+// ";messageid=" suffix of a channel thread.
+type Activity struct {
+	ID           string
+	Conversation string
+	ReplyToID    string
+	Revisions    []string
+	Buttons      []Button
+	Deleted      bool
+}
+
+// Text is the current text of the activity.
+func (a Activity) Text() string {
+	return a.Revisions[len(a.Revisions)-1]
+}
+
+// Button is an Action.Submit button on an Adaptive Card.
+type Button struct {
+	Title string
+	Data  map[string]any
+}
+
+// Stats counts the requests the bot made that are not activities.
+type Stats struct {
+	KeyFetches    int
+	TokensIssued  int
+	Conversations int
+}
+
+// userMessage is a message by a fake user, kept so edits and deletions can
+// refer to it.
+type userMessage struct {
+	Conversation string
+	Kind         string
+	User         string
+	Text         string
+}
+
+// Server is a fake Teams. Create it with NewServer and either mount it as
+// an http.Handler, calling SetURL with its address, or call Start.
+type Server struct {
+	mux    *http.ServeMux
+	key    *rsa.PrivateKey
+	botURL string
+
+	mu         sync.Mutex
+	url        string
+	seq        int64
+	activities []*Activity
+	users      map[string]userMessage
+	tokens     map[string]bool
+	stats      Stats
+	keysServed chan struct{}
+
+	httpServer *httptest.Server
+}
+
+// NewServer creates a fake that delivers activities to the bot's
+// /api/messages endpoint at botURL.
+func NewServer(botURL string) *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(fmt.Sprintf("faketeams: failed to generate key: %v", err))
+	}
+	s := &Server{
+		mux:        http.NewServeMux(),
+		key:        key,
+		botURL:     botURL,
+		seq:        time.Now().UnixMilli(),
+		users:      make(map[string]userMessage),
+		tokens:     make(map[string]bool),
+		keysServed: make(chan struct{}),
+	}
+	s.mux.HandleFunc("GET /keys", s.keys)
+	s.mux.HandleFunc("POST /oauth2/token", s.token)
+	s.mux.HandleFunc("POST /connector/v3/conversations", s.authorized(s.createConversation))
+	s.mux.HandleFunc("POST /connector/v3/conversations/{conversation}/activities", s.authorized(s.sendActivity))
+	s.mux.HandleFunc("POST /connector/v3/conversations/{conversation}/activities/{activity}", s.authorized(s.sendActivity))
+	s.mux.HandleFunc("PUT /connector/v3/conversations/{conversation}/activities/{activity}", s.authorized(s.updateActivity))
+	s.mux.HandleFunc("DELETE /connector/v3/conversations/{conversation}/activities/{activity}", s.authorized(s.deleteActivity))
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Start serves the fake on a random local port until Close.
+func (s *Server) Start() {
+	s.httpServer = httptest.NewServer(s)
+	s.SetURL(s.httpServer.URL)
+}
+
+func (s *Server) Close() {
+	if s.httpServer != nil {
+		s.httpServer.Close()
+	}
+}
+
+// SetURL sets the address the fake is served at, which activities name as
+// their service URL.
+func (s *Server) SetURL(url string) {
+	s.mu.Lock()
+	s.url = strings.TrimSuffix(url, "/")
+	s.mu.Unlock()
+}
+
+// JWKSURL is what to configure the bot with as TEAMS_JWKS_URL.
+func (s *Server) JWKSURL() string {
+	return s.baseURL() + "/keys"
+}
+
+// TokenURL is what to configure the bot with as TEAMS_TOKEN_URL.
+func (s *Server) TokenURL() string {
+	return s.baseURL() + "/oauth2/token"
+}
+
+// ServiceURL is the connector URL activities come from, and what to
+// configure the bot with as TEAMS_SERVICE_URL.
+func (s *Server) ServiceURL() string {
+	return s.baseURL() + "/connector/"
+}
+
+func (s *Server) baseURL() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.url
+}
+
+// Activities returns copies of every activity the bot has sent, in order.
+func (s *Server) Activities() []Activity {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Activity, len(s.activities))
+	for i, a := range s.activities {
+		out[i] = clone(a)
+	}
+	return out
+}
+
+// Activity returns a copy of the bot's activity with the given ID.
+func (s *Server) Activity(id string) (Activity, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.find(id)
+	if a == nil {
+		return Activity{}, false
+	}
+	return clone(a), true
+}
+
+func (s *Server) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+func (s *Server) keys(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.stats.KeyFetches++
+	select {
+	case <-s.keysServed:
+	default:
+		close(s.keysServed)
+	}
+	s.mu.Unlock()
+	pub := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]any{{
+		"kty":          "RSA",
+		"use":          "sig",
+		"kid":          KeyID,
+		"n":            base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":            base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		"endorsements": []string{ChannelID},
+	}}})
+}
+
+// token issues a connector token for the client credentials of AppID.
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "client_credentials" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+	if r.PostForm.Get("client_id") != AppID || r.PostForm.Get("client_secret") != AppPassword {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client", "error_description": "Invalid client secret provided."})
+		return
+	}
+	s.mu.Lock()
+	s.stats.TokensIssued++
+	token := fmt.Sprintf("fake-token-%d", s.stats.TokensIssued)
+	s.tokens[token] = true
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"token_type": "Bearer", "expires_in": 3600, "access_token": token})
+}
+
+// authorized rejects connector requests without a token from the token
+// endpoint.
+func (s *Server) authorized(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		s.mu.Lock()
+		ok := s.tokens[token]
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Unauthorized", "Authorization has been denied for this request.")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// createConversation starts a personal chat between the bot and a user.
+func (s *Server) createConversation(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Members []struct {
+			ID string `json:"id"`
+		} `json:"members"`
+		IsGroup bool `json:"isGroup"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Members) != 1 || req.IsGroup {
+		writeError(w, http.StatusBadRequest, "BadArgument", "Expected one member of a personal conversation.")
+		return
+	}
+	s.mu.Lock()
+	s.stats.Conversations++
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, map[string]string{"id": personalConversation(req.Members[0].ID)})
+}
+
+// outgoing is the part of an activity from the bot that the fake keeps.
+type outgoing struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	Attachments []struct {
+		ContentType string `json:"contentType"`
+		Content     struct {
+			Actions []struct {
+				Type  string         `json:"type"`
+				Title string         `json:"title"`
+				Data  map[string]any `json:"data"`
+			} `json:"actions"`
+		} `json:"content"`
+	} `json:"attachments"`
+}
+
+func (o outgoing) buttons() []Button {
+	var out []Button
+	for _, att := range o.Attachments {
+		for _, a := range att.Content.Actions {
+			if a.Type == "Action.Submit" {
+				out = append(out, Button{Title: a.Title, Data: a.Data})
+			}
+		}
+	}
+	return out
+}
+
+func decodeActivity(w http.ResponseWriter, r *http.Request) (outgoing, bool) {
+	var o outgoing
+	if err := json.NewDecoder(r.Body).Decode(&o); err != nil || o.Type != "message" {
+		writeError(w, http.StatusBadRequest, "BadArgument", "Invalid message activity.")
+		return o, false
+	}
+	return o, true
+}
+
+func (s *Server) sendActivity(w http.ResponseWriter, r *http.Request) {
+	o, ok := decodeActivity(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	a := &Activity{
+		ID:           s.nextID(),
+		Conversation: r.PathValue("conversation"),
+		ReplyToID:    r.PathValue("activity"),
+		Revisions:    []string{o.Text},
+		Buttons:      o.buttons(),
+	}
+	s.activities = append(s.activities, a)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, map[string]string{"id": a.ID})
+}
+
+func (s *Server) updateActivity(w http.ResponseWriter, r *http.Request) {
+	o, ok := decodeActivity(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.find(r.PathValue("activity"))
+	if a == nil || a.Deleted {
+		writeError(w, http.StatusNotFound, "ActivityNotFoundInConversation", "Activity not found.")
+		return
+	}
+	a.Revisions = append(a.Revisions, o.Text)
+	a.Buttons = o.buttons()
+	writeJSON(w, http.StatusOK, map[string]string{"id": a.ID})
+}
+
+func (s *Server) deleteActivity(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.find(r.PathValue("activity"))
+	if a == nil || a.Deleted {
+		writeError(w, http.StatusNotFound, "ActivityNotFoundInConversation", "Activity not found.")
+		return
+	}
+	a.Deleted = true
+	w.WriteHeader(http.StatusOK)
+}
+
+// nextID returns a new activity ID. Teams uses millisecond timestamps.
+// s.mu must be held.
+func (s *Server) nextID() string {
+	s.seq++
+	return fmt.Sprint(s.seq)
+}
+
+// find returns the bot's activity with the given ID. s.mu must be held.
+func (s *Server) find(id string) *Activity {
+	for _, a := range s.activities {
+		if a.ID == id {
+			return a
+		}
+	}
+	return nil
+}
+
+func clone(a *Activity) Activity {
+	c := *a
+	c.Revisions = slices.Clone(a.Revisions)
+	c.Buttons = slices.Clone(a.Buttons)
+	return c
+}
+
+func personalConversation(userID string) string {
+	return "a:personal-" + userID
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("faketeams: failed to write response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]any{"error": map[string]string{"code": code, "message": message}})
+}
@@ -0,0 +1,200 @@
+package teams
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"chatrelay-bot/pkg/models"
+)
+
+// maxTextLength is where the text of a message is cut short, in bytes.
+// Teams rejects messages over about 28 KB, and the card and markup need
+// some of that.
+const maxTextLength = 24000
+
+// Post sends msg, as a reply in the channel thread rooted at msg.Thread if
+// set. Chats have no threads, so there msg.Thread is ignored.
+func (c *Client) Post(ctx context.Context, msg models.OutgoingMessage) (string, error) {
+	tracer := otel.Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, "PostMessageToTeams",
+		trace.WithAttributes(
+			attribute.String("teams.conversation_id", msg.Conversation),
+			attribute.String("teams.thread_id", msg.Thread),
+			attribute.Int("teams.message_length", len(msg.Text)),
+		),
+	)
+	defer span.End()
+
+	info := c.conversation(msg.Conversation)
+	id := msg.Conversation
+	if msg.Thread != "" && info.kind == conversationChannel {
+		id += ";messageid=" + msg.Thread
+	}
+	var created resourceResponse
+	if err := c.connector.do(ctx, "POST", info.serviceURL, []string{"v3", "conversations", id, "activities"}, c.message(msg), &created); err != nil {
+		slog.ErrorContext(ctx, "Failed to send Teams message", "error", err, "conversation", msg.Conversation)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to send message")
+		return "", err
+	}
+	span.SetStatus(codes.Ok, "success")
+	return created.ID, nil
+}
+
+// Update replaces the text and buttons of a message.
+func (c *Client) Update(ctx context.Context, id string, msg models.OutgoingMessage) error {
+	tracer := otel.Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, "UpdateMessageInTeams",
+		trace.WithAttributes(
+			attribute.String("teams.conversation_id", msg.Conversation),
+			attribute.String("teams.activity_id", id),
+		),
+	)
+	defer span.End()
+
+	a := c.message(msg)
+	a.ID = id
+	info := c.conversation(msg.Conversation)
+	if err := c.connector.do(ctx, "PUT", info.serviceURL, []string{"v3", "conversations", msg.Conversation, "activities", id}, a, nil); err != nil {
+		slog.ErrorContext(ctx, "Failed to update Teams message", "error", err, "activity", id)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to update message")
+		return fmt.Errorf("failed to update message: %w", err)
+	}
+	span.SetStatus(codes.Ok, "success")
+	return nil
+}
+
+func (c *Client) Delete(ctx context.Context, conversation, id string) error {
+	tracer := otel.Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, "DeleteMessageInTeams",
+		trace.WithAttributes(
+			attribute.String("teams.conversation_id", conversation),
+			attribute.String("teams.activity_id", id),
+		),
+	)
+	defer span.End()
+
+	info := c.conversation(conversation)
+	if err := c.connector.do(ctx, "DELETE", info.serviceURL, []string{"v3", "conversations", conversation, "activities", id}, nil, nil); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to delete message")
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+	span.SetStatus(codes.Ok, "success")
+	return nil
+}
+
+// Notify sends text to userID in their personal chat with the bot, as
+// Teams has no messages that only one member of a conversation can see.
+func (c *Client) Notify(ctx context.Context, conversation, userID, text string) error {
+	tracer := otel.Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, "NotifyUserInTeams",
+		trace.WithAttributes(
+			attribute.String("teams.conversation_id", conversation),
+			attribute.String("teams.user_id", userID),
+		),
+	)
+	defer span.End()
+
+	personal, err := c.personalConversation(ctx, conversation, userID)
+	if err == nil {
+		_, err = c.Post(ctx, models.OutgoingMessage{Conversation: personal, Text: text})
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to notify user")
+		return fmt.Errorf("failed to notify user: %w", err)
+	}
+	span.SetStatus(codes.Ok, "success")
+	return nil
+}
+
+// personalConversation returns the ID of userID's personal chat with the
+// bot, creating it through the connector that conversation came from if no
+// message from it has been seen.
+func (c *Client) personalConversation(ctx context.Context, conversation, userID string) (string, error) {
+	c.mu.Lock()
+	id, ok := c.personal[userID]
+	botID := c.botID
+	c.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	info := c.conversation(conversation)
+	if info.kind == conversationPersonal {
+		return conversation, nil
+	}
+	body := map[string]any{
+		"bot":         channelAccount{ID: botID},
+		"members":     []channelAccount{{ID: userID}},
+		"isGroup":     false,
+		"tenantId":    info.tenantID,
+		"channelData": channelData{Tenant: &idObject{ID: info.tenantID}},
+	}
+	var created resourceResponse
+	if err := c.connector.do(ctx, "POST", info.serviceURL, []string{"v3", "conversations"}, body, &created); err != nil {
+		return "", fmt.Errorf("failed to create personal conversation: %w", err)
+	}
+	c.mu.Lock()
+	c.personal[userID] = created.ID
+	c.conversations[created.ID] = conversationInfo{serviceURL: info.serviceURL, tenantID: info.tenantID, kind: conversationPersonal}
+	c.mu.Unlock()
+	return created.ID, nil
+}
+
+// conversation returns what is known about a conversation. One that no
+// activity has come from is reached through the default service URL.
+func (c *Client) conversation(id string) conversationInfo {
+	c.mu.Lock()
+	info, ok := c.conversations[id]
+	c.mu.Unlock()
+	if !ok {
+		info.serviceURL = c.serviceURL
+	}
+	return info
+}
+
+// message builds a message activity with msg's text and its actions as the
+// buttons of an Adaptive Card.
+func (c *Client) message(msg models.OutgoingMessage) activity {
+	text := msg.Text
+	if len(text) > maxTextLength {
+		cut := maxTextLength - len("…")
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		text = text[:cut] + "…"
+	}
+	a := activity{Type: "message", Text: text, TextFormat: "markdown"}
+	if len(msg.Actions) == 0 {
+		return a
+	}
+	var actions []map[string]any
+	for _, act := range msg.Actions {
+		actions = append(actions, map[string]any{
+			"type":  "Action.Submit",
+			"title": act.Label,
+			"data":  submitData{Action: act.ID, Value: act.Value},
+		})
+	}
+	a.Attachments = []attachment{{
+		ContentType: "application/vnd.microsoft.card.adaptive",
+		Content: map[string]any{
+			"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+			"type":    "AdaptiveCard",
+			"version": "1.4",
+			"body":    []any{},
+			"actions": actions,
+		},
+	}}
+	return a
+}
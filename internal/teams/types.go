@@ -0,0 +1,81 @@
+package teams
+
+import "encoding/json"
+
+// Conversation types. Only channel conversations have threads.
+const (
+	conversationPersonal = "personal"
+	conversationChannel  = "channel"
+)
+
+// activity is a Bot Framework activity, as received on /api/messages and
+// sent to the connector API.
+type activity struct {
+	Type         string          `json:"type"`
+	ID           string          `json:"id,omitempty"`
+	Timestamp    string          `json:"timestamp,omitempty"`
+	ServiceURL   string          `json:"serviceUrl,omitempty"`
+	ChannelID    string          `json:"channelId,omitempty"`
+	From         *channelAccount `json:"from,omitempty"`
+	Conversation *conversation   `json:"conversation,omitempty"`
+	Recipient    *channelAccount `json:"recipient,omitempty"`
+	ReplyToID    string          `json:"replyToId,omitempty"`
+	Text         string          `json:"text,omitempty"`
+	TextFormat   string          `json:"textFormat,omitempty"`
+	Attachments  []attachment    `json:"attachments,omitempty"`
+	Entities     []entity        `json:"entities,omitempty"`
+	ChannelData  *channelData    `json:"channelData,omitempty"`
+	Value        json.RawMessage `json:"value,omitempty"`
+}
+
+type channelAccount struct {
+	ID          string `json:"id"`
+	Name        string `json:"name,omitempty"`
+	AADObjectID string `json:"aadObjectId,omitempty"`
+}
+
+type conversation struct {
+	ID               string `json:"id"`
+	ConversationType string `json:"conversationType,omitempty"`
+	TenantID         string `json:"tenantId,omitempty"`
+	IsGroup          bool   `json:"isGroup,omitempty"`
+}
+
+// attachment is a file or card on an activity.
+type attachment struct {
+	ContentType string `json:"contentType"`
+	ContentURL  string `json:"contentUrl,omitempty"`
+	Content     any    `json:"content,omitempty"`
+	Name        string `json:"name,omitempty"`
+}
+
+// entity is extra data on an activity. Mentions have Type "mention", with
+// Text being the <at>…</at> markup for the mention in the activity's text.
+type entity struct {
+	Type      string          `json:"type"`
+	Mentioned *channelAccount `json:"mentioned,omitempty"`
+	Text      string          `json:"text,omitempty"`
+}
+
+type channelData struct {
+	Tenant  *idObject `json:"tenant,omitempty"`
+	Team    *idObject `json:"team,omitempty"`
+	Channel *idObject `json:"channel,omitempty"`
+}
+
+type idObject struct {
+	ID string `json:"id"`
+}
+
+// resourceResponse is the connector's reply to a created activity or
+// conversation.
+type resourceResponse struct {
+	ID string `json:"id"`
+}
+
+// submitData is the data of an Action.Submit button, which Teams sends back
+// as the Value of a message activity when it is pressed.
+type submitData struct {
+	Action string `json:"chatrelay_action"`
+	Value  string `json:"value"`
+}
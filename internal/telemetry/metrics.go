@@ -0,0 +1,243 @@
+package telemetry
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const meterName = "chatrelay"
+
+// Outcome values recorded on mention and backend metrics.
+const (
+	OutcomeSuccess      = "success"
+	OutcomeBackendError = "backend_error"
+	OutcomeSlackError   = "slack_error"
+	OutcomeCancelled    = "cancelled"
+)
+
+type instruments struct {
+	mentionsReceived   metric.Int64Counter
+	mentionsCompleted  metric.Int64Counter
+	backendLatency     metric.Float64Histogram
+	timeToFirstChunk   metric.Float64Histogram
+	slackAPICalls      metric.Int64Counter
+	discordAPICalls    metric.Int64Counter
+	mattermostAPICalls metric.Int64Counter
+	teamsAPICalls      metric.Int64Counter
+	retries            metric.Int64Counter
+	inFlight           metric.Int64UpDownCounter
+	answerLength       metric.Int64Histogram
+	accessDenied       metric.Int64Counter
+	rateLimited        metric.Int64Counter
+}
+
+var inst *instruments
+
+func initInstruments() error {
+	meter := otel.Meter(meterName)
+	i := &instruments{}
+	var err error
+
+	if i.mentionsReceived, err = meter.Int64Counter("chatrelay.mentions.received",
+		metric.WithDescription("App mentions received from Slack"),
+		metric.WithUnit("{mention}"),
+	); err != nil {
+		return err
+	}
+	if i.mentionsCompleted, err = meter.Int64Counter("chatrelay.mentions.completed",
+		metric.WithDescription("App mentions that finished processing, by outcome"),
+		metric.WithUnit("{mention}"),
+	); err != nil {
+		return err
+	}
+	if i.backendLatency, err = meter.Float64Histogram("chatrelay.backend.request.duration",
+		metric.WithDescription("Duration of chat backend requests including retries"),
+		metric.WithUnit("s"),
+	); err != nil {
+		return err
+	}
+	if i.timeToFirstChunk, err = meter.Float64Histogram("chatrelay.answer.time_to_first_chunk",
+		metric.WithDescription("Time from receiving a mention to the first answer chunk shown in Slack"),
+		metric.WithUnit("s"),
+	); err != nil {
+		return err
+	}
+	if i.slackAPICalls, err = meter.Int64Counter("chatrelay.slack.api.calls",
+		metric.WithDescription("Slack Web API calls, by method and error code"),
+		metric.WithUnit("{call}"),
+	); err != nil {
+		return err
+	}
+	if i.discordAPICalls, err = meter.Int64Counter("chatrelay.discord.api.calls",
+		metric.WithDescription("Discord REST API calls, by route and status"),
+		metric.WithUnit("{call}"),
+	); err != nil {
+		return err
+	}
+	if i.mattermostAPICalls, err = meter.Int64Counter("chatrelay.mattermost.api.calls",
+		metric.WithDescription("Mattermost REST API calls, by route and status"),
+		metric.WithUnit("{call}"),
+	); err != nil {
+		return err
+	}
+	if i.teamsAPICalls, err = meter.Int64Counter("chatrelay.teams.api.calls",
+		metric.WithDescription("Teams connector API calls, by route and status"),
+		metric.WithUnit("{call}"),
+	); err != nil {
+		return err
+	}
+	if i.retries, err = meter.Int64Counter("chatrelay.retries",
+		metric.WithDescription("Retried calls to Slack or the chat backend"),
+		metric.WithUnit("{retry}"),
+	); err != nil {
+		return err
+	}
+	if i.inFlight, err = meter.Int64UpDownCounter("chatrelay.conversations.in_flight",
+		metric.WithDescription("Conversations currently being answered"),
+		metric.WithUnit("{conversation}"),
+	); err != nil {
+		return err
+	}
+	if i.answerLength, err = meter.Int64Histogram("chatrelay.answer.length",
+		metric.WithDescription("Length of answers relayed to Slack"),
+		metric.WithUnit("{char}"),
+	); err != nil {
+		return err
+	}
+
+	if i.accessDenied, err = meter.Int64Counter("chatrelay.access.denied",
+		metric.WithDescription("Mentions rejected by access control, by reason"),
+		metric.WithUnit("{mention}"),
+	); err != nil {
+		return err
+	}
+
+	if i.rateLimited, err = meter.Int64Counter("chatrelay.ratelimit.rejected",
+		metric.WithDescription("Mentions rejected by a rate limit or quota, by limit"),
+		metric.WithUnit("{mention}"),
+	); err != nil {
+		return err
+	}
+
+	inst = i
+	return nil
+}
+
+func RecordMentionReceived(ctx context.Context) {
+	if inst == nil {
+		return
+	}
+	inst.mentionsReceived.Add(ctx, 1)
+}
+
+func RecordMentionCompleted(ctx context.Context, outcome string) {
+	if inst == nil {
+		return
+	}
+	inst.mentionsCompleted.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", outcome)))
+}
+
+func RecordBackendLatency(ctx context.Context, d time.Duration, outcome string) {
+	if inst == nil {
+		return
+	}
+	inst.backendLatency.Record(ctx, d.Seconds(), metric.WithAttributes(attribute.String("outcome", outcome)))
+}
+
+func RecordTimeToFirstChunk(ctx context.Context, d time.Duration) {
+	if inst == nil {
+		return
+	}
+	inst.timeToFirstChunk.Record(ctx, d.Seconds())
+}
+
+// RecordSlackAPICall counts a single Slack Web API call. errorCode is "ok"
+// for successful calls.
+func RecordSlackAPICall(ctx context.Context, method, errorCode string) {
+	if inst == nil {
+		return
+	}
+	inst.slackAPICalls.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("slack.method", method),
+		attribute.String("slack.error_code", errorCode),
+	))
+}
+
+// RecordDiscordAPICall counts a single Discord REST call. route has its IDs
+// replaced by placeholders; status is the HTTP status code, or
+// "transport_error".
+func RecordDiscordAPICall(ctx context.Context, route, status string) {
+	if inst == nil {
+		return
+	}
+	inst.discordAPICalls.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("discord.route", route),
+		attribute.String("discord.status", status),
+	))
+}
+
+// RecordMattermostAPICall counts a single Mattermost REST call, like
+// RecordDiscordAPICall.
+func RecordMattermostAPICall(ctx context.Context, route, status string) {
+	if inst == nil {
+		return
+	}
+	inst.mattermostAPICalls.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("mattermost.route", route),
+		attribute.String("mattermost.status", status),
+	))
+}
+
+// RecordTeamsAPICall counts a single Bot Framework connector call, like
+// RecordDiscordAPICall.
+func RecordTeamsAPICall(ctx context.Context, route, status string) {
+	if inst == nil {
+		return
+	}
+	inst.teamsAPICalls.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("teams.route", route),
+		attribute.String("teams.status", status),
+	))
+}
+
+func RecordRetry(ctx context.Context, component, operation string) {
+	if inst == nil {
+		return
+	}
+	inst.retries.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("component", component),
+		attribute.String("operation", operation),
+	))
+}
+
+func AddInFlightConversations(ctx context.Context, delta int64) {
+	if inst == nil {
+		return
+	}
+	inst.inFlight.Add(ctx, delta)
+}
+
+func RecordAnswerLength(ctx context.Context, length int) {
+	if inst == nil {
+		return
+	}
+	inst.answerLength.Record(ctx, int64(length))
+}
+
+func RecordAccessDenied(ctx context.Context, reason string) {
+	if inst == nil {
+		return
+	}
+	inst.accessDenied.Add(ctx, 1, metric.WithAttributes(attribute.String("reason", reason)))
+}
+
+func RecordRateLimited(ctx context.Context, limit string) {
+	if inst == nil {
+		return
+	}
+	inst.rateLimited.Add(ctx, 1, metric.WithAttributes(attribute.String("limit", limit)))
+}
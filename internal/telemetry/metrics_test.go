@@ -0,0 +1,146 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// collectMetrics installs a MeterProvider with a manual reader and the
+// instruments on it for the rest of the test. The returned function reads
+// what has been recorded so far.
+func collectMetrics(t *testing.T) func() map[string]metricdata.Aggregation {
+	t.Helper()
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	prevProvider, prevInst := otel.GetMeterProvider(), inst
+	otel.SetMeterProvider(provider)
+	t.Cleanup(func() {
+		otel.SetMeterProvider(prevProvider)
+		inst = prevInst
+		provider.Shutdown(context.Background())
+	})
+	if err := initInstruments(); err != nil {
+		t.Fatal(err)
+	}
+	return func() map[string]metricdata.Aggregation {
+		var rm metricdata.ResourceMetrics
+		if err := reader.Collect(context.Background(), &rm); err != nil {
+			t.Fatal(err)
+		}
+		metrics := make(map[string]metricdata.Aggregation)
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				metrics[m.Name] = m.Data
+			}
+		}
+		return metrics
+	}
+}
+
+// sum returns the value of a counter's data point with the given
+// attributes.
+func sum(t *testing.T, data metricdata.Aggregation, attrs ...attribute.KeyValue) int64 {
+	t.Helper()
+	var points []metricdata.DataPoint[int64]
+	switch s := data.(type) {
+	case metricdata.Sum[int64]:
+		points = s.DataPoints
+	default:
+		t.Fatalf("metric is %T, want an int64 sum", data)
+	}
+	want := attribute.NewSet(attrs...)
+	for _, p := range points {
+		if p.Attributes.Equals(&want) {
+			return p.Value
+		}
+	}
+	return 0
+}
+
+func TestRecordMetrics(t *testing.T) {
+	collect := collectMetrics(t)
+	ctx := context.Background()
+
+	RecordMentionReceived(ctx)
+	RecordMentionReceived(ctx)
+	RecordMentionCompleted(ctx, OutcomeSuccess)
+	RecordMentionCompleted(ctx, OutcomeBackendError)
+	RecordMentionCompleted(ctx, OutcomeSuccess)
+	RecordBackendLatency(ctx, 1500*time.Millisecond, OutcomeSuccess)
+	RecordTimeToFirstChunk(ctx, 200*time.Millisecond)
+	RecordSlackAPICall(ctx, "chat.update", "ok")
+	RecordSlackAPICall(ctx, "chat.update", "ratelimited")
+	RecordDiscordAPICall(ctx, "/channels/{id}/messages", "200")
+	RecordMattermostAPICall(ctx, "/posts", "201")
+	RecordTeamsAPICall(ctx, "/v3/conversations/{id}/activities", "transport_error")
+	RecordRetry(ctx, "backend", "chat")
+	AddInFlightConversations(ctx, 3)
+	AddInFlightConversations(ctx, -1)
+	RecordAnswerLength(ctx, 420)
+	RecordAccessDenied(ctx, "user_denied")
+	RecordRateLimited(ctx, "user")
+
+	metrics := collect()
+	counters := []struct {
+		name  string
+		attrs []attribute.KeyValue
+		want  int64
+	}{
+		{name: "chatrelay.mentions.received", want: 2},
+		{name: "chatrelay.mentions.completed", attrs: []attribute.KeyValue{attribute.String("outcome", OutcomeSuccess)}, want: 2},
+		{name: "chatrelay.mentions.completed", attrs: []attribute.KeyValue{attribute.String("outcome", OutcomeBackendError)}, want: 1},
+		{name: "chatrelay.slack.api.calls", attrs: []attribute.KeyValue{attribute.String("slack.method", "chat.update"), attribute.String("slack.error_code", "ratelimited")}, want: 1},
+		{name: "chatrelay.discord.api.calls", attrs: []attribute.KeyValue{attribute.String("discord.route", "/channels/{id}/messages"), attribute.String("discord.status", "200")}, want: 1},
+		{name: "chatrelay.mattermost.api.calls", attrs: []attribute.KeyValue{attribute.String("mattermost.route", "/posts"), attribute.String("mattermost.status", "201")}, want: 1},
+		{name: "chatrelay.teams.api.calls", attrs: []attribute.KeyValue{attribute.String("teams.route", "/v3/conversations/{id}/activities"), attribute.String("teams.status", "transport_error")}, want: 1},
+		{name: "chatrelay.retries", attrs: []attribute.KeyValue{attribute.String("component", "backend"), attribute.String("operation", "chat")}, want: 1},
+		{name: "chatrelay.conversations.in_flight", want: 2},
+		{name: "chatrelay.access.denied", attrs: []attribute.KeyValue{attribute.String("reason", "user_denied")}, want: 1},
+		{name: "chatrelay.ratelimit.rejected", attrs: []attribute.KeyValue{attribute.String("limit", "user")}, want: 1},
+	}
+	for _, c := range counters {
+		data, ok := metrics[c.name]
+		if !ok {
+			t.Errorf("%s was not recorded", c.name)
+			continue
+		}
+		if got := sum(t, data, c.attrs...); got != c.want {
+			t.Errorf("%s%v = %d, want %d", c.name, c.attrs, got, c.want)
+		}
+	}
+
+	latency, ok := metrics["chatrelay.backend.request.duration"].(metricdata.Histogram[float64])
+	if !ok || len(latency.DataPoints) != 1 || latency.DataPoints[0].Sum != 1.5 {
+		t.Errorf("backend latency = %+v, want one 1.5s observation", metrics["chatrelay.backend.request.duration"])
+	}
+	length, ok := metrics["chatrelay.answer.length"].(metricdata.Histogram[int64])
+	if !ok || len(length.DataPoints) != 1 || length.DataPoints[0].Sum != 420 {
+		t.Errorf("answer length = %+v, want one 420 character observation", metrics["chatrelay.answer.length"])
+	}
+}
+
+func TestRecordWithoutInstruments(t *testing.T) {
+	prev := inst
+	inst = nil
+	t.Cleanup(func() { inst = prev })
+
+	// Recording before InitOpenTelemetry, as tests and tools that do not
+	// set up telemetry do, must not panic.
+	ctx := context.Background()
+	RecordMentionReceived(ctx)
+	RecordMentionCompleted(ctx, OutcomeSuccess)
+	RecordBackendLatency(ctx, time.Second, OutcomeSuccess)
+	RecordTimeToFirstChunk(ctx, time.Second)
+	RecordSlackAPICall(ctx, "chat.postMessage", "ok")
+	RecordRetry(ctx, "slack", "chat.update")
+	AddInFlightConversations(ctx, 1)
+	RecordAnswerLength(ctx, 1)
+	RecordAccessDenied(ctx, "user_denied")
+	RecordRateLimited(ctx, "user")
+}
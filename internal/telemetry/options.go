@@ -0,0 +1,199 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"google.golang.org/grpc/credentials"
+
+	"chatrelay-bot/pkg/models"
+)
+
+// Version is the service version reported on every signal. It is set at
+// build time with:
+//
+//	go build -ldflags "-X chatrelay-bot/internal/telemetry.Version=1.4.2" ./cmd/chatrelay
+//
+// OTEL_SERVICE_VERSION overrides it at runtime.
+var Version = "dev"
+
+// exporterOptions holds the connection settings shared by the OTLP trace,
+// log and metric exporters.
+type exporterOptions struct {
+	endpoint  string
+	insecure  bool
+	tlsConfig *tls.Config
+	headers   map[string]string
+}
+
+func newExporterOptions(cfg *models.AppConfig) (exporterOptions, error) {
+	opts := exporterOptions{
+		endpoint: cfg.TelemetryEndpoint,
+		insecure: cfg.TelemetryInsecure,
+	}
+
+	headers, err := parseKeyValues(cfg.TelemetryHeaders)
+	if err != nil {
+		return exporterOptions{}, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_HEADERS: %w", err)
+	}
+	opts.headers = headers
+
+	if opts.insecure {
+		return opts, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.TelemetryCACert != "" {
+		pem, err := os.ReadFile(cfg.TelemetryCACert)
+		if err != nil {
+			return exporterOptions{}, fmt.Errorf("failed to read OTLP CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return exporterOptions{}, fmt.Errorf("no certificates found in %s", cfg.TelemetryCACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.TelemetryClientCert != "" || cfg.TelemetryClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TelemetryClientCert, cfg.TelemetryClientKey)
+		if err != nil {
+			return exporterOptions{}, fmt.Errorf("failed to load OTLP client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	opts.tlsConfig = tlsConfig
+	return opts, nil
+}
+
+func newSampler(cfg *models.AppConfig) (sdktrace.Sampler, error) {
+	ratio := cfg.TraceSamplerRatio
+	if ratio < 0 || ratio > 1 {
+		return nil, fmt.Errorf("trace sampler ratio must be between 0 and 1, got %v", ratio)
+	}
+
+	switch strings.ToLower(cfg.TraceSampler) {
+	case "", "always", "always_on":
+		return sdktrace.AlwaysSample(), nil
+	case "never", "always_off":
+		return sdktrace.NeverSample(), nil
+	case "ratio", "traceidratio":
+		return sdktrace.TraceIDRatioBased(ratio), nil
+	case "parent_ratio", "parentbased_traceidratio":
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio)), nil
+	default:
+		return nil, fmt.Errorf("unsupported trace sampler: %s", cfg.TraceSampler)
+	}
+}
+
+func newResource(ctx context.Context, cfg *models.AppConfig) (*resource.Resource, error) {
+	version := cfg.ServiceVersion
+	if version == "" {
+		version = Version
+	}
+	instanceID := cfg.ServiceInstanceID
+	if instanceID == "" {
+		if hostname, err := os.Hostname(); err == nil {
+			instanceID = hostname
+		}
+	}
+
+	attrs := []attribute.KeyValue{
+		semconv.ServiceNameKey.String(cfg.ServiceName),
+		semconv.ServiceVersionKey.String(version),
+		semconv.DeploymentEnvironment(cfg.DeploymentEnvironment),
+	}
+	if instanceID != "" {
+		attrs = append(attrs, semconv.ServiceInstanceID(instanceID))
+	}
+
+	extra, err := parseKeyValues(cfg.ResourceAttributes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTEL_RESOURCE_ATTRIBUTES: %w", err)
+	}
+	for key, value := range extra {
+		attrs = append(attrs, attribute.String(key, value))
+	}
+
+	return resource.New(ctx, resource.WithAttributes(attrs...))
+}
+
+// parseKeyValues parses the "key1=value1,key2=value2" format used by
+// OTEL_RESOURCE_ATTRIBUTES and OTEL_EXPORTER_OTLP_HEADERS.
+func parseKeyValues(raw string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", pair)
+		}
+		values[key] = strings.TrimSpace(value)
+	}
+	return values, nil
+}
+
+func (o exporterOptions) grpcTraceOptions() []otlptracegrpc.Option {
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(o.endpoint), otlptracegrpc.WithHeaders(o.headers)}
+	if o.insecure {
+		return append(opts, otlptracegrpc.WithInsecure())
+	}
+	return append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(o.tlsConfig)))
+}
+
+func (o exporterOptions) httpTraceOptions() []otlptracehttp.Option {
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(o.endpoint), otlptracehttp.WithHeaders(o.headers)}
+	if o.insecure {
+		return append(opts, otlptracehttp.WithInsecure())
+	}
+	return append(opts, otlptracehttp.WithTLSClientConfig(o.tlsConfig))
+}
+
+func (o exporterOptions) grpcLogOptions() []otlploggrpc.Option {
+	opts := []otlploggrpc.Option{otlploggrpc.WithEndpoint(o.endpoint), otlploggrpc.WithHeaders(o.headers)}
+	if o.insecure {
+		return append(opts, otlploggrpc.WithInsecure())
+	}
+	return append(opts, otlploggrpc.WithTLSCredentials(credentials.NewTLS(o.tlsConfig)))
+}
+
+func (o exporterOptions) httpLogOptions() []otlploghttp.Option {
+	opts := []otlploghttp.Option{otlploghttp.WithEndpoint(o.endpoint), otlploghttp.WithHeaders(o.headers)}
+	if o.insecure {
+		return append(opts, otlploghttp.WithInsecure())
+	}
+	return append(opts, otlploghttp.WithTLSClientConfig(o.tlsConfig))
+}
+
+func (o exporterOptions) grpcMetricOptions() []otlpmetricgrpc.Option {
+	opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(o.endpoint), otlpmetricgrpc.WithHeaders(o.headers)}
+	if o.insecure {
+		return append(opts, otlpmetricgrpc.WithInsecure())
+	}
+	return append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(o.tlsConfig)))
+}
+
+func (o exporterOptions) httpMetricOptions() []otlpmetrichttp.Option {
+	opts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(o.endpoint), otlpmetrichttp.WithHeaders(o.headers)}
+	if o.insecure {
+		return append(opts, otlpmetrichttp.WithInsecure())
+	}
+	return append(opts, otlpmetrichttp.WithTLSClientConfig(o.tlsConfig))
+}
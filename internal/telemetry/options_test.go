@@ -0,0 +1,190 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/pem"
+	"maps"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+
+	"chatrelay-bot/pkg/models"
+)
+
+func TestParseKeyValues(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    map[string]string
+		wantErr bool
+	}{
+		{raw: "", want: map[string]string{}},
+		{raw: "team=chat, region = eu-west-1 ,", want: map[string]string{"team": "chat", "region": "eu-west-1"}},
+		{raw: "authorization=Bearer abc=", want: map[string]string{"authorization": "Bearer abc="}},
+		{raw: "empty=", want: map[string]string{"empty": ""}},
+		{raw: "team", wantErr: true},
+		{raw: "=chat", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := parseKeyValues(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseKeyValues(%q) error = %v, want error %v", tt.raw, err, tt.wantErr)
+			}
+			if !tt.wantErr && !maps.Equal(got, tt.want) {
+				t.Errorf("parseKeyValues(%q) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSampler(t *testing.T) {
+	tests := []struct {
+		sampler string
+		ratio   float64
+		// want is part of the sampler's description, or of the error when
+		// wantErr is set.
+		want    string
+		wantErr bool
+	}{
+		{sampler: "", want: "AlwaysOnSampler"},
+		{sampler: "always_on", want: "AlwaysOnSampler"},
+		{sampler: "NEVER", want: "AlwaysOffSampler"},
+		{sampler: "ratio", ratio: 0.25, want: "TraceIDRatioBased{0.25}"},
+		{sampler: "parentbased_traceidratio", ratio: 0.1, want: "ParentBased{root:TraceIDRatioBased{0.1}"},
+		{sampler: "ratio", ratio: 1.5, want: "between 0 and 1", wantErr: true},
+		{sampler: "sometimes", want: "unsupported trace sampler", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sampler, func(t *testing.T) {
+			s, err := newSampler(&models.AppConfig{TraceSampler: tt.sampler, TraceSamplerRatio: tt.ratio})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("newSampler = %v, want an error about %q", err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := s.Description(); !strings.Contains(d, tt.want) {
+				t.Errorf("sampler = %s, want %s", d, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewResource(t *testing.T) {
+	ctx := context.Background()
+	cfg := &models.AppConfig{
+		ServiceName:           "chatrelay",
+		DeploymentEnvironment: "staging",
+		ServiceInstanceID:     "bot-1",
+		ResourceAttributes:    "team=chat,region=eu",
+	}
+	res, err := newResource(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[attribute.Key]string{
+		semconv.ServiceNameKey:           "chatrelay",
+		semconv.ServiceVersionKey:        Version,
+		semconv.DeploymentEnvironmentKey: "staging",
+		semconv.ServiceInstanceIDKey:     "bot-1",
+		"team":                           "chat",
+		"region":                         "eu",
+	}
+	for key, value := range want {
+		if got, ok := res.Set().Value(key); !ok || got.AsString() != value {
+			t.Errorf("%s = %q, want %q", key, got.AsString(), value)
+		}
+	}
+
+	cfg.ServiceVersion = "1.4.2"
+	cfg.ServiceInstanceID = ""
+	res, err = newResource(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := res.Set().Value(semconv.ServiceVersionKey); got.AsString() != "1.4.2" {
+		t.Errorf("service.version = %q, want OTEL_SERVICE_VERSION to override the build version", got.AsString())
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		if got, _ := res.Set().Value(semconv.ServiceInstanceIDKey); got.AsString() != hostname {
+			t.Errorf("service.instance.id = %q, want the hostname %q", got.AsString(), hostname)
+		}
+	}
+
+	cfg.ResourceAttributes = "team"
+	if _, err := newResource(ctx, cfg); err == nil || !strings.Contains(err.Error(), "OTEL_RESOURCE_ATTRIBUTES") {
+		t.Errorf("newResource = %v, want an OTEL_RESOURCE_ATTRIBUTES error", err)
+	}
+}
+
+func TestNewExporterOptions(t *testing.T) {
+	dir := t.TempDir()
+	server := httptest.NewTLSServer(nil)
+	server.Close()
+	caPath := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600)
+	notPEM := filepath.Join(dir, "not.pem")
+	os.WriteFile(notPEM, []byte("not a certificate"), 0o600)
+
+	tests := []struct {
+		name    string
+		cfg     models.AppConfig
+		wantErr string
+		check   func(t *testing.T, o exporterOptions)
+	}{
+		{
+			name: "insecure",
+			cfg:  models.AppConfig{TelemetryEndpoint: "collector:4317", TelemetryInsecure: true, TelemetryHeaders: "x-api-key=k"},
+			check: func(t *testing.T, o exporterOptions) {
+				if o.tlsConfig != nil || o.endpoint != "collector:4317" || o.headers["x-api-key"] != "k" {
+					t.Errorf("options = %+v, want no TLS and the endpoint and header", o)
+				}
+			},
+		},
+		{
+			name: "system roots",
+			cfg:  models.AppConfig{TelemetryEndpoint: "collector:4317"},
+			check: func(t *testing.T, o exporterOptions) {
+				if o.tlsConfig == nil || o.tlsConfig.RootCAs != nil {
+					t.Errorf("TLS config = %+v, want TLS with the system roots", o.tlsConfig)
+				}
+			},
+		},
+		{
+			name: "custom CA",
+			cfg:  models.AppConfig{TelemetryCACert: caPath},
+			check: func(t *testing.T, o exporterOptions) {
+				if o.tlsConfig == nil || o.tlsConfig.RootCAs == nil {
+					t.Errorf("TLS config = %+v, want the CA from %s", o.tlsConfig, caPath)
+				}
+			},
+		},
+		{name: "invalid headers", cfg: models.AppConfig{TelemetryHeaders: "x-api-key"}, wantErr: "invalid OTEL_EXPORTER_OTLP_HEADERS"},
+		{name: "missing CA", cfg: models.AppConfig{TelemetryCACert: filepath.Join(dir, "missing.pem")}, wantErr: "failed to read OTLP CA certificate"},
+		{name: "CA without certificates", cfg: models.AppConfig{TelemetryCACert: notPEM}, wantErr: "no certificates found"},
+		{name: "client key without certificate", cfg: models.AppConfig{TelemetryClientKey: notPEM}, wantErr: "failed to load OTLP client certificate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, err := newExporterOptions(&tt.cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("newExporterOptions = %v, want an error about %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, o)
+		})
+	}
+}
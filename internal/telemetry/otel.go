@@ -4,55 +4,68 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
 	"go.opentelemetry.io/contrib/instrumentation/host"
 	"go.opentelemetry.io/contrib/instrumentation/runtime"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
 	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/log"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
 
+	"chatrelay-bot/internal/redact"
 	"chatrelay-bot/pkg/models"
 )
 
 var (
 	tp *sdktrace.TracerProvider
 	lp *log.LoggerProvider
+	mp *sdkmetric.MeterProvider
+
+	promRegistry *prometheus.Registry
+	promHandler  http.Handler
 )
 
 func InitOpenTelemetry(ctx context.Context, cfg *models.AppConfig) error {
 	var err error
 
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String(cfg.ServiceName),
-			semconv.ServiceVersionKey.String("1.0.0"),
-			attribute.String("environment", "development"),
-		),
-	)
+	res, err := newResource(ctx, cfg)
 	if err != nil {
 		return fmt.Errorf("failed to create resource: %w", err)
 	}
+	sampler, err := newSampler(cfg)
+	if err != nil {
+		return err
+	}
+	exporterOpts, err := newExporterOptions(cfg)
+	if err != nil {
+		return err
+	}
 
 	// Trace Exporter
 	switch cfg.TelemetryExporter {
 	case "grpc":
-		tp, err = initGRPCTracerProvider(ctx, cfg.TelemetryEndpoint, res)
+		tp, err = initGRPCTracerProvider(ctx, exporterOpts, res, sampler)
 	case "http/protobuf":
-		tp, err = initHTTPTracerProvider(ctx, cfg.TelemetryEndpoint, res)
+		tp, err = initHTTPTracerProvider(ctx, exporterOpts, res, sampler)
 	case "console":
-		tp, err = initConsoleTracerProvider(ctx, res)
+		tp, err = initConsoleTracerProvider(ctx, res, sampler)
 	default:
 		return fmt.Errorf("unsupported telemetry exporter: %s", cfg.TelemetryExporter)
 	}
@@ -68,9 +81,9 @@ func InitOpenTelemetry(ctx context.Context, cfg *models.AppConfig) error {
 	// Log Exporter
 	switch cfg.TelemetryExporter {
 	case "grpc":
-		lp, err = initGRPCLoggerProvider(ctx, cfg.TelemetryEndpoint, res)
+		lp, err = initGRPCLoggerProvider(ctx, exporterOpts, res)
 	case "http/protobuf":
-		lp, err = initHTTPLoggerProvider(ctx, cfg.TelemetryEndpoint, res)
+		lp, err = initHTTPLoggerProvider(ctx, exporterOpts, res)
 	case "console":
 		lp, err = initConsoleLoggerProvider(ctx, res)
 	default:
@@ -81,16 +94,56 @@ func InitOpenTelemetry(ctx context.Context, cfg *models.AppConfig) error {
 		return err
 	}
 
-	// Simplified slog setup using default TextHandler
-	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	// Simplified slog setup using default TextHandler, with user content
+	// redacted according to REDACTION_MODE
+	redactionMode, err := redact.ParseMode(cfg.RedactionMode)
+	if err != nil {
+		return err
+	}
+	redact.SetPolicy(redact.Policy{Mode: redactionMode, TruncateLength: cfg.RedactionTruncateLength})
+	slog.SetDefault(slog.New(redact.NewHandler(slog.NewTextHandler(os.Stdout, nil))))
+
+	// Metric Exporters: the Prometheus reader backs the /metrics endpoint and
+	// is always registered; OTLP push is added unless only pull is requested.
+	promReader, err := initPrometheusMetricReader()
+	if err != nil {
+		return err
+	}
+	readers := []sdkmetric.Reader{promReader}
+	if cfg.MetricsExporter != "prometheus" {
+		var pushReader sdkmetric.Reader
+		switch cfg.TelemetryExporter {
+		case "grpc":
+			pushReader, err = initGRPCMetricReader(ctx, exporterOpts)
+		case "http/protobuf":
+			pushReader, err = initHTTPMetricReader(ctx, exporterOpts)
+		case "console":
+			pushReader, err = initConsoleMetricReader(ctx)
+		default:
+			fmt.Printf("Warning: Unsupported metric exporter %s. Using console.\n", cfg.TelemetryExporter)
+			pushReader, err = initConsoleMetricReader(ctx)
+		}
+		if err != nil {
+			return err
+		}
+		readers = append(readers, pushReader)
+	}
+	mpOpts := []sdkmetric.Option{sdkmetric.WithResource(res)}
+	for _, reader := range readers {
+		mpOpts = append(mpOpts, sdkmetric.WithReader(reader))
+	}
+	mp = sdkmetric.NewMeterProvider(mpOpts...)
+	otel.SetMeterProvider(mp)
+
+	if err := initInstruments(); err != nil {
+		return fmt.Errorf("failed to create application instruments: %w", err)
+	}
 
 	// Host and Runtime metrics
-	if err := host.Start(); err != nil {
+	if err := host.Start(host.WithMeterProvider(mp)); err != nil {
 		fmt.Printf("Warning: host instrumentation: %v\n", err)
 	}
-	if err := runtime.Start(runtime.WithMeterProvider(
-		sdkmetric.NewMeterProvider(sdkmetric.WithResource(res)),
-	)); err != nil {
+	if err := runtime.Start(runtime.WithMeterProvider(mp)); err != nil {
 		fmt.Printf("Warning: runtime instrumentation: %v\n", err)
 	}
 
@@ -98,54 +151,46 @@ func InitOpenTelemetry(ctx context.Context, cfg *models.AppConfig) error {
 	return nil
 }
 
-func initGRPCTracerProvider(ctx context.Context, endpoint string, res *resource.Resource) (*sdktrace.TracerProvider, error) {
-	exporter, err := otlptracegrpc.New(ctx,
-		otlptracegrpc.WithEndpoint(endpoint),
-		otlptracegrpc.WithInsecure(),
-	)
+func initGRPCTracerProvider(ctx context.Context, opts exporterOptions, res *resource.Resource, sampler sdktrace.Sampler) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracegrpc.New(ctx, opts.grpcTraceOptions()...)
 	if err != nil {
 		return nil, err
 	}
 	return sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithSampler(sampler),
 		sdktrace.WithResource(res),
 		sdktrace.WithBatcher(exporter),
 	), nil
 }
 
-func initHTTPTracerProvider(ctx context.Context, endpoint string, res *resource.Resource) (*sdktrace.TracerProvider, error) {
+func initHTTPTracerProvider(ctx context.Context, opts exporterOptions, res *resource.Resource, sampler sdktrace.Sampler) (*sdktrace.TracerProvider, error) {
 	exporter, err := otlptracehttp.New(ctx,
-		otlptracehttp.WithEndpoint(endpoint),
-		otlptracehttp.WithInsecure(),
-		otlptracehttp.WithURLPath("/v1/traces"),
+		append(opts.httpTraceOptions(), otlptracehttp.WithURLPath("/v1/traces"))...,
 	)
 	if err != nil {
 		return nil, err
 	}
 	return sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithSampler(sampler),
 		sdktrace.WithResource(res),
 		sdktrace.WithBatcher(exporter),
 	), nil
 }
 
-func initConsoleTracerProvider(ctx context.Context, res *resource.Resource) (*sdktrace.TracerProvider, error) {
+func initConsoleTracerProvider(ctx context.Context, res *resource.Resource, sampler sdktrace.Sampler) (*sdktrace.TracerProvider, error) {
 	exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
 	if err != nil {
 		return nil, err
 	}
 	return sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithSampler(sampler),
 		sdktrace.WithResource(res),
 		sdktrace.WithBatcher(exporter),
 	), nil
 }
 
-func initGRPCLoggerProvider(ctx context.Context, endpoint string, res *resource.Resource) (*log.LoggerProvider, error) {
-	exporter, err := otlploggrpc.New(ctx,
-		otlploggrpc.WithEndpoint(endpoint),
-		otlploggrpc.WithInsecure(),
-	)
+func initGRPCLoggerProvider(ctx context.Context, opts exporterOptions, res *resource.Resource) (*log.LoggerProvider, error) {
+	exporter, err := otlploggrpc.New(ctx, opts.grpcLogOptions()...)
 	if err != nil {
 		return nil, err
 	}
@@ -155,11 +200,9 @@ func initGRPCLoggerProvider(ctx context.Context, endpoint string, res *resource.
 	), nil
 }
 
-func initHTTPLoggerProvider(ctx context.Context, endpoint string, res *resource.Resource) (*log.LoggerProvider, error) {
+func initHTTPLoggerProvider(ctx context.Context, opts exporterOptions, res *resource.Resource) (*log.LoggerProvider, error) {
 	exporter, err := otlploghttp.New(ctx,
-		otlploghttp.WithEndpoint(endpoint),
-		otlploghttp.WithInsecure(),
-		otlploghttp.WithURLPath("/v1/logs"),
+		append(opts.httpLogOptions(), otlploghttp.WithURLPath("/v1/logs"))...,
 	)
 	if err != nil {
 		return nil, err
@@ -181,6 +224,50 @@ func initConsoleLoggerProvider(ctx context.Context, res *resource.Resource) (*lo
 	), nil
 }
 
+func initPrometheusMetricReader() (sdkmetric.Reader, error) {
+	promRegistry = prometheus.NewRegistry()
+	promHandler = promhttp.HandlerFor(promRegistry, promhttp.HandlerOpts{})
+	return otelprom.New(otelprom.WithRegisterer(promRegistry))
+}
+
+func initGRPCMetricReader(ctx context.Context, opts exporterOptions) (sdkmetric.Reader, error) {
+	exporter, err := otlpmetricgrpc.New(ctx, opts.grpcMetricOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	return sdkmetric.NewPeriodicReader(exporter), nil
+}
+
+func initHTTPMetricReader(ctx context.Context, opts exporterOptions) (sdkmetric.Reader, error) {
+	exporter, err := otlpmetrichttp.New(ctx,
+		append(opts.httpMetricOptions(), otlpmetrichttp.WithURLPath("/v1/metrics"))...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return sdkmetric.NewPeriodicReader(exporter), nil
+}
+
+func initConsoleMetricReader(ctx context.Context) (sdkmetric.Reader, error) {
+	exporter, err := stdoutmetric.New(stdoutmetric.WithPrettyPrint())
+	if err != nil {
+		return nil, err
+	}
+	return sdkmetric.NewPeriodicReader(exporter), nil
+}
+
+// MetricsHandler serves the Prometheus exposition of all application, host
+// and runtime metrics. It responds with 503 until InitOpenTelemetry has run.
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if promHandler == nil {
+			http.Error(w, "metrics not initialized", http.StatusServiceUnavailable)
+			return
+		}
+		promHandler.ServeHTTP(w, r)
+	})
+}
+
 func ShutdownOpenTelemetry(ctx context.Context) {
 	if tp != nil {
 		fmt.Println("Shutting down tracer provider...")
@@ -194,4 +281,10 @@ func ShutdownOpenTelemetry(ctx context.Context) {
 			fmt.Printf("Error shutting down logger: %v\n", err)
 		}
 	}
+	if mp != nil {
+		fmt.Println("Shutting down meter provider...")
+		if err := mp.Shutdown(ctx); err != nil {
+			fmt.Printf("Error shutting down meter provider: %v\n", err)
+		}
+	}
 }
@@ -0,0 +1,188 @@
+// Package webhook posts an event to an outbound webhook for every answer
+// the bot completes, on any platform. Each delivery is signed with HMAC
+// SHA-256 so the receiver can check that it came from ChatRelay:
+//
+//	X-ChatRelay-Timestamp: <unix seconds>
+//	X-ChatRelay-Signature: sha256=<hex HMAC of "<timestamp>.<body>" keyed with WEBHOOK_SECRET>
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+
+	"chatrelay-bot/internal/telemetry"
+	"chatrelay-bot/pkg/models"
+)
+
+const (
+	// EventAnswerCompleted is the type of the event sent for an answer.
+	EventAnswerCompleted = "answer.completed"
+	maxAttempts          = 3
+)
+
+// Event is the JSON body of a delivery.
+type Event struct {
+	ID           string        `json:"id"`
+	Type         string        `json:"type"`
+	Time         time.Time     `json:"time"`
+	Platform     string        `json:"platform"`
+	Workspace    string        `json:"workspace,omitempty"`
+	Conversation string        `json:"conversation"`
+	Thread       string        `json:"thread,omitempty"`
+	MessageID    string        `json:"message_id"`
+	ReplyID      string        `json:"reply_id"`
+	User         models.Author `json:"user"`
+	Question     string        `json:"question"`
+	Answer       string        `json:"answer"`
+	Usage        *models.Usage `json:"usage,omitempty"`
+	DurationMS   int64         `json:"duration_ms"`
+}
+
+// Sender delivers events in the background, retrying failed deliveries a
+// few times.
+type Sender struct {
+	url    string
+	secret atomic.Pointer[string]
+	http   *http.Client
+	wg     sync.WaitGroup
+}
+
+func NewSender(url, secret string) *Sender {
+	s := &Sender{
+		url: url,
+		http: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: otelhttp.NewTransport(http.DefaultTransport,
+				otelhttp.WithTracerProvider(otel.GetTracerProvider()),
+				otelhttp.WithPropagators(otel.GetTextMapPropagator()),
+			),
+		},
+	}
+	s.SetSecret(secret)
+	return s
+}
+
+// SetSecret makes deliveries, including retries of earlier ones, signed
+// with a rotated secret.
+func (s *Sender) SetSecret(secret string) {
+	s.secret.Store(&secret)
+}
+
+// AnswerCompleted sends an answer.completed event without waiting for it
+// to be delivered.
+func (s *Sender) AnswerCompleted(ctx context.Context, answer models.CompletedAnswer) {
+	msg := answer.Message
+	ev := Event{
+		ID:           newID(),
+		Type:         EventAnswerCompleted,
+		Time:         time.Now().UTC(),
+		Platform:     msg.Platform,
+		Workspace:    msg.Workspace,
+		Conversation: msg.Conversation,
+		Thread:       msg.Thread,
+		MessageID:    msg.ID,
+		ReplyID:      answer.ReplyID,
+		User:         msg.Author,
+		Question:     msg.Text,
+		Answer:       answer.Answer,
+		Usage:        answer.Usage,
+		DurationMS:   answer.Duration.Milliseconds(),
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ctx := context.WithoutCancel(ctx)
+		if err := s.deliver(ctx, ev); err != nil {
+			slog.ErrorContext(ctx, "Failed to deliver webhook", "error", err, "event", ev.ID, "type", ev.Type)
+		}
+	}()
+}
+
+// Wait blocks until deliveries in progress have finished, or ctx is done.
+func (s *Sender) Wait(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.WarnContext(ctx, "Gave up waiting for webhook deliveries")
+	}
+}
+
+func (s *Sender) deliver(ctx context.Context, ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	for attempt := 1; ; attempt++ {
+		err := s.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if attempt >= maxAttempts {
+			return err
+		}
+		wait := time.Duration(attempt) * time.Second
+		slog.WarnContext(ctx, "Webhook delivery will be retried", "error", err, "event", ev.ID, "attempt", attempt, "delay", wait)
+		telemetry.RecordRetry(ctx, "webhook", ev.Type)
+		time.Sleep(wait)
+	}
+}
+
+// post sends one signed delivery. Any 2xx response counts as delivered.
+func (s *Sender) post(ctx context.Context, body []byte) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ChatRelay-Webhook")
+	req.Header.Set("X-ChatRelay-Timestamp", timestamp)
+	req.Header.Set("X-ChatRelay-Signature", "sha256="+Sign(*s.secret.Load(), timestamp, body))
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the hex HMAC SHA-256 signature of a delivery, for receivers
+// written in Go.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "evt_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,161 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"chatrelay-bot/pkg/models"
+)
+
+func TestSign(t *testing.T) {
+	// Computed independently with:
+	//   printf '%s' '1700000000.{"id":"evt_1"}' | openssl dgst -sha256 -hmac whsec_test
+	const want = "c89214b5b5da833daed6f0b8c5bb6bd58cea9022bd80ccc78230f3942d632925"
+	if got := Sign("whsec_test", "1700000000", []byte(`{"id":"evt_1"}`)); got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+	if Sign("whsec_other", "1700000000", []byte(`{"id":"evt_1"}`)) == want {
+		t.Error("signature does not depend on the secret")
+	}
+	if Sign("whsec_test", "1700000001", []byte(`{"id":"evt_1"}`)) == want {
+		t.Error("signature does not depend on the timestamp")
+	}
+}
+
+// delivery is a request received by the test receiver.
+type delivery struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver answers deliveries with statuses in turn, then 204.
+func receiver(t *testing.T, statuses ...int) (*httptest.Server, func() []delivery) {
+	var mu sync.Mutex
+	var got []delivery
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		got = append(got, delivery{header: r.Header.Clone(), body: body})
+		status := http.StatusNoContent
+		if len(statuses) > 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []delivery {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]delivery(nil), got...)
+	}
+}
+
+func completedAnswer() models.CompletedAnswer {
+	return models.CompletedAnswer{
+		Message: models.IncomingMessage{
+			Platform:     "slack",
+			ID:           "1700000000.000100",
+			Workspace:    "T1",
+			Conversation: "C1",
+			Author:       models.Author{ID: "U1", Name: "jane"},
+			Text:         "What is ChatRelay?",
+		},
+		ReplyID:  "1700000000.000200",
+		Answer:   "A chat bot.",
+		Usage:    &models.Usage{TotalTokens: 42},
+		Duration: 1500 * time.Millisecond,
+	}
+}
+
+func TestSenderDeliversSignedEvent(t *testing.T) {
+	srv, deliveries := receiver(t)
+	s := NewSender(srv.URL, "whsec_test")
+	s.AnswerCompleted(context.Background(), completedAnswer())
+	s.Wait(context.Background())
+
+	got := deliveries()
+	if len(got) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(got))
+	}
+	d := got[0]
+	timestamp := d.header.Get("X-ChatRelay-Timestamp")
+	if ts, err := strconv.ParseInt(timestamp, 10, 64); err != nil || time.Since(time.Unix(ts, 0)).Abs() > time.Minute {
+		t.Errorf("timestamp = %q, want the current Unix time", timestamp)
+	}
+	if sig, want := d.header.Get("X-ChatRelay-Signature"), "sha256="+Sign("whsec_test", timestamp, d.body); sig != want {
+		t.Errorf("signature = %q, want %q", sig, want)
+	}
+	if ct := d.header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	var ev Event
+	if err := json.Unmarshal(d.body, &ev); err != nil {
+		t.Fatal(err)
+	}
+	want := Event{
+		ID:           ev.ID,
+		Type:         EventAnswerCompleted,
+		Time:         ev.Time,
+		Platform:     "slack",
+		Workspace:    "T1",
+		Conversation: "C1",
+		MessageID:    "1700000000.000100",
+		ReplyID:      "1700000000.000200",
+		User:         models.Author{ID: "U1", Name: "jane"},
+		Question:     "What is ChatRelay?",
+		Answer:       "A chat bot.",
+		Usage:        &models.Usage{TotalTokens: 42},
+		DurationMS:   1500,
+	}
+	if ev.ID == "" || ev.Time.IsZero() {
+		t.Errorf("event has no ID or time: %+v", ev)
+	}
+	if ev.Usage == nil || *ev.Usage != *want.Usage {
+		t.Errorf("usage = %+v, want %+v", ev.Usage, want.Usage)
+	}
+	ev.Usage, want.Usage = nil, nil
+	if ev != want {
+		t.Errorf("event = %+v, want %+v", ev, want)
+	}
+}
+
+func TestSenderRetriesFailedDeliveries(t *testing.T) {
+	srv, deliveries := receiver(t, http.StatusBadGateway)
+	s := NewSender(srv.URL, "whsec_test")
+	s.AnswerCompleted(context.Background(), completedAnswer())
+	s.Wait(context.Background())
+
+	got := deliveries()
+	if len(got) != 2 {
+		t.Fatalf("got %d deliveries, want a failed one and its retry", len(got))
+	}
+	if string(got[0].body) != string(got[1].body) {
+		t.Error("retry sent a different event")
+	}
+}
+
+func TestSenderSignsWithRotatedSecret(t *testing.T) {
+	srv, deliveries := receiver(t)
+	s := NewSender(srv.URL, "whsec_old")
+	s.SetSecret("whsec_new")
+	s.AnswerCompleted(context.Background(), completedAnswer())
+	s.Wait(context.Background())
+
+	got := deliveries()
+	if len(got) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(got))
+	}
+	d := got[0]
+	if sig, want := d.header.Get("X-ChatRelay-Signature"), "sha256="+Sign("whsec_new", d.header.Get("X-ChatRelay-Timestamp"), d.body); sig != want {
+		t.Errorf("signature = %q, want one with the rotated secret", sig)
+	}
+}
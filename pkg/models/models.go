@@ -6,12 +6,23 @@ import (
 )
 
 type ChatRequest struct {
-	UserID string `json:"user_id"`
-	Query  string `json:"query"`
+	UserID   string `json:"user_id"`
+	Query    string `json:"query"`
+	Language string `json:"language,omitempty"`
+	// BackendURL routes the request to a backend other than CHAT_BACKEND_URL.
+	BackendURL string `json:"-"`
 }
 
 type ChatResponse struct {
 	FullResponse string `json:"full_response"`
+	// Usage is reported by backends that count tokens; it is nil otherwise.
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
 }
 
 type SSEMessage struct {
@@ -31,6 +42,86 @@ type SlackEvent struct {
 	Ts      string `json:"ts"`
 }
 
+// IncomingMessage is a message addressed to the bot on any chat platform.
+// IDs are the platform's own; Thread is the ID of the message the thread
+// hangs off, empty for a top-level message. Mentions are the other users
+// the message mentions, not counting the bot, in the order the platform
+// lists them.
+type IncomingMessage struct {
+	Platform     string       `json:"platform"`
+	ID           string       `json:"id"`
+	Workspace    string       `json:"workspace,omitempty"`
+	Conversation string       `json:"conversation"`
+	Thread       string       `json:"thread,omitempty"`
+	Author       Author       `json:"author"`
+	Text         string       `json:"text"`
+	Attachments  []Attachment `json:"attachments,omitempty"`
+	Mentions     []Author     `json:"mentions,omitempty"`
+}
+
+type Author struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+type Attachment struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	MIMEType string `json:"mime_type,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+}
+
+// OutgoingMessage is a message the bot posts or edits. Actions are shown as
+// buttons where the platform supports them.
+type OutgoingMessage struct {
+	Conversation string
+	Thread       string
+	Text         string
+	Actions      []Action
+}
+
+type Action struct {
+	ID    string
+	Label string
+	Value string
+}
+
+// CompletedAnswer is an answer the bot finished relaying. Answer is the
+// backend's text, without the footer.
+type CompletedAnswer struct {
+	Message  IncomingMessage
+	ReplyID  string
+	Answer   string
+	Usage    *Usage
+	Duration time.Duration
+}
+
+// ChannelOverride is a per-channel or per-workspace override block from the
+// config file. Unset fields inherit from the next broader level.
+type ChannelOverride struct {
+	Enabled         *bool   `yaml:"enabled"`
+	Placeholder     *string `yaml:"placeholder"`
+	Footer          *string `yaml:"footer"`
+	BackendURL      *string `yaml:"backend_url"`
+	Streaming       *bool   `yaml:"streaming"`
+	ThreadOnly      *bool   `yaml:"thread_only"`
+	MaxAnswerLength *int    `yaml:"max_answer_length"`
+	Language        *string `yaml:"language"`
+}
+
+// ChannelSettings is the behaviour resolved for a single event from the
+// global settings and any workspace and channel overrides.
+type ChannelSettings struct {
+	Enabled         bool
+	Placeholder     string
+	Footer          string
+	BackendURL      string
+	Streaming       bool
+	ThreadOnly      bool
+	MaxAnswerLength int
+	Language        string
+}
+
 type SlackMessageResponse struct {
 	Channel   string `json:"channel"`
 	Text      string `json:"text"`
@@ -39,19 +130,84 @@ type SlackMessageResponse struct {
 }
 
 type AppConfig struct {
-	SlackAppToken        string        `env:"SLACK_APP_TOKEN,required"`
-	SlackBotToken        string        `env:"SLACK_BOT_TOKEN,required"`
-	ChatBackendURL       string        `env:"CHAT_BACKEND_URL,required"`
-	ListenPort           string        `env:"LISTEN_PORT,default=8080"`
-	MockBackendPort      string        `env:"MOCK_BACKEND_PORT,default=8081"`
-	TelemetryExporter    string        `env:"OTEL_EXPORTER_OTLP_PROTOCOL,default=grpc"`
-	TelemetryEndpoint    string        `env:"OTEL_EXPORTER_OTLP_ENDPOINT,default=localhost:4317"`
-	ServiceName          string        `env:"OTEL_SERVICE_NAME,default=chatrelay-bot"`
-	RequestTimeout       time.Duration `env:"REQUEST_TIMEOUT,default=30s"`
-	SlackAPIRetryCount   int           `env:"SLACK_API_RETRY_COUNT,default=3"`
-	SlackAPIRetryDelay   time.Duration `env:"SLACK_API_RETRY_DELAY,default=1s"`
-	BackendAPIRetryCount int           `env:"BACKEND_API_RETRY_COUNT,default=3"`
-	BackendAPIRetryDelay time.Duration `env:"BACKEND_API_RETRY_DELAY,default=1s"`
+	SlackAppToken             string        `env:"SLACK_APP_TOKEN" secret:"true"`
+	SlackBotToken             string        `env:"SLACK_BOT_TOKEN" secret:"true" reload:"live"`
+	ChatBackendURL            string        `env:"CHAT_BACKEND_URL,required"`
+	ListenPort                string        `env:"LISTEN_PORT,default=8080"`
+	MockBackendPort           string        `env:"MOCK_BACKEND_PORT,default=8081"`
+	MockBackendScenarios      string        `env:"MOCK_BACKEND_SCENARIOS"`
+	MockBackendScenario       string        `env:"MOCK_BACKEND_SCENARIO,default=default"`
+	TelemetryExporter         string        `env:"OTEL_EXPORTER_OTLP_PROTOCOL,default=grpc"`
+	TelemetryEndpoint         string        `env:"OTEL_EXPORTER_OTLP_ENDPOINT,default=localhost:4317"`
+	ServiceName               string        `env:"OTEL_SERVICE_NAME,default=chatrelay-bot"`
+	MetricsExporter           string        `env:"OTEL_METRICS_EXPORTER,default=prometheus"`
+	TelemetryInsecure         bool          `env:"OTEL_EXPORTER_OTLP_INSECURE,default=true"`
+	TelemetryCACert           string        `env:"OTEL_EXPORTER_OTLP_CERTIFICATE"`
+	TelemetryClientCert       string        `env:"OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE"`
+	TelemetryClientKey        string        `env:"OTEL_EXPORTER_OTLP_CLIENT_KEY"`
+	TelemetryHeaders          string        `env:"OTEL_EXPORTER_OTLP_HEADERS" secret:"true"`
+	TraceSampler              string        `env:"OTEL_TRACES_SAMPLER,default=always_on"`
+	TraceSamplerRatio         float64       `env:"OTEL_TRACES_SAMPLER_ARG,default=1.0"`
+	ServiceVersion            string        `env:"OTEL_SERVICE_VERSION"`
+	ServiceInstanceID         string        `env:"OTEL_SERVICE_INSTANCE_ID"`
+	DeploymentEnvironment     string        `env:"DEPLOYMENT_ENVIRONMENT,default=development"`
+	ResourceAttributes        string        `env:"OTEL_RESOURCE_ATTRIBUTES"`
+	RedactionMode             string        `env:"REDACTION_MODE,default=truncate" reload:"live"`
+	RedactionTruncateLength   int           `env:"REDACTION_TRUNCATE_LENGTH,default=64" reload:"live"`
+	RequestTimeout            time.Duration `env:"REQUEST_TIMEOUT,default=30s" reload:"live"`
+	SlackAPIRetryCount        int           `env:"SLACK_API_RETRY_COUNT,default=3" reload:"live"`
+	SlackAPIRetryDelay        time.Duration `env:"SLACK_API_RETRY_DELAY,default=1s" reload:"live"`
+	SlackAPIURL               string        `env:"SLACK_API_URL"`
+	DiscordBotToken           string        `env:"DISCORD_BOT_TOKEN" secret:"true" reload:"live"`
+	DiscordAPIURL             string        `env:"DISCORD_API_URL"`
+	MattermostURL             string        `env:"MATTERMOST_URL"`
+	MattermostBotToken        string        `env:"MATTERMOST_BOT_TOKEN" secret:"true" reload:"live"`
+	MattermostActionsURL      string        `env:"MATTERMOST_ACTIONS_URL"`
+	TeamsAppID                string        `env:"TEAMS_APP_ID"`
+	TeamsAppPassword          string        `env:"TEAMS_APP_PASSWORD" secret:"true" reload:"live"`
+	TeamsJWKSURL              string        `env:"TEAMS_JWKS_URL"`
+	TeamsTokenURL             string        `env:"TEAMS_TOKEN_URL"`
+	TeamsServiceURL           string        `env:"TEAMS_SERVICE_URL"`
+	APIKeys                   string        `env:"API_KEYS" secret:"true" reload:"live"`
+	WebhookURL                string        `env:"WEBHOOK_URL"`
+	WebhookSecret             string        `env:"WEBHOOK_SECRET" secret:"true" reload:"live"`
+	BackendAPIRetryCount      int           `env:"BACKEND_API_RETRY_COUNT,default=3" reload:"live"`
+	BackendAPIRetryDelay      time.Duration `env:"BACKEND_API_RETRY_DELAY,default=1s" reload:"live"`
+	BackendBreakerThreshold   int           `env:"BACKEND_BREAKER_THRESHOLD,default=5" reload:"live"`
+	BackendBreakerCooldown    time.Duration `env:"BACKEND_BREAKER_COOLDOWN,default=30s" reload:"live"`
+	SecretsRefreshInterval    time.Duration `env:"SECRETS_REFRESH_INTERVAL,default=1m"`
+	BotEnabled                bool          `env:"BOT_ENABLED,default=true" reload:"live"`
+	PlaceholderText           string        `env:"PLACEHOLDER_TEXT,default=Thinking..." reload:"live"`
+	FooterText                string        `env:"FOOTER_TEXT,default=_Powered by ChatRelay_" reload:"live"`
+	StreamingEnabled          bool          `env:"STREAMING_ENABLED,default=true" reload:"live"`
+	ThreadOnlyReplies         bool          `env:"THREAD_ONLY_REPLIES,default=false" reload:"live"`
+	MaxAnswerLength           int           `env:"MAX_ANSWER_LENGTH,default=0" reload:"live"`
+	AnswerLanguage            string        `env:"ANSWER_LANGUAGE" reload:"live"`
+	StreamUpdateInterval      time.Duration `env:"STREAM_UPDATE_INTERVAL,default=500ms" reload:"live"`
+	AccessAllowUsers          []string      `env:"ACCESS_ALLOW_USERS" reload:"live"`
+	AccessDenyUsers           []string      `env:"ACCESS_DENY_USERS" reload:"live"`
+	AccessAllowChannels       []string      `env:"ACCESS_ALLOW_CHANNELS" reload:"live"`
+	AccessDenyChannels        []string      `env:"ACCESS_DENY_CHANNELS" reload:"live"`
+	AccessAllowUserGroups     []string      `env:"ACCESS_ALLOW_USERGROUPS" reload:"live"`
+	AccessDenyUserGroups      []string      `env:"ACCESS_DENY_USERGROUPS" reload:"live"`
+	AccessUserGroupCacheTTL   time.Duration `env:"ACCESS_USERGROUP_CACHE_TTL,default=5m" reload:"live"`
+	AccessDeniedMessage       string        `env:"ACCESS_DENIED_MESSAGE,default=Sorry! You don't have access to ChatRelay here. Please ask a workspace admin if you need it." reload:"live"`
+	AdminUsers                []string      `env:"ADMIN_USERS" reload:"live"`
+	StorePath                 string        `env:"STORE_PATH"`
+	ShutdownDrainTimeout      time.Duration `env:"SHUTDOWN_DRAIN_TIMEOUT,default=30s"`
+	RecoveryMode              string        `env:"RECOVERY_MODE,default=apologize"`
+	RateLimitUserPerMinute    int           `env:"RATE_LIMIT_USER_PER_MINUTE,default=6" reload:"live"`
+	RateLimitUserBurst        int           `env:"RATE_LIMIT_USER_BURST,default=3" reload:"live"`
+	RateLimitChannelPerMinute int           `env:"RATE_LIMIT_CHANNEL_PER_MINUTE,default=30" reload:"live"`
+	RateLimitChannelBurst     int           `env:"RATE_LIMIT_CHANNEL_BURST,default=10" reload:"live"`
+	QuotaDailyRequests        int           `env:"QUOTA_DAILY_REQUESTS,default=0" reload:"live"`
+	QuotaMonthlyRequests      int           `env:"QUOTA_MONTHLY_REQUESTS,default=0" reload:"live"`
+	QuotaDailyTokens          int           `env:"QUOTA_DAILY_TOKENS,default=0" reload:"live"`
+	QuotaMonthlyTokens        int           `env:"QUOTA_MONTHLY_TOKENS,default=0" reload:"live"`
+
+	// Override blocks can only be set in the config file.
+	WorkspaceOverrides map[string]ChannelOverride `file:"workspaces" reload:"live"`
+	ChannelOverrides   map[string]ChannelOverride `file:"channels" reload:"live"`
 }
 
 func NewConfig() *AppConfig {